@@ -0,0 +1,302 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github/demo/config"
+	"github/demo/daos"
+	"github/demo/database"
+	"github/demo/database/dialects"
+	"github/demo/model/catalog"
+	"github/demo/model/command"
+	"github/demo/model/device"
+	"github/demo/model/firmware"
+	"github/demo/model/group"
+	"github/demo/model/telemetry"
+	"github/demo/repository"
+	"github/demo/service"
+	"github/demo/utils/artifact"
+	"github/demo/utils/keywrap"
+	"github/demo/utils/log"
+	"github/demo/utils/metrics"
+	"github/demo/utils/schedule"
+)
+
+// App holds one isolated instance of the service, several of them can run in
+// one process
+type App struct {
+	Config  *config.Config
+	Engine  *repository.Engine
+	Metrics *metrics.Registry
+
+	// === Repository ===
+	DeviceRepo    device.Repository
+	HistoryRepo   device.HistoryRepository
+	GroupRepo     group.Repository
+	CatalogRepo   catalog.Repository
+	TelemetryRepo telemetry.Repository
+	CommandRepo   command.Repository
+	FirmwareRepo  firmware.Repository
+	CampaignRepo  firmware.CampaignRepository
+	KeyRepo       firmware.KeyRepository
+
+	// === Service ===
+	DeviceService    service.IDeviceService
+	GroupService     service.IGroupService
+	CatalogService   service.ICatalogService
+	TelemetryService service.ITelemetryService
+	CommandService   service.ICommandService
+	FirmwareService  service.IFirmwareService
+
+	// Jobs run in the background while the app serves
+	Jobs []schedule.Job
+}
+
+// New builds the repositories and services of cf on top of the database of e
+func New(cf *config.Config, e *repository.Engine) (*App, error) {
+	a := &App{
+		Config:  cf,
+		Engine:  e,
+		Metrics: metrics.NewRegistry(),
+	}
+
+	// === Repository ===
+	if dialects.Dialect(cf.Database.Dialect) == dialects.Memory {
+		a.DeviceRepo = daos.NewMemoryDeviceRepo()
+		a.HistoryRepo = daos.NewMemoryHistoryRepo()
+		a.GroupRepo = daos.NewMemoryGroupRepo()
+		a.CatalogRepo = daos.NewMemoryCatalogRepo()
+		a.TelemetryRepo = daos.NewMemoryTelemetryRepo()
+		a.CommandRepo = daos.NewMemoryCommandRepo()
+		a.FirmwareRepo = daos.NewMemoryFirmwareRepo()
+		a.CampaignRepo = daos.NewMemoryCampaignRepo()
+		a.KeyRepo = daos.NewMemoryKeyRepo()
+	} else {
+		a.DeviceRepo = daos.NewDeviceRepo(e.GormDB)
+		a.HistoryRepo = daos.NewHistoryRepo(e.GormDB)
+		a.GroupRepo = daos.NewGroupRepo(e.GormDB)
+		a.CatalogRepo = daos.NewCatalogRepo(e.GormDB)
+		a.TelemetryRepo = daos.NewTelemetryRepo(e.GormDB)
+		a.CommandRepo = daos.NewCommandRepo(e.GormDB)
+		a.FirmwareRepo = daos.NewFirmwareRepo(e.GormDB)
+		a.CampaignRepo = daos.NewCampaignRepo(e.GormDB)
+		a.KeyRepo = daos.NewKeyRepo(e.GormDB)
+	}
+
+	// === Service ===
+	l, err := liveness(cf.Heartbeat)
+	if err != nil {
+		return nil, err
+	}
+	a.DeviceService = service.NewDeviceService(a.DeviceRepo, a.HistoryRepo, a.CatalogRepo, l)
+	a.GroupService = service.NewGroupService(a.GroupRepo, a.DeviceRepo, a.DeviceService)
+	a.CatalogService = service.NewCatalogService(a.CatalogRepo, a.DeviceRepo)
+	r, err := retention(cf.Telemetry)
+	if err != nil {
+		return nil, err
+	}
+	a.TelemetryService = service.NewTelemetryService(a.TelemetryRepo, a.DeviceRepo, r)
+	p, err := commandPolicy(cf.Command)
+	if err != nil {
+		return nil, err
+	}
+	a.CommandService = service.NewCommandService(a.CommandRepo, a.DeviceRepo, p)
+	kek, err := signingKEK(cf.Firmware)
+	if err != nil {
+		return nil, err
+	}
+	a.FirmwareService = service.NewFirmwareService(a.FirmwareRepo, a.CampaignRepo, a.KeyRepo, kek, a.DeviceRepo,
+		artifact.NewStore(artifactDir(cf.Firmware)), a.CommandService)
+
+	// === Jobs ===
+	if cf.Telemetry != nil && len(cf.Telemetry.PurgeInterval) > 0 {
+		interval, err := time.ParseDuration(cf.Telemetry.PurgeInterval)
+		if err != nil {
+			return nil, fmt.Errorf("Telemetry purge interval invalid: %q", cf.Telemetry.PurgeInterval)
+		}
+		a.Jobs = append(a.Jobs, schedule.Job{
+			Name:     "telemetry purge",
+			Interval: interval,
+			Run:      a.purgeTelemetry,
+		})
+	}
+
+	if cf.Command != nil && len(cf.Command.CleanupInterval) > 0 {
+		interval, err := time.ParseDuration(cf.Command.CleanupInterval)
+		if err != nil {
+			return nil, fmt.Errorf("Command cleanup interval invalid: %q", cf.Command.CleanupInterval)
+		}
+		a.Jobs = append(a.Jobs, schedule.Job{
+			Name:     "command cleanup",
+			Interval: interval,
+			Run:      a.cleanupCommands,
+		})
+	}
+
+	if cf.Firmware != nil && len(cf.Firmware.RolloutInterval) > 0 {
+		interval, err := time.ParseDuration(cf.Firmware.RolloutInterval)
+		if err != nil {
+			return nil, fmt.Errorf("Firmware rollout interval invalid: %q", cf.Firmware.RolloutInterval)
+		}
+		a.Jobs = append(a.Jobs, schedule.Job{
+			Name:     "firmware rollout",
+			Interval: interval,
+			Run:      a.rolloutFirmware,
+		})
+	}
+
+	// === Metrics ===
+	database.RegisterMetrics(a.Metrics, e.Database)
+	service.RegisterMetrics(a.Metrics, a.DeviceService)
+
+	log.Info("Create app success")
+	return a, nil
+}
+
+// liveness returns the heartbeat thresholds of c, the default ones for those
+// unset
+func liveness(c *config.Heartbeat) (*service.Liveness, error) {
+	l := service.DefaultLiveness
+	if c == nil {
+		return &l, nil
+	}
+	for _, v := range []struct {
+		value string
+		d     *time.Duration
+	}{
+		{c.Online, &l.Online},
+		{c.Offline, &l.Offline},
+	} {
+		if len(v.value) == 0 {
+			continue
+		}
+		d, err := time.ParseDuration(v.value)
+		if err != nil {
+			return nil, fmt.Errorf("Heartbeat threshold invalid: %q", v.value)
+		}
+		*v.d = d
+	}
+	if l.Online <= 0 || l.Offline < l.Online {
+		return nil, fmt.Errorf("Heartbeat thresholds invalid: online %s, offline %s", l.Online, l.Offline)
+	}
+	return &l, nil
+}
+
+// retention returns the telemetry retentions of c, the default ones for those
+// unset
+func retention(c *config.Telemetry) (*service.Retention, error) {
+	r := service.DefaultRetention
+	if c == nil {
+		return &r, nil
+	}
+	for _, v := range []struct {
+		value string
+		d     *time.Duration
+	}{
+		{c.Raw, &r.Raw},
+		{c.Minute, &r.Minute},
+		{c.Hour, &r.Hour},
+	} {
+		if len(v.value) == 0 {
+			continue
+		}
+		d, err := time.ParseDuration(v.value)
+		if err != nil {
+			return nil, fmt.Errorf("Telemetry retention invalid: %q", v.value)
+		}
+		*v.d = d
+	}
+	if r.Raw <= 0 || r.Minute < r.Raw || r.Hour < r.Minute {
+		return nil, fmt.Errorf("Telemetry retentions invalid: raw %s, minute %s, hour %s", r.Raw, r.Minute, r.Hour)
+	}
+	return &r, nil
+}
+
+// commandPolicy returns the command bounds of c, the default ones for those
+// unset
+func commandPolicy(c *config.Command) (*service.CommandPolicy, error) {
+	p := service.DefaultCommandPolicy
+	if c == nil {
+		return &p, nil
+	}
+	for _, v := range []struct {
+		value string
+		d     *time.Duration
+	}{
+		{c.DefaultTTL, &p.DefaultTTL},
+		{c.MaxTTL, &p.MaxTTL},
+		{c.PollTimeout, &p.PollTimeout},
+		{c.Retention, &p.Retention},
+	} {
+		if len(v.value) == 0 {
+			continue
+		}
+		d, err := time.ParseDuration(v.value)
+		if err != nil {
+			return nil, fmt.Errorf("Command bound invalid: %q", v.value)
+		}
+		*v.d = d
+	}
+	if p.DefaultTTL <= 0 || p.MaxTTL < p.DefaultTTL || p.PollTimeout < 0 || p.Retention < 0 {
+		return nil, fmt.Errorf("Command bounds invalid: default ttl %s, max ttl %s, poll timeout %s, retention %s",
+			p.DefaultTTL, p.MaxTTL, p.PollTimeout, p.Retention)
+	}
+	return &p, nil
+}
+
+// artifactDir returns the directory of the firmware artifacts of c
+func artifactDir(c *config.Firmware) string {
+	if c == nil || len(c.ArtifactDir) == 0 {
+		return config.NewConfig().Firmware.ArtifactDir
+	}
+	return c.ArtifactDir
+}
+
+// signingKEK returns the key-encryption key of the signing keys of c, nil
+// when it is unset, the releases are stored unsigned then
+func signingKEK(c *config.Firmware) (*keywrap.KEK, error) {
+	if c == nil || len(c.SigningKEK) == 0 {
+		log.Warn("Firmware signing kek is not set, the releases are stored unsigned")
+		return nil, nil
+	}
+	kek, err := keywrap.Parse(c.SigningKEK)
+	if err != nil {
+		return nil, fmt.Errorf("Firmware signing kek invalid: %v", err)
+	}
+	return kek, nil
+}
+
+// purgeTelemetry deletes the telemetry past its retention
+func (a *App) purgeTelemetry(ctx context.Context) error {
+	deleted, code := a.TelemetryService.Purge(ctx)
+	if code != service.ErrorCodeSuccess {
+		return fmt.Errorf("telemetry purge fail: %s", service.ErrorMsg(code))
+	}
+	if deleted > 0 {
+		log.WithContext(ctx).Infof("telemetry purge deleted %d", deleted)
+	}
+	return nil
+}
+
+// cleanupCommands expires the commands past their TTL and deletes those past
+// their retention
+func (a *App) cleanupCommands(ctx context.Context) error {
+	expired, deleted, code := a.CommandService.Cleanup(ctx)
+	if code != service.ErrorCodeSuccess {
+		return fmt.Errorf("command cleanup fail: %s", service.ErrorMsg(code))
+	}
+	if expired > 0 || deleted > 0 {
+		log.WithContext(ctx).Infof("command cleanup expired %d, deleted %d", expired, deleted)
+	}
+	return nil
+}
+
+// rolloutFirmware steps the running firmware campaigns
+func (a *App) rolloutFirmware(ctx context.Context) error {
+	if code := a.FirmwareService.Rollout(ctx); code != service.ErrorCodeSuccess {
+		return fmt.Errorf("firmware rollout fail: %s", service.ErrorMsg(code))
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/app"
+	"github/demo/config"
+	"github/demo/repository"
+	"github/demo/service"
+)
+
+func newMemoryApp(t *testing.T) *app.App {
+	cf := config.NewConfig()
+	cf.Database.Dialect = "memory"
+	e, err := repository.NewEngine(context.Background(), cf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := app.New(cf, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestApp_Isolated(t *testing.T) {
+	a1 := newMemoryApp(t)
+	a2 := newMemoryApp(t)
+
+	_, code := a1.CatalogService.Create(context.Background(), &service.Model{Name: "Pro", Colors: []string{"White"}, Versions: []string{"v1.2"}})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	_, code = a1.DeviceService.Register(context.Background(), &service.Device{Model: "Pro", Color: "White", Version: "v1.2"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	counts, code := a1.DeviceService.Count(context.Background())
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, []*service.DeviceCount{{Model: "Pro", Version: "v1.2", Total: 1}}, counts)
+
+	// the catalog is not shared either
+	_, code = a2.DeviceService.Register(context.Background(), &service.Device{Model: "Pro", Color: "White", Version: "v1.2"})
+	assert.Equal(t, service.ErrorCodeDeviceNotInCatalog, code)
+
+	counts, code = a2.DeviceService.Count(context.Background())
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, []*service.DeviceCount{}, counts)
+
+	var m1, m2 bytes.Buffer
+	assert.NoError(t, a1.Metrics.Write(&m1))
+	assert.NoError(t, a2.Metrics.Write(&m2))
+	assert.Contains(t, m1.String(), `demo_devices{model="Pro",version="v1.2"} 1`)
+	assert.NotContains(t, m2.String(), `demo_devices{`)
+}
@@ -0,0 +1,273 @@
+// Package cli implements the subcommands of the demo binary.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github/demo/app"
+	"github/demo/config"
+	preparation "github/demo/init"
+	"github/demo/repository"
+	"github/demo/utils/log"
+	"github/demo/utils/schedule"
+	"github/demo/utils/startup"
+	"github/demo/utils/trace"
+)
+
+// Exit codes of the process
+const (
+	ExitOK = iota
+	// ExitFail is a command that ran and failed
+	ExitFail
+	// ExitUsage is a wrong command line
+	ExitUsage
+)
+
+// Exit codes of the startup phases
+const (
+	ExitConfig = iota + 10
+	ExitLogger
+	ExitDatabase
+	ExitMigrations
+	ExitServices
+	ExitHTTP
+	ExitJobs
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(c *CLI, args []string) int
+}
+
+var commands []*command
+
+// CLI runs one command line, writing its output to Stdout and its errors to
+// Stderr
+type CLI struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Run runs the command line args of the process, serve when empty
+func Run(args []string) int {
+	c := &CLI{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	return c.Run(args)
+}
+
+// Run runs the command line args, serve when empty
+func (c *CLI) Run(args []string) int {
+	if len(args) == 0 {
+		args = []string{"serve"}
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(c, args[1:])
+		}
+	}
+	if args[0] != "help" && args[0] != "-h" && args[0] != "--help" {
+		fmt.Fprintf(c.Stderr, "unknown command %q\n\n", args[0])
+	}
+	c.usage()
+	return ExitUsage
+}
+
+func (c *CLI) usage() {
+	fmt.Fprintln(c.Stderr, "Usage: demo <command> [arguments]")
+	fmt.Fprintln(c.Stderr)
+	fmt.Fprintln(c.Stderr, "Commands:")
+	sorted := append([]*command{}, commands...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	for _, cmd := range sorted {
+		fmt.Fprintf(c.Stderr, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+func (c *CLI) errorf(format string, args ...interface{}) {
+	fmt.Fprintf(c.Stderr, format+"\n", args...)
+}
+
+// flagSet returns the flags of a subcommand, printing its errors to Stderr
+func (c *CLI) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	return fs
+}
+
+func (c *CLI) printJSON(v interface{}) int {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		c.errorf("%v", err)
+		return ExitFail
+	}
+	fmt.Fprintln(c.Stdout, string(b))
+	return ExitOK
+}
+
+// subcommand dispatches args to the actions of a command
+func (c *CLI) subcommand(name string, args []string, actions map[string]func(args []string) int) int {
+	if len(args) > 0 {
+		if run, ok := actions[args[0]]; ok {
+			return run(args[1:])
+		}
+		c.errorf("unknown %s command %q", name, args[0])
+	}
+
+	var names []string
+	for n := range actions {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	c.errorf("Usage: demo %s <%s>", name, strings.Join(names, "|"))
+	return ExitUsage
+}
+
+// runtime holds what the startup phases of a command bring up
+type runtime struct {
+	cf *config.Config
+	e  *repository.Engine
+	a  *app.App
+
+	// quiet sends the logs to stderr, away from the output of a command
+	quiet bool
+}
+
+func (r *runtime) configPhase() startup.Phase {
+	return startup.Phase{
+		Name:     "config",
+		Timeout:  5 * time.Second,
+		ExitCode: ExitConfig,
+		Run: func(ctx context.Context) (startup.Cleanup, error) {
+			var err error
+			r.cf, err = preparation.Config()
+			return nil, err
+		},
+	}
+}
+
+func (r *runtime) loggerPhase() startup.Phase {
+	return startup.Phase{
+		Name:     "logger",
+		Timeout:  5 * time.Second,
+		ExitCode: ExitLogger,
+		Run: func(ctx context.Context) (startup.Cleanup, error) {
+			if r.quiet {
+				r.cf.Logger.Sinks = []string{"stderr"}
+			}
+			if err := preparation.Logger(r.cf); err != nil {
+				return nil, err
+			}
+			return func(ctx context.Context) error {
+				err := trace.Setup(trace.Options{})
+				log.Close()
+				return err
+			}, nil
+		},
+	}
+}
+
+func (r *runtime) databasePhase() startup.Phase {
+	return startup.Phase{
+		Name:     "database",
+		Timeout:  30 * time.Second,
+		ExitCode: ExitDatabase,
+		Run: func(ctx context.Context) (startup.Cleanup, error) {
+			var err error
+			if r.e, err = repository.NewEngine(ctx, r.cf); err != nil {
+				return nil, err
+			}
+			r.e.Database.SetPool(10, 100, time.Hour)
+			return func(ctx context.Context) error {
+				r.e.Database.Close()
+				return nil
+			}, nil
+		},
+	}
+}
+
+func (r *runtime) migrationsPhase() startup.Phase {
+	return startup.Phase{
+		Name:     "migrations",
+		Timeout:  time.Minute,
+		ExitCode: ExitMigrations,
+		Run: func(ctx context.Context) (startup.Cleanup, error) {
+			return nil, r.e.Migrate(ctx)
+		},
+	}
+}
+
+func (r *runtime) servicesPhase() startup.Phase {
+	return startup.Phase{
+		Name:     "services",
+		Timeout:  10 * time.Second,
+		ExitCode: ExitServices,
+		Run: func(ctx context.Context) (startup.Cleanup, error) {
+			var err error
+			r.a, err = app.New(r.cf, r.e)
+			return nil, err
+		},
+	}
+}
+
+// jobsPhase runs the background jobs of the app until the shutdown
+func (r *runtime) jobsPhase() startup.Phase {
+	return startup.Phase{
+		Name:     "jobs",
+		Timeout:  time.Second,
+		ExitCode: ExitJobs,
+		Run: func(ctx context.Context) (startup.Cleanup, error) {
+			s := schedule.New(r.a.Jobs...)
+			s.Start()
+			return s.Stop, nil
+		},
+	}
+}
+
+// start runs phases and then fn, the phases are shut down when fn returns
+func (r *runtime) start(fn func() int, phases ...startup.Phase) int {
+	s := startup.New(phases...)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout(r.cf))
+		defer cancel()
+		s.Shutdown(ctx)
+	}()
+
+	if err := s.Run(context.Background()); err != nil {
+		return startup.ExitCode(err)
+	}
+	return fn()
+}
+
+const (
+	defaultShutdownTimeout = 10 * time.Second
+	// shutdownMargin is left to the cleanups once the requests are done
+	shutdownMargin = 5 * time.Second
+)
+
+// shutdownTimeout is how long the shutdown waits for the requests of c to
+// end, a command poll waiting up to its timeout included, and for the phases
+// to clean up
+func shutdownTimeout(c *config.Config) time.Duration {
+	d := defaultShutdownTimeout
+	if c == nil || c.Server == nil || c.Command == nil {
+		return d
+	}
+	for _, v := range []string{c.Server.RequestTimeout, c.Command.PollTimeout} {
+		if t, err := time.ParseDuration(v); err == nil && t+shutdownMargin > d {
+			d = t + shutdownMargin
+		}
+	}
+	return d
+}
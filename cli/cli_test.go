@@ -0,0 +1,383 @@
+package cli_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/cli"
+	"github/demo/env"
+	"github/demo/service"
+)
+
+// setupEnv points the config at a new SQLite database
+func setupEnv(t *testing.T) func(t *testing.T) {
+	name := filepath.Join(os.TempDir(), "gorm"+uuid.Must(uuid.NewV4()).String()+".db")
+	vars := map[string]string{
+		env.DBDialect:  "sqlite",
+		env.DBHost:     name,
+		env.DBPassword: "secret",
+	}
+	for k, v := range vars {
+		os.Setenv(k, v)
+	}
+	return func(t *testing.T) {
+		for k := range vars {
+			os.Unsetenv(k)
+		}
+		os.Remove(name)
+	}
+}
+
+func run(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	c := &cli.CLI{Stdout: &stdout, Stderr: &stderr}
+	code := c.Run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLI_Usage(t *testing.T) {
+	tt := []struct {
+		description string
+		args        []string
+		wantCode    int
+		wantErr     string
+	}{
+		{
+			description: "help",
+			args:        []string{"help"},
+			wantCode:    cli.ExitUsage,
+			wantErr:     "Usage: demo <command> [arguments]",
+		},
+		{
+			description: "unknown command",
+			args:        []string{"bogus"},
+			wantCode:    cli.ExitUsage,
+			wantErr:     `unknown command "bogus"`,
+		},
+		{
+			description: "unknown subcommand",
+			args:        []string{"migrate", "sideways"},
+			wantCode:    cli.ExitUsage,
+			wantErr:     "Usage: demo migrate <down|status|up>",
+		},
+		{
+			description: "bad flag",
+			args:        []string{"migrate", "down", "-steps", "0"},
+			wantCode:    cli.ExitUsage,
+			wantErr:     "steps must be positive",
+		},
+		{
+			description: "missing id",
+			args:        []string{"device", "get"},
+			wantCode:    cli.ExitUsage,
+			wantErr:     "Usage: demo device get <id>",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			code, _, stderr := run(tc.args...)
+			assert.Equal(t, tc.wantCode, code)
+			assert.Contains(t, stderr, tc.wantErr)
+		})
+	}
+}
+
+func TestCLI_Config(t *testing.T) {
+	teardown := setupEnv(t)
+	defer teardown(t)
+
+	code, stdout, _ := run("config", "print")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Contains(t, stdout, `"password": "******"`)
+	assert.NotContains(t, stdout, "secret")
+
+	code, stdout, _ = run("config", "validate")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Equal(t, "config is valid\n", stdout)
+
+	os.Setenv(env.DBQueryTimeout, "soon")
+	defer os.Unsetenv(env.DBQueryTimeout)
+	code, _, stderr := run("config", "validate")
+	assert.Equal(t, cli.ExitConfig, code)
+	assert.Contains(t, stderr, "config DB_QueryTimeout invalid")
+}
+
+func TestCLI_Migrate(t *testing.T) {
+	teardown := setupEnv(t)
+	defer teardown(t)
+
+	code, stdout, _ := run("migrate", "status")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Regexp(t, `create_device +pending`, stdout)
+
+	code, stdout, _ = run("migrate", "up")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Contains(t, stdout, "applied 1 create_device")
+
+	code, stdout, _ = run("migrate", "up")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Equal(t, "no pending migration\n", stdout)
+
+	code, stdout, _ = run("migrate", "status")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Regexp(t, `create_device +applied`, stdout)
+
+	// the latest migration only, by default
+	code, stdout, _ = run("migrate", "down")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Regexp(t, `^reverted \d+ \w+\n$`, stdout)
+	assert.NotContains(t, stdout, "reverted 1 ")
+}
+
+func TestCLI_Device(t *testing.T) {
+	teardown := setupEnv(t)
+	defer teardown(t)
+
+	code, _, _ := run("migrate", "up")
+	assert.Equal(t, cli.ExitOK, code)
+	code, _, _ = run("model", "create", "-colors", "White,Black", "-versions", "v1.2", "Pro")
+	assert.Equal(t, cli.ExitOK, code)
+	code, _, _ = run("model", "create", "-colors", "Black", "-versions", "v1.2", "Normal")
+	assert.Equal(t, cli.ExitOK, code)
+
+	code, _, stderr := run("device", "create", "-model", "Pro", "-color", "Red", "-version", "v1.2")
+	assert.Equal(t, cli.ExitFail, code)
+	assert.Contains(t, stderr, "Device not in model catalog")
+
+	code, stdout, _ := run("device", "create", "-model", "Pro", "-color", "White", "-version", "v1.2")
+	assert.Equal(t, cli.ExitOK, code)
+	created := &service.Device{}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), created))
+	assert.Equal(t, "Pro", created.Model)
+
+	code, stdout, _ = run("device", "create", "-model", "Normal", "-color", "Black", "-version", "v1.2")
+	assert.Equal(t, cli.ExitOK, code)
+
+	code, stdout, _ = run("device", "list", "-model", "Pro")
+	assert.Equal(t, cli.ExitOK, code)
+	var devices []*service.Device
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &devices))
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, created.Id, devices[0].Id)
+	}
+
+	code, stdout, _ = run("device", "get", created.Id)
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Contains(t, stdout, created.Id)
+
+	code, stdout, _ = run("device", "label", created.Id, "site=tpe", "env=lab")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.JSONEq(t, `{"site":"tpe","env":"lab"}`, stdout)
+
+	code, stdout, _ = run("device", "list", "-selector", "site=tpe,env!=prod")
+	assert.Equal(t, cli.ExitOK, code)
+	devices = nil
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &devices))
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, map[string]string{"site": "tpe", "env": "lab"}, devices[0].Labels)
+	}
+
+	code, stdout, _ = run("device", "unlabel", created.Id, "env")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.JSONEq(t, `{"site":"tpe"}`, stdout)
+
+	code, stdout, _ = run("device", "activate", created.Id)
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Contains(t, stdout, `"state": "active"`)
+
+	code, _, stderr = run("device", "activate", created.Id)
+	assert.Equal(t, cli.ExitFail, code)
+	assert.Contains(t, stderr, "Device state transition invalid")
+
+	code, stdout, _ = run("device", "list", "-state", "active")
+	assert.Equal(t, cli.ExitOK, code)
+	devices = nil
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &devices))
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, created.Id, devices[0].Id)
+	}
+
+	code, _, stderr = run("device", "label", created.Id, "site")
+	assert.Equal(t, cli.ExitUsage, code)
+	assert.Contains(t, stderr, "not key=value")
+
+	code, stdout, _ = run("device", "delete", created.Id)
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Equal(t, "deleted "+created.Id+"\n", stdout)
+
+	code, _, stderr = run("device", "get", created.Id)
+	assert.Equal(t, cli.ExitFail, code)
+	assert.True(t, strings.Contains(stderr, "not found"))
+
+	code, _, stderr = run("device", "delete", created.Id)
+	assert.Equal(t, cli.ExitFail, code)
+	assert.Contains(t, stderr, "not found")
+
+	code, stdout, _ = run("device", "history", created.Id)
+	assert.Equal(t, cli.ExitOK, code)
+	var history []*service.History
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &history))
+	if assert.Len(t, history, 5) {
+		assert.Equal(t, "delete", history[0].Action)
+		assert.Equal(t, "activate", history[1].Action)
+		assert.Equal(t, "create", history[4].Action)
+		assert.True(t, strings.HasPrefix(history[4].Actor, "cli"))
+	}
+}
+
+func TestCLI_DeviceExchange(t *testing.T) {
+	teardown := setupEnv(t)
+	defer teardown(t)
+
+	code, _, _ := run("migrate", "up")
+	assert.Equal(t, cli.ExitOK, code)
+	code, _, _ = run("model", "create", "-colors", "White", "-versions", "v1.2", "Pro")
+	assert.Equal(t, cli.ExitOK, code)
+
+	input := filepath.Join(os.TempDir(), "import"+uuid.Must(uuid.NewV4()).String()+".csv")
+	defer os.Remove(input)
+	assert.NoError(t, ioutil.WriteFile(input, []byte("model,color,version\nPro,White,v1.2\n,Black,v1.2\n"), 0600))
+
+	code, stdout, _ := run("device", "import", "-dry-run", input)
+	assert.Equal(t, cli.ExitFail, code)
+	result := &service.ImportResult{}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), result))
+	assert.Equal(t, true, result.DryRun)
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 1, result.Failed)
+
+	code, stdout, _ = run("device", "export")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Equal(t, "id,model,color,version,create_time,update_time\n", stdout)
+
+	code, _, _ = run("device", "import", input)
+	assert.Equal(t, cli.ExitFail, code)
+
+	code, stdout, _ = run("device", "export", "-format", "ndjson")
+	assert.Equal(t, cli.ExitOK, code)
+	d := &service.Device{}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), d))
+	assert.Equal(t, "Pro", d.Model)
+
+	code, _, stderr := run("device", "export", "-format", "xml")
+	assert.Equal(t, cli.ExitUsage, code)
+	assert.Contains(t, stderr, "format not support")
+}
+
+func TestCLI_Model(t *testing.T) {
+	teardown := setupEnv(t)
+	defer teardown(t)
+
+	code, _, _ := run("migrate", "up")
+	assert.Equal(t, cli.ExitOK, code)
+
+	code, stdout, _ := run("model", "create", "-colors", "White, Black", "-versions", "v1.2", "Pro")
+	assert.Equal(t, cli.ExitOK, code)
+	m := &service.Model{}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), m))
+	assert.Equal(t, []string{"Black", "White"}, m.Colors)
+
+	code, _, stderr := run("model", "create", "Pro")
+	assert.Equal(t, cli.ExitFail, code)
+	assert.Contains(t, stderr, "Model already exists")
+
+	code, _, _ = run("device", "create", "-model", "Pro", "-color", "Black", "-version", "v1.2")
+	assert.Equal(t, cli.ExitOK, code)
+
+	code, stdout, _ = run("model", "mismatch")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Equal(t, "[]\n", stdout)
+
+	// a color in use stays
+	code, _, stderr = run("model", "update", "-colors", "White", "-versions", "v1.2,v1.3", "Pro")
+	assert.Equal(t, cli.ExitFail, code)
+	assert.Contains(t, stderr, "Model in use")
+
+	code, stdout, _ = run("model", "update", "-colors", "White,Black", "-versions", "v1.2,v1.3", "Pro")
+	assert.Equal(t, cli.ExitOK, code)
+	assert.NoError(t, json.Unmarshal([]byte(stdout), m))
+	assert.Equal(t, []string{"v1.2", "v1.3"}, m.Versions)
+
+	code, _, stderr = run("model", "delete", "Pro")
+	assert.Equal(t, cli.ExitFail, code)
+	assert.Contains(t, stderr, "Model in use")
+
+	code, _, stderr = run("model", "get", "Lite")
+	assert.Equal(t, cli.ExitFail, code)
+	assert.Contains(t, stderr, "model Lite not found")
+}
+
+func TestCLI_Firmware(t *testing.T) {
+	teardown := setupEnv(t)
+	defer teardown(t)
+	dir, err := ioutil.TempDir("", "firmware")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	os.Setenv(env.FirmwareArtifactDir, filepath.Join(dir, "artifacts"))
+	defer os.Unsetenv(env.FirmwareArtifactDir)
+	os.Setenv(env.FirmwareSigningKEK, "BwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwc=")
+	defer os.Unsetenv(env.FirmwareSigningKEK)
+	file := filepath.Join(dir, "firmware.bin")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("hello"), 0644))
+
+	code, _, _ := run("migrate", "up")
+	assert.Equal(t, cli.ExitOK, code)
+
+	code, _, stderr := run("firmware", "upload", "-model", "Pro", "-version", "v2.0")
+	assert.Equal(t, cli.ExitUsage, code)
+	assert.Contains(t, stderr, "Usage: demo firmware upload")
+
+	code, _, stderr = run("firmware", "upload", "-model", "Pro", file)
+	assert.Equal(t, cli.ExitFail, code)
+	assert.Contains(t, stderr, "Firmware release invalid")
+
+	code, stdout, _ := run("firmware", "upload", "-model", "Pro", "-version", "v2.0", file)
+	assert.Equal(t, cli.ExitOK, code)
+	release := &service.Release{}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), release))
+	assert.NotEmpty(t, release.Signature)
+
+	// a release signed before a rotation is still verified
+	code, stdout, _ = run("firmware", "rotate-key")
+	assert.Equal(t, cli.ExitOK, code)
+	k := &service.SigningKey{}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), k))
+	assert.NotEqual(t, release.KeyId, k.Id)
+
+	code, stdout, _ = run("firmware", "keys")
+	assert.Equal(t, cli.ExitOK, code)
+	keys := []*service.SigningKey{}
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &keys))
+	assert.Len(t, keys, 2)
+	assert.NotContains(t, stdout, "private")
+
+	code, stdout, _ = run("firmware", "verify", release.Id)
+	assert.Equal(t, cli.ExitOK, code)
+	assert.Contains(t, stdout, `"valid": true`)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "artifacts", release.Id), []byte("hellO"), 0644))
+	code, stdout, _ = run("firmware", "verify", release.Id)
+	assert.Equal(t, cli.ExitFail, code)
+	assert.Contains(t, stdout, `"reason": "artifact digest mismatch"`)
+
+	code, _, stderr = run("firmware", "verify", "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60")
+	assert.Equal(t, cli.ExitFail, code)
+	assert.Contains(t, stderr, "release 5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60 not found")
+}
+
+func TestCLI_StartupFail(t *testing.T) {
+	os.Setenv(env.DBDialect, "mysql")
+	defer os.Unsetenv(env.DBDialect)
+
+	code, _, _ := run("device", "list")
+	assert.Equal(t, cli.ExitDatabase, code)
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+
+	preparation "github/demo/init"
+)
+
+func init() {
+	commands = append(commands, &command{
+		name:  "config",
+		usage: "print the config with its secrets masked, or validate it: print | validate",
+		run:   (*CLI).config,
+	})
+}
+
+func (c *CLI) config(args []string) int {
+	return c.subcommand("config", args, map[string]func(args []string) int{
+		"print":    c.configPrint,
+		"validate": c.configValidate,
+	})
+}
+
+func (c *CLI) configPrint(args []string) int {
+	fs := c.flagSet("config print")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	cf, err := preparation.Config()
+	if err != nil {
+		// still show what was read, the error says what is wrong with it
+		c.errorf("%v", err)
+	}
+
+	info, werr := cf.Watch()
+	if werr != nil {
+		c.errorf("%v", werr)
+		return ExitFail
+	}
+	fmt.Fprintln(c.Stdout, info)
+	if err != nil {
+		return ExitConfig
+	}
+	return ExitOK
+}
+
+func (c *CLI) configValidate(args []string) int {
+	fs := c.flagSet("config validate")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	if _, err := preparation.Config(); err != nil {
+		c.errorf("%v", err)
+		return ExitConfig
+	}
+	fmt.Fprintln(c.Stdout, "config is valid")
+	return ExitOK
+}
@@ -0,0 +1,325 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gofrs/uuid"
+
+	"github/demo/model/device"
+	"github/demo/service"
+	"github/demo/utils/audit"
+)
+
+func init() {
+	commands = append(commands, &command{
+		name:  "device",
+		usage: "manage the devices in the configured database: list | get <id> | create | delete <id> | history <id> | activate|suspend|decommission <id> | label <id> <key=value>... | unlabel <id> <key>... | export | import <file>",
+		run:   (*CLI).device,
+	})
+}
+
+func (c *CLI) device(args []string) int {
+	return c.subcommand("device", args, map[string]func(args []string) int{
+		"list":         c.deviceList,
+		"get":          c.deviceGet,
+		"create":       c.deviceCreate,
+		"delete":       c.deviceDelete,
+		"history":      c.deviceHistory,
+		"activate":     c.deviceTransition(device.ActionActivate),
+		"suspend":      c.deviceTransition(device.ActionSuspend),
+		"decommission": c.deviceTransition(device.ActionDecommission),
+		"label":        c.deviceLabel,
+		"unlabel":      c.deviceUnlabel,
+		"export":       c.deviceExport,
+		"import":       c.deviceImport,
+	})
+}
+
+// actorContext returns the context of a command, its changes are recorded as
+// made by the user running it
+func actorContext() context.Context {
+	actor := "cli"
+	if u := os.Getenv("USER"); len(u) > 0 {
+		actor += ":" + u
+	}
+	return audit.NewContext(context.Background(), actor)
+}
+
+// withServices runs fn once the services are up, without the HTTP server
+func (c *CLI) withServices(fn func(s service.IDeviceService) int) int {
+	r := &runtime{quiet: true}
+	return r.start(func() int {
+		return fn(r.a.DeviceService)
+	}, r.configPhase(), r.loggerPhase(), r.databasePhase(), r.servicesPhase())
+}
+
+// failed reports code unless it is a success
+func (c *CLI) failed(code service.ErrorCode) bool {
+	if code == service.ErrorCodeSuccess || code == service.ErrorCodeSuccessButNotFound {
+		return false
+	}
+	c.errorf("%d %s", code, service.ErrorMsg(code))
+	return true
+}
+
+func (c *CLI) deviceList(args []string) int {
+	fs := c.flagSet("device list")
+	d := &service.Device{}
+	fs.StringVar(&d.Model, "model", "", "filter by model")
+	fs.StringVar(&d.Color, "color", "", "filter by color")
+	fs.StringVar(&d.Version, "version", "", "filter by version")
+	fs.StringVar(&d.State, "state", "", "filter by lifecycle state")
+	fs.StringVar(&d.Status, "status", "", "filter by status: online, stale or offline")
+	fs.StringVar(&d.Selector, "selector", "", "filter by label selector, such as site=tpe,env!=lab")
+	page := &service.Page{}
+	fs.Uint64Var(&page.Page, "page", 1, "page number, from 1")
+	fs.Uint64Var(&page.Number, "number", 50, "devices per page")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	return c.withServices(func(s service.IDeviceService) int {
+		devices, code := s.Find(actorContext(), d, page)
+		if c.failed(code) {
+			return ExitFail
+		}
+		if devices == nil {
+			devices = []*service.Device{}
+		}
+		return c.printJSON(devices)
+	})
+}
+
+func (c *CLI) deviceGet(args []string) int {
+	fs := c.flagSet("device get")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() != 1 {
+		c.errorf("Usage: demo device get <id>")
+		return ExitUsage
+	}
+	if uuid.FromStringOrNil(fs.Arg(0)) == uuid.Nil {
+		c.errorf("%d %s", service.ErrorCodeParseUUIDFail, service.ErrorMsg(service.ErrorCodeParseUUIDFail))
+		return ExitUsage
+	}
+
+	return c.withServices(func(s service.IDeviceService) int {
+		devices, code := s.Find(actorContext(), &service.Device{Id: fs.Arg(0)}, &service.Page{Page: 1, Number: 1})
+		if c.failed(code) {
+			return ExitFail
+		}
+		if len(devices) == 0 {
+			c.errorf("device %s not found", fs.Arg(0))
+			return ExitFail
+		}
+		return c.printJSON(devices[0])
+	})
+}
+
+func (c *CLI) deviceCreate(args []string) int {
+	fs := c.flagSet("device create")
+	d := &service.Device{}
+	fs.StringVar(&d.Model, "model", "", "model of the device")
+	fs.StringVar(&d.Color, "color", "", "color of the device")
+	fs.StringVar(&d.Version, "version", "", "version of the device")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	return c.withServices(func(s service.IDeviceService) int {
+		created, code := s.Register(actorContext(), d)
+		if c.failed(code) {
+			return ExitFail
+		}
+		return c.printJSON(created)
+	})
+}
+
+func (c *CLI) deviceDelete(args []string) int {
+	fs := c.flagSet("device delete")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() != 1 {
+		c.errorf("Usage: demo device delete <id>")
+		return ExitUsage
+	}
+
+	return c.withServices(func(s service.IDeviceService) int {
+		code := s.Delete(actorContext(), fs.Arg(0))
+		if c.failed(code) {
+			return ExitFail
+		}
+		if code == service.ErrorCodeSuccessButNotFound {
+			c.errorf("device %s not found", fs.Arg(0))
+			return ExitFail
+		}
+		fmt.Fprintf(c.Stdout, "deleted %s\n", fs.Arg(0))
+		return ExitOK
+	})
+}
+
+func (c *CLI) deviceHistory(args []string) int {
+	fs := c.flagSet("device history")
+	page := &service.Page{}
+	fs.Uint64Var(&page.Page, "page", 1, "page number, from 1")
+	fs.Uint64Var(&page.Number, "number", 50, "records per page")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() != 1 {
+		c.errorf("Usage: demo device history [-page n] [-number n] <id>")
+		return ExitUsage
+	}
+
+	return c.withServices(func(s service.IDeviceService) int {
+		history, code := s.History(actorContext(), fs.Arg(0), page)
+		if c.failed(code) {
+			return ExitFail
+		}
+		return c.printJSON(history)
+	})
+}
+
+// deviceTransition returns the command applying the lifecycle transition
+// action to a device
+func (c *CLI) deviceTransition(action string) func(args []string) int {
+	return func(args []string) int {
+		fs := c.flagSet("device " + action)
+		if err := fs.Parse(args); err != nil {
+			return ExitUsage
+		}
+		if fs.NArg() != 1 {
+			c.errorf("Usage: demo device %s <id>", action)
+			return ExitUsage
+		}
+
+		return c.withServices(func(s service.IDeviceService) int {
+			d, code := s.Transition(actorContext(), fs.Arg(0), action)
+			if c.failed(code) {
+				return ExitFail
+			}
+			return c.printJSON(d)
+		})
+	}
+}
+
+func (c *CLI) deviceLabel(args []string) int {
+	fs := c.flagSet("device label")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() < 2 {
+		c.errorf("Usage: demo device label <id> <key=value>...")
+		return ExitUsage
+	}
+	labels := make(map[string]string)
+	for _, arg := range fs.Args()[1:] {
+		i := strings.Index(arg, "=")
+		if i < 0 {
+			c.errorf("label %q is not key=value", arg)
+			return ExitUsage
+		}
+		labels[arg[:i]] = arg[i+1:]
+	}
+
+	return c.withServices(func(s service.IDeviceService) int {
+		labels, code := s.SetLabels(actorContext(), fs.Arg(0), labels)
+		if c.failed(code) {
+			return ExitFail
+		}
+		return c.printJSON(labels)
+	})
+}
+
+func (c *CLI) deviceUnlabel(args []string) int {
+	fs := c.flagSet("device unlabel")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() < 2 {
+		c.errorf("Usage: demo device unlabel <id> <key>...")
+		return ExitUsage
+	}
+
+	return c.withServices(func(s service.IDeviceService) int {
+		labels, code := s.RemoveLabels(actorContext(), fs.Arg(0), fs.Args()[1:]...)
+		if c.failed(code) {
+			return ExitFail
+		}
+		return c.printJSON(labels)
+	})
+}
+
+func (c *CLI) deviceExport(args []string) int {
+	fs := c.flagSet("device export")
+	format := fs.String("format", service.FormatCSV, "output format: csv or ndjson")
+	d := &service.Device{}
+	fs.StringVar(&d.Model, "model", "", "filter by model")
+	fs.StringVar(&d.Color, "color", "", "filter by color")
+	fs.StringVar(&d.Version, "version", "", "filter by version")
+	fs.StringVar(&d.Selector, "selector", "", "filter by label selector, such as site=tpe,env!=lab")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	enc, err := service.NewDeviceEncoder(*format, c.Stdout)
+	if err != nil {
+		c.errorf("%v", err)
+		return ExitUsage
+	}
+
+	return c.withServices(func(s service.IDeviceService) int {
+		if c.failed(s.Export(actorContext(), d, enc)) {
+			return ExitFail
+		}
+		return ExitOK
+	})
+}
+
+func (c *CLI) deviceImport(args []string) int {
+	fs := c.flagSet("device import")
+	format := fs.String("format", service.FormatCSV, "input format: csv or ndjson")
+	dryRun := fs.Bool("dry-run", false, "validate the input without writing")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() != 1 {
+		c.errorf("Usage: demo device import [-format csv|ndjson] [-dry-run] <file|->")
+		return ExitUsage
+	}
+
+	var r io.Reader = os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			c.errorf("%v", err)
+			return ExitFail
+		}
+		defer f.Close()
+		r = f
+	}
+	dec, err := service.NewDeviceDecoder(*format, r)
+	if err != nil {
+		c.errorf("%v", err)
+		return ExitUsage
+	}
+
+	return c.withServices(func(s service.IDeviceService) int {
+		result, code := s.Import(actorContext(), dec, *dryRun)
+		if c.failed(code) {
+			return ExitFail
+		}
+		if exit := c.printJSON(result); exit != ExitOK {
+			return exit
+		}
+		if result.Failed > 0 {
+			return ExitFail
+		}
+		return ExitOK
+	})
+}
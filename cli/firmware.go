@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"os"
+
+	"github/demo/service"
+)
+
+func init() {
+	commands = append(commands, &command{
+		name:  "firmware",
+		usage: "manage the firmware releases and their signing keys: upload <file> | verify <id> | keys | rotate-key",
+		run:   (*CLI).firmware,
+	})
+}
+
+func (c *CLI) firmware(args []string) int {
+	return c.subcommand("firmware", args, map[string]func(args []string) int{
+		"upload":     c.firmwareUpload,
+		"verify":     c.firmwareVerify,
+		"keys":       c.firmwareKeys,
+		"rotate-key": c.firmwareRotateKey,
+	})
+}
+
+// withFirmware runs fn once the services are up, without the HTTP server
+func (c *CLI) withFirmware(fn func(s service.IFirmwareService) int) int {
+	r := &runtime{quiet: true}
+	return r.start(func() int {
+		return fn(r.a.FirmwareService)
+	}, r.configPhase(), r.loggerPhase(), r.databasePhase(), r.servicesPhase())
+}
+
+// firmwareUpload registers the artifact of a file as a release, signed with
+// the active key when there is a key-encryption key
+func (c *CLI) firmwareUpload(args []string) int {
+	fs := c.flagSet("firmware upload")
+	x := &service.ReleaseRequest{}
+	fs.StringVar(&x.Model, "model", "", "model of the release")
+	fs.StringVar(&x.Version, "version", "", "firmware version of the release")
+	fs.StringVar(&x.Notes, "notes", "", "release notes")
+	fs.StringVar(&x.Checksum, "checksum", "", "SHA-256 digest of the file in hex, unchecked when empty")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() != 1 {
+		c.errorf("Usage: demo firmware upload -model <model> -version <version> [-notes text] [-checksum sha256] <file>")
+		return ExitUsage
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		c.errorf("%v", err)
+		return ExitFail
+	}
+	defer f.Close()
+
+	return c.withFirmware(func(s service.IFirmwareService) int {
+		created, code := s.CreateRelease(actorContext(), x, f)
+		if c.failed(code) {
+			return ExitFail
+		}
+		return c.printJSON(created)
+	})
+}
+
+// firmwareVerify checks the artifact of a release against its digest and
+// signature, it fails when they don't match
+func (c *CLI) firmwareVerify(args []string) int {
+	fs := c.flagSet("firmware verify")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() != 1 {
+		c.errorf("Usage: demo firmware verify <id>")
+		return ExitUsage
+	}
+
+	return c.withFirmware(func(s service.IFirmwareService) int {
+		v, code := s.VerifyRelease(actorContext(), fs.Arg(0))
+		if code == service.ErrorCodeNotFound {
+			c.errorf("release %s not found", fs.Arg(0))
+			return ExitFail
+		}
+		if c.failed(code) {
+			return ExitFail
+		}
+		if exit := c.printJSON(v); exit != ExitOK {
+			return exit
+		}
+		if !v.Valid {
+			return ExitFail
+		}
+		return ExitOK
+	})
+}
+
+func (c *CLI) firmwareKeys(args []string) int {
+	fs := c.flagSet("firmware keys")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	return c.withFirmware(func(s service.IFirmwareService) int {
+		keys, code := s.Keys(actorContext())
+		if c.failed(code) {
+			return ExitFail
+		}
+		return c.printJSON(keys)
+	})
+}
+
+// firmwareRotateKey makes a new key sign the releases, the retired one still
+// verifies those it signed
+func (c *CLI) firmwareRotateKey(args []string) int {
+	fs := c.flagSet("firmware rotate-key")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	return c.withFirmware(func(s service.IFirmwareService) int {
+		k, code := s.RotateKey(actorContext())
+		if c.failed(code) {
+			return ExitFail
+		}
+		return c.printJSON(k)
+	})
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github/demo/migration"
+)
+
+func init() {
+	commands = append(commands, &command{
+		name:  "migrate",
+		usage: "apply, revert or list the schema migrations: up | down [-steps n] | status",
+		run:   (*CLI).migrate,
+	})
+}
+
+func (c *CLI) migrate(args []string) int {
+	return c.subcommand("migrate", args, map[string]func(args []string) int{
+		"up":     c.migrateUp,
+		"down":   c.migrateDown,
+		"status": c.migrateStatus,
+	})
+}
+
+// withDatabase runs fn once the database is up, the memory dialect has no
+// schema to migrate
+func (c *CLI) withDatabase(fn func(r *runtime) int) int {
+	r := &runtime{quiet: true}
+	return r.start(func() int {
+		if r.e.GormDB == nil {
+			c.errorf("dialect %s has no schema to migrate", r.cf.Database.Dialect)
+			return ExitFail
+		}
+		return fn(r)
+	}, r.configPhase(), r.loggerPhase(), r.databasePhase())
+}
+
+func (c *CLI) migrateUp(args []string) int {
+	fs := c.flagSet("migrate up")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	return c.withDatabase(func(r *runtime) int {
+		done, err := migration.Up(r.e.GormDB)
+		for _, m := range done {
+			fmt.Fprintf(c.Stdout, "applied %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			c.errorf("%v", err)
+			return ExitFail
+		}
+		if len(done) == 0 {
+			fmt.Fprintln(c.Stdout, "no pending migration")
+		}
+		return ExitOK
+	})
+}
+
+func (c *CLI) migrateDown(args []string) int {
+	fs := c.flagSet("migrate down")
+	steps := fs.Int("steps", 1, "number of migrations to revert")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if *steps < 1 {
+		c.errorf("steps must be positive, got %d", *steps)
+		return ExitUsage
+	}
+
+	return c.withDatabase(func(r *runtime) int {
+		done, err := migration.Down(r.e.GormDB, *steps)
+		for _, m := range done {
+			fmt.Fprintf(c.Stdout, "reverted %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			c.errorf("%v", err)
+			return ExitFail
+		}
+		if len(done) == 0 {
+			fmt.Fprintln(c.Stdout, "no applied migration")
+		}
+		return ExitOK
+	})
+}
+
+func (c *CLI) migrateStatus(args []string) int {
+	fs := c.flagSet("migrate status")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	return c.withDatabase(func(r *runtime) int {
+		status, err := migration.List(r.e.GormDB)
+		if err != nil {
+			c.errorf("%v", err)
+			return ExitFail
+		}
+
+		w := tabwriter.NewWriter(c.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range status {
+			state, at := "pending", "-"
+			if s.Applied {
+				state = "applied"
+				at = time.Unix(0, s.AppliedAt*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, state, at)
+		}
+		w.Flush()
+		return ExitOK
+	})
+}
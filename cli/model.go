@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github/demo/service"
+)
+
+func init() {
+	commands = append(commands, &command{
+		name:  "model",
+		usage: "manage the model catalog in the configured database: list | get <name> | create <name> | update <name> | delete <name> | mismatch",
+		run:   (*CLI).model,
+	})
+}
+
+func (c *CLI) model(args []string) int {
+	return c.subcommand("model", args, map[string]func(args []string) int{
+		"list":     c.modelList,
+		"get":      c.modelGet,
+		"create":   c.modelCreate,
+		"update":   c.modelUpdate,
+		"delete":   c.modelDelete,
+		"mismatch": c.modelMismatch,
+	})
+}
+
+// withCatalog runs fn once the services are up, without the HTTP server
+func (c *CLI) withCatalog(fn func(s service.ICatalogService) int) int {
+	r := &runtime{quiet: true}
+	return r.start(func() int {
+		return fn(r.a.CatalogService)
+	}, r.configPhase(), r.loggerPhase(), r.databasePhase(), r.servicesPhase())
+}
+
+// splitList returns the comma separated values of s
+func splitList(s string) []string {
+	if len(s) == 0 {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+func (c *CLI) modelList(args []string) int {
+	fs := c.flagSet("model list")
+	page := &service.Page{}
+	fs.Uint64Var(&page.Page, "page", 1, "page number, from 1")
+	fs.Uint64Var(&page.Number, "number", 50, "models per page")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	return c.withCatalog(func(s service.ICatalogService) int {
+		models, code := s.Find(actorContext(), page)
+		if c.failed(code) {
+			return ExitFail
+		}
+		return c.printJSON(models)
+	})
+}
+
+func (c *CLI) modelGet(args []string) int {
+	fs := c.flagSet("model get")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() != 1 {
+		c.errorf("Usage: demo model get <name>")
+		return ExitUsage
+	}
+
+	return c.withCatalog(func(s service.ICatalogService) int {
+		m, code := s.Get(actorContext(), fs.Arg(0))
+		if code == service.ErrorCodeNotFound {
+			c.errorf("model %s not found", fs.Arg(0))
+			return ExitFail
+		}
+		if c.failed(code) {
+			return ExitFail
+		}
+		return c.printJSON(m)
+	})
+}
+
+// modelFlags parses the colors and the versions of model name from args
+func (c *CLI) modelFlags(cmd string, args []string) (*service.Model, bool) {
+	fs := c.flagSet("model " + cmd)
+	colors := fs.String("colors", "", "comma separated colors of the model")
+	versions := fs.String("versions", "", "comma separated versions of the model")
+	if err := fs.Parse(args); err != nil {
+		return nil, false
+	}
+	if fs.NArg() != 1 {
+		c.errorf("Usage: demo model %s [-colors a,b] [-versions x,y] <name>", cmd)
+		return nil, false
+	}
+	return &service.Model{
+		Name:     fs.Arg(0),
+		Colors:   splitList(*colors),
+		Versions: splitList(*versions),
+	}, true
+}
+
+func (c *CLI) modelCreate(args []string) int {
+	m, ok := c.modelFlags("create", args)
+	if !ok {
+		return ExitUsage
+	}
+
+	return c.withCatalog(func(s service.ICatalogService) int {
+		created, code := s.Create(actorContext(), m)
+		if c.failed(code) {
+			return ExitFail
+		}
+		return c.printJSON(created)
+	})
+}
+
+func (c *CLI) modelUpdate(args []string) int {
+	m, ok := c.modelFlags("update", args)
+	if !ok {
+		return ExitUsage
+	}
+
+	return c.withCatalog(func(s service.ICatalogService) int {
+		_, code := s.Update(actorContext(), m)
+		if code == service.ErrorCodeNotFound {
+			c.errorf("model %s not found", m.Name)
+			return ExitFail
+		}
+		if c.failed(code) {
+			return ExitFail
+		}
+		updated, code := s.Get(actorContext(), m.Name)
+		if c.failed(code) {
+			return ExitFail
+		}
+		return c.printJSON(updated)
+	})
+}
+
+func (c *CLI) modelDelete(args []string) int {
+	fs := c.flagSet("model delete")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fs.NArg() != 1 {
+		c.errorf("Usage: demo model delete <name>")
+		return ExitUsage
+	}
+
+	return c.withCatalog(func(s service.ICatalogService) int {
+		code := s.Delete(actorContext(), fs.Arg(0))
+		if c.failed(code) {
+			return ExitFail
+		}
+		if code == service.ErrorCodeSuccessButNotFound {
+			c.errorf("model %s not found", fs.Arg(0))
+			return ExitFail
+		}
+		fmt.Fprintf(c.Stdout, "deleted %s\n", fs.Arg(0))
+		return ExitOK
+	})
+}
+
+// modelMismatch prints the devices that don't match the catalog, it fails
+// when there is any
+func (c *CLI) modelMismatch(args []string) int {
+	fs := c.flagSet("model mismatch")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	return c.withCatalog(func(s service.ICatalogService) int {
+		mismatches, code := s.Mismatches(actorContext(), nil)
+		if c.failed(code) {
+			return ExitFail
+		}
+		if exit := c.printJSON(mismatches); exit != ExitOK {
+			return exit
+		}
+		if len(mismatches) > 0 {
+			return ExitFail
+		}
+		return ExitOK
+	})
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github/demo/rest"
+	"github/demo/utils/log"
+	"github/demo/utils/startup"
+)
+
+func init() {
+	commands = append(commands, &command{
+		name:  "serve",
+		usage: "start the HTTP server, the default command",
+		run:   (*CLI).serve,
+	})
+}
+
+func (c *CLI) serve(args []string) int {
+	fs := c.flagSet("serve")
+	if err := fs.Parse(args); err != nil {
+		return ExitUsage
+	}
+
+	r := &runtime{}
+	serveErr := make(chan error, 1)
+	httpPhase := startup.Phase{
+		Name:     "HTTP",
+		Timeout:  5 * time.Second,
+		ExitCode: ExitHTTP,
+		Run: func(ctx context.Context) (startup.Cleanup, error) {
+			ln, err := net.Listen("tcp", r.cf.Server.Addr)
+			if err != nil {
+				return nil, err
+			}
+			srv := &http.Server{Handler: rest.Init(r.a)}
+			go func() {
+				if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+					serveErr <- err
+				}
+			}()
+			log.Infof("listen on %s", ln.Addr())
+			return srv.Shutdown, nil
+		},
+	}
+
+	return r.start(func() int {
+		r.cf.Watch()
+
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(quit)
+
+		select {
+		case sig := <-quit:
+			log.Infof("receive %v, shutting down", sig)
+			return ExitOK
+		case err := <-serveErr:
+			log.Errorf("http serve fail => %+v", err)
+			return ExitHTTP
+		}
+	}, r.configPhase(), r.loggerPhase(), r.databasePhase(), r.migrationsPhase(), r.servicesPhase(), r.jobsPhase(), httpPhase)
+}
@@ -3,15 +3,27 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github/demo/env"
+	"github/demo/utils/keywrap"
 	"github/demo/utils/log"
 )
 
 type Logger struct {
-	Env      string `json:"env"`
-	Filename string `json:"filename"`
-	Level    string `json:"level"`
+	Env        string            `json:"env"`
+	Filename   string            `json:"filename"`
+	Level      string            `json:"level"`
+	Format     string            `json:"format"`
+	Sinks      []string          `json:"sinks"`
+	Syslog     string            `json:"syslog"`
+	Fields     map[string]string `json:"fields"`
+	MaxSize    int               `json:"max_size"`
+	MaxAge     string            `json:"max_age"`
+	MaxBackups int               `json:"max_backups"`
+	Compress   bool              `json:"compress"`
 }
 
 type Database struct {
@@ -21,22 +33,131 @@ type Database struct {
 	Name     string `json:"name"`
 	User     string `json:"user"`
 	Password string `json:"password"`
+	// QueryTimeout bounds the statements of a request without deadline
+	QueryTimeout string `json:"query_timeout"`
+}
+
+type Access struct {
+	Skip   []string           `json:"skip"`
+	Sample map[string]float64 `json:"sample"`
+}
+
+type Trace struct {
+	ServiceName string  `json:"service_name"`
+	Exporter    string  `json:"exporter"`
+	Filename    string  `json:"filename"`
+	Endpoint    string  `json:"endpoint"`
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+type Server struct {
+	Addr string `json:"addr"`
+	// RequestTimeout is the deadline of every request
+	RequestTimeout string `json:"request_timeout"`
+}
+
+// Heartbeat classifies the devices by the time since their last heartbeat
+type Heartbeat struct {
+	// Online is how long a device stays online after a heartbeat
+	Online string `json:"online"`
+	// Offline is how long after a heartbeat a device is offline, it is stale
+	// in between
+	Offline string `json:"offline"`
+}
+
+// Telemetry is how long the telemetry is kept, by resolution
+type Telemetry struct {
+	// Raw, Minute and Hour are the retentions of the raw points and of the
+	// rollups of a minute and of an hour, each at most the next one
+	Raw    string `json:"raw"`
+	Minute string `json:"minute"`
+	Hour   string `json:"hour"`
+	// PurgeInterval is how often the telemetry past its retention is deleted
+	PurgeInterval string `json:"purge_interval"`
+}
+
+// Command bounds the commands queued for the devices
+type Command struct {
+	// DefaultTTL is how long a command queued without a TTL lives, at most
+	// MaxTTL
+	DefaultTTL string `json:"default_ttl"`
+	MaxTTL     string `json:"max_ttl"`
+	// PollTimeout is the longest a device waits for its next command, less
+	// than the request timeout of the server
+	PollTimeout string `json:"poll_timeout"`
+	// Retention is how long a command is kept once it succeeded, failed or
+	// expired
+	Retention string `json:"retention"`
+	// CleanupInterval is how often the commands are expired and purged
+	CleanupInterval string `json:"cleanup_interval"`
+}
+
+// Firmware is where the firmware artifacts are kept and how often the
+// rollout campaigns are stepped
+type Firmware struct {
+	ArtifactDir     string `json:"artifact_dir"`
+	RolloutInterval string `json:"rollout_interval"`
+	// SigningKEK is the key-encryption key of the signing keys, 32 bytes in
+	// base64, the releases are stored unsigned without it
+	SigningKEK string `json:"signing_kek"`
 }
 
 type Config struct {
-	Logger   *Logger   `json:"logger"`
-	Database *Database `json:"database"`
+	Server    *Server    `json:"server"`
+	Logger    *Logger    `json:"logger"`
+	Access    *Access    `json:"access"`
+	Trace     *Trace     `json:"trace"`
+	Database  *Database  `json:"database"`
+	Heartbeat *Heartbeat `json:"heartbeat"`
+	Telemetry *Telemetry `json:"telemetry"`
+	Command   *Command   `json:"command"`
+	Firmware  *Firmware  `json:"firmware"`
+
+	// parseErrs are the values of Init that didn't parse
+	parseErrs []error
 }
 
 func (c *Config) Init(v env.Variables) bool {
 	for _, key := range v.Keys() {
 		switch key {
+		case env.ServerAddr:
+			c.Server.Addr = fmt.Sprintf("%v", v[env.ServerAddr])
+		case env.ServerRequestTimeout:
+			c.Server.RequestTimeout = fmt.Sprintf("%v", v[env.ServerRequestTimeout])
 		case env.LogEnv:
 			c.Logger.Env = fmt.Sprintf("%v", v[env.LogEnv])
 		case env.LogFile:
 			c.Logger.Filename = fmt.Sprintf("%v", v[env.LogFile])
 		case env.LogLevel:
 			c.Logger.Level = fmt.Sprintf("%v", v[env.LogLevel])
+		case env.LogFormat:
+			c.Logger.Format = fmt.Sprintf("%v", v[env.LogFormat])
+		case env.LogSinks:
+			c.Logger.Sinks = splitList(fmt.Sprintf("%v", v[env.LogSinks]))
+		case env.LogSyslog:
+			c.Logger.Syslog = fmt.Sprintf("%v", v[env.LogSyslog])
+		case env.LogFields:
+			c.Logger.Fields = splitPairs(fmt.Sprintf("%v", v[env.LogFields]))
+		case env.LogMaxSize:
+			c.Logger.MaxSize = c.parseInt(key, v[env.LogMaxSize])
+		case env.LogMaxAge:
+			c.Logger.MaxAge = fmt.Sprintf("%v", v[env.LogMaxAge])
+		case env.LogMaxBackups:
+			c.Logger.MaxBackups = c.parseInt(key, v[env.LogMaxBackups])
+		case env.LogCompress:
+			c.Logger.Compress = c.parseBool(key, v[env.LogCompress])
+		case env.AccessSkip:
+			c.Access.Skip = splitList(fmt.Sprintf("%v", v[env.AccessSkip]))
+		case env.AccessSample:
+			c.Access.Sample = c.parseRates(key, v[env.AccessSample])
+		case env.TraceExporter:
+			c.Trace.Exporter = fmt.Sprintf("%v", v[env.TraceExporter])
+		case env.TraceFilename:
+			c.Trace.Filename = fmt.Sprintf("%v", v[env.TraceFilename])
+		case env.TraceEndpoint:
+			c.Trace.Endpoint = fmt.Sprintf("%v", v[env.TraceEndpoint])
+		case env.TraceSampleRatio:
+			c.Trace.SampleRatio = c.parseFloat(key, v[env.TraceSampleRatio])
 		case env.DBDialect:
 			c.Database.Dialect = fmt.Sprintf("%v", v[env.DBDialect])
 		case env.DBHost:
@@ -49,14 +170,233 @@ func (c *Config) Init(v env.Variables) bool {
 			c.Database.User = fmt.Sprintf("%v", v[env.DBUser])
 		case env.DBPassword:
 			c.Database.Password = fmt.Sprintf("%v", v[env.DBPassword])
+		case env.DBQueryTimeout:
+			c.Database.QueryTimeout = fmt.Sprintf("%v", v[env.DBQueryTimeout])
+		case env.HeartbeatOnline:
+			c.Heartbeat.Online = fmt.Sprintf("%v", v[env.HeartbeatOnline])
+		case env.HeartbeatOffline:
+			c.Heartbeat.Offline = fmt.Sprintf("%v", v[env.HeartbeatOffline])
+		case env.TelemetryRaw:
+			c.Telemetry.Raw = fmt.Sprintf("%v", v[env.TelemetryRaw])
+		case env.TelemetryMinute:
+			c.Telemetry.Minute = fmt.Sprintf("%v", v[env.TelemetryMinute])
+		case env.TelemetryHour:
+			c.Telemetry.Hour = fmt.Sprintf("%v", v[env.TelemetryHour])
+		case env.TelemetryPurge:
+			c.Telemetry.PurgeInterval = fmt.Sprintf("%v", v[env.TelemetryPurge])
+		case env.CommandDefaultTTL:
+			c.Command.DefaultTTL = fmt.Sprintf("%v", v[env.CommandDefaultTTL])
+		case env.CommandMaxTTL:
+			c.Command.MaxTTL = fmt.Sprintf("%v", v[env.CommandMaxTTL])
+		case env.CommandPollTimeout:
+			c.Command.PollTimeout = fmt.Sprintf("%v", v[env.CommandPollTimeout])
+		case env.CommandRetention:
+			c.Command.Retention = fmt.Sprintf("%v", v[env.CommandRetention])
+		case env.CommandCleanup:
+			c.Command.CleanupInterval = fmt.Sprintf("%v", v[env.CommandCleanup])
+		case env.FirmwareArtifactDir:
+			c.Firmware.ArtifactDir = fmt.Sprintf("%v", v[env.FirmwareArtifactDir])
+		case env.FirmwareRollout:
+			c.Firmware.RolloutInterval = fmt.Sprintf("%v", v[env.FirmwareRollout])
+		case env.FirmwareSigningKEK:
+			c.Firmware.SigningKEK = fmt.Sprintf("%v", v[env.FirmwareSigningKEK])
 		}
 	}
 
 	return true
 }
 
+// invalid records the value of key Init couldn't parse, Validate reports it
+func (c *Config) invalid(key string, err error) {
+	log.Errorf("config %s invalid => %+v", key, err)
+	c.parseErrs = append(c.parseErrs, fmt.Errorf("config %s invalid: %v", key, err))
+}
+
+func (c *Config) parseInt(key string, v interface{}) int {
+	i, err := strconv.Atoi(fmt.Sprintf("%v", v))
+	if err != nil {
+		c.invalid(key, err)
+	}
+	return i
+}
+
+func (c *Config) parseBool(key string, v interface{}) bool {
+	b, err := strconv.ParseBool(fmt.Sprintf("%v", v))
+	if err != nil {
+		c.invalid(key, err)
+	}
+	return b
+}
+
+func (c *Config) parseFloat(key string, v interface{}) float64 {
+	f, err := strconv.ParseFloat(fmt.Sprintf("%v", v), 64)
+	if err != nil {
+		c.invalid(key, err)
+	}
+	return f
+}
+
+// parseRates parses "path1=0.1,path2=0.5"
+func (c *Config) parseRates(key string, v interface{}) map[string]float64 {
+	rates := make(map[string]float64)
+	for k, r := range splitPairs(fmt.Sprintf("%v", v)) {
+		f, err := strconv.ParseFloat(r, 64)
+		if err != nil {
+			c.invalid(key, err)
+			continue
+		}
+		rates[k] = f
+	}
+	return rates
+}
+
+// splitList parses "a,b,c"
+func splitList(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// splitPairs parses "k1=v1,k2=v2"
+func splitPairs(s string) map[string]string {
+	pairs := make(map[string]string)
+	for _, v := range splitList(s) {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		pairs[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return pairs
+}
+
+// Validate checks the values that are parsed later on, so a bad config fails
+// before anything is started
+func (c *Config) Validate() error {
+	// a value that didn't parse is left zero, it isn't run with silently
+	if len(c.parseErrs) > 0 {
+		return c.parseErrs[0]
+	}
+
+	durations := []struct {
+		key   string
+		value string
+	}{
+		{env.ServerRequestTimeout, c.Server.RequestTimeout},
+		{env.LogMaxAge, c.Logger.MaxAge},
+		{env.DBQueryTimeout, c.Database.QueryTimeout},
+		{env.HeartbeatOnline, c.Heartbeat.Online},
+		{env.HeartbeatOffline, c.Heartbeat.Offline},
+		{env.TelemetryRaw, c.Telemetry.Raw},
+		{env.TelemetryMinute, c.Telemetry.Minute},
+		{env.TelemetryHour, c.Telemetry.Hour},
+		{env.TelemetryPurge, c.Telemetry.PurgeInterval},
+		{env.CommandDefaultTTL, c.Command.DefaultTTL},
+		{env.CommandMaxTTL, c.Command.MaxTTL},
+		{env.CommandPollTimeout, c.Command.PollTimeout},
+		{env.CommandRetention, c.Command.Retention},
+		{env.CommandCleanup, c.Command.CleanupInterval},
+		{env.FirmwareRollout, c.Firmware.RolloutInterval},
+	}
+	for _, d := range durations {
+		if len(d.value) == 0 {
+			continue
+		}
+		if _, err := time.ParseDuration(d.value); err != nil {
+			return fmt.Errorf("config %s invalid: %v", d.key, err)
+		}
+	}
+
+	if len(c.Heartbeat.Online) > 0 && len(c.Heartbeat.Offline) > 0 {
+		online, _ := time.ParseDuration(c.Heartbeat.Online)
+		offline, _ := time.ParseDuration(c.Heartbeat.Offline)
+		if online <= 0 || offline < online {
+			return fmt.Errorf("config %s invalid: %s not in (0, %s]", env.HeartbeatOnline, c.Heartbeat.Online, c.Heartbeat.Offline)
+		}
+	}
+
+	// the rollups are computed from the finer ones, they must outlive them
+	retentions := []struct {
+		key   string
+		value string
+	}{
+		{env.TelemetryRaw, c.Telemetry.Raw},
+		{env.TelemetryMinute, c.Telemetry.Minute},
+		{env.TelemetryHour, c.Telemetry.Hour},
+	}
+	for i, r := range retentions {
+		if len(r.value) == 0 {
+			continue
+		}
+		d, _ := time.ParseDuration(r.value)
+		if d <= 0 {
+			return fmt.Errorf("config %s invalid: %s not positive", r.key, r.value)
+		}
+		if i+1 < len(retentions) && len(retentions[i+1].value) > 0 {
+			next, _ := time.ParseDuration(retentions[i+1].value)
+			if d > next {
+				return fmt.Errorf("config %s invalid: %s longer than %s", r.key, r.value, retentions[i+1].value)
+			}
+		}
+	}
+
+	if len(c.Command.DefaultTTL) > 0 && len(c.Command.MaxTTL) > 0 {
+		ttl, _ := time.ParseDuration(c.Command.DefaultTTL)
+		max, _ := time.ParseDuration(c.Command.MaxTTL)
+		if ttl <= 0 || max < ttl {
+			return fmt.Errorf("config %s invalid: %s not in (0, %s]", env.CommandDefaultTTL, c.Command.DefaultTTL, c.Command.MaxTTL)
+		}
+	}
+	// a device waiting for a command must be answered before its request
+	// times out
+	if len(c.Command.PollTimeout) > 0 && len(c.Server.RequestTimeout) > 0 {
+		poll, _ := time.ParseDuration(c.Command.PollTimeout)
+		timeout, _ := time.ParseDuration(c.Server.RequestTimeout)
+		if poll < 0 || (timeout > 0 && poll >= timeout) {
+			return fmt.Errorf("config %s invalid: %s not in [0, %s)", env.CommandPollTimeout, c.Command.PollTimeout, c.Server.RequestTimeout)
+		}
+	}
+
+	if len(c.Firmware.SigningKEK) > 0 {
+		if _, err := keywrap.Parse(c.Firmware.SigningKEK); err != nil {
+			return fmt.Errorf("config %s invalid: %v", env.FirmwareSigningKEK, err)
+		}
+	}
+	if c.Trace.SampleRatio < 0 || c.Trace.SampleRatio > 1 {
+		return fmt.Errorf("config %s invalid: %v not in [0, 1]", env.TraceSampleRatio, c.Trace.SampleRatio)
+	}
+	if len(c.Database.Dialect) == 0 {
+		return fmt.Errorf("config %s missing", env.DBDialect)
+	}
+	return nil
+}
+
+// mask replaces the secrets in Watch
+const mask = "******"
+
+// masked returns a copy of c without its secrets
+func (c *Config) masked() *Config {
+	m := *c
+	if c.Database != nil && len(c.Database.Password) > 0 {
+		db := *c.Database
+		db.Password = mask
+		m.Database = &db
+	}
+	if c.Firmware != nil && len(c.Firmware.SigningKEK) > 0 {
+		f := *c.Firmware
+		f.SigningKEK = mask
+		m.Firmware = &f
+	}
+	return &m
+}
+
+// Watch logs and returns c as JSON, the secrets are masked
 func (c *Config) Watch() (string, error) {
-	cJson, err := json.MarshalIndent(c, "", "  ")
+	cJson, err := json.MarshalIndent(c.masked(), "", "  ")
 	if err != nil {
 		log.Error(err)
 		return "", err
@@ -68,11 +408,47 @@ func (c *Config) Watch() (string, error) {
 
 func NewConfig() *Config {
 	c := &Config{
+		Server: &Server{
+			Addr:           ":8080",
+			RequestTimeout: "30s",
+		},
 		Logger: &Logger{
-			Env:   "development",
-			Level: "debug",
+			Env:    "development",
+			Level:  "debug",
+			Format: "text",
+		},
+		Access: &Access{
+			Skip: []string{"/healthz", "/metrics"},
+		},
+		Trace: &Trace{
+			ServiceName: "demo",
+			Exporter:    "none",
+			SampleRatio: 1,
+		},
+		Database: &Database{
+			QueryTimeout: "5s",
+		},
+		Heartbeat: &Heartbeat{
+			Online:  "2m",
+			Offline: "10m",
+		},
+		Telemetry: &Telemetry{
+			Raw:           "168h",
+			Minute:        "720h",
+			Hour:          "8760h",
+			PurgeInterval: "10m",
+		},
+		Command: &Command{
+			DefaultTTL:      "1h",
+			MaxTTL:          "24h",
+			PollTimeout:     "20s",
+			Retention:       "720h",
+			CleanupInterval: "1m",
+		},
+		Firmware: &Firmware{
+			ArtifactDir:     "data/firmware",
+			RolloutInterval: "1m",
 		},
-		Database: &Database{},
 	}
 
 	return c
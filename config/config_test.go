@@ -28,12 +28,86 @@ func Test_init(t *testing.T) {
 	assert.Equal(t, port, cf.Database.Port)
 }
 
+func Test_initInvalid(t *testing.T) {
+	tt := []struct {
+		description string
+		vars        env.Variables
+		err         string
+	}{
+		{
+			description: "max size",
+			vars:        env.Variables{env.LogMaxSize: "big"},
+			err:         `config Logger_MaxSize invalid: strconv.Atoi: parsing "big": invalid syntax`,
+		},
+		{
+			description: "compress",
+			vars:        env.Variables{env.LogCompress: "yes please"},
+			err:         `config Logger_Compress invalid: strconv.ParseBool: parsing "yes please": invalid syntax`,
+		},
+		{
+			description: "sample ratio",
+			vars:        env.Variables{env.TraceSampleRatio: "half"},
+			err:         `config Trace_SampleRatio invalid: strconv.ParseFloat: parsing "half": invalid syntax`,
+		},
+		{
+			description: "access sample",
+			vars:        env.Variables{env.AccessSample: "/v1/device=some"},
+			err:         `config Access_Sample invalid: strconv.ParseFloat: parsing "some": invalid syntax`,
+		},
+		{
+			description: "valid",
+			vars:        env.Variables{env.LogMaxSize: "100", env.LogCompress: "true", env.TraceSampleRatio: "0.5"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			cf := config.NewConfig()
+			cf.Database.Dialect = "memory"
+			cf.Init(tc.vars)
+
+			err := cf.Validate()
+			if len(tc.err) == 0 {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
+
 func Test_watch(t *testing.T) {
 	json := `{
+  "server": {
+    "addr": ":8080",
+    "request_timeout": "30s"
+  },
   "logger": {
     "env": "development",
     "filename": "",
-    "level": "debug"
+    "level": "debug",
+    "format": "text",
+    "sinks": null,
+    "syslog": "",
+    "fields": null,
+    "max_size": 0,
+    "max_age": "",
+    "max_backups": 0,
+    "compress": false
+  },
+  "access": {
+    "skip": [
+      "/healthz",
+      "/metrics"
+    ],
+    "sample": null
+  },
+  "trace": {
+    "service_name": "demo",
+    "exporter": "none",
+    "filename": "",
+    "endpoint": "",
+    "sample_ratio": 1
   },
   "database": {
     "dialect": "",
@@ -41,7 +115,30 @@ func Test_watch(t *testing.T) {
     "port": "",
     "name": "",
     "user": "",
-    "password": ""
+    "password": "",
+    "query_timeout": "5s"
+  },
+  "heartbeat": {
+    "online": "2m",
+    "offline": "10m"
+  },
+  "telemetry": {
+    "raw": "168h",
+    "minute": "720h",
+    "hour": "8760h",
+    "purge_interval": "10m"
+  },
+  "command": {
+    "default_ttl": "1h",
+    "max_ttl": "24h",
+    "poll_timeout": "20s",
+    "retention": "720h",
+    "cleanup_interval": "1m"
+  },
+  "firmware": {
+    "artifact_dir": "data/firmware",
+    "rollout_interval": "1m",
+    "signing_kek": ""
   }
 }`
 
@@ -51,3 +148,86 @@ func Test_watch(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, json, info)
 }
+
+func Test_validate(t *testing.T) {
+	tt := []struct {
+		description string
+		modify      func(cf *config.Config)
+		err         string
+	}{
+		{
+			description: "valid",
+			modify:      func(cf *config.Config) {},
+		},
+		{
+			description: "missing dialect",
+			modify:      func(cf *config.Config) { cf.Database.Dialect = "" },
+			err:         "config DB_Dialect missing",
+		},
+		{
+			description: "bad duration",
+			modify:      func(cf *config.Config) { cf.Database.QueryTimeout = "soon" },
+			err:         `config DB_QueryTimeout invalid: time: invalid duration "soon"`,
+		},
+		{
+			description: "online longer than offline",
+			modify:      func(cf *config.Config) { cf.Heartbeat.Online = "1h" },
+			err:         "config Heartbeat_Online invalid: 1h not in (0, 10m]",
+		},
+		{
+			description: "raw points outlive their rollups",
+			modify:      func(cf *config.Config) { cf.Telemetry.Raw = "1000h" },
+			err:         "config Telemetry_Raw invalid: 1000h longer than 720h",
+		},
+		{
+			description: "poll outlives the request",
+			modify:      func(cf *config.Config) { cf.Command.PollTimeout = "1m" },
+			err:         "config Command_PollTimeout invalid: 1m not in [0, 30s)",
+		},
+		{
+			description: "bad rollout interval",
+			modify:      func(cf *config.Config) { cf.Firmware.RolloutInterval = "often" },
+			err:         `config Firmware_RolloutInterval invalid: time: invalid duration "often"`,
+		},
+		{
+			description: "short signing kek",
+			modify:      func(cf *config.Config) { cf.Firmware.SigningKEK = "c2hvcnQ=" },
+			err:         "config Firmware_SigningKEK invalid: key-encryption key is 5 bytes, not 32",
+		},
+		{
+			description: "bad sample ratio",
+			modify:      func(cf *config.Config) { cf.Trace.SampleRatio = 2 },
+			err:         "config Trace_SampleRatio invalid: 2 not in [0, 1]",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			cf := config.NewConfig()
+			cf.Database.Dialect = "memory"
+			tc.modify(cf)
+
+			err := cf.Validate()
+			if len(tc.err) == 0 {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.err)
+			}
+		})
+	}
+}
+
+func Test_watchMask(t *testing.T) {
+	cf := config.NewConfig()
+	cf.Database.Password = "1qaz@WSX"
+	cf.Firmware.SigningKEK = "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="
+
+	info, err := cf.Watch()
+	assert.NoError(t, err)
+	assert.Contains(t, info, `"password": "******"`)
+	assert.Contains(t, info, `"signing_kek": "******"`)
+	assert.NotContains(t, info, "1qaz@WSX")
+	assert.NotContains(t, info, "AQEBAQEB")
+	assert.Equal(t, "1qaz@WSX", cf.Database.Password)
+	assert.Equal(t, "AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=", cf.Firmware.SigningKEK)
+}
@@ -0,0 +1,226 @@
+package daos
+
+import (
+	"context"
+	"strings"
+
+	"github/demo/database"
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/model/firmware"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+// targetInsert is followed by the values of the targets, a target added
+// again, such as by two instances starting the same wave, is skipped
+const (
+	targetInsert   = "INSERT INTO firmware_campaign_device (campaign_id, device_id, wave, status, start_time, update_time) VALUES "
+	targetConflict = " ON CONFLICT DO NOTHING"
+)
+
+// targetsPerInsert keeps the bound values of a statement under the limit of
+// SQLite
+const targetsPerInsert = 100
+
+type campaignRepo struct {
+	db *gorm.DB
+}
+
+func (r *campaignRepo) Create(ctx context.Context, c *firmware.Campaign) (*firmware.Campaign, error) {
+	ctx, span := trace.Start(ctx, "campaignRepository.Create")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	if err := r.conn(ctx).Create(c).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("campaignRepository Create fail => %+v", err)
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *campaignRepo) Get(ctx context.Context, id device.UUID) (*firmware.Campaign, error) {
+	ctx, span := trace.Start(ctx, "campaignRepository.Get")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	c := firmware.Campaign{}
+	if err := r.conn(ctx).Where("id = ?", id).Find(&c).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("campaignRepository Get fail => %+v", err)
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *campaignRepo) Find(ctx context.Context, release device.UUID, status string, p *model.Page) ([]*firmware.Campaign, error) {
+	ctx, span := trace.Start(ctx, "campaignRepository.Find")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	db := r.conn(ctx)
+	if len(release) > 0 {
+		db = db.Where("release_id = ?", release)
+	}
+	if len(status) > 0 {
+		db = db.Where("status = ?", status)
+	}
+	campaigns := []*firmware.Campaign{}
+	err := db.Order("create_time desc, id desc").
+		Limit(p.Limit).Offset(p.Offset).
+		Find(&campaigns).Error
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("campaignRepository Find fail => %+v", err)
+		return nil, err
+	}
+	return campaigns, nil
+}
+
+func (r *campaignRepo) Update(ctx context.Context, c *firmware.Campaign, from []string, wave int) (int64, error) {
+	ctx, span := trace.Start(ctx, "campaignRepository.Update")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	if len(from) == 0 {
+		return 0, nil
+	}
+
+	// the status and the wave are compared and set in one statement, of two
+	// instances moving the campaign on only one does
+	x := r.conn(ctx).Model(&firmware.Campaign{}).
+		Where("id = ? AND status IN (?) AND wave = ?", c.Id, from, wave).
+		Updates(map[string]interface{}{
+			"status":            c.Status,
+			"wave":              c.Wave,
+			"failure_threshold": c.FailureThreshold,
+			"reason":            c.Reason,
+			"update_time":       c.UpdateTime,
+		})
+	if err := x.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("campaignRepository Update fail => %+v", err)
+		return 0, err
+	}
+	return x.RowsAffected, nil
+}
+
+func (r *campaignRepo) AddTargets(ctx context.Context, targets []*firmware.Target) (int64, error) {
+	ctx, span := trace.Start(ctx, "campaignRepository.AddTargets")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	var added int64
+	db := r.conn(ctx)
+	for len(targets) > 0 {
+		n := len(targets)
+		if n > targetsPerInsert {
+			n = targetsPerInsert
+		}
+
+		values := make([]string, 0, n)
+		args := make([]interface{}, 0, 6*n)
+		for _, t := range targets[:n] {
+			values = append(values, "(?, ?, ?, ?, ?, ?)")
+			args = append(args, t.CampaignId, t.DeviceId, t.Wave, t.Status, t.StartTime, t.UpdateTime)
+		}
+		x := db.Exec(targetInsert+strings.Join(values, ", ")+targetConflict, args...)
+		if err := x.Error; err != nil {
+			span.SetError(err)
+			log.WithContext(ctx).Errorf("campaignRepository AddTargets fail => %+v", err)
+			return added, err
+		}
+		added += x.RowsAffected
+		targets = targets[n:]
+	}
+	return added, nil
+}
+
+func (r *campaignRepo) Targets(ctx context.Context, id device.UUID, status string, p *model.Page) ([]*firmware.Target, error) {
+	ctx, span := trace.Start(ctx, "campaignRepository.Targets")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	db := r.conn(ctx).Where("campaign_id = ?", id)
+	if len(status) > 0 {
+		db = db.Where("status = ?", status)
+	}
+	if p != nil {
+		db = db.Limit(p.Limit).Offset(p.Offset)
+	}
+	targets := []*firmware.Target{}
+	if err := db.Order("wave, device_id").Find(&targets).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("campaignRepository Targets fail => %+v", err)
+		return nil, err
+	}
+	return targets, nil
+}
+
+func (r *campaignRepo) SetTargetStatus(ctx context.Context, id, deviceId device.UUID, from, to string, now int64) (int64, error) {
+	ctx, span := trace.Start(ctx, "campaignRepository.SetTargetStatus")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	x := r.conn(ctx).Model(&firmware.Target{}).
+		Where("campaign_id = ? AND device_id = ? AND status = ?", id, deviceId, from).
+		Updates(map[string]interface{}{
+			"status":      to,
+			"update_time": now,
+		})
+	if err := x.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("campaignRepository SetTargetStatus fail => %+v", err)
+		return 0, err
+	}
+	return x.RowsAffected, nil
+}
+
+func (r *campaignRepo) CountTargets(ctx context.Context, id device.UUID) (map[string]int64, error) {
+	ctx, span := trace.Start(ctx, "campaignRepository.CountTargets")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	rows := []*struct {
+		Status string `gorm:"column:status"`
+		Total  int64  `gorm:"column:total"`
+	}{}
+	err := r.conn(ctx).Model(&firmware.Target{}).
+		Select("status, COUNT(*) AS total").
+		Where("campaign_id = ?", id).
+		Group("status").
+		Scan(&rows).Error
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("campaignRepository CountTargets fail => %+v", err)
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, v := range rows {
+		counts[v.Status] = v.Total
+	}
+	return counts, nil
+}
+
+// conn returns the db bound to ctx
+func (r *campaignRepo) conn(ctx context.Context) *gorm.DB {
+	return database.WithContext(r.db, ctx)
+}
+
+func NewCampaignRepo(db *gorm.DB) firmware.CampaignRepository {
+	return &campaignRepo{
+		db: db,
+	}
+}
@@ -0,0 +1,240 @@
+package daos
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github/demo/database"
+	"github/demo/model"
+	"github/demo/model/catalog"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+type catalogRepo struct {
+	db *gorm.DB
+}
+
+func (r *catalogRepo) Get(ctx context.Context, name string) (*catalog.Model, error) {
+	ctx, span := trace.Start(ctx, "catalogRepository.Get")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	var m catalog.Model
+	db := r.conn(ctx)
+	if err := db.Where("lower(name) = lower(?)", name).Find(&m).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("catalogRepository Get fail => %+v", err)
+		return nil, err
+	}
+	if err := attachOptions(db, &m); err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("catalogRepository Get options fail => %+v", err)
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *catalogRepo) Create(ctx context.Context, m *catalog.Model) (*catalog.Model, error) {
+	ctx, span := trace.Start(ctx, "catalogRepository.Create")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	m.CreateTime = now
+	m.UpdateTime = now
+	m.Colors, m.Versions = missing(m.Colors, nil), missing(m.Versions, nil)
+
+	err := database.Transaction(r.conn(ctx), func(tx *gorm.DB) error {
+		if err := tx.Create(m).Error; err != nil {
+			return err
+		}
+		return createOptions(tx, m)
+	})
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("catalogRepository Create fail => %+v", err)
+		return nil, err
+	}
+	return m, nil
+}
+
+func (r *catalogRepo) Update(ctx context.Context, m *catalog.Model) (int64, error) {
+	ctx, span := trace.Start(ctx, "catalogRepository.Update")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	m.UpdateTime = time.Now().UnixNano() / int64(time.Millisecond)
+
+	var affect int64
+	err := database.Transaction(r.conn(ctx), func(tx *gorm.DB) error {
+		x := tx.Model(&catalog.Model{}).Where("name = ?", m.Name).Update("update_time", m.UpdateTime)
+		if x.Error != nil || x.RowsAffected == 0 {
+			return x.Error
+		}
+		affect = x.RowsAffected
+
+		// only the options left out are deleted, those kept may be in use
+		colors := tx.Where("model = ?", m.Name)
+		if len(m.Colors) > 0 {
+			colors = colors.Where("color NOT IN (?)", m.Colors)
+		}
+		if err := colors.Delete(&catalog.Color{}).Error; err != nil {
+			return err
+		}
+		versions := tx.Where("model = ?", m.Name)
+		if len(m.Versions) > 0 {
+			versions = versions.Where("version NOT IN (?)", m.Versions)
+		}
+		if err := versions.Delete(&catalog.Version{}).Error; err != nil {
+			return err
+		}
+
+		current := &catalog.Model{Name: m.Name}
+		if err := attachOptions(tx, current); err != nil {
+			return err
+		}
+		return createOptions(tx, &catalog.Model{
+			Name:     m.Name,
+			Colors:   missing(m.Colors, current.Colors),
+			Versions: missing(m.Versions, current.Versions),
+		})
+	})
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("catalogRepository Update fail => %+v", err)
+		return 0, err
+	}
+	return affect, nil
+}
+
+func (r *catalogRepo) Delete(ctx context.Context, name string) (int64, error) {
+	ctx, span := trace.Start(ctx, "catalogRepository.Delete")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	var affect int64
+	err := database.Transaction(r.conn(ctx), func(tx *gorm.DB) error {
+		if err := tx.Where("model = ?", name).Delete(&catalog.Color{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("model = ?", name).Delete(&catalog.Version{}).Error; err != nil {
+			return err
+		}
+		delete := tx.Where("name = ?", name).Delete(&catalog.Model{})
+		affect = delete.RowsAffected
+		return delete.Error
+	})
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("catalogRepository Delete fail => %+v", err)
+		return 0, err
+	}
+	return affect, nil
+}
+
+func (r *catalogRepo) Find(ctx context.Context, p *model.Page) ([]*catalog.Model, error) {
+	ctx, span := trace.Start(ctx, "catalogRepository.Find")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	db := r.conn(ctx)
+	models := []*catalog.Model{}
+	if err := db.Order("name").Limit(p.Limit).Offset(p.Offset).Find(&models).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("catalogRepository Find fail => %+v", err)
+		return nil, err
+	}
+	if len(models) == 0 {
+		return models, nil
+	}
+
+	names := make([]string, 0, len(models))
+	byName := make(map[string]*catalog.Model, len(models))
+	for _, m := range models {
+		names = append(names, m.Name)
+		byName[m.Name] = m
+		m.Colors, m.Versions = []string{}, []string{}
+	}
+
+	var colors []*catalog.Color
+	if err := db.Where("model IN (?)", names).Order("color").Find(&colors).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("catalogRepository Find colors fail => %+v", err)
+		return nil, err
+	}
+	for _, c := range colors {
+		byName[c.Model].Colors = append(byName[c.Model].Colors, c.Color)
+	}
+	var versions []*catalog.Version
+	if err := db.Where("model IN (?)", names).Order("version").Find(&versions).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("catalogRepository Find versions fail => %+v", err)
+		return nil, err
+	}
+	for _, v := range versions {
+		byName[v.Model].Versions = append(byName[v.Model].Versions, v.Version)
+	}
+	return models, nil
+}
+
+// conn returns the db bound to ctx
+func (r *catalogRepo) conn(ctx context.Context) *gorm.DB {
+	return database.WithContext(r.db, ctx)
+}
+
+// attachOptions reads the colors and the versions of m
+func attachOptions(db *gorm.DB, m *catalog.Model) error {
+	m.Colors, m.Versions = []string{}, []string{}
+	if err := db.Model(&catalog.Color{}).Where("model = ?", m.Name).Order("color").Pluck("color", &m.Colors).Error; err != nil {
+		return err
+	}
+	return db.Model(&catalog.Version{}).Where("model = ?", m.Name).Order("version").Pluck("version", &m.Versions).Error
+}
+
+// createOptions stores the colors and the versions of m
+func createOptions(tx *gorm.DB, m *catalog.Model) error {
+	for _, c := range m.Colors {
+		if err := tx.Create(&catalog.Color{Model: m.Name, Color: c}).Error; err != nil {
+			return err
+		}
+	}
+	for _, v := range m.Versions {
+		if err := tx.Create(&catalog.Version{Model: m.Name, Version: v}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missing returns the values of want not in have, sorted and without
+// duplicates
+func missing(want, have []string) []string {
+	seen := make(map[string]bool, len(have))
+	for _, v := range have {
+		seen[v] = true
+	}
+	re := []string{}
+	for _, v := range want {
+		if !seen[v] {
+			seen[v] = true
+			re = append(re, v)
+		}
+	}
+	sort.Strings(re)
+	return re
+}
+
+func NewCatalogRepo(db *gorm.DB) catalog.Repository {
+	return &catalogRepo{
+		db: db,
+	}
+}
@@ -0,0 +1,164 @@
+package daos
+
+import (
+	"context"
+
+	"github/demo/database"
+	"github/demo/model"
+	"github/demo/model/command"
+	"github/demo/model/device"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+type commandRepo struct {
+	db *gorm.DB
+}
+
+func (r *commandRepo) Create(ctx context.Context, c *command.Command) (*command.Command, error) {
+	ctx, span := trace.Start(ctx, "commandRepository.Create")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	if err := r.conn(ctx).Create(c).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("commandRepository Create fail => %+v", err)
+		return nil, err
+	}
+	return c, nil
+}
+
+func (r *commandRepo) Get(ctx context.Context, id device.UUID) (*command.Command, error) {
+	ctx, span := trace.Start(ctx, "commandRepository.Get")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	c := command.Command{}
+	if err := r.conn(ctx).Where("id = ?", id).Find(&c).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("commandRepository Get fail => %+v", err)
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *commandRepo) Next(ctx context.Context, id device.UUID, now int64) (*command.Command, error) {
+	ctx, span := trace.Start(ctx, "commandRepository.Next")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	commands := []*command.Command{}
+	err := r.conn(ctx).
+		Where("device_id = ? AND status = ? AND expire_time > ?", id, command.StatusPending, now).
+		Order("create_time, id").
+		Limit(1).
+		Find(&commands).Error
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("commandRepository Next fail => %+v", err)
+		return nil, err
+	}
+	if len(commands) == 0 {
+		return nil, nil
+	}
+	return commands[0], nil
+}
+
+func (r *commandRepo) SetStatus(ctx context.Context, id device.UUID, from []string, to, result string, now int64) (int64, error) {
+	ctx, span := trace.Start(ctx, "commandRepository.SetStatus")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	if len(from) == 0 {
+		return 0, nil
+	}
+
+	// the status is compared and set in one statement, of two concurrent
+	// reports from the same status only one moves the command. A command past
+	// its expire time is left to Expire, even before it runs.
+	x := r.conn(ctx).Model(&command.Command{}).Where("id = ? AND status IN (?) AND expire_time > ?", id, from, now).Updates(map[string]interface{}{
+		"status":      to,
+		"result":      result,
+		"update_time": now,
+	})
+	if err := x.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("commandRepository SetStatus fail => %+v", err)
+		return 0, err
+	}
+	return x.RowsAffected, nil
+}
+
+func (r *commandRepo) Find(ctx context.Context, id device.UUID, status string, p *model.Page) ([]*command.Command, error) {
+	ctx, span := trace.Start(ctx, "commandRepository.Find")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	db := r.conn(ctx).Where("device_id = ?", id)
+	if len(status) > 0 {
+		db = db.Where("status = ?", status)
+	}
+	commands := []*command.Command{}
+	err := db.Order("create_time desc, id desc").
+		Limit(p.Limit).Offset(p.Offset).
+		Find(&commands).Error
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("commandRepository Find fail => %+v", err)
+		return nil, err
+	}
+	return commands, nil
+}
+
+func (r *commandRepo) Expire(ctx context.Context, now int64) (int64, error) {
+	ctx, span := trace.Start(ctx, "commandRepository.Expire")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	x := r.conn(ctx).Model(&command.Command{}).
+		Where("status IN (?) AND expire_time <= ?", command.Open, now).
+		Updates(map[string]interface{}{
+			"status":      command.StatusExpired,
+			"update_time": now,
+		})
+	if err := x.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("commandRepository Expire fail => %+v", err)
+		return 0, err
+	}
+	return x.RowsAffected, nil
+}
+
+func (r *commandRepo) Purge(ctx context.Context, before int64) (int64, error) {
+	ctx, span := trace.Start(ctx, "commandRepository.Purge")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	x := r.conn(ctx).Where("status NOT IN (?) AND update_time < ?", command.Open, before).Delete(&command.Command{})
+	if err := x.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("commandRepository Purge fail => %+v", err)
+		return 0, err
+	}
+	return x.RowsAffected, nil
+}
+
+// conn returns the db bound to ctx
+func (r *commandRepo) conn(ctx context.Context) *gorm.DB {
+	return database.WithContext(r.db, ctx)
+}
+
+func NewCommandRepo(db *gorm.DB) command.Repository {
+	return &commandRepo{
+		db: db,
+	}
+}
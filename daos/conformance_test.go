@@ -0,0 +1,281 @@
+package daos_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github/demo/config"
+	"github/demo/daos"
+	"github/demo/database"
+	"github/demo/database/dialects"
+	"github/demo/model/catalog"
+	"github/demo/model/command"
+	"github/demo/model/device"
+	"github/demo/model/firmware"
+	"github/demo/model/group"
+	"github/demo/model/telemetry"
+	"github/demo/test/conformance"
+)
+
+// testDSN opts in to the Postgres backend, a key=value connection string of a
+// server the tests may create databases on, e.g.
+// "host=localhost port=5432 user=postgres password=postgres dbname=postgres"
+const testDSN = "DB_TEST_DSN"
+
+// opener returns a database holding only the migrated tables of a suite and
+// the func releasing it
+type opener func(t *testing.T) (*gorm.DB, func(t *testing.T))
+
+// eachBackend runs suite against a new SQLite file per case and, when
+// DB_TEST_DSN is set, against a throwaway Postgres database made for the run
+// and dropped after it. The configured database of the app is never touched.
+func eachBackend(t *testing.T, tables []interface{}, suite func(t *testing.T, open opener)) {
+	t.Run("Sqlite", func(t *testing.T) {
+		suite(t, func(t *testing.T) (*gorm.DB, func(t *testing.T)) {
+			db, teardown := setupSqlite(t)
+			db.GetDB().AutoMigrate(tables...)
+			return db.GetDB(), teardown
+		})
+	})
+
+	t.Run("Postgres", func(t *testing.T) {
+		dsn := os.Getenv(testDSN)
+		if len(dsn) == 0 {
+			t.Skip(testDSN + " is not set")
+		}
+		db, teardown := setupPostgres(t, dsn)
+		defer teardown(t)
+
+		suite(t, func(t *testing.T) (*gorm.DB, func(t *testing.T)) {
+			resetSchema(t, db.GetDB())
+			db.GetDB().AutoMigrate(tables...)
+			return db.GetDB(), func(t *testing.T) {}
+		})
+	})
+}
+
+func TestDeviceRepository(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		conformance.DeviceRepository(t, func(t *testing.T, devices ...*device.Device) (device.Repository, func(t *testing.T)) {
+			return daos.NewMemoryDeviceRepo(devices...), func(t *testing.T) {}
+		})
+	})
+	eachBackend(t, []interface{}{&device.Device{}, &device.Label{}, &device.Member{}}, func(t *testing.T, open opener) {
+		conformance.DeviceRepository(t, func(t *testing.T, devices ...*device.Device) (device.Repository, func(t *testing.T)) {
+			db, teardown := open(t)
+			for _, d := range devices {
+				db.Create(d)
+			}
+			return daos.NewDeviceRepo(db), teardown
+		})
+	})
+}
+
+func TestHistoryRepository(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		conformance.HistoryRepository(t, func(t *testing.T) (device.HistoryRepository, func(t *testing.T)) {
+			return daos.NewMemoryHistoryRepo(), func(t *testing.T) {}
+		})
+	})
+	eachBackend(t, []interface{}{&device.History{}}, func(t *testing.T, open opener) {
+		conformance.HistoryRepository(t, func(t *testing.T) (device.HistoryRepository, func(t *testing.T)) {
+			db, teardown := open(t)
+			return daos.NewHistoryRepo(db), teardown
+		})
+	})
+}
+
+func TestGroupRepository(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		conformance.GroupRepository(t, func(t *testing.T) (group.Repository, func(t *testing.T)) {
+			return daos.NewMemoryGroupRepo(), func(t *testing.T) {}
+		})
+	})
+	eachBackend(t, []interface{}{&group.Group{}}, func(t *testing.T, open opener) {
+		conformance.GroupRepository(t, func(t *testing.T) (group.Repository, func(t *testing.T)) {
+			db, teardown := open(t)
+			return daos.NewGroupRepo(db), teardown
+		})
+	})
+}
+
+func TestCatalogRepository(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		conformance.CatalogRepository(t, func(t *testing.T) (catalog.Repository, func(t *testing.T)) {
+			return daos.NewMemoryCatalogRepo(), func(t *testing.T) {}
+		})
+	})
+	eachBackend(t, []interface{}{&catalog.Model{}, &catalog.Color{}, &catalog.Version{}}, func(t *testing.T, open opener) {
+		conformance.CatalogRepository(t, func(t *testing.T) (catalog.Repository, func(t *testing.T)) {
+			db, teardown := open(t)
+			return daos.NewCatalogRepo(db), teardown
+		})
+	})
+}
+
+func TestTelemetryRepository(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		conformance.TelemetryRepository(t, func(t *testing.T) (telemetry.Repository, func(t *testing.T)) {
+			return daos.NewMemoryTelemetryRepo(), func(t *testing.T) {}
+		})
+	})
+	eachBackend(t, []interface{}{&telemetry.Point{}, &telemetry.Rollup{}}, func(t *testing.T, open opener) {
+		conformance.TelemetryRepository(t, func(t *testing.T) (telemetry.Repository, func(t *testing.T)) {
+			db, teardown := open(t)
+			return daos.NewTelemetryRepo(db), teardown
+		})
+	})
+}
+
+func TestCommandRepository(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		conformance.CommandRepository(t, func(t *testing.T) (command.Repository, func(t *testing.T)) {
+			return daos.NewMemoryCommandRepo(), func(t *testing.T) {}
+		})
+	})
+	eachBackend(t, []interface{}{&command.Command{}}, func(t *testing.T, open opener) {
+		conformance.CommandRepository(t, func(t *testing.T) (command.Repository, func(t *testing.T)) {
+			db, teardown := open(t)
+			return daos.NewCommandRepo(db), teardown
+		})
+	})
+}
+
+func TestFirmwareRepository(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		conformance.FirmwareRepository(t, func(t *testing.T) (firmware.Repository, func(t *testing.T)) {
+			return daos.NewMemoryFirmwareRepo(), func(t *testing.T) {}
+		})
+	})
+	eachBackend(t, []interface{}{&firmware.Release{}}, func(t *testing.T, open opener) {
+		conformance.FirmwareRepository(t, func(t *testing.T) (firmware.Repository, func(t *testing.T)) {
+			db, teardown := open(t)
+			return daos.NewFirmwareRepo(db), teardown
+		})
+	})
+}
+
+func TestCampaignRepository(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		conformance.CampaignRepository(t, func(t *testing.T) (firmware.CampaignRepository, func(t *testing.T)) {
+			return daos.NewMemoryCampaignRepo(), func(t *testing.T) {}
+		})
+	})
+	eachBackend(t, []interface{}{&firmware.Campaign{}, &firmware.Target{}}, func(t *testing.T, open opener) {
+		conformance.CampaignRepository(t, func(t *testing.T) (firmware.CampaignRepository, func(t *testing.T)) {
+			db, teardown := open(t)
+			return daos.NewCampaignRepo(db), teardown
+		})
+	})
+}
+
+func TestKeyRepository(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		conformance.KeyRepository(t, func(t *testing.T) (firmware.KeyRepository, func(t *testing.T)) {
+			return daos.NewMemoryKeyRepo(), func(t *testing.T) {}
+		})
+	})
+	eachBackend(t, []interface{}{&firmware.Key{}}, func(t *testing.T, open opener) {
+		conformance.KeyRepository(t, func(t *testing.T) (firmware.KeyRepository, func(t *testing.T)) {
+			db, teardown := open(t)
+			return daos.NewKeyRepo(db), teardown
+		})
+	})
+}
+
+// setupSqlite opens a database in a new SQLite file
+func setupSqlite(t *testing.T) (database.IDatabase, func(t *testing.T)) {
+	name := filepath.Join(os.TempDir(), "gorm"+uuid.Must(uuid.NewV4()).String()+".db")
+	df, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if df == nil || err != nil {
+		panic(fmt.Sprintf("No error should happen when creating db file, but got %+v", err))
+	}
+
+	db, err := database.NewDatabase(context.Background(), &config.Database{
+		Dialect: "sqlite",
+		Host:    df.Name(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, func(t *testing.T) {
+		db.Close()
+		os.Remove(df.Name())
+	}
+}
+
+// setupPostgres creates a database named after a new uuid on the server of
+// dsn, the teardown drops it
+func setupPostgres(t *testing.T, dsn string) (database.IDatabase, func(t *testing.T)) {
+	c := postgresConfig(dsn)
+	admin, err := database.NewDatabase(context.Background(), c)
+	if err != nil {
+		t.Fatalf("connect postgres fail => %+v", err)
+	}
+
+	name := "demo_test_" + strings.Replace(uuid.Must(uuid.NewV4()).String(), "-", "", -1)
+	if err := admin.GetDB().Exec("CREATE DATABASE " + name).Error; err != nil {
+		admin.Close()
+		t.Fatalf("create database %s fail => %+v", name, err)
+	}
+
+	x := *c
+	x.Name = name
+	db, err := database.NewDatabase(context.Background(), &x)
+	if err != nil {
+		admin.GetDB().Exec("DROP DATABASE IF EXISTS " + name)
+		admin.Close()
+		t.Fatalf("connect postgres fail => %+v", err)
+	}
+	return db, func(t *testing.T) {
+		db.Close()
+		if err := admin.GetDB().Exec("DROP DATABASE IF EXISTS " + name).Error; err != nil {
+			t.Errorf("drop database %s fail => %+v", name, err)
+		}
+		admin.Close()
+	}
+}
+
+// resetSchema empties a throwaway database between the cases of a suite
+func resetSchema(t *testing.T, db *gorm.DB) {
+	if err := db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public").Error; err != nil {
+		t.Fatalf("reset schema fail => %+v", err)
+	}
+}
+
+// postgresConfig reads the host, port, user, password and dbname of a
+// key=value connection string
+func postgresConfig(dsn string) *config.Database {
+	c := &config.Database{
+		Dialect: dialects.Postgres.String(),
+		Host:    "localhost",
+		Port:    "5432",
+		Name:    "postgres",
+	}
+	for _, f := range strings.Fields(dsn) {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "host":
+			c.Host = kv[1]
+		case "port":
+			c.Port = kv[1]
+		case "user":
+			c.User = kv[1]
+		case "password":
+			c.Password = kv[1]
+		case "dbname":
+			c.Name = kv[1]
+		}
+	}
+	return c
+}
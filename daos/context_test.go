@@ -0,0 +1,180 @@
+package daos_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/config"
+	"github/demo/daos"
+	"github/demo/database"
+	"github/demo/model"
+	"github/demo/model/device"
+)
+
+func TestDeviceDaos_Context(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	s.db.GetDB().DropTable(&device.Device{})
+	s.db.GetDB().AutoMigrate(&device.Device{})
+	s.db.GetDB().Create(GetDevice1())
+
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tt := []struct {
+		name string
+		ctx  context.Context
+		err  error
+	}{
+		{
+			name: "deadline exceeded",
+			ctx:  expired,
+			err:  context.DeadlineExceeded,
+		},
+		{
+			name: "canceled",
+			ctx:  canceled,
+			err:  context.Canceled,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.deviceRepo.Get(tc.ctx, GetDevice1().Id)
+			assert.Equal(t, tc.err, err)
+
+			_, err = s.deviceRepo.Find(tc.ctx, &device.Device{}, &model.Page{Limit: 10})
+			assert.Equal(t, tc.err, err)
+
+			_, err = s.deviceRepo.Create(tc.ctx, GetDevice2())
+			assert.Equal(t, tc.err, err)
+
+			_, err = s.deviceRepo.Delete(tc.ctx, GetDevice1().Id)
+			assert.Equal(t, tc.err, err)
+
+			// nothing was written
+			devices, err := s.deviceRepo.List(context.Background(), &device.Device{})
+			assert.NoError(t, err)
+			assert.Equal(t, []*device.Device{GetDevice1()}, devices)
+		})
+	}
+}
+
+func TestDeviceDaos_QueryTimeout(t *testing.T) {
+	name := filepath.Join(os.TempDir(), "gorm"+uuid.Must(uuid.NewV4()).String()+".db")
+	df, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if df == nil || err != nil {
+		panic(fmt.Sprintf("No error should happen when creating db file, but got %+v", err))
+	}
+	defer os.Remove(df.Name())
+
+	db, err := database.NewDatabase(context.Background(), &config.Database{
+		Dialect:      "sqlite",
+		Host:         df.Name(),
+		QueryTimeout: "1ns",
+	})
+	assert.NoError(t, err)
+	defer db.Close()
+	db.GetDB().AutoMigrate(&device.Device{})
+
+	repo := daos.NewDeviceRepo(db.GetDB())
+	_, err = repo.Get(context.Background(), GetDevice1().Id)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	err = repo.Iterate(context.Background(), &device.Device{}, nil, func(*device.Device) error { return nil })
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// the deadline of the caller wins over the default
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err = repo.Get(ctx, GetDevice1().Id)
+	assert.EqualError(t, err, "record not found")
+
+	// the timeout bounds the query of Iterate, not the rows streamed to a
+	// slow fn
+	slow, err := database.NewDatabase(context.Background(), &config.Database{
+		Dialect:      "sqlite",
+		Host:         df.Name(),
+		QueryTimeout: "50ms",
+	})
+	assert.NoError(t, err)
+	defer slow.Close()
+	slow.GetDB().Create(GetDevice1())
+	slow.GetDB().Create(GetDevice2())
+
+	visited := 0
+	err = daos.NewDeviceRepo(slow.GetDB()).Iterate(context.Background(), &device.Device{}, nil, func(*device.Device) error {
+		time.Sleep(100 * time.Millisecond)
+		visited++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, visited)
+
+	_, err = database.NewDatabase(context.Background(), &config.Database{
+		Dialect:      "sqlite",
+		Host:         df.Name(),
+		QueryTimeout: "soon",
+	})
+	assert.EqualError(t, err, `Database query timeout invalid: "soon"`)
+}
+
+func TestWithContext(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	// counts long enough to be cancelled while it runs
+	count := `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000)
+		SELECT count(*) FROM c`
+
+	tt := []struct {
+		name string
+		run  func(db *gorm.DB) error
+	}{
+		{
+			name: "query",
+			run: func(db *gorm.DB) error {
+				var n int64
+				return db.Raw(count).Row().Scan(&n)
+			},
+		},
+		{
+			name: "exec",
+			run: func(db *gorm.DB) error {
+				return db.Exec("CREATE TEMP TABLE counted AS " + count).Error
+			},
+		},
+		{
+			name: "transaction",
+			run: func(db *gorm.DB) error {
+				return database.Transaction(db, func(tx *gorm.DB) error {
+					return tx.Exec("CREATE TEMP TABLE counted AS " + count).Error
+				})
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			timer := time.AfterFunc(50*time.Millisecond, cancel)
+			defer timer.Stop()
+
+			start := time.Now()
+			err := tc.run(database.WithContext(s.db.GetDB(), ctx))
+			assert.Equal(t, context.Canceled, err)
+			assert.True(t, time.Since(start) < 5*time.Second, "the statement ran to its end")
+		})
+	}
+}
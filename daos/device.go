@@ -1,12 +1,16 @@
 package daos
 
 import (
+	"context"
+	"sort"
 	"time"
 
+	"github/demo/database"
 	"github/demo/model"
 	"github/demo/model/device"
 	"github/demo/utils"
 	"github/demo/utils/log"
+	"github/demo/utils/trace"
 
 	"github.com/jinzhu/gorm"
 )
@@ -16,30 +20,50 @@ type deviceRepo struct {
 	db   *gorm.DB
 }
 
-func (r *deviceRepo) Get(id device.UUID) (*device.Device, error) {
+func (r *deviceRepo) Get(ctx context.Context, id device.UUID) (*device.Device, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.Get")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
 	var d device.Device
 
-	if err := r.db.Where("id = ?", id).Find(&d).Error; err != nil {
-		log.Errorf("deviceRepository Get fail => %+v", err)
+	if err := r.conn(ctx).Where("id = ?", id).Find(&d).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository Get fail => %+v", err)
 		return nil, err
 	}
 
 	return &d, nil
 }
 
-func (r *deviceRepo) Create(d *device.Device) (*device.Device, error) {
+func (r *deviceRepo) Create(ctx context.Context, d *device.Device) (*device.Device, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.Create")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
 	d.CreateTime = time.Now().UnixNano() / int64(time.Millisecond)
+	if len(d.State) == 0 {
+		d.State = device.StateProvisioned
+	}
 
-	md := r.db.Create(d)
+	md := r.conn(ctx).Create(d)
 	if err := md.Error; err != nil {
-		log.Errorf("deviceRepository Create fail => %+v", err)
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository Create fail => %+v", err)
 		return nil, err
 	}
 	x := md.Value.(*device.Device)
 	return x, nil
 }
 
-func (r *deviceRepo) Update(d *device.Device) (*device.Device, int64, error) {
+func (r *deviceRepo) Update(ctx context.Context, d *device.Device) (*device.Device, int64, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.Update")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
 	if d == nil {
 		return nil, 0, nil
 	}
@@ -56,9 +80,10 @@ func (r *deviceRepo) Update(d *device.Device) (*device.Device, int64, error) {
 	umap := utils.Map(d)
 
 	re := &device.Device{}
-	x := r.Query("id = ?", d.Id).Model(re).Updates(umap)
+	x := r.conn(ctx).Where("id = ?", d.Id).Model(re).Updates(umap)
 	if err := x.Error; err != nil {
-		log.Errorf("[DB][device] update Info error: %+v", err)
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("[DB][device] update Info error: %+v", err)
 		return nil, 0, err
 	}
 	affectRow := x.RowsAffected
@@ -70,34 +95,388 @@ func (r *deviceRepo) Update(d *device.Device) (*device.Device, int64, error) {
 	return re, affectRow, nil
 }
 
-func (r *deviceRepo) Delete(id device.UUID) (int64, error) {
-	delete := r.db.Where("id = ?", id).Delete(&device.Device{})
+func (r *deviceRepo) Delete(ctx context.Context, id device.UUID) (int64, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.Delete")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	delete := r.conn(ctx).Where("id = ?", id).Delete(&device.Device{})
 	row := delete.RowsAffected
 	var err error
 	if err = delete.Error; err != nil {
-		log.Errorf("deviceRepository Delete fail => %+v", err)
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository Delete fail => %+v", err)
 	}
 	return row, err
 }
 
-func (r *deviceRepo) List(d *device.Device) ([]*device.Device, error) {
+func (r *deviceRepo) List(ctx context.Context, d *device.Device) ([]*device.Device, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.List")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
 	var devices []*device.Device
-	if err := r.db.Where(d).Find(&devices).Error; err != nil {
-		log.Errorf("deviceRepository List fail => %+v", err)
+	if err := selectSeen(selectMembers(selectLabels(r.conn(ctx).Where(d), d), d), d).Find(&devices).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository List fail => %+v", err)
 		return nil, err
 	}
 	return devices, nil
 }
 
-func (r *deviceRepo) Find(d *device.Device, p *model.Page) ([]*device.Device, error) {
+func (r *deviceRepo) Find(ctx context.Context, d *device.Device, p *model.Page) ([]*device.Device, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.Find")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
 	var devices []*device.Device
-	if err := r.db.Where(d).Limit(p.Limit).Offset(p.Offset).Find(&devices).Error; err != nil {
-		log.Errorf("deviceRepository Find fail => %+v", err)
+	if err := selectSeen(selectMembers(selectLabels(r.conn(ctx).Where(d), d), d), d).Limit(p.Limit).Offset(p.Offset).Find(&devices).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository Find fail => %+v", err)
 		return nil, err
 	}
 	return devices, nil
 }
 
+func (r *deviceRepo) Iterate(ctx context.Context, d *device.Device, p *model.Page, fn func(*device.Device) error) error {
+	ctx, span := trace.Start(ctx, "deviceRepository.Iterate")
+	defer span.Finish()
+	// the query timeout bounds the query only, the rows are streamed at the
+	// pace of fn for as long as ctx lasts
+	ctx, started, cancel := database.WithStartTimeout(ctx, r.db)
+	defer cancel()
+
+	db := r.conn(ctx)
+	q := selectSeen(selectMembers(selectLabels(db.Model(&device.Device{}).Where(d), d), d), d)
+	if p != nil && p.Limit > 0 {
+		q = q.Limit(p.Limit).Offset(p.Offset)
+	}
+	rows, err := q.Rows()
+	if e := started(); e != nil {
+		if err == nil {
+			rows.Close()
+		}
+		err = e
+	}
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository Iterate fail => %+v", err)
+		return err
+	}
+	defer rows.Close()
+
+	total := 0
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			span.SetError(err)
+			log.WithContext(ctx).Errorf("deviceRepository Iterate fail => %+v", err)
+			return err
+		}
+		x := &device.Device{}
+		if err := db.ScanRows(rows, x); err != nil {
+			span.SetError(err)
+			log.WithContext(ctx).Errorf("deviceRepository Iterate scan fail => %+v", err)
+			return err
+		}
+		if err := fn(x); err != nil {
+			return err
+		}
+		total++
+	}
+	span.SetAttribute("device.count", total)
+
+	if err := rows.Err(); err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository Iterate fail => %+v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *deviceRepo) Count(ctx context.Context) ([]*device.Count, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.Count")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	var counts []*device.Count
+	err := r.conn(ctx).Model(&device.Device{}).
+		Select("model, version, count(*) as total").
+		Group("model, version").
+		Order("model, version").
+		Scan(&counts).Error
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository Count fail => %+v", err)
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func (r *deviceRepo) SetLabels(ctx context.Context, id device.UUID, labels map[string]string) error {
+	ctx, span := trace.Start(ctx, "deviceRepository.SetLabels")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	err := database.Transaction(r.conn(ctx), func(tx *gorm.DB) error {
+		if err := tx.Where("device_id = ? AND label_key IN (?)", id, keys).Delete(&device.Label{}).Error; err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := tx.Create(&device.Label{DeviceId: id, Key: k, Value: labels[k]}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository SetLabels fail => %+v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *deviceRepo) RemoveLabels(ctx context.Context, id device.UUID, keys ...string) (int64, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.RemoveLabels")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	q := r.conn(ctx).Where("device_id = ?", id)
+	if len(keys) > 0 {
+		q = q.Where("label_key IN (?)", keys)
+	}
+	delete := q.Delete(&device.Label{})
+	if err := delete.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository RemoveLabels fail => %+v", err)
+		return 0, err
+	}
+	return delete.RowsAffected, nil
+}
+
+func (r *deviceRepo) Labels(ctx context.Context, ids ...device.UUID) (map[device.UUID]map[string]string, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.Labels")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	labels := make(map[device.UUID]map[string]string)
+	if len(ids) == 0 {
+		return labels, nil
+	}
+
+	var rows []*device.Label
+	if err := r.conn(ctx).Where("device_id IN (?)", ids).Find(&rows).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository Labels fail => %+v", err)
+		return nil, err
+	}
+	for _, l := range rows {
+		if labels[l.DeviceId] == nil {
+			labels[l.DeviceId] = make(map[string]string)
+		}
+		labels[l.DeviceId][l.Key] = l.Value
+	}
+	return labels, nil
+}
+
+func (r *deviceRepo) AddMembers(ctx context.Context, group device.UUID, ids ...device.UUID) error {
+	ctx, span := trace.Start(ctx, "deviceRepository.AddMembers")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	err := database.Transaction(r.conn(ctx), func(tx *gorm.DB) error {
+		var existing []device.UUID
+		if err := tx.Model(&device.Member{}).Where("group_id = ? AND device_id IN (?)", group, ids).Pluck("device_id", &existing).Error; err != nil {
+			return err
+		}
+		member := make(map[device.UUID]bool, len(existing))
+		for _, id := range existing {
+			member[id] = true
+		}
+		for _, id := range ids {
+			if member[id] {
+				continue
+			}
+			member[id] = true
+			if err := tx.Create(&device.Member{GroupId: group, DeviceId: id}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository AddMembers fail => %+v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *deviceRepo) RemoveMembers(ctx context.Context, group device.UUID, ids ...device.UUID) (int64, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.RemoveMembers")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	q := r.conn(ctx).Where("group_id = ?", group)
+	if len(ids) > 0 {
+		q = q.Where("device_id IN (?)", ids)
+	}
+	delete := q.Delete(&device.Member{})
+	if err := delete.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository RemoveMembers fail => %+v", err)
+		return 0, err
+	}
+	return delete.RowsAffected, nil
+}
+
+func (r *deviceRepo) SetState(ctx context.Context, id device.UUID, from []string, to string) (int64, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.SetState")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	if len(from) == 0 {
+		return 0, nil
+	}
+
+	// the state is compared and set in one statement, of two concurrent
+	// transitions from the same state only one moves the device
+	x := r.conn(ctx).Model(&device.Device{}).Where("id = ? AND state IN (?)", id, from).Updates(map[string]interface{}{
+		"state":       to,
+		"update_time": time.Now().UnixNano() / int64(time.Millisecond),
+	})
+	if err := x.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository SetState fail => %+v", err)
+		return 0, err
+	}
+	return x.RowsAffected, nil
+}
+
+func (r *deviceRepo) Heartbeat(ctx context.Context, id device.UUID, seen int64, firmware string) (int64, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.Heartbeat")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	// a heartbeat isn't a change of the device, its update time is kept
+	columns := map[string]interface{}{
+		"last_seen": seen,
+	}
+	if len(firmware) > 0 {
+		columns["firmware"] = firmware
+	}
+	x := r.conn(ctx).Model(&device.Device{}).Where("id = ?", id).UpdateColumns(columns)
+	if err := x.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository Heartbeat fail => %+v", err)
+		return 0, err
+	}
+	return x.RowsAffected, nil
+}
+
+func (r *deviceRepo) AdvanceShadow(ctx context.Context, id device.UUID, from int64, desired *device.Desired) (int64, error) {
+	ctx, span := trace.Start(ctx, "deviceRepository.AdvanceShadow")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	// the version is compared and set in one statement, of two concurrent
+	// changes of the same version only one is applied
+	columns := map[string]interface{}{
+		"shadow_version": from + 1,
+	}
+	if desired != nil {
+		columns["desired_color"] = desired.Color
+		columns["desired_version"] = desired.Version
+		columns["update_time"] = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	x := r.conn(ctx).Model(&device.Device{}).Where("id = ? AND shadow_version = ?", id, from).UpdateColumns(columns)
+	if err := x.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("deviceRepository AdvanceShadow fail => %+v", err)
+		return 0, err
+	}
+	return x.RowsAffected, nil
+}
+
+// selectSeen narrows db down to the devices last seen in d.Seen
+func selectSeen(db *gorm.DB, d *device.Device) *gorm.DB {
+	if d == nil || d.Seen == nil {
+		return db
+	}
+	if d.Seen.Since != 0 {
+		db = db.Where("last_seen >= ?", d.Seen.Since)
+	}
+	if d.Seen.Before != 0 {
+		db = db.Where("last_seen < ?", d.Seen.Before)
+	}
+	return db
+}
+
+// selectMembers narrows db down to the members of the groups of
+// d.Membership
+func selectMembers(db *gorm.DB, d *device.Device) *gorm.DB {
+	if d == nil || d.Membership == nil {
+		return db
+	}
+	if len(d.Membership.GroupIds) == 0 {
+		return db.Where("1 = 0")
+	}
+	return db.Where("id IN (SELECT device_id FROM device_group_member WHERE group_id IN (?))", d.Membership.GroupIds)
+}
+
+// selectLabels narrows db down to the devices selected by d.Selector, each
+// requirement is a subquery on the label index
+func selectLabels(db *gorm.DB, d *device.Device) *gorm.DB {
+	if d == nil || d.Selector == nil {
+		return db
+	}
+
+	for _, req := range d.Selector.Requirements {
+		sub := "SELECT device_id FROM device_label WHERE label_key = ?"
+		args := []interface{}{req.Key}
+		if len(req.Values) > 0 {
+			sub += " AND label_value IN (?)"
+			args = append(args, req.Values)
+		}
+
+		switch req.Operator {
+		case device.Exists, device.Equals, device.In:
+			db = db.Where("id IN ("+sub+")", args...)
+		default:
+			db = db.Where("id NOT IN ("+sub+")", args...)
+		}
+	}
+	return db
+}
+
+// conn returns the db bound to ctx
+func (r *deviceRepo) conn(ctx context.Context) *gorm.DB {
+	return database.WithContext(r.db, ctx)
+}
+
 func (r *deviceRepo) Query(query interface{}, args ...interface{}) *gorm.DB {
 	return r.db.Where(query, args...)
 }
@@ -1,6 +1,7 @@
 package daos_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -37,7 +38,7 @@ func setupDeviceTestCaseSuite(t *testing.T) (DeviceTestCaseSuite, func(t *testin
 		Host:    df.Name(),
 	}
 
-	s.db, err = database.NewDatabase(c)
+	s.db, err = database.NewDatabase(context.Background(), c)
 	s.deviceRepo = daos.NewDeviceRepo(s.db.GetDB())
 	return s, func(t *testing.T) {
 		s.db.Close()
@@ -123,7 +124,7 @@ func TestDeviceDaos_Get(t *testing.T) {
 			teardownSubTest := tc.setupTestCase(t)
 			defer teardownSubTest(t)
 
-			p, err := s.deviceRepo.Get(tc.id)
+			p, err := s.deviceRepo.Get(context.Background(), tc.id)
 			if err != nil {
 				assert.EqualError(t, err, tc.err.Error(), "An error was expected")
 			} else {
@@ -164,11 +165,13 @@ func TestDeviceDaos_Create(t *testing.T) {
 			teardownSubTest := tc.setupTestCase(t)
 			defer teardownSubTest(t)
 
-			p, err := s.deviceRepo.Create(tc.testData)
+			p, err := s.deviceRepo.Create(context.Background(), tc.testData)
 			if err != nil {
 				assert.EqualError(t, err, tc.err.Error(), "An error was expected")
 			} else {
 				tc.wantResult.CreateTime = p.CreateTime
+				// a new device is provisioned
+				tc.wantResult.State = device.StateProvisioned
 				assert.Equal(t, p, tc.wantResult)
 			}
 		})
@@ -224,12 +227,12 @@ func TestDeviceDaos_Update(t *testing.T) {
 			teardownSubTest := tc.setupTestCase(t)
 			defer teardownSubTest(t)
 
-			device, affected, err := s.deviceRepo.Update(tc.testData)
+			device, affected, err := s.deviceRepo.Update(context.Background(), tc.testData)
 			assert.Equal(t, tc.err, err)
 			assert.Equal(t, tc.rowAffected, affected)
 			if err == nil && device != nil {
 				tc.wantResult.UpdateTime = device.UpdateTime
-				d, _ := s.deviceRepo.Get(tc.testData.Id)
+				d, _ := s.deviceRepo.Get(context.Background(), tc.testData.Id)
 				assert.Equal(t, tc.testData, d)
 			}
 		})
@@ -282,7 +285,7 @@ func TestDeviceDaos_Delete(t *testing.T) {
 			teardownSubTest := tc.setupTestCase(t)
 			defer teardownSubTest(t)
 
-			affected, err := s.deviceRepo.Delete(tc.id)
+			affected, err := s.deviceRepo.Delete(context.Background(), tc.id)
 			assert.Equal(t, tc.err, err)
 			assert.Equal(t, tc.rowAffected, affected)
 		})
@@ -350,7 +353,7 @@ func TestDeviceDaos_List(t *testing.T) {
 			teardownSubTest := tc.setupTestCase(t)
 			defer teardownSubTest(t)
 
-			devices, err := s.deviceRepo.List(tc.testData)
+			devices, err := s.deviceRepo.List(context.Background(), tc.testData)
 			if err != nil {
 				assert.EqualError(t, err, tc.err.Error(), "An error was expected")
 			} else {
@@ -427,7 +430,7 @@ func TestDeviceDaos_Find(t *testing.T) {
 			teardownSubTest := tc.setupTestCase(t)
 			defer teardownSubTest(t)
 
-			devices, err := s.deviceRepo.Find(tc.testData, tc.testPage)
+			devices, err := s.deviceRepo.Find(context.Background(), tc.testData, tc.testPage)
 			if err != nil {
 				assert.EqualError(t, err, tc.err.Error(), "An error was expected")
 			} else {
@@ -436,3 +439,60 @@ func TestDeviceDaos_Find(t *testing.T) {
 		})
 	}
 }
+
+func TestDeviceDaos_Count(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	tt := []struct {
+		name          string
+		wantResult    []*device.Count
+		err           error
+		setupTestCase test.SetupSubTest
+	}{
+		{
+			name:       "no data",
+			wantResult: []*device.Count{},
+			err:        nil,
+			setupTestCase: func(t *testing.T) func(t *testing.T) {
+				s.db.GetDB().DropTable(&device.Device{})
+				s.db.GetDB().AutoMigrate(&device.Device{})
+
+				return func(t *testing.T) {
+				}
+			},
+		},
+		{
+			name: "group by model and version",
+			wantResult: []*device.Count{
+				{Model: "Normal", Version: "v1.2", Total: 1},
+				{Model: "Pro", Version: "v1.2", Total: 1},
+				{Model: "Pro", Version: "v1.5", Total: 1},
+			},
+			err: nil,
+			setupTestCase: func(t *testing.T) func(t *testing.T) {
+				s.db.GetDB().DropTable(&device.Device{})
+				s.db.GetDB().AutoMigrate(&device.Device{})
+				s.db.GetDB().Create(GetDevice1())
+				s.db.GetDB().Create(GetDevice2())
+				d := UpdateDevice1()
+				d.Id = "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60"
+				s.db.GetDB().Create(d)
+
+				return func(t *testing.T) {
+				}
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			teardownSubTest := tc.setupTestCase(t)
+			defer teardownSubTest(t)
+
+			counts, err := s.deviceRepo.Count(context.Background())
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.wantResult, counts)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package daos
+
+import (
+	"context"
+
+	"github/demo/database"
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/model/firmware"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+type firmwareRepo struct {
+	db *gorm.DB
+}
+
+func (r *firmwareRepo) Create(ctx context.Context, x *firmware.Release) (*firmware.Release, error) {
+	ctx, span := trace.Start(ctx, "firmwareRepository.Create")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	if err := r.conn(ctx).Create(x).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("firmwareRepository Create fail => %+v", err)
+		return nil, err
+	}
+	return x, nil
+}
+
+func (r *firmwareRepo) Get(ctx context.Context, id device.UUID) (*firmware.Release, error) {
+	ctx, span := trace.Start(ctx, "firmwareRepository.Get")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	x := firmware.Release{}
+	if err := r.conn(ctx).Where("id = ?", id).Find(&x).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("firmwareRepository Get fail => %+v", err)
+		return nil, err
+	}
+	return &x, nil
+}
+
+func (r *firmwareRepo) Find(ctx context.Context, m, version string, p *model.Page) ([]*firmware.Release, error) {
+	ctx, span := trace.Start(ctx, "firmwareRepository.Find")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	db := r.conn(ctx)
+	if len(m) > 0 {
+		db = db.Where("model = ?", m)
+	}
+	if len(version) > 0 {
+		db = db.Where("version = ?", version)
+	}
+	releases := []*firmware.Release{}
+	err := db.Order("create_time desc, id desc").
+		Limit(p.Limit).Offset(p.Offset).
+		Find(&releases).Error
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("firmwareRepository Find fail => %+v", err)
+		return nil, err
+	}
+	return releases, nil
+}
+
+func (r *firmwareRepo) Delete(ctx context.Context, id device.UUID) (int64, error) {
+	ctx, span := trace.Start(ctx, "firmwareRepository.Delete")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	x := r.conn(ctx).Where("id = ?", id).Delete(&firmware.Release{})
+	if err := x.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("firmwareRepository Delete fail => %+v", err)
+		return 0, err
+	}
+	return x.RowsAffected, nil
+}
+
+// conn returns the db bound to ctx
+func (r *firmwareRepo) conn(ctx context.Context) *gorm.DB {
+	return database.WithContext(r.db, ctx)
+}
+
+func NewFirmwareRepo(db *gorm.DB) firmware.Repository {
+	return &firmwareRepo{
+		db: db,
+	}
+}
@@ -0,0 +1,155 @@
+package daos
+
+import (
+	"context"
+	"time"
+
+	"github/demo/database"
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/model/group"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+type groupRepo struct {
+	db *gorm.DB
+}
+
+func (r *groupRepo) Get(ctx context.Context, id device.UUID) (*group.Group, error) {
+	ctx, span := trace.Start(ctx, "groupRepository.Get")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	var g group.Group
+	if err := r.conn(ctx).Where("id = ?", id).Find(&g).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("groupRepository Get fail => %+v", err)
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (r *groupRepo) Create(ctx context.Context, g *group.Group) (*group.Group, error) {
+	ctx, span := trace.Start(ctx, "groupRepository.Create")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	g.CreateTime = now
+	g.UpdateTime = now
+
+	if err := r.conn(ctx).Create(g).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("groupRepository Create fail => %+v", err)
+		return nil, err
+	}
+	return g, nil
+}
+
+func (r *groupRepo) Update(ctx context.Context, g *group.Group) (int64, error) {
+	ctx, span := trace.Start(ctx, "groupRepository.Update")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	g.UpdateTime = time.Now().UnixNano() / int64(time.Millisecond)
+	// a map keeps the nil parent, Updates skips the zero fields of a struct
+	x := r.conn(ctx).Model(&group.Group{}).Where("id = ?", g.Id).Updates(map[string]interface{}{
+		"parent_id":   g.ParentId,
+		"name":        g.Name,
+		"update_time": g.UpdateTime,
+	})
+	if err := x.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("groupRepository Update fail => %+v", err)
+		return 0, err
+	}
+	return x.RowsAffected, nil
+}
+
+func (r *groupRepo) Delete(ctx context.Context, id device.UUID) (int64, error) {
+	ctx, span := trace.Start(ctx, "groupRepository.Delete")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	delete := r.conn(ctx).Where("id = ?", id).Delete(&group.Group{})
+	if err := delete.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("groupRepository Delete fail => %+v", err)
+		return 0, err
+	}
+	return delete.RowsAffected, nil
+}
+
+func (r *groupRepo) Find(ctx context.Context, parent *device.UUID, p *model.Page) ([]*group.Group, error) {
+	ctx, span := trace.Start(ctx, "groupRepository.Find")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	q := r.conn(ctx)
+	if parent != nil {
+		q = q.Where("parent_id = ?", *parent)
+	}
+	groups := []*group.Group{}
+	if err := q.Order("create_time, id").Limit(p.Limit).Offset(p.Offset).Find(&groups).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("groupRepository Find fail => %+v", err)
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (r *groupRepo) Descendants(ctx context.Context, id device.UUID) ([]device.UUID, error) {
+	ctx, span := trace.Start(ctx, "groupRepository.Descendants")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	// UNION drops the rows seen before, a cycle can't recurse forever
+	rows, err := r.conn(ctx).Raw(`WITH RECURSIVE tree(id) AS (
+		SELECT id FROM device_group WHERE id = ?
+		UNION
+		SELECT g.id FROM device_group g JOIN tree t ON g.parent_id = t.id
+	) SELECT id FROM tree`, id).Rows()
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("groupRepository Descendants fail => %+v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []device.UUID{}
+	for rows.Next() {
+		var x device.UUID
+		if err := rows.Scan(&x); err != nil {
+			span.SetError(err)
+			log.WithContext(ctx).Errorf("groupRepository Descendants scan fail => %+v", err)
+			return nil, err
+		}
+		ids = append(ids, x)
+	}
+	if err := rows.Err(); err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("groupRepository Descendants fail => %+v", err)
+		return nil, err
+	}
+	return ids, nil
+}
+
+// conn returns the db bound to ctx
+func (r *groupRepo) conn(ctx context.Context) *gorm.DB {
+	return database.WithContext(r.db, ctx)
+}
+
+func NewGroupRepo(db *gorm.DB) group.Repository {
+	return &groupRepo{
+		db: db,
+	}
+}
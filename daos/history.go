@@ -0,0 +1,57 @@
+package daos
+
+import (
+	"context"
+
+	"github/demo/database"
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+type historyRepo struct {
+	db *gorm.DB
+}
+
+func (r *historyRepo) Create(ctx context.Context, h *device.History) error {
+	ctx, span := trace.Start(ctx, "historyRepository.Create")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	if err := database.WithContext(r.db, ctx).Create(h).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("historyRepository Create fail => %+v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *historyRepo) Find(ctx context.Context, id device.UUID, p *model.Page) ([]*device.History, error) {
+	ctx, span := trace.Start(ctx, "historyRepository.Find")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	history := []*device.History{}
+	err := database.WithContext(r.db, ctx).
+		Where("device_id = ?", id).
+		Order("create_time desc, id desc").
+		Limit(p.Limit).Offset(p.Offset).
+		Find(&history).Error
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("historyRepository Find fail => %+v", err)
+		return nil, err
+	}
+	return history, nil
+}
+
+func NewHistoryRepo(db *gorm.DB) device.HistoryRepository {
+	return &historyRepo{
+		db: db,
+	}
+}
@@ -0,0 +1,105 @@
+package daos
+
+import (
+	"context"
+
+	"github/demo/database"
+	"github/demo/model/firmware"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+type keyRepo struct {
+	db *gorm.DB
+}
+
+func (r *keyRepo) Get(ctx context.Context, id string) (*firmware.Key, error) {
+	ctx, span := trace.Start(ctx, "keyRepository.Get")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	k := firmware.Key{}
+	if err := r.conn(ctx).Where("id = ?", id).Find(&k).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("keyRepository Get fail => %+v", err)
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (r *keyRepo) Active(ctx context.Context) (*firmware.Key, error) {
+	ctx, span := trace.Start(ctx, "keyRepository.Active")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	keys := []*firmware.Key{}
+	err := r.conn(ctx).Where("status = ?", firmware.KeyActive).
+		Order("create_time desc, id desc").
+		Limit(1).
+		Find(&keys).Error
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("keyRepository Active fail => %+v", err)
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return keys[0], nil
+}
+
+func (r *keyRepo) Find(ctx context.Context) ([]*firmware.Key, error) {
+	ctx, span := trace.Start(ctx, "keyRepository.Find")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	keys := []*firmware.Key{}
+	if err := r.conn(ctx).Order("create_time desc, id desc").Find(&keys).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("keyRepository Find fail => %+v", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *keyRepo) Rotate(ctx context.Context, k *firmware.Key) error {
+	ctx, span := trace.Start(ctx, "keyRepository.Rotate")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	err := database.Transaction(r.conn(ctx), func(tx *gorm.DB) error {
+		err := tx.Model(&firmware.Key{}).
+			Where("status = ?", firmware.KeyActive).
+			Updates(map[string]interface{}{
+				"status":      firmware.KeyRetired,
+				"retire_time": k.CreateTime,
+			}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(k).Error
+	})
+	if err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("keyRepository Rotate fail => %+v", err)
+		return err
+	}
+	return nil
+}
+
+// conn returns the db bound to ctx
+func (r *keyRepo) conn(ctx context.Context) *gorm.DB {
+	return database.WithContext(r.db, ctx)
+}
+
+func NewKeyRepo(db *gorm.DB) firmware.KeyRepository {
+	return &keyRepo{
+		db: db,
+	}
+}
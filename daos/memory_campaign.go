@@ -0,0 +1,238 @@
+package daos
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/model/firmware"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+// memoryCampaignRepo keeps the campaigns and their targets in memory, with
+// the ordering and status semantics of campaignRepo
+type memoryCampaignRepo struct {
+	mu        sync.RWMutex
+	campaigns map[device.UUID]*firmware.Campaign
+	// targets holds the targets of a campaign by device id
+	targets map[device.UUID]map[device.UUID]*firmware.Target
+}
+
+func (r *memoryCampaignRepo) Create(ctx context.Context, c *firmware.Campaign) (*firmware.Campaign, error) {
+	_, span := trace.Start(ctx, "memoryCampaignRepository.Create")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.campaigns[c.Id]; ok {
+		err := fmt.Errorf("campaign %s already exists", c.Id)
+		span.SetError(err)
+		return nil, err
+	}
+	x := *c
+	r.campaigns[c.Id] = &x
+	return c, nil
+}
+
+func (r *memoryCampaignRepo) Get(ctx context.Context, id device.UUID) (*firmware.Campaign, error) {
+	_, span := trace.Start(ctx, "memoryCampaignRepository.Get")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.campaigns[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	x := *c
+	return &x, nil
+}
+
+func (r *memoryCampaignRepo) Find(ctx context.Context, release device.UUID, status string, p *model.Page) ([]*firmware.Campaign, error) {
+	_, span := trace.Start(ctx, "memoryCampaignRepository.Find")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matched := []*firmware.Campaign{}
+	for _, c := range r.campaigns {
+		if (len(release) > 0 && c.ReleaseId != release) || (len(status) > 0 && c.Status != status) {
+			continue
+		}
+		matched = append(matched, c)
+	}
+	// newest first
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].CreateTime != matched[j].CreateTime {
+			return matched[i].CreateTime > matched[j].CreateTime
+		}
+		return matched[i].Id > matched[j].Id
+	})
+
+	campaigns := []*firmware.Campaign{}
+	for i := p.Offset; i < uint64(len(matched)) && uint64(len(campaigns)) < p.Limit; i++ {
+		x := *matched[i]
+		campaigns = append(campaigns, &x)
+	}
+	return campaigns, nil
+}
+
+func (r *memoryCampaignRepo) Update(ctx context.Context, c *firmware.Campaign, from []string, wave int) (int64, error) {
+	_, span := trace.Start(ctx, "memoryCampaignRepository.Update")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	x, ok := r.campaigns[c.Id]
+	if !ok || !oneOf(x.Status, from) || x.Wave != wave {
+		return 0, nil
+	}
+	x.Status = c.Status
+	x.Wave = c.Wave
+	x.FailureThreshold = c.FailureThreshold
+	x.Reason = c.Reason
+	x.UpdateTime = c.UpdateTime
+	return 1, nil
+}
+
+func (r *memoryCampaignRepo) AddTargets(ctx context.Context, targets []*firmware.Target) (int64, error) {
+	_, span := trace.Start(ctx, "memoryCampaignRepository.AddTargets")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var added int64
+	for _, t := range targets {
+		devices, ok := r.targets[t.CampaignId]
+		if !ok {
+			devices = make(map[device.UUID]*firmware.Target)
+			r.targets[t.CampaignId] = devices
+		}
+		if _, ok := devices[t.DeviceId]; ok {
+			continue
+		}
+		x := *t
+		devices[t.DeviceId] = &x
+		added++
+	}
+	return added, nil
+}
+
+func (r *memoryCampaignRepo) Targets(ctx context.Context, id device.UUID, status string, p *model.Page) ([]*firmware.Target, error) {
+	_, span := trace.Start(ctx, "memoryCampaignRepository.Targets")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matched := []*firmware.Target{}
+	for _, t := range r.targets[id] {
+		if len(status) == 0 || t.Status == status {
+			matched = append(matched, t)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].Wave != matched[j].Wave {
+			return matched[i].Wave < matched[j].Wave
+		}
+		return matched[i].DeviceId < matched[j].DeviceId
+	})
+
+	targets := []*firmware.Target{}
+	for i := range matched {
+		if p != nil && (uint64(i) < p.Offset || uint64(len(targets)) >= p.Limit) {
+			continue
+		}
+		x := *matched[i]
+		targets = append(targets, &x)
+	}
+	return targets, nil
+}
+
+func (r *memoryCampaignRepo) SetTargetStatus(ctx context.Context, id, deviceId device.UUID, from, to string, now int64) (int64, error) {
+	_, span := trace.Start(ctx, "memoryCampaignRepository.SetTargetStatus")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.targets[id][deviceId]
+	if !ok || t.Status != from {
+		return 0, nil
+	}
+	t.Status = to
+	t.UpdateTime = now
+	return 1, nil
+}
+
+func (r *memoryCampaignRepo) CountTargets(ctx context.Context, id device.UUID) (map[string]int64, error) {
+	_, span := trace.Start(ctx, "memoryCampaignRepository.CountTargets")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, t := range r.targets[id] {
+		counts[t.Status]++
+	}
+	return counts, nil
+}
+
+// NewMemoryCampaignRepo returns a firmware.CampaignRepository kept in memory
+func NewMemoryCampaignRepo() firmware.CampaignRepository {
+	return &memoryCampaignRepo{
+		campaigns: make(map[device.UUID]*firmware.Campaign),
+		targets:   make(map[device.UUID]map[device.UUID]*firmware.Target),
+	}
+}
@@ -0,0 +1,167 @@
+package daos
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github/demo/model"
+	"github/demo/model/catalog"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+// memoryCatalogRepo keeps the models of the catalog in memory, by name
+type memoryCatalogRepo struct {
+	mu     sync.RWMutex
+	models map[string]*catalog.Model
+}
+
+func (r *memoryCatalogRepo) Get(ctx context.Context, name string) (*catalog.Model, error) {
+	_, span := trace.Start(ctx, "memoryCatalogRepository.Get")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m := r.lookup(name)
+	if m == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return copyModel(m), nil
+}
+
+// lookup returns model name regardless of case, r.mu must be held
+func (r *memoryCatalogRepo) lookup(name string) *catalog.Model {
+	if m, ok := r.models[name]; ok {
+		return m
+	}
+	for _, m := range r.models {
+		if strings.EqualFold(m.Name, name) {
+			return m
+		}
+	}
+	return nil
+}
+
+func (r *memoryCatalogRepo) Create(ctx context.Context, m *catalog.Model) (*catalog.Model, error) {
+	_, span := trace.Start(ctx, "memoryCatalogRepository.Create")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.lookup(m.Name) != nil {
+		err := fmt.Errorf("model %s already exists", m.Name)
+		span.SetError(err)
+		return nil, err
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	m.CreateTime = now
+	m.UpdateTime = now
+	m.Colors, m.Versions = missing(m.Colors, nil), missing(m.Versions, nil)
+	r.models[m.Name] = copyModel(m)
+	return m, nil
+}
+
+func (r *memoryCatalogRepo) Update(ctx context.Context, m *catalog.Model) (int64, error) {
+	_, span := trace.Start(ctx, "memoryCatalogRepository.Update")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	x, ok := r.models[m.Name]
+	if !ok {
+		return 0, nil
+	}
+	m.UpdateTime = time.Now().UnixNano() / int64(time.Millisecond)
+	x.Colors = missing(m.Colors, nil)
+	x.Versions = missing(m.Versions, nil)
+	x.UpdateTime = m.UpdateTime
+	return 1, nil
+}
+
+func (r *memoryCatalogRepo) Delete(ctx context.Context, name string) (int64, error) {
+	_, span := trace.Start(ctx, "memoryCatalogRepository.Delete")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.models[name]; !ok {
+		return 0, nil
+	}
+	delete(r.models, name)
+	return 1, nil
+}
+
+func (r *memoryCatalogRepo) Find(ctx context.Context, p *model.Page) ([]*catalog.Model, error) {
+	_, span := trace.Start(ctx, "memoryCatalogRepository.Find")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.models))
+	for name := range r.models {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	models := []*catalog.Model{}
+	for i, name := range names {
+		if uint64(len(models)) >= p.Limit {
+			break
+		}
+		if uint64(i) < p.Offset {
+			continue
+		}
+		models = append(models, copyModel(r.models[name]))
+	}
+	return models, nil
+}
+
+func copyModel(m *catalog.Model) *catalog.Model {
+	x := *m
+	x.Colors = append([]string{}, m.Colors...)
+	x.Versions = append([]string{}, m.Versions...)
+	return &x
+}
+
+// NewMemoryCatalogRepo returns a catalog.Repository kept in memory
+func NewMemoryCatalogRepo() catalog.Repository {
+	return &memoryCatalogRepo{
+		models: make(map[string]*catalog.Model),
+	}
+}
@@ -0,0 +1,215 @@
+package daos
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github/demo/model"
+	"github/demo/model/command"
+	"github/demo/model/device"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+// memoryCommandRepo keeps the commands in memory, with the ordering and
+// status semantics of commandRepo
+type memoryCommandRepo struct {
+	mu       sync.RWMutex
+	commands map[device.UUID]*command.Command
+}
+
+func (r *memoryCommandRepo) Create(ctx context.Context, c *command.Command) (*command.Command, error) {
+	_, span := trace.Start(ctx, "memoryCommandRepository.Create")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.commands[c.Id]; ok {
+		err := fmt.Errorf("command %s already exists", c.Id)
+		span.SetError(err)
+		return nil, err
+	}
+	x := *c
+	r.commands[c.Id] = &x
+	return c, nil
+}
+
+func (r *memoryCommandRepo) Get(ctx context.Context, id device.UUID) (*command.Command, error) {
+	_, span := trace.Start(ctx, "memoryCommandRepository.Get")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.commands[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	x := *c
+	return &x, nil
+}
+
+func (r *memoryCommandRepo) Next(ctx context.Context, id device.UUID, now int64) (*command.Command, error) {
+	_, span := trace.Start(ctx, "memoryCommandRepository.Next")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, c := range r.sorted() {
+		if c.DeviceId == id && c.Status == command.StatusPending && c.ExpireTime > now {
+			x := *c
+			return &x, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *memoryCommandRepo) SetStatus(ctx context.Context, id device.UUID, from []string, to, result string, now int64) (int64, error) {
+	_, span := trace.Start(ctx, "memoryCommandRepository.SetStatus")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.commands[id]
+	if !ok || !oneOf(c.Status, from) || c.ExpireTime <= now {
+		return 0, nil
+	}
+	c.Status = to
+	c.Result = result
+	c.UpdateTime = now
+	return 1, nil
+}
+
+func (r *memoryCommandRepo) Find(ctx context.Context, id device.UUID, status string, p *model.Page) ([]*command.Command, error) {
+	_, span := trace.Start(ctx, "memoryCommandRepository.Find")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// newest first
+	sorted := r.sorted()
+	commands := []*command.Command{}
+	offset := p.Offset
+	for i := len(sorted) - 1; i >= 0 && uint64(len(commands)) < p.Limit; i-- {
+		c := sorted[i]
+		if c.DeviceId != id || (len(status) > 0 && c.Status != status) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		x := *c
+		commands = append(commands, &x)
+	}
+	return commands, nil
+}
+
+func (r *memoryCommandRepo) Expire(ctx context.Context, now int64) (int64, error) {
+	_, span := trace.Start(ctx, "memoryCommandRepository.Expire")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var expired int64
+	for _, c := range r.commands {
+		if oneOf(c.Status, command.Open) && c.ExpireTime <= now {
+			c.Status = command.StatusExpired
+			c.UpdateTime = now
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func (r *memoryCommandRepo) Purge(ctx context.Context, before int64) (int64, error) {
+	_, span := trace.Start(ctx, "memoryCommandRepository.Purge")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, c := range r.commands {
+		if !oneOf(c.Status, command.Open) && c.UpdateTime < before {
+			delete(r.commands, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// sorted returns the commands by create time and then id, oldest first
+func (r *memoryCommandRepo) sorted() []*command.Command {
+	commands := make([]*command.Command, 0, len(r.commands))
+	for _, c := range r.commands {
+		commands = append(commands, c)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		if commands[i].CreateTime != commands[j].CreateTime {
+			return commands[i].CreateTime < commands[j].CreateTime
+		}
+		return commands[i].Id < commands[j].Id
+	})
+	return commands
+}
+
+// oneOf reports whether s is one of list
+func oneOf(s string, list []string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// NewMemoryCommandRepo returns a command.Repository kept in memory
+func NewMemoryCommandRepo() command.Repository {
+	return &memoryCommandRepo{
+		commands: make(map[device.UUID]*command.Command),
+	}
+}
@@ -0,0 +1,534 @@
+package daos
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+// memoryDeviceRepo keeps the devices in memory, in the order they were
+// created, with the filtering, paging and update semantics of deviceRepo.
+type memoryDeviceRepo struct {
+	mu      sync.RWMutex
+	devices map[device.UUID]*device.Device
+	order   []device.UUID
+	labels  map[device.UUID]map[string]string
+	// members of each group
+	members map[device.UUID]map[device.UUID]bool
+}
+
+func (r *memoryDeviceRepo) Get(ctx context.Context, id device.UUID) (*device.Device, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.Get")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	d, ok := r.devices[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	x := *d
+	return &x, nil
+}
+
+func (r *memoryDeviceRepo) Create(ctx context.Context, d *device.Device) (*device.Device, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.Create")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.devices[d.Id]; ok {
+		err := fmt.Errorf("device %s already exists", d.Id)
+		span.SetError(err)
+		return nil, err
+	}
+
+	d.CreateTime = time.Now().UnixNano() / int64(time.Millisecond)
+	if len(d.State) == 0 {
+		d.State = device.StateProvisioned
+	}
+	r.insert(d)
+	return d, nil
+}
+
+func (r *memoryDeviceRepo) Update(ctx context.Context, d *device.Device) (*device.Device, int64, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.Update")
+	defer span.Finish()
+
+	if d == nil {
+		return nil, 0, nil
+	}
+
+	c := device.Device{
+		Id: d.Id,
+	}
+
+	if *d == c {
+		return nil, 0, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, 0, err
+	}
+
+	d.UpdateTime = time.Now().UnixNano() / int64(time.Millisecond)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	x, ok := r.devices[d.Id]
+	if !ok {
+		return &device.Device{}, 0, nil
+	}
+	// the zero fields are left untouched, as utils.Map omits them
+	if len(d.Model) > 0 {
+		x.Model = d.Model
+	}
+	if len(d.Color) > 0 {
+		x.Color = d.Color
+	}
+	if len(d.Version) > 0 {
+		x.Version = d.Version
+	}
+	// the state only changes through SetState
+	x.UpdateTime = d.UpdateTime
+
+	re := *x
+	return &re, 1, nil
+}
+
+func (r *memoryDeviceRepo) Delete(ctx context.Context, id device.UUID) (int64, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.Delete")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.devices[id]; !ok {
+		return 0, nil
+	}
+	delete(r.devices, id)
+	for i, v := range r.order {
+		if v == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	return 1, nil
+}
+
+func (r *memoryDeviceRepo) List(ctx context.Context, d *device.Device) ([]*device.Device, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.List")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.filter(d, 0, -1), nil
+}
+
+func (r *memoryDeviceRepo) Find(ctx context.Context, d *device.Device, p *model.Page) ([]*device.Device, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.Find")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.filter(d, int(p.Offset), int(p.Limit)), nil
+}
+
+func (r *memoryDeviceRepo) Iterate(ctx context.Context, d *device.Device, p *model.Page, fn func(*device.Device) error) error {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.Iterate")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return err
+	}
+
+	offset, limit := 0, -1
+	if p != nil && p.Limit > 0 {
+		offset, limit = int(p.Offset), int(p.Limit)
+	}
+
+	// fn runs on a snapshot, it may use the repository itself
+	r.mu.RLock()
+	devices := r.filter(d, offset, limit)
+	r.mu.RUnlock()
+
+	for _, x := range devices {
+		if err := ctx.Err(); err != nil {
+			span.SetError(err)
+			return err
+		}
+		if err := fn(x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryDeviceRepo) Count(ctx context.Context) ([]*device.Count, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.Count")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := make(map[[2]string]*device.Count)
+	counts := []*device.Count{}
+	for _, id := range r.order {
+		d := r.devices[id]
+		key := [2]string{d.Model, d.Version}
+		c, ok := groups[key]
+		if !ok {
+			c = &device.Count{Model: d.Model, Version: d.Version}
+			groups[key] = c
+			counts = append(counts, c)
+		}
+		c.Total++
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Model != counts[j].Model {
+			return counts[i].Model < counts[j].Model
+		}
+		return counts[i].Version < counts[j].Version
+	})
+
+	return counts, nil
+}
+
+func (r *memoryDeviceRepo) SetLabels(ctx context.Context, id device.UUID, labels map[string]string) error {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.SetLabels")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.labels[id] == nil {
+		r.labels[id] = make(map[string]string)
+	}
+	for k, v := range labels {
+		r.labels[id][k] = v
+	}
+	return nil
+}
+
+func (r *memoryDeviceRepo) RemoveLabels(ctx context.Context, id device.UUID, keys ...string) (int64, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.RemoveLabels")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	labels := r.labels[id]
+	if len(keys) == 0 {
+		delete(r.labels, id)
+		return int64(len(labels)), nil
+	}
+
+	var removed int64
+	for _, k := range keys {
+		if _, ok := labels[k]; ok {
+			delete(labels, k)
+			removed++
+		}
+	}
+	if len(labels) == 0 {
+		delete(r.labels, id)
+	}
+	return removed, nil
+}
+
+func (r *memoryDeviceRepo) Labels(ctx context.Context, ids ...device.UUID) (map[device.UUID]map[string]string, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.Labels")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	labels := make(map[device.UUID]map[string]string)
+	for _, id := range ids {
+		if len(r.labels[id]) == 0 {
+			continue
+		}
+		labels[id] = make(map[string]string, len(r.labels[id]))
+		for k, v := range r.labels[id] {
+			labels[id][k] = v
+		}
+	}
+	return labels, nil
+}
+
+func (r *memoryDeviceRepo) AddMembers(ctx context.Context, group device.UUID, ids ...device.UUID) error {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.AddMembers")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(ids) == 0 {
+		return nil
+	}
+	if r.members[group] == nil {
+		r.members[group] = make(map[device.UUID]bool)
+	}
+	for _, id := range ids {
+		r.members[group][id] = true
+	}
+	return nil
+}
+
+func (r *memoryDeviceRepo) RemoveMembers(ctx context.Context, group device.UUID, ids ...device.UUID) (int64, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.RemoveMembers")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members := r.members[group]
+	if len(ids) == 0 {
+		delete(r.members, group)
+		return int64(len(members)), nil
+	}
+
+	var removed int64
+	for _, id := range ids {
+		if members[id] {
+			delete(members, id)
+			removed++
+		}
+	}
+	if len(members) == 0 {
+		delete(r.members, group)
+	}
+	return removed, nil
+}
+
+func (r *memoryDeviceRepo) SetState(ctx context.Context, id device.UUID, from []string, to string) (int64, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.SetState")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	x, ok := r.devices[id]
+	if !ok {
+		return 0, nil
+	}
+	for _, state := range from {
+		if x.State == state {
+			x.State = to
+			x.UpdateTime = time.Now().UnixNano() / int64(time.Millisecond)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (r *memoryDeviceRepo) Heartbeat(ctx context.Context, id device.UUID, seen int64, firmware string) (int64, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.Heartbeat")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	x, ok := r.devices[id]
+	if !ok {
+		return 0, nil
+	}
+	x.LastSeen = seen
+	if len(firmware) > 0 {
+		x.Firmware = firmware
+	}
+	return 1, nil
+}
+
+func (r *memoryDeviceRepo) AdvanceShadow(ctx context.Context, id device.UUID, from int64, desired *device.Desired) (int64, error) {
+	_, span := trace.Start(ctx, "memoryDeviceRepository.AdvanceShadow")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	x, ok := r.devices[id]
+	if !ok || x.ShadowVersion != from {
+		return 0, nil
+	}
+	x.ShadowVersion = from + 1
+	if desired != nil {
+		x.DesiredColor = desired.Color
+		x.DesiredVersion = desired.Version
+		x.UpdateTime = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	return 1, nil
+}
+
+// member reports whether device id is a member of the groups of
+// d.Membership
+func (r *memoryDeviceRepo) member(id device.UUID, d *device.Device) bool {
+	if d == nil || d.Membership == nil {
+		return true
+	}
+	for _, g := range d.Membership.GroupIds {
+		if r.members[g][id] {
+			return true
+		}
+	}
+	return false
+}
+
+// Query is not supported, there is no database behind the repository
+func (r *memoryDeviceRepo) Query(query interface{}, args ...interface{}) *gorm.DB {
+	return nil
+}
+
+func (r *memoryDeviceRepo) insert(d *device.Device) {
+	x := *d
+	r.devices[x.Id] = &x
+	r.order = append(r.order, x.Id)
+}
+
+// filter returns copies of the devices matching the non-zero fields of d,
+// skipping offset of them and returning at most limit, a negative limit
+// returns all of them
+func (r *memoryDeviceRepo) filter(d *device.Device, offset, limit int) []*device.Device {
+	devices := []*device.Device{}
+	for _, id := range r.order {
+		if limit >= 0 && len(devices) >= limit {
+			break
+		}
+		x := r.devices[id]
+		if !match(x, d, r.labels[id]) || !r.member(id, d) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		c := *x
+		devices = append(devices, &c)
+	}
+	return devices
+}
+
+// match reports whether x equals the non-zero fields of d, as gorm does for
+// struct conditions, and its labels meet the selector of d
+func match(x, d *device.Device, labels map[string]string) bool {
+	if d == nil {
+		return true
+	}
+	if d.Selector != nil && !d.Selector.Matches(labels) {
+		return false
+	}
+	switch {
+	case len(d.Id) > 0 && d.Id != x.Id,
+		len(d.Model) > 0 && d.Model != x.Model,
+		len(d.Color) > 0 && d.Color != x.Color,
+		len(d.Version) > 0 && d.Version != x.Version,
+		len(d.State) > 0 && d.State != x.State,
+		len(d.Firmware) > 0 && d.Firmware != x.Firmware,
+		d.LastSeen != 0 && d.LastSeen != x.LastSeen,
+		d.Seen != nil && d.Seen.Since != 0 && x.LastSeen < d.Seen.Since,
+		d.Seen != nil && d.Seen.Before != 0 && x.LastSeen >= d.Seen.Before,
+		d.CreateTime != 0 && d.CreateTime != x.CreateTime,
+		d.UpdateTime != 0 && d.UpdateTime != x.UpdateTime:
+		return false
+	}
+	return true
+}
+
+// NewMemoryDeviceRepo returns a device.Repository kept in memory, holding
+// devices as they are
+func NewMemoryDeviceRepo(devices ...*device.Device) device.Repository {
+	r := &memoryDeviceRepo{
+		devices: make(map[device.UUID]*device.Device),
+		labels:  make(map[device.UUID]map[string]string),
+		members: make(map[device.UUID]map[device.UUID]bool),
+	}
+	for _, d := range devices {
+		r.insert(d)
+	}
+	return r
+}
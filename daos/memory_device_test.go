@@ -0,0 +1,208 @@
+package daos_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/daos"
+	"github/demo/model"
+	"github/demo/model/device"
+)
+
+func TestMemoryDeviceDaos_Get(t *testing.T) {
+	repo := daos.NewMemoryDeviceRepo(GetDevice1())
+
+	d, err := repo.Get(context.Background(), GetDevice1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, GetDevice1(), d)
+
+	// the caller gets a copy
+	d.Model = "changed"
+	d, _ = repo.Get(context.Background(), GetDevice1().Id)
+	assert.Equal(t, GetDevice1(), d)
+
+	_, err = repo.Get(context.Background(), GetDevice2().Id)
+	assert.EqualError(t, err, "record not found")
+}
+
+func TestMemoryDeviceDaos_Create(t *testing.T) {
+	repo := daos.NewMemoryDeviceRepo()
+
+	d, err := repo.Create(context.Background(), GetDevice1())
+	assert.NoError(t, err)
+	assert.NotZero(t, d.CreateTime)
+
+	_, err = repo.Create(context.Background(), GetDevice1())
+	assert.Error(t, err)
+
+	devices, _ := repo.List(context.Background(), &device.Device{})
+	assert.Equal(t, []*device.Device{d}, devices)
+}
+
+func TestMemoryDeviceDaos_Update(t *testing.T) {
+	tt := []struct {
+		name        string
+		testData    *device.Device
+		wantResult  *device.Device
+		rowAffected int64
+	}{
+		{
+			name:        "success",
+			testData:    UpdateDevice1(),
+			wantResult:  UpdateDevice1(),
+			rowAffected: 1,
+		},
+		{
+			name:        "ignore_uuid_update",
+			testData:    UpdateDevice2(),
+			wantResult:  GetDevice1(),
+			rowAffected: 0,
+		},
+		{
+			name:        "keep zero fields",
+			testData:    &device.Device{Id: GetDevice1().Id, Color: "Red"},
+			wantResult:  &device.Device{Id: GetDevice1().Id, Model: "Pro", Color: "Red", Version: "v1.2"},
+			rowAffected: 1,
+		},
+		{
+			name:        "not exist id",
+			testData:    &device.Device{Id: GetDevice2().Id, Color: "Red"},
+			wantResult:  GetDevice1(),
+			rowAffected: 0,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := daos.NewMemoryDeviceRepo(GetDevice1())
+
+			_, affected, err := repo.Update(context.Background(), tc.testData)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.rowAffected, affected)
+
+			d, _ := repo.Get(context.Background(), GetDevice1().Id)
+			tc.wantResult.UpdateTime = d.UpdateTime
+			assert.Equal(t, tc.wantResult, d)
+		})
+	}
+}
+
+func TestMemoryDeviceDaos_Delete(t *testing.T) {
+	repo := daos.NewMemoryDeviceRepo(GetDevice1(), GetDevice2())
+
+	affected, err := repo.Delete(context.Background(), GetDevice1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+
+	affected, err = repo.Delete(context.Background(), GetDevice1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), affected)
+
+	devices, _ := repo.List(context.Background(), &device.Device{})
+	assert.Equal(t, []*device.Device{GetDevice2()}, devices)
+}
+
+func TestMemoryDeviceDaos_Find(t *testing.T) {
+	repo := daos.NewMemoryDeviceRepo(GetDevice1(), GetDevice2())
+
+	tt := []struct {
+		name       string
+		testData   *device.Device
+		testPage   *model.Page
+		wantResult []*device.Device
+	}{
+		{
+			name:       "no data",
+			testData:   &device.Device{},
+			testPage:   &model.Page{Limit: 0, Offset: 0},
+			wantResult: []*device.Device{},
+		},
+		{
+			name:       "input limit > count",
+			testData:   &device.Device{},
+			testPage:   &model.Page{Limit: 3, Offset: 0},
+			wantResult: []*device.Device{GetDevice1(), GetDevice2()},
+		},
+		{
+			name:       "offset",
+			testData:   &device.Device{},
+			testPage:   &model.Page{Limit: 1, Offset: 1},
+			wantResult: []*device.Device{GetDevice2()},
+		},
+		{
+			name:       "find id",
+			testData:   &device.Device{Id: GetDevice2().Id},
+			testPage:   &model.Page{Limit: 2, Offset: 0},
+			wantResult: []*device.Device{GetDevice2()},
+		},
+		{
+			name:       "find version",
+			testData:   &device.Device{Version: "v1.2"},
+			testPage:   &model.Page{Limit: 2, Offset: 0},
+			wantResult: []*device.Device{GetDevice1(), GetDevice2()},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			devices, err := repo.Find(context.Background(), tc.testData, tc.testPage)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantResult, devices)
+		})
+	}
+}
+
+func TestMemoryDeviceDaos_Count(t *testing.T) {
+	d := UpdateDevice1()
+	d.Id = "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60"
+	repo := daos.NewMemoryDeviceRepo(GetDevice1(), GetDevice2(), d)
+
+	counts, err := repo.Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*device.Count{
+		{Model: "Normal", Version: "v1.2", Total: 1},
+		{Model: "Pro", Version: "v1.2", Total: 1},
+		{Model: "Pro", Version: "v1.5", Total: 1},
+	}, counts)
+
+	counts, err = daos.NewMemoryDeviceRepo().Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*device.Count{}, counts)
+}
+
+func TestMemoryDeviceDaos_Context(t *testing.T) {
+	repo := daos.NewMemoryDeviceRepo(GetDevice1())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.Get(ctx, GetDevice1().Id)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Create(ctx, GetDevice2())
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Delete(ctx, GetDevice1().Id)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestMemoryDeviceDaos_Concurrent(t *testing.T) {
+	repo := daos.NewMemoryDeviceRepo()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d := GetDevice1()
+			d.Id = device.UUID(GetDevice1().Id.String()[:34] + string(rune('a'+i/10)) + string(rune('0'+i%10)))
+			repo.Create(context.Background(), d)
+			repo.Update(context.Background(), &device.Device{Id: d.Id, Color: "Red"})
+			repo.Find(context.Background(), &device.Device{}, &model.Page{Limit: 10})
+		}(i)
+	}
+	wg.Wait()
+
+	counts, _ := repo.Count(context.Background())
+	assert.Equal(t, []*device.Count{{Model: "Pro", Version: "v1.2", Total: 50}}, counts)
+}
@@ -0,0 +1,132 @@
+package daos
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/model/firmware"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+// memoryFirmwareRepo keeps the releases in memory, with the ordering and
+// uniqueness of firmwareRepo
+type memoryFirmwareRepo struct {
+	mu       sync.RWMutex
+	releases map[device.UUID]*firmware.Release
+}
+
+func (r *memoryFirmwareRepo) Create(ctx context.Context, x *firmware.Release) (*firmware.Release, error) {
+	_, span := trace.Start(ctx, "memoryFirmwareRepository.Create")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.releases[x.Id]; ok {
+		err := fmt.Errorf("release %s already exists", x.Id)
+		span.SetError(err)
+		return nil, err
+	}
+	for _, v := range r.releases {
+		if v.Model == x.Model && v.Version == x.Version {
+			err := fmt.Errorf("release %s %s already exists", x.Model, x.Version)
+			span.SetError(err)
+			return nil, err
+		}
+	}
+	c := *x
+	r.releases[x.Id] = &c
+	return x, nil
+}
+
+func (r *memoryFirmwareRepo) Get(ctx context.Context, id device.UUID) (*firmware.Release, error) {
+	_, span := trace.Start(ctx, "memoryFirmwareRepository.Get")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	x, ok := r.releases[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	c := *x
+	return &c, nil
+}
+
+func (r *memoryFirmwareRepo) Find(ctx context.Context, m, version string, p *model.Page) ([]*firmware.Release, error) {
+	_, span := trace.Start(ctx, "memoryFirmwareRepository.Find")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matched := []*firmware.Release{}
+	for _, x := range r.releases {
+		if (len(m) > 0 && x.Model != m) || (len(version) > 0 && x.Version != version) {
+			continue
+		}
+		matched = append(matched, x)
+	}
+	// newest first
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].CreateTime != matched[j].CreateTime {
+			return matched[i].CreateTime > matched[j].CreateTime
+		}
+		return matched[i].Id > matched[j].Id
+	})
+
+	releases := []*firmware.Release{}
+	for i := p.Offset; i < uint64(len(matched)) && uint64(len(releases)) < p.Limit; i++ {
+		c := *matched[i]
+		releases = append(releases, &c)
+	}
+	return releases, nil
+}
+
+func (r *memoryFirmwareRepo) Delete(ctx context.Context, id device.UUID) (int64, error) {
+	_, span := trace.Start(ctx, "memoryFirmwareRepository.Delete")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.releases[id]; !ok {
+		return 0, nil
+	}
+	delete(r.releases, id)
+	return 1, nil
+}
+
+// NewMemoryFirmwareRepo returns a firmware.Repository kept in memory
+func NewMemoryFirmwareRepo() firmware.Repository {
+	return &memoryFirmwareRepo{
+		releases: make(map[device.UUID]*firmware.Release),
+	}
+}
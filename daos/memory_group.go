@@ -0,0 +1,192 @@
+package daos
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/model/group"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+// memoryGroupRepo keeps the groups in memory, in the order they were created
+type memoryGroupRepo struct {
+	mu     sync.RWMutex
+	groups map[device.UUID]*group.Group
+	order  []device.UUID
+}
+
+func (r *memoryGroupRepo) Get(ctx context.Context, id device.UUID) (*group.Group, error) {
+	_, span := trace.Start(ctx, "memoryGroupRepository.Get")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	g, ok := r.groups[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return copyGroup(g), nil
+}
+
+func (r *memoryGroupRepo) Create(ctx context.Context, g *group.Group) (*group.Group, error) {
+	_, span := trace.Start(ctx, "memoryGroupRepository.Create")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.groups[g.Id]; ok {
+		err := fmt.Errorf("group %s already exists", g.Id)
+		span.SetError(err)
+		return nil, err
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	g.CreateTime = now
+	g.UpdateTime = now
+	r.groups[g.Id] = copyGroup(g)
+	r.order = append(r.order, g.Id)
+	return g, nil
+}
+
+func (r *memoryGroupRepo) Update(ctx context.Context, g *group.Group) (int64, error) {
+	_, span := trace.Start(ctx, "memoryGroupRepository.Update")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	x, ok := r.groups[g.Id]
+	if !ok {
+		return 0, nil
+	}
+	g.UpdateTime = time.Now().UnixNano() / int64(time.Millisecond)
+	x.ParentId = copyGroup(g).ParentId
+	x.Name = g.Name
+	x.UpdateTime = g.UpdateTime
+	return 1, nil
+}
+
+func (r *memoryGroupRepo) Delete(ctx context.Context, id device.UUID) (int64, error) {
+	_, span := trace.Start(ctx, "memoryGroupRepository.Delete")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.groups[id]; !ok {
+		return 0, nil
+	}
+	delete(r.groups, id)
+	for i, v := range r.order {
+		if v == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	return 1, nil
+}
+
+func (r *memoryGroupRepo) Find(ctx context.Context, parent *device.UUID, p *model.Page) ([]*group.Group, error) {
+	_, span := trace.Start(ctx, "memoryGroupRepository.Find")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := []*group.Group{}
+	offset := p.Offset
+	for _, id := range r.order {
+		if uint64(len(groups)) >= p.Limit {
+			break
+		}
+		g := r.groups[id]
+		if parent != nil && (g.ParentId == nil || *g.ParentId != *parent) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		groups = append(groups, copyGroup(g))
+	}
+	return groups, nil
+}
+
+func (r *memoryGroupRepo) Descendants(ctx context.Context, id device.UUID) ([]device.UUID, error) {
+	_, span := trace.Start(ctx, "memoryGroupRepository.Descendants")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := []device.UUID{}
+	if _, ok := r.groups[id]; !ok {
+		return ids, nil
+	}
+	seen := map[device.UUID]bool{id: true}
+	ids = append(ids, id)
+	for i := 0; i < len(ids); i++ {
+		for _, child := range r.order {
+			g := r.groups[child]
+			if g.ParentId != nil && *g.ParentId == ids[i] && !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids, nil
+}
+
+func copyGroup(g *group.Group) *group.Group {
+	x := *g
+	if g.ParentId != nil {
+		parent := *g.ParentId
+		x.ParentId = &parent
+	}
+	return &x
+}
+
+// NewMemoryGroupRepo returns a group.Repository kept in memory
+func NewMemoryGroupRepo() group.Repository {
+	return &memoryGroupRepo{
+		groups: make(map[device.UUID]*group.Group),
+	}
+}
@@ -0,0 +1,69 @@
+package daos
+
+import (
+	"context"
+	"sync"
+
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/utils/trace"
+)
+
+// memoryHistoryRepo keeps the history of the devices in memory, in the order
+// it was recorded
+type memoryHistoryRepo struct {
+	mu      sync.RWMutex
+	history []*device.History
+}
+
+func (r *memoryHistoryRepo) Create(ctx context.Context, h *device.History) error {
+	_, span := trace.Start(ctx, "memoryHistoryRepository.Create")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h.Id = uint64(len(r.history) + 1)
+	x := *h
+	r.history = append(r.history, &x)
+	return nil
+}
+
+func (r *memoryHistoryRepo) Find(ctx context.Context, id device.UUID, p *model.Page) ([]*device.History, error) {
+	_, span := trace.Start(ctx, "memoryHistoryRepository.Find")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// newest first, the ids grow with the time of the records
+	history := []*device.History{}
+	offset := p.Offset
+	for i := len(r.history) - 1; i >= 0 && uint64(len(history)) < p.Limit; i-- {
+		if r.history[i].DeviceId != id {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		x := *r.history[i]
+		history = append(history, &x)
+	}
+	return history, nil
+}
+
+// NewMemoryHistoryRepo returns a device.HistoryRepository kept in memory
+func NewMemoryHistoryRepo() device.HistoryRepository {
+	return &memoryHistoryRepo{}
+}
@@ -0,0 +1,131 @@
+package daos
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github/demo/model/firmware"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+// memoryKeyRepo keeps the signing keys in memory, with the ordering of
+// keyRepo
+type memoryKeyRepo struct {
+	mu   sync.RWMutex
+	keys map[string]*firmware.Key
+}
+
+func (r *memoryKeyRepo) Get(ctx context.Context, id string) (*firmware.Key, error) {
+	_, span := trace.Start(ctx, "memoryKeyRepository.Get")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	k, ok := r.keys[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	x := *k
+	return &x, nil
+}
+
+func (r *memoryKeyRepo) Active(ctx context.Context) (*firmware.Key, error) {
+	_, span := trace.Start(ctx, "memoryKeyRepository.Active")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, k := range r.sorted() {
+		if k.Status == firmware.KeyActive {
+			x := *k
+			return &x, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (r *memoryKeyRepo) Find(ctx context.Context) ([]*firmware.Key, error) {
+	_, span := trace.Start(ctx, "memoryKeyRepository.Find")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []*firmware.Key{}
+	for _, k := range r.sorted() {
+		x := *k
+		keys = append(keys, &x)
+	}
+	return keys, nil
+}
+
+func (r *memoryKeyRepo) Rotate(ctx context.Context, k *firmware.Key) error {
+	_, span := trace.Start(ctx, "memoryKeyRepository.Rotate")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.keys[k.Id]; ok {
+		err := fmt.Errorf("key %s already exists", k.Id)
+		span.SetError(err)
+		return err
+	}
+	for _, v := range r.keys {
+		if v.Status == firmware.KeyActive {
+			v.Status = firmware.KeyRetired
+			v.RetireTime = k.CreateTime
+		}
+	}
+	x := *k
+	r.keys[k.Id] = &x
+	return nil
+}
+
+// sorted returns the keys newest first, the caller holds the lock
+func (r *memoryKeyRepo) sorted() []*firmware.Key {
+	keys := make([]*firmware.Key, 0, len(r.keys))
+	for _, k := range r.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreateTime != keys[j].CreateTime {
+			return keys[i].CreateTime > keys[j].CreateTime
+		}
+		return keys[i].Id > keys[j].Id
+	})
+	return keys
+}
+
+// NewMemoryKeyRepo returns a firmware.KeyRepository kept in memory
+func NewMemoryKeyRepo() firmware.KeyRepository {
+	return &memoryKeyRepo{
+		keys: make(map[string]*firmware.Key),
+	}
+}
@@ -0,0 +1,190 @@
+package daos
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github/demo/model/device"
+	"github/demo/model/telemetry"
+	"github/demo/utils/trace"
+)
+
+// seriesKey is a metric of a device
+type seriesKey struct {
+	id     device.UUID
+	metric string
+}
+
+// memoryTelemetryRepo keeps the points and the rollups in memory, by series
+// and then by time
+type memoryTelemetryRepo struct {
+	mu     sync.RWMutex
+	points map[seriesKey]map[int64]float64
+	// rollups by step
+	rollups map[int64]map[seriesKey]map[int64]*telemetry.Bucket
+}
+
+func (r *memoryTelemetryRepo) Append(ctx context.Context, points []*telemetry.Point) (int64, error) {
+	_, span := trace.Start(ctx, "memoryTelemetryRepository.Append")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var stored int64
+	for _, p := range points {
+		k := seriesKey{id: p.DeviceId, metric: p.Metric}
+		series, ok := r.points[k]
+		if !ok {
+			series = make(map[int64]float64)
+			r.points[k] = series
+		}
+		if _, ok := series[p.Time]; ok {
+			continue
+		}
+		series[p.Time] = p.Value
+		stored++
+	}
+	return stored, nil
+}
+
+func (r *memoryTelemetryRepo) Rollup(ctx context.Context, id device.UUID, metrics []string, source, step, from, to int64) error {
+	_, span := trace.Start(ctx, "memoryTelemetryRepository.Rollup")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rollups, ok := r.rollups[step]
+	if !ok {
+		rollups = make(map[seriesKey]map[int64]*telemetry.Bucket)
+		r.rollups[step] = rollups
+	}
+	for _, metric := range metrics {
+		k := seriesKey{id: id, metric: metric}
+		buckets := r.buckets(k, source, step, from, to)
+		if len(buckets) == 0 {
+			continue
+		}
+		if rollups[k] == nil {
+			rollups[k] = make(map[int64]*telemetry.Bucket)
+		}
+		for _, b := range buckets {
+			rollups[k][b.Time] = b
+		}
+	}
+	return nil
+}
+
+func (r *memoryTelemetryRepo) Series(ctx context.Context, q *telemetry.Query) ([]*telemetry.Bucket, error) {
+	_, span := trace.Start(ctx, "memoryTelemetryRepository.Series")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.buckets(seriesKey{id: q.DeviceId, metric: q.Metric}, q.Source, q.Step, q.From, q.To), nil
+}
+
+func (r *memoryTelemetryRepo) Purge(ctx context.Context, step, before int64) (int64, error) {
+	_, span := trace.Start(ctx, "memoryTelemetryRepository.Purge")
+	defer span.Finish()
+
+	if err := ctx.Err(); err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	if step == 0 {
+		for _, series := range r.points {
+			for t := range series {
+				if t < before {
+					delete(series, t)
+					deleted++
+				}
+			}
+		}
+		return deleted, nil
+	}
+	for _, series := range r.rollups[step] {
+		for t := range series {
+			if t < before {
+				delete(series, t)
+				deleted++
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// buckets sums up series k in [from, to) in buckets of step, from the rollups
+// of source or the raw points when source is 0, by time
+func (r *memoryTelemetryRepo) buckets(k seriesKey, source, step, from, to int64) []*telemetry.Bucket {
+	byTime := make(map[int64]*telemetry.Bucket)
+	add := func(t int64, b *telemetry.Bucket) {
+		if t < from || t >= to {
+			return
+		}
+		start := t - t%step
+		x, ok := byTime[start]
+		if !ok {
+			c := *b
+			c.Time = start
+			byTime[start] = &c
+			return
+		}
+		x.Count += b.Count
+		x.Sum += b.Sum
+		if b.Min < x.Min {
+			x.Min = b.Min
+		}
+		if b.Max > x.Max {
+			x.Max = b.Max
+		}
+	}
+
+	if source == 0 {
+		for t, v := range r.points[k] {
+			add(t, &telemetry.Bucket{Count: 1, Sum: v, Min: v, Max: v})
+		}
+	} else {
+		for t, b := range r.rollups[source][k] {
+			add(t, b)
+		}
+	}
+
+	buckets := make([]*telemetry.Bucket, 0, len(byTime))
+	for _, b := range byTime {
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Time < buckets[j].Time })
+	return buckets
+}
+
+// NewMemoryTelemetryRepo returns a telemetry.Repository kept in memory
+func NewMemoryTelemetryRepo() telemetry.Repository {
+	return &memoryTelemetryRepo{
+		points:  make(map[seriesKey]map[int64]float64),
+		rollups: make(map[int64]map[seriesKey]map[int64]*telemetry.Bucket),
+	}
+}
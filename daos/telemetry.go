@@ -0,0 +1,156 @@
+package daos
+
+import (
+	"context"
+	"strings"
+
+	"github/demo/database"
+	"github/demo/model/device"
+	"github/demo/model/telemetry"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+
+	"github.com/jinzhu/gorm"
+)
+
+// The statements below are plain SQL understood by both SQLite and Postgres.
+// Buckets are grouped by the position of their column, Postgres doesn't
+// match two bound steps as the same expression.
+const (
+	// pointInsert is followed by the values of the points, a point sent
+	// again, such as by a retried batch, is skipped
+	pointInsert   = "INSERT INTO device_telemetry (device_id, metric, point_time, value) VALUES "
+	pointConflict = " ON CONFLICT DO NOTHING"
+
+	// rollupUpsert stores the rolled up buckets selected after it, replacing
+	// those already stored
+	rollupUpsert   = "INSERT INTO device_telemetry_rollup (device_id, metric, step, bucket_time, total, sum_value, min_value, max_value) "
+	rollupConflict = " ON CONFLICT (device_id, metric, step, bucket_time) DO UPDATE SET " +
+		"total = excluded.total, sum_value = excluded.sum_value, min_value = excluded.min_value, max_value = excluded.max_value"
+
+	rollupFromPoints = "SELECT device_id, metric, CAST(? AS BIGINT), point_time - point_time % ?, COUNT(*), SUM(value), MIN(value), MAX(value) " +
+		"FROM device_telemetry WHERE device_id = ? AND metric IN (?) AND point_time >= ? AND point_time < ? GROUP BY 1, 2, 3, 4"
+	rollupFromRollups = "SELECT device_id, metric, CAST(? AS BIGINT), bucket_time - bucket_time % ?, SUM(total), SUM(sum_value), MIN(min_value), MAX(max_value) " +
+		"FROM device_telemetry_rollup WHERE device_id = ? AND metric IN (?) AND step = ? AND bucket_time >= ? AND bucket_time < ? GROUP BY 1, 2, 3, 4"
+
+	seriesFromPoints = "SELECT point_time - point_time % ? AS bucket_time, COUNT(*) AS total, SUM(value) AS sum_value, MIN(value) AS min_value, MAX(value) AS max_value " +
+		"FROM device_telemetry WHERE device_id = ? AND metric = ? AND point_time >= ? AND point_time < ? GROUP BY 1 ORDER BY 1"
+	seriesFromRollups = "SELECT bucket_time - bucket_time % ? AS bucket_time, SUM(total) AS total, SUM(sum_value) AS sum_value, MIN(min_value) AS min_value, MAX(max_value) AS max_value " +
+		"FROM device_telemetry_rollup WHERE device_id = ? AND metric = ? AND step = ? AND bucket_time >= ? AND bucket_time < ? GROUP BY 1 ORDER BY 1"
+)
+
+// pointsPerInsert keeps the bound values of a statement under the limit of
+// SQLite
+const pointsPerInsert = 200
+
+type telemetryRepo struct {
+	db *gorm.DB
+}
+
+func (r *telemetryRepo) Append(ctx context.Context, points []*telemetry.Point) (int64, error) {
+	ctx, span := trace.Start(ctx, "telemetryRepository.Append")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	var stored int64
+	db := r.conn(ctx)
+	for len(points) > 0 {
+		n := len(points)
+		if n > pointsPerInsert {
+			n = pointsPerInsert
+		}
+
+		values := make([]string, 0, n)
+		args := make([]interface{}, 0, 4*n)
+		for _, p := range points[:n] {
+			values = append(values, "(?, ?, ?, ?)")
+			args = append(args, p.DeviceId, p.Metric, p.Time, p.Value)
+		}
+		x := db.Exec(pointInsert+strings.Join(values, ", ")+pointConflict, args...)
+		if err := x.Error; err != nil {
+			span.SetError(err)
+			log.WithContext(ctx).Errorf("telemetryRepository Append fail => %+v", err)
+			return stored, err
+		}
+		stored += x.RowsAffected
+		points = points[n:]
+	}
+	return stored, nil
+}
+
+func (r *telemetryRepo) Rollup(ctx context.Context, id device.UUID, metrics []string, source, step, from, to int64) error {
+	ctx, span := trace.Start(ctx, "telemetryRepository.Rollup")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	var x *gorm.DB
+	if source == 0 {
+		x = r.conn(ctx).Exec(rollupUpsert+rollupFromPoints+rollupConflict, step, step, id, metrics, from, to)
+	} else {
+		x = r.conn(ctx).Exec(rollupUpsert+rollupFromRollups+rollupConflict, step, step, id, metrics, source, from, to)
+	}
+	if err := x.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("telemetryRepository Rollup fail => %+v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *telemetryRepo) Series(ctx context.Context, q *telemetry.Query) ([]*telemetry.Bucket, error) {
+	ctx, span := trace.Start(ctx, "telemetryRepository.Series")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	var x *gorm.DB
+	if q.Source == 0 {
+		x = r.conn(ctx).Raw(seriesFromPoints, q.Step, q.DeviceId, q.Metric, q.From, q.To)
+	} else {
+		x = r.conn(ctx).Raw(seriesFromRollups, q.Step, q.DeviceId, q.Metric, q.Source, q.From, q.To)
+	}
+	buckets := []*telemetry.Bucket{}
+	if err := x.Scan(&buckets).Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("telemetryRepository Series fail => %+v", err)
+		return nil, err
+	}
+	return buckets, nil
+}
+
+func (r *telemetryRepo) Purge(ctx context.Context, step, before int64) (int64, error) {
+	ctx, span := trace.Start(ctx, "telemetryRepository.Purge")
+	defer span.Finish()
+	ctx, cancel := database.WithTimeout(ctx, r.db)
+	defer cancel()
+
+	var x *gorm.DB
+	if step == 0 {
+		x = r.conn(ctx).Where("point_time < ?", before).Delete(&telemetry.Point{})
+	} else {
+		x = r.conn(ctx).Where("step = ? AND bucket_time < ?", step, before).Delete(&telemetry.Rollup{})
+	}
+	if err := x.Error; err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("telemetryRepository Purge fail => %+v", err)
+		return 0, err
+	}
+	return x.RowsAffected, nil
+}
+
+// conn returns the db bound to ctx
+func (r *telemetryRepo) conn(ctx context.Context) *gorm.DB {
+	return database.WithContext(r.db, ctx)
+}
+
+func NewTelemetryRepo(db *gorm.DB) telemetry.Repository {
+	return &telemetryRepo{
+		db: db,
+	}
+}
@@ -0,0 +1,68 @@
+package daos_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/daos"
+	"github/demo/model/device"
+	"github/demo/utils/trace"
+)
+
+func TestDeviceDaos_Trace(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	s.db.GetDB().DropTable(&device.Device{})
+	s.db.GetDB().AutoMigrate(&device.Device{})
+	s.db.GetDB().Create(GetDevice1())
+
+	name := filepath.Join(os.TempDir(), "trace"+uuid.Must(uuid.NewV4()).String()+".json")
+	defer os.Remove(name)
+	assert.NoError(t, trace.Setup(trace.Options{Exporter: trace.ExporterFile, Filename: name, SampleRatio: 1}))
+
+	// the callbacks belong to the database, a db opened aside is not traced
+	other, err := gorm.Open("sqlite3", s.db.GetDB().DB())
+	assert.NoError(t, err)
+
+	ctx, root := trace.Start(context.Background(), "test")
+	_, err = s.deviceRepo.Get(ctx, GetDevice1().Id)
+	assert.NoError(t, err)
+	_, err = daos.NewDeviceRepo(other).List(ctx, &device.Device{})
+	assert.NoError(t, err)
+	root.Finish()
+	assert.NoError(t, trace.Setup(trace.Options{}))
+
+	f, err := os.Open(name)
+	assert.NoError(t, err)
+	defer f.Close()
+	spans := make(map[string]map[string]interface{})
+	selects := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m := make(map[string]interface{})
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &m))
+		spans[m["name"].(string)] = m
+		if m["name"] == "SELECT device" {
+			selects++
+		}
+	}
+	assert.Equal(t, 1, selects)
+
+	repo, sql := spans["deviceRepository.Get"], spans["SELECT device"]
+	assert.NotNil(t, repo)
+	assert.NotNil(t, sql)
+	assert.Equal(t, spans["test"]["span_id"], repo["parent_span_id"])
+	assert.Equal(t, repo["span_id"], sql["parent_span_id"])
+	attrs := sql["attributes"].(map[string]interface{})
+	assert.Equal(t, "sqlite3", attrs["db.system"])
+	assert.Contains(t, attrs["db.statement"], `SELECT * FROM "device"`)
+}
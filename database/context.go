@@ -0,0 +1,193 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const optionsKey = "demo:options"
+
+// options of a database that have to survive WithContext
+type options struct {
+	// queryTimeout bounds a statement whose context has no deadline
+	queryTimeout time.Duration
+	// logMode logs every statement
+	logMode bool
+}
+
+func getOptions(db *gorm.DB) *options {
+	if v, ok := db.Get(optionsKey); ok {
+		if o, ok := v.(*options); ok {
+			return o
+		}
+	}
+	return &options{}
+}
+
+// WithTimeout returns a copy of ctx bounded by the default query timeout of
+// db, ctx is returned untouched when it already carries a deadline
+func WithTimeout(ctx context.Context, db *gorm.DB) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	o := getOptions(db)
+	if o.queryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, o.queryTimeout)
+}
+
+// WithStartTimeout is WithTimeout for a query whose rows are read at the pace
+// of the caller. The default query timeout bounds the returned context until
+// started is called, once the query returned, and no longer after. started
+// returns the error of the timeout when it cut the query.
+func WithStartTimeout(ctx context.Context, db *gorm.DB) (_ context.Context, started func() error, cancel context.CancelFunc) {
+	start, cancelStart := WithTimeout(ctx, db)
+	run, cancelRun := context.WithCancel(ctx)
+	stop := context.AfterFunc(start, cancelRun)
+
+	var err error
+	done := false
+	started = func() error {
+		if !done && !stop() {
+			err = start.Err()
+		}
+		done = true
+		return err
+	}
+	return run, started, func() {
+		stop()
+		cancelStart()
+		cancelRun()
+	}
+}
+
+// WithContext returns db bound to ctx. Its statements run with ctx through
+// database/sql, one still running once ctx is done is cancelled by the
+// driver, and they are recorded as spans of the trace in ctx. The scoped
+// settings of db are not kept, its connection is, a transaction included.
+// A db not made by NewDatabase is returned as is, tagged with ctx.
+func WithContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	common, ok := sqlCommon(db)
+	if _, ours := db.Get(optionsKey); !ok || !ours {
+		return db.Set(contextKey, ctx)
+	}
+	return bind(db, ctx, common)
+}
+
+// Transaction runs fn in a transaction begun with the context db is bound
+// to, the statements of fn run with it as well. The transaction is committed
+// when fn returns nil and rolled back otherwise.
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	ctx := boundContext(db)
+	common, _ := sqlCommon(db)
+	begin, ok := common.(interface {
+		BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+	})
+	if !ok {
+		return gorm.ErrCantStartTransaction
+	}
+	tx, err := begin.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			tx.Rollback()
+		}
+	}()
+	err = fn(bind(db, ctx, tx))
+	if err == nil {
+		err = tx.Commit()
+	}
+	panicked = false
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// bind opens gorm over common with ctx, gorm has no way to pass a context
+// to the statements it runs
+func bind(db *gorm.DB, ctx context.Context, common contextCommon) *gorm.DB {
+	o := getOptions(db)
+	conn, err := gorm.Open(db.Dialect().GetName(), &contextDB{ctx: ctx, db: common})
+	if err != nil {
+		return db.Set(contextKey, ctx)
+	}
+	conn.SetLogger(gormLogger{})
+	if o.logMode {
+		conn.LogMode(true)
+	}
+	registerCallbacks(conn)
+	return conn.Set(optionsKey, o).Set(contextKey, ctx)
+}
+
+func boundContext(db *gorm.DB) context.Context {
+	if v, ok := db.Get(contextKey); ok {
+		if ctx, ok := v.(context.Context); ok {
+			return ctx
+		}
+	}
+	return context.Background()
+}
+
+// sqlCommon returns the *sql.DB or *sql.Tx under db, bound to a context or not
+func sqlCommon(db *gorm.DB) (contextCommon, bool) {
+	switch common := db.CommonDB().(type) {
+	case *contextDB:
+		return common.db, true
+	case contextCommon:
+		return common, true
+	}
+	return nil, false
+}
+
+// contextCommon is the part of *sql.DB and *sql.Tx that takes a context
+type contextCommon interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// contextDB runs the statements of gorm with a context. It can't begin a
+// transaction, gorm then runs a single create, update or delete without one,
+// see Transaction.
+type contextDB struct {
+	ctx context.Context
+	db  contextCommon
+}
+
+func (c *contextDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	result, err := c.db.ExecContext(c.ctx, query, args...)
+	return result, c.err(err)
+}
+
+func (c *contextDB) Prepare(query string) (*sql.Stmt, error) {
+	stmt, err := c.db.PrepareContext(c.ctx, query)
+	return stmt, c.err(err)
+}
+
+func (c *contextDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := c.db.QueryContext(c.ctx, query, args...)
+	return rows, c.err(err)
+}
+
+func (c *contextDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, query, args...)
+}
+
+// err prefers the error of the context, drivers report a cancelled
+// statement differently
+func (c *contextDB) err(err error) error {
+	if err != nil && c.ctx.Err() != nil {
+		return c.ctx.Err()
+	}
+	return err
+}
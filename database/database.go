@@ -1,6 +1,8 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 
 type IDatabase interface {
 	SetPool(int, int, time.Duration) bool
+	Stats() sql.DBStats
 	GetDB() *gorm.DB
 	IsConnected() bool
 	Close() bool
@@ -20,9 +23,13 @@ type IDatabase interface {
 
 type database struct {
 	gormDB *gorm.DB
+	memory bool
 }
 
 func (db *database) SetPool(idleConns int, openConns int, duration time.Duration) bool {
+	if db.gormDB == nil {
+		return false
+	}
 	sqlDB := db.gormDB.DB()
 	sqlDB.SetMaxIdleConns(idleConns)
 	sqlDB.SetMaxOpenConns(openConns)
@@ -30,11 +37,21 @@ func (db *database) SetPool(idleConns int, openConns int, duration time.Duration
 	return true
 }
 
+func (db *database) Stats() sql.DBStats {
+	if db.gormDB == nil {
+		return sql.DBStats{}
+	}
+	return db.gormDB.DB().Stats()
+}
+
 func (db *database) GetDB() *gorm.DB {
 	return db.gormDB
 }
 
 func (db *database) IsConnected() bool {
+	if db.memory {
+		return true
+	}
 	if db.gormDB == nil {
 		return false
 	}
@@ -42,21 +59,47 @@ func (db *database) IsConnected() bool {
 }
 
 func (db *database) Close() bool {
+	if db.gormDB == nil {
+		return true
+	}
 	db.gormDB.Close()
 	return true
 }
 
-func NewDatabase(c *config.Database) (IDatabase, error) {
+// NewDatabase connects to the database of c, the connection gives up once
+// ctx is done
+func NewDatabase(ctx context.Context, c *config.Database) (IDatabase, error) {
+	o := &options{}
+	if len(c.QueryTimeout) > 0 {
+		d, err := time.ParseDuration(c.QueryTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("Database query timeout invalid: %q", c.QueryTimeout)
+		}
+		o.queryTimeout = d
+	}
+
 	db := &database{}
 	switch dialects.Dialect(c.Dialect) {
 	case dialects.Postgres:
-		db.gormDB = dialects.PostgreSQL(c)
+		db.gormDB = dialects.PostgreSQL(ctx, c)
 	case dialects.Sqlite:
 		db.gormDB = dialects.SqliteDB(c)
+		o.logMode = true
+	case dialects.Memory:
+		db.memory = true
 	default:
 		return nil, fmt.Errorf("Database not support: %q", c.Dialect)
 	}
 
+	if db.gormDB == nil && !db.memory {
+		return nil, fmt.Errorf("Database connect fail: %q", c.Dialect)
+	}
+	if db.gormDB != nil {
+		db.gormDB.SetLogger(gormLogger{})
+		registerCallbacks(db.gormDB)
+		db.gormDB = db.gormDB.Set(optionsKey, o)
+	}
+
 	log.Info("Create database success")
 	return db, nil
 }
@@ -9,4 +9,6 @@ func (d Dialect) String() string {
 const (
 	Postgres Dialect = "postgres"
 	Sqlite   Dialect = "sqlite"
+	// Memory keeps the data in the process, there is no database behind it
+	Memory Dialect = "memory"
 )
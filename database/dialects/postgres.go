@@ -1,6 +1,8 @@
 package dialects
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 
 	"github.com/jinzhu/gorm"
@@ -10,14 +12,26 @@ import (
 	"github/demo/utils/log"
 )
 
-func PostgreSQL(c *config.Database) *gorm.DB {
+// PostgreSQL connects to the database of c, giving up once ctx is done
+func PostgreSQL(ctx context.Context, c *config.Database) *gorm.DB {
 	connect := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", c.Host, c.Port, c.User, c.Name, c.Password)
 
-	pDB, err := gorm.Open("postgres", connect)
+	sqlDB, err := sql.Open("postgres", connect)
 	if err != nil {
 		log.Errorf("failed to connect database, %+v", err)
 		return nil
 	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		log.Errorf("failed to connect database, %+v", err)
+		return nil
+	}
+	pDB, err := gorm.Open("postgres", sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		log.Errorf("failed to connect database, %+v", err)
+		return nil
+	}
 
 	return pDB
 }
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"fmt"
+
+	"github/demo/utils/log"
+)
+
+// gormLogger writes the statements logged by gorm through the logger of the
+// service instead of stdout
+type gormLogger struct{}
+
+func (gormLogger) Print(v ...interface{}) {
+	if len(v) < 2 {
+		log.Debug(v...)
+		return
+	}
+
+	switch v[0] {
+	case "sql":
+		if len(v) < 6 {
+			break
+		}
+		log.Debugf("[gorm] %s %v [%v] %v rows affected", v[3], v[4], v[2], v[5])
+		return
+	case "log":
+		log.Debugf("[gorm] %s", fmt.Sprint(v[2:]...))
+		return
+	}
+	log.Debug(v...)
+}
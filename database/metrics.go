@@ -0,0 +1,34 @@
+package database
+
+import (
+	"database/sql"
+
+	"github/demo/utils/metrics"
+)
+
+// RegisterMetrics exposes the connection pool statistics of db on reg
+func RegisterMetrics(reg *metrics.Registry, db IDatabase) {
+	stat := func(name, help, typ string, value func(s sql.DBStats) float64) {
+		reg.Func(name, help, typ, nil, func(report func(float64, ...string)) error {
+			report(value(db.Stats()))
+			return nil
+		})
+	}
+
+	stat("demo_db_max_open_connections", "Maximum number of open connections to the database.", metrics.TypeGauge,
+		func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })
+	stat("demo_db_open_connections", "The number of established connections both in use and idle.", metrics.TypeGauge,
+		func(s sql.DBStats) float64 { return float64(s.OpenConnections) })
+	stat("demo_db_in_use_connections", "The number of connections currently in use.", metrics.TypeGauge,
+		func(s sql.DBStats) float64 { return float64(s.InUse) })
+	stat("demo_db_idle_connections", "The number of idle connections.", metrics.TypeGauge,
+		func(s sql.DBStats) float64 { return float64(s.Idle) })
+	stat("demo_db_wait_count_total", "The total number of connections waited for.", metrics.TypeCounter,
+		func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	stat("demo_db_wait_duration_seconds_total", "The total time blocked waiting for a new connection.", metrics.TypeCounter,
+		func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+	stat("demo_db_max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns.", metrics.TypeCounter,
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })
+	stat("demo_db_max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime.", metrics.TypeCounter,
+		func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) })
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+
+	"github/demo/utils/trace"
+)
+
+const (
+	contextKey = "demo:context"
+	spanKey    = "demo:span"
+)
+
+// registerCallbacks traces the statements of db and stops them once their
+// context is done. The callbacks are registered on db only, the defaults of
+// gorm are left untouched.
+func registerCallbacks(db *gorm.DB) {
+	cb := db.Callback()
+	cb.Create().Before("gorm:create").Register("demo:trace_before_create", beforeStatement("INSERT"))
+	cb.Create().After("gorm:create").Register("demo:trace_after_create", afterStatement)
+	cb.Query().Before("gorm:query").Register("demo:trace_before_query", beforeStatement("SELECT"))
+	cb.Query().After("gorm:query").Register("demo:trace_after_query", afterStatement)
+	cb.Update().Before("gorm:update").Register("demo:trace_before_update", beforeStatement("UPDATE"))
+	cb.Update().After("gorm:update").Register("demo:trace_after_update", afterStatement)
+	cb.Delete().Before("gorm:delete").Register("demo:trace_before_delete", beforeStatement("DELETE"))
+	cb.Delete().After("gorm:delete").Register("demo:trace_after_delete", afterStatement)
+	cb.RowQuery().Before("gorm:row_query").Register("demo:trace_before_row_query", beforeStatement("SELECT"))
+	cb.RowQuery().After("gorm:row_query").Register("demo:trace_after_row_query", afterStatement)
+}
+
+func beforeStatement(operation string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		ctx := scopeContext(scope)
+		if ctx == nil {
+			return
+		}
+		// ctx is done already, the statement is not even built
+		if err := ctx.Err(); err != nil {
+			scope.Err(err)
+			if v, ok := scope.InstanceGet("row_query_result"); ok {
+				if result, ok := v.(*gorm.RowsQueryResult); ok {
+					result.Error = err
+				}
+			}
+			scope.SkipLeft()
+			return
+		}
+
+		_, span := trace.StartKind(ctx, operation+" "+scope.TableName(), trace.KindClient)
+		span.SetAttribute("db.system", scope.Dialect().GetName())
+		span.SetAttribute("db.operation", operation)
+		span.SetAttribute("db.sql.table", scope.TableName())
+		scope.InstanceSet(spanKey, span)
+	}
+}
+
+func afterStatement(scope *gorm.Scope) {
+	// drivers report a cancelled statement differently, prefer the error
+	// of the context
+	if ctx := scopeContext(scope); ctx != nil && scope.DB().Error != nil && ctx.Err() != nil {
+		scope.DB().Error = ctx.Err()
+	}
+
+	v, ok := scope.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(*trace.Span)
+	if !ok {
+		return
+	}
+
+	span.SetAttribute("db.statement", scope.SQL)
+	span.SetAttribute("db.rows_affected", scope.DB().RowsAffected)
+	if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		span.SetError(err)
+	}
+	span.Finish()
+}
+
+func scopeContext(scope *gorm.Scope) context.Context {
+	v, ok := scope.Get(contextKey)
+	if !ok {
+		return nil
+	}
+	ctx, _ := v.(context.Context)
+	return ctx
+}
@@ -6,27 +6,89 @@ import (
 )
 
 const (
-	LogEnv     = "Logger_Env"
-	LogLevel   = "Logger_Level"
-	LogFile    = "Logger_Filename"
-	DBDialect  = "DB_Dialect"
-	DBHost     = "DB_Host"
-	DBPort     = "DB_Port"
-	DBName     = "DB_Name"
-	DBUser     = "DB_User"
-	DBPassword = "DB_Password"
+	ServerAddr           = "Server_Addr"
+	ServerRequestTimeout = "Server_RequestTimeout"
+	LogEnv               = "Logger_Env"
+	LogLevel             = "Logger_Level"
+	LogFile              = "Logger_Filename"
+	LogFormat            = "Logger_Format"
+	LogSinks             = "Logger_Sinks"
+	LogSyslog            = "Logger_Syslog"
+	LogFields            = "Logger_Fields"
+	LogMaxSize           = "Logger_MaxSize"
+	LogMaxAge            = "Logger_MaxAge"
+	LogMaxBackups        = "Logger_MaxBackups"
+	LogCompress          = "Logger_Compress"
+	AccessSkip           = "Access_Skip"
+	AccessSample         = "Access_Sample"
+	TraceExporter        = "Trace_Exporter"
+	TraceFilename        = "Trace_Filename"
+	TraceEndpoint        = "Trace_Endpoint"
+	TraceSampleRatio     = "Trace_SampleRatio"
+	DBDialect            = "DB_Dialect"
+	DBHost               = "DB_Host"
+	DBPort               = "DB_Port"
+	DBName               = "DB_Name"
+	DBUser               = "DB_User"
+	DBPassword           = "DB_Password"
+	DBQueryTimeout       = "DB_QueryTimeout"
+	HeartbeatOnline      = "Heartbeat_Online"
+	HeartbeatOffline     = "Heartbeat_Offline"
+	TelemetryRaw         = "Telemetry_Raw"
+	TelemetryMinute      = "Telemetry_Minute"
+	TelemetryHour        = "Telemetry_Hour"
+	TelemetryPurge       = "Telemetry_PurgeInterval"
+	CommandDefaultTTL    = "Command_DefaultTTL"
+	CommandMaxTTL        = "Command_MaxTTL"
+	CommandPollTimeout   = "Command_PollTimeout"
+	CommandRetention     = "Command_Retention"
+	CommandCleanup       = "Command_CleanupInterval"
+	FirmwareArtifactDir  = "Firmware_ArtifactDir"
+	FirmwareRollout      = "Firmware_RolloutInterval"
+	FirmwareSigningKEK   = "Firmware_SigningKEK"
 )
 
 var eVar []string = []string{
+	ServerAddr,
+	ServerRequestTimeout,
 	LogEnv,
 	LogLevel,
 	LogFile,
+	LogFormat,
+	LogSinks,
+	LogSyslog,
+	LogFields,
+	LogMaxSize,
+	LogMaxAge,
+	LogMaxBackups,
+	LogCompress,
+	AccessSkip,
+	AccessSample,
+	TraceExporter,
+	TraceFilename,
+	TraceEndpoint,
+	TraceSampleRatio,
 	DBDialect,
 	DBHost,
 	DBPort,
 	DBName,
 	DBUser,
 	DBPassword,
+	DBQueryTimeout,
+	HeartbeatOnline,
+	HeartbeatOffline,
+	TelemetryRaw,
+	TelemetryMinute,
+	TelemetryHour,
+	TelemetryPurge,
+	CommandDefaultTTL,
+	CommandMaxTTL,
+	CommandPollTimeout,
+	CommandRetention,
+	CommandCleanup,
+	FirmwareArtifactDir,
+	FirmwareRollout,
+	FirmwareSigningKEK,
 }
 
 type Variables map[string]interface{}
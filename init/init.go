@@ -1,12 +1,17 @@
 package init
 
 import (
+	"time"
+
 	"github/demo/config"
 	"github/demo/env"
 	"github/demo/utils/log"
+	"github/demo/utils/trace"
 )
 
-func Init() *config.Config {
+// Config reads the config from the environment, the config is returned with
+// the error of its validation
+func Config() (*config.Config, error) {
 	// Init env
 	vars := env.Init()
 
@@ -14,8 +19,48 @@ func Init() *config.Config {
 	cf := config.NewConfig()
 	cf.Init(vars)
 
+	return cf, cf.Validate()
+}
+
+// Logger sets up the logger and the tracer of cf
+func Logger(cf *config.Config) error {
 	// Init logger
-	log.Init(cf.Logger.Env, cf.Logger.Filename, cf.Logger.Level)
+	maxAge, err := parseDuration(cf.Logger.MaxAge)
+	if err != nil {
+		return err
+	}
+	err = log.Setup(log.Options{
+		Env:      cf.Logger.Env,
+		Level:    cf.Logger.Level,
+		Format:   cf.Logger.Format,
+		Sinks:    cf.Logger.Sinks,
+		Filename: cf.Logger.Filename,
+		Rotate: log.Rotate{
+			MaxSize:    cf.Logger.MaxSize,
+			MaxAge:     maxAge,
+			MaxBackups: cf.Logger.MaxBackups,
+			Compress:   cf.Logger.Compress,
+		},
+		Syslog: cf.Logger.Syslog,
+		Fields: cf.Logger.Fields,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Init tracer
+	return trace.Setup(trace.Options{
+		ServiceName: cf.Trace.ServiceName,
+		Exporter:    cf.Trace.Exporter,
+		Filename:    cf.Trace.Filename,
+		Endpoint:    cf.Trace.Endpoint,
+		SampleRatio: cf.Trace.SampleRatio,
+	})
+}
 
-	return cf
+func parseDuration(s string) (time.Duration, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
 }
@@ -0,0 +1,140 @@
+// Package migration versions the schema of the database. Every change of the
+// schema is appended to migrations with the next version, the applied ones are
+// recorded in the schema_migrations table.
+package migration
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github/demo/database"
+	"github/demo/utils/log"
+)
+
+// Migration is one versioned change of the schema
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(db *gorm.DB) error
+	Down    func(db *gorm.DB) error
+}
+
+// Status of one migration
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt int64
+}
+
+type record struct {
+	Version   int64  `gorm:"column:version;primary_key;auto_increment:false"`
+	Name      string `gorm:"column:name;not null"`
+	AppliedAt int64  `gorm:"column:applied_at;not null"`
+}
+
+func (record) TableName() string {
+	return "schema_migrations"
+}
+
+// Up applies the pending migrations in order, each one in a transaction, and
+// returns the applied ones
+func Up(db *gorm.DB) ([]*Migration, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []*Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := database.Transaction(db, func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&record{
+				Version:   m.Version,
+				Name:      m.Name,
+				AppliedAt: time.Now().UnixNano() / int64(time.Millisecond),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d %s up fail: %v", m.Version, m.Name, err)
+		}
+		log.Infof("migration %d %s applied", m.Version, m.Name)
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// the reverted ones
+func Down(db *gorm.DB, steps int) ([]*Migration, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []*Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := database.Transaction(db, func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Where("version = ?", m.Version).Delete(&record{}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d %s down fail: %v", m.Version, m.Name, err)
+		}
+		log.Infof("migration %d %s reverted", m.Version, m.Name)
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// List returns the status of every migration, oldest first
+func List(db *gorm.DB) ([]*Status, error) {
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var status []*Status
+	for _, m := range migrations {
+		r, ok := applied[m.Version]
+		s := &Status{
+			Version: m.Version,
+			Name:    m.Name,
+			Applied: ok,
+		}
+		if ok {
+			s.AppliedAt = r.AppliedAt
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+func appliedVersions(db *gorm.DB) (map[int64]*record, error) {
+	if err := db.AutoMigrate(&record{}).Error; err != nil {
+		return nil, err
+	}
+
+	var records []*record
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]*record)
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
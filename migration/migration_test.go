@@ -0,0 +1,139 @@
+package migration_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/config"
+	"github/demo/database"
+	"github/demo/migration"
+	"github/demo/model/catalog"
+	"github/demo/model/command"
+	"github/demo/model/device"
+	"github/demo/model/firmware"
+	"github/demo/model/group"
+	"github/demo/model/telemetry"
+)
+
+func setupDatabase(t *testing.T) (database.IDatabase, func(t *testing.T)) {
+	name := filepath.Join(os.TempDir(), "gorm"+uuid.Must(uuid.NewV4()).String()+".db")
+	df, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if df == nil || err != nil {
+		panic(fmt.Sprintf("No error should happen when creating db file, but got %+v", err))
+	}
+
+	db, err := database.NewDatabase(context.Background(), &config.Database{
+		Dialect: "sqlite",
+		Host:    df.Name(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, func(t *testing.T) {
+		db.Close()
+		os.Remove(df.Name())
+	}
+}
+
+func TestMigration(t *testing.T) {
+	db, teardown := setupDatabase(t)
+	defer teardown(t)
+
+	status, err := migration.List(db.GetDB())
+	assert.NoError(t, err)
+	for _, s := range status {
+		assert.False(t, s.Applied, "%d %s", s.Version, s.Name)
+	}
+
+	done, err := migration.Up(db.GetDB())
+	assert.NoError(t, err)
+	assert.Len(t, done, len(status))
+	assert.True(t, db.GetDB().HasTable(&device.Device{}))
+	assert.True(t, db.GetDB().HasTable(&device.History{}))
+	assert.True(t, db.GetDB().HasTable(&device.Label{}))
+	assert.True(t, db.GetDB().HasTable(&group.Group{}))
+	assert.True(t, db.GetDB().HasTable(&device.Member{}))
+	assert.True(t, db.GetDB().HasTable(&catalog.Model{}))
+	assert.True(t, db.GetDB().HasTable(&catalog.Color{}))
+	assert.True(t, db.GetDB().HasTable(&catalog.Version{}))
+	assert.True(t, db.GetDB().HasTable(&telemetry.Point{}))
+	assert.True(t, db.GetDB().HasTable(&telemetry.Rollup{}))
+	assert.True(t, db.GetDB().HasTable(&command.Command{}))
+	assert.True(t, db.GetDB().HasTable(&firmware.Release{}))
+	assert.True(t, db.GetDB().HasTable(&firmware.Campaign{}))
+	assert.True(t, db.GetDB().HasTable(&firmware.Target{}))
+	assert.True(t, db.GetDB().HasTable(&firmware.Key{}))
+	assert.True(t, db.GetDB().Dialect().HasColumn("firmware_release", "signature"))
+	assert.True(t, db.GetDB().Dialect().HasColumn("firmware_signing_key", "wrapped_key"))
+	assert.False(t, db.GetDB().Dialect().HasColumn("firmware_signing_key", "private_key"))
+	// a model is unique regardless of case
+	assert.NoError(t, db.GetDB().Create(&catalog.Model{Name: "Pro"}).Error)
+	assert.Error(t, db.GetDB().Create(&catalog.Model{Name: "PRO"}).Error)
+	assert.NoError(t, db.GetDB().Delete(&catalog.Model{Name: "Pro"}).Error)
+
+	// applied migrations are skipped
+	done, err = migration.Up(db.GetDB())
+	assert.NoError(t, err)
+	assert.Empty(t, done)
+
+	status, err = migration.List(db.GetDB())
+	assert.NoError(t, err)
+	for _, s := range status {
+		assert.True(t, s.Applied, "%d %s", s.Version, s.Name)
+		assert.NotZero(t, s.AppliedAt)
+	}
+
+	done, err = migration.Down(db.GetDB(), len(status))
+	assert.NoError(t, err)
+	assert.Len(t, done, len(status))
+	assert.Equal(t, int64(1), done[len(done)-1].Version)
+	assert.False(t, db.GetDB().HasTable(&device.History{}))
+	assert.False(t, db.GetDB().HasTable(&firmware.Key{}))
+	// the baseline of init.sql is kept
+	assert.True(t, db.GetDB().HasTable(&device.Device{}))
+
+	done, err = migration.Down(db.GetDB(), 1)
+	assert.NoError(t, err)
+	assert.Empty(t, done)
+
+	done, err = migration.Up(db.GetDB())
+	assert.NoError(t, err)
+	assert.Len(t, done, len(status))
+}
+
+func TestMigration_Baseline(t *testing.T) {
+	db, teardown := setupDatabase(t)
+	defer teardown(t)
+
+	// the table of init.sql, with a device stored before the migrations
+	assert.NoError(t, db.GetDB().Exec(`CREATE TABLE device (
+		id uuid NOT NULL PRIMARY KEY,
+		model text NOT NULL,
+		color text NOT NULL,
+		version text NOT NULL,
+		create_time bigint NOT NULL,
+		update_time bigint NOT NULL
+	)`).Error)
+	assert.NoError(t, db.GetDB().Exec(`INSERT INTO device VALUES
+		('c3b4a1d2-0000-4000-8000-000000000001', 'm1', 'red', 'v1', 1, 1)`).Error)
+
+	done, err := migration.Up(db.GetDB())
+	assert.NoError(t, err)
+
+	var d device.Device
+	assert.NoError(t, db.GetDB().First(&d).Error)
+	assert.Equal(t, "m1", d.Model)
+	assert.Equal(t, device.StateProvisioned, d.State)
+
+	_, err = migration.Down(db.GetDB(), len(done))
+	assert.NoError(t, err)
+	var count int
+	assert.NoError(t, db.GetDB().Table("device").Count(&count).Error)
+	assert.Equal(t, 1, count)
+}
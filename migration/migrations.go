@@ -0,0 +1,228 @@
+package migration
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// migrations of the schema, in version order, never edit an applied one. Each
+// runs on its own copy of the tables, see schema.go
+var migrations = []*Migration{
+	{
+		Version: 1,
+		Name:    "create_device",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&deviceV1{}).Error
+		},
+		// the device table is the baseline of init.sql, older than the
+		// migrations, it is kept with its data
+		Down: func(db *gorm.DB) error {
+			return nil
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_device_history",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&historyV2{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&historyV2{}).Error
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_device_label",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&labelV3{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&labelV3{}).Error
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_device_group",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&groupV4{}, &memberV4{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&memberV4{}, &groupV4{}).Error
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create_device_model",
+		Up: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&modelV5{}, &colorV5{}, &versionV5{}).Error; err != nil {
+				return err
+			}
+			return execPostgres(db, catalogForeignKeys)
+		},
+		Down: func(db *gorm.DB) error {
+			if err := execPostgres(db, dropCatalogForeignKeys); err != nil {
+				return err
+			}
+			return db.DropTableIfExists(&colorV5{}, &versionV5{}, &modelV5{}).Error
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add_device_state",
+		Up: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&deviceV6{}).Error; err != nil {
+				return err
+			}
+			// the devices stored before are provisioned
+			return db.Model(&deviceV6{}).Where("state IS NULL OR state = ''").
+				UpdateColumn("state", "provisioned").Error
+		},
+		Down: func(db *gorm.DB) error {
+			if err := db.Model(&deviceV6{}).RemoveIndex("idx_device_state").Error; err != nil {
+				return err
+			}
+			// SQLite can't drop a column, it is left unused
+			if db.Dialect().GetName() == "sqlite3" {
+				return nil
+			}
+			return db.Model(&deviceV6{}).DropColumn("state").Error
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add_device_heartbeat",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&deviceV7{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			if err := db.Model(&deviceV7{}).RemoveIndex("idx_device_last_seen").Error; err != nil {
+				return err
+			}
+			// SQLite can't drop a column, they are left unused
+			if db.Dialect().GetName() == "sqlite3" {
+				return nil
+			}
+			if err := db.Model(&deviceV7{}).DropColumn("firmware").Error; err != nil {
+				return err
+			}
+			return db.Model(&deviceV7{}).DropColumn("last_seen").Error
+		},
+	},
+	{
+		Version: 8,
+		Name:    "create_device_telemetry",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&pointV8{}, &rollupV8{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&rollupV8{}, &pointV8{}).Error
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_device_shadow",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&deviceV9{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			// SQLite can't drop a column, they are left unused
+			if db.Dialect().GetName() == "sqlite3" {
+				return nil
+			}
+			for _, column := range []string{"shadow_version", "desired_version", "desired_color"} {
+				if err := db.Model(&deviceV9{}).DropColumn(column).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 10,
+		Name:    "create_device_command",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&commandV10{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&commandV10{}).Error
+		},
+	},
+	{
+		Version: 11,
+		Name:    "create_firmware",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&releaseV11{}, &campaignV11{}, &targetV11{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&targetV11{}, &campaignV11{}, &releaseV11{}).Error
+		},
+	},
+	{
+		Version: 12,
+		Name:    "add_firmware_signing",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&keyV12{}, &releaseV12{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			if err := db.DropTableIfExists(&keyV12{}).Error; err != nil {
+				return err
+			}
+			// SQLite can't drop a column, they are left unused
+			if db.Dialect().GetName() == "sqlite3" {
+				return nil
+			}
+			for _, column := range []string{"key_id", "signature"} {
+				if err := db.Model(&releaseV12{}).DropColumn(column).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add_device_model_name_index",
+		// a model is unique regardless of case, models stored before that
+		// differ in case only fail the migration and have to be merged first
+		Up: func(db *gorm.DB) error {
+			return db.Exec("CREATE UNIQUE INDEX idx_device_model_lower_name ON device_model (lower(name))").Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.Exec("DROP INDEX IF EXISTS idx_device_model_lower_name").Error
+		},
+	},
+}
+
+// catalogForeignKeys tie the devices to the catalog. The devices stored
+// before are not checked, NOT VALID leaves them to the mismatch report.
+var catalogForeignKeys = []string{
+	`ALTER TABLE device_model_color ADD CONSTRAINT fk_device_model_color_model
+		FOREIGN KEY (model) REFERENCES device_model (name) ON DELETE CASCADE`,
+	`ALTER TABLE device_model_version ADD CONSTRAINT fk_device_model_version_model
+		FOREIGN KEY (model) REFERENCES device_model (name) ON DELETE CASCADE`,
+	`ALTER TABLE device ADD CONSTRAINT fk_device_model
+		FOREIGN KEY (model) REFERENCES device_model (name) NOT VALID`,
+	`ALTER TABLE device ADD CONSTRAINT fk_device_model_color
+		FOREIGN KEY (model, color) REFERENCES device_model_color (model, color) NOT VALID`,
+	`ALTER TABLE device ADD CONSTRAINT fk_device_model_version
+		FOREIGN KEY (model, version) REFERENCES device_model_version (model, version) NOT VALID`,
+}
+
+var dropCatalogForeignKeys = []string{
+	`ALTER TABLE device DROP CONSTRAINT IF EXISTS fk_device_model_version`,
+	`ALTER TABLE device DROP CONSTRAINT IF EXISTS fk_device_model_color`,
+	`ALTER TABLE device DROP CONSTRAINT IF EXISTS fk_device_model`,
+}
+
+// execPostgres runs statements on Postgres only. SQLite can't add a
+// constraint to a table, the service checks the catalog on every backend.
+func execPostgres(db *gorm.DB, statements []string) error {
+	if db.Dialect().GetName() != "postgres" {
+		return nil
+	}
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
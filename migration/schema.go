@@ -0,0 +1,231 @@
+package migration
+
+// The tables as each migration left them. A migration runs on these copies,
+// never on the models, so a later change to a model does not change what an
+// applied migration did. Never edit them, a new column is a new migration
+// with its own copy.
+
+// deviceV1 is the device table of init.sql
+type deviceV1 struct {
+	Id         string `gorm:"column:id;unique;type:uuid;primary_key"`
+	Model      string `gorm:"column:model;not null"`
+	Color      string `gorm:"column:color;not null"`
+	Version    string `gorm:"column:version;not null"`
+	CreateTime int64  `gorm:"column:create_time;not null"`
+	UpdateTime int64  `gorm:"column:update_time;not null"`
+}
+
+func (deviceV1) TableName() string {
+	return "device"
+}
+
+type historyV2 struct {
+	Id         uint64 `gorm:"column:id;primary_key"`
+	DeviceId   string `gorm:"column:device_id;type:uuid;not null;index:idx_device_history_device_id"`
+	Action     string `gorm:"column:action;not null"`
+	Actor      string `gorm:"column:actor;not null"`
+	RequestId  string `gorm:"column:request_id;not null"`
+	Changes    string `gorm:"column:changes;type:text;not null"`
+	CreateTime int64  `gorm:"column:create_time;not null"`
+}
+
+func (historyV2) TableName() string {
+	return "device_history"
+}
+
+type labelV3 struct {
+	DeviceId string `gorm:"column:device_id;type:uuid;primary_key"`
+	Key      string `gorm:"column:label_key;primary_key;index:idx_device_label_key_value"`
+	Value    string `gorm:"column:label_value;not null;index:idx_device_label_key_value"`
+}
+
+func (labelV3) TableName() string {
+	return "device_label"
+}
+
+type groupV4 struct {
+	Id         string  `gorm:"column:id;unique;type:uuid;primary_key"`
+	ParentId   *string `gorm:"column:parent_id;type:uuid;index:idx_device_group_parent_id"`
+	Name       string  `gorm:"column:name;not null"`
+	CreateTime int64   `gorm:"column:create_time;not null"`
+	UpdateTime int64   `gorm:"column:update_time;not null"`
+}
+
+func (groupV4) TableName() string {
+	return "device_group"
+}
+
+type memberV4 struct {
+	GroupId  string `gorm:"column:group_id;type:uuid;primary_key"`
+	DeviceId string `gorm:"column:device_id;type:uuid;primary_key;index:idx_device_group_member_device_id"`
+}
+
+func (memberV4) TableName() string {
+	return "device_group_member"
+}
+
+type modelV5 struct {
+	Name       string `gorm:"column:name;primary_key"`
+	CreateTime int64  `gorm:"column:create_time;not null"`
+	UpdateTime int64  `gorm:"column:update_time;not null"`
+}
+
+func (modelV5) TableName() string {
+	return "device_model"
+}
+
+type colorV5 struct {
+	Model string `gorm:"column:model;primary_key"`
+	Color string `gorm:"column:color;primary_key"`
+}
+
+func (colorV5) TableName() string {
+	return "device_model_color"
+}
+
+type versionV5 struct {
+	Model   string `gorm:"column:model;primary_key"`
+	Version string `gorm:"column:version;primary_key"`
+}
+
+func (versionV5) TableName() string {
+	return "device_model_version"
+}
+
+// deviceV6 holds the columns added by version 6 only, AutoMigrate adds the
+// missing ones to the table
+type deviceV6 struct {
+	State string `gorm:"column:state;index:idx_device_state"`
+}
+
+func (deviceV6) TableName() string {
+	return "device"
+}
+
+type deviceV7 struct {
+	LastSeen int64  `gorm:"column:last_seen;not null;default:0;index:idx_device_last_seen"`
+	Firmware string `gorm:"column:firmware"`
+}
+
+func (deviceV7) TableName() string {
+	return "device"
+}
+
+type pointV8 struct {
+	DeviceId string  `gorm:"column:device_id;type:uuid;primary_key"`
+	Metric   string  `gorm:"column:metric;primary_key"`
+	Time     int64   `gorm:"column:point_time;primary_key;auto_increment:false;index:idx_device_telemetry_time"`
+	Value    float64 `gorm:"column:value;not null"`
+}
+
+func (pointV8) TableName() string {
+	return "device_telemetry"
+}
+
+type rollupV8 struct {
+	DeviceId string  `gorm:"column:device_id;type:uuid;primary_key"`
+	Metric   string  `gorm:"column:metric;primary_key"`
+	Step     int64   `gorm:"column:step;primary_key;auto_increment:false;index:idx_device_telemetry_rollup_time"`
+	Time     int64   `gorm:"column:bucket_time;primary_key;auto_increment:false;index:idx_device_telemetry_rollup_time"`
+	Count    int64   `gorm:"column:total;not null"`
+	Sum      float64 `gorm:"column:sum_value;not null"`
+	Min      float64 `gorm:"column:min_value;not null"`
+	Max      float64 `gorm:"column:max_value;not null"`
+}
+
+func (rollupV8) TableName() string {
+	return "device_telemetry_rollup"
+}
+
+type deviceV9 struct {
+	DesiredColor   string `gorm:"column:desired_color"`
+	DesiredVersion string `gorm:"column:desired_version"`
+	ShadowVersion  int64  `gorm:"column:shadow_version;not null;default:0"`
+}
+
+func (deviceV9) TableName() string {
+	return "device"
+}
+
+type commandV10 struct {
+	Id         string `gorm:"column:id;type:uuid;primary_key"`
+	DeviceId   string `gorm:"column:device_id;type:uuid;not null;index:idx_device_command_device_id"`
+	Name       string `gorm:"column:name;not null"`
+	Payload    string `gorm:"column:payload;type:text;not null"`
+	Status     string `gorm:"column:status;not null;index:idx_device_command_status"`
+	Result     string `gorm:"column:result;type:text;not null"`
+	CreateTime int64  `gorm:"column:create_time;not null"`
+	UpdateTime int64  `gorm:"column:update_time;not null"`
+	ExpireTime int64  `gorm:"column:expire_time;not null;index:idx_device_command_expire_time"`
+}
+
+func (commandV10) TableName() string {
+	return "device_command"
+}
+
+type releaseV11 struct {
+	Id         string `gorm:"column:id;type:uuid;primary_key"`
+	Model      string `gorm:"column:model;not null;unique_index:uix_firmware_release_model_version"`
+	Version    string `gorm:"column:version;not null;unique_index:uix_firmware_release_model_version"`
+	Checksum   string `gorm:"column:checksum;not null"`
+	Size       int64  `gorm:"column:size;not null"`
+	Notes      string `gorm:"column:notes;type:text;not null"`
+	CreateTime int64  `gorm:"column:create_time;not null"`
+}
+
+func (releaseV11) TableName() string {
+	return "firmware_release"
+}
+
+type campaignV11 struct {
+	Id               string  `gorm:"column:id;type:uuid;primary_key"`
+	ReleaseId        string  `gorm:"column:release_id;type:uuid;not null;index:idx_firmware_campaign_release_id"`
+	Selector         string  `gorm:"column:selector;not null"`
+	Waves            string  `gorm:"column:waves;not null"`
+	Wave             int     `gorm:"column:wave;not null"`
+	Status           string  `gorm:"column:status;not null;index:idx_firmware_campaign_status"`
+	FailureThreshold float64 `gorm:"column:failure_threshold;not null"`
+	Timeout          int64   `gorm:"column:timeout;not null"`
+	Reason           string  `gorm:"column:reason;not null"`
+	CreateTime       int64   `gorm:"column:create_time;not null"`
+	UpdateTime       int64   `gorm:"column:update_time;not null"`
+}
+
+func (campaignV11) TableName() string {
+	return "firmware_campaign"
+}
+
+type targetV11 struct {
+	CampaignId string `gorm:"column:campaign_id;type:uuid;primary_key"`
+	DeviceId   string `gorm:"column:device_id;type:uuid;primary_key;index:idx_firmware_campaign_device_device_id"`
+	Wave       int    `gorm:"column:wave;not null"`
+	Status     string `gorm:"column:status;not null"`
+	StartTime  int64  `gorm:"column:start_time;not null"`
+	UpdateTime int64  `gorm:"column:update_time;not null"`
+}
+
+func (targetV11) TableName() string {
+	return "firmware_campaign_device"
+}
+
+type keyV12 struct {
+	Id         string `gorm:"column:id;primary_key"`
+	PublicKey  string `gorm:"column:public_key;type:text;not null"`
+	WrappedKey string `gorm:"column:wrapped_key;type:text;not null"`
+	Status     string `gorm:"column:status;not null;index:idx_firmware_signing_key_status"`
+	CreateTime int64  `gorm:"column:create_time;not null"`
+	RetireTime int64  `gorm:"column:retire_time;not null"`
+}
+
+func (keyV12) TableName() string {
+	return "firmware_signing_key"
+}
+
+type releaseV12 struct {
+	Signature string `gorm:"column:signature;type:text;not null;default:''"`
+	KeyId     string `gorm:"column:key_id;not null;default:''"`
+}
+
+func (releaseV12) TableName() string {
+	return "firmware_release"
+}
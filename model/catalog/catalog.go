@@ -0,0 +1,76 @@
+package catalog
+
+import (
+	"context"
+
+	"github/demo/model"
+)
+
+// Model is a product model of the catalog, with the colors it comes in and
+// the versions it supports
+type Model struct {
+	Name       string   `gorm:"column:name;primary_key"`
+	Colors     []string `gorm:"-"`
+	Versions   []string `gorm:"-"`
+	CreateTime int64    `gorm:"column:create_time;not null"`
+	UpdateTime int64    `gorm:"column:update_time;not null"`
+}
+
+func (Model) TableName() string {
+	return "device_model"
+}
+
+// Color is a color a model comes in
+type Color struct {
+	Model string `gorm:"column:model;primary_key"`
+	Color string `gorm:"column:color;primary_key"`
+}
+
+func (Color) TableName() string {
+	return "device_model_color"
+}
+
+// Version is a version a model supports
+type Version struct {
+	Model   string `gorm:"column:model;primary_key"`
+	Version string `gorm:"column:version;primary_key"`
+}
+
+func (Version) TableName() string {
+	return "device_model_version"
+}
+
+// HasColor reports whether m comes in color
+func (m *Model) HasColor(color string) bool {
+	for _, c := range m.Colors {
+		if c == color {
+			return true
+		}
+	}
+	return false
+}
+
+// HasVersion reports whether m supports version
+func (m *Model) HasVersion(version string) bool {
+	for _, v := range m.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+type Repository interface {
+	// Get returns model name with its colors and versions, sorted. The name
+	// is compared case-insensitively, as a model is unique regardless of case.
+	Get(ctx context.Context, name string) (*Model, error)
+	// Create stores m, a model of the same name regardless of case can't be
+	// stored twice
+	Create(ctx context.Context, m *Model) (*Model, error)
+	// Update replaces the colors and the versions of m
+	Update(ctx context.Context, m *Model) (int64, error)
+	// Delete removes model name with its colors and versions
+	Delete(ctx context.Context, name string) (int64, error)
+	// Find returns the models ordered by name
+	Find(ctx context.Context, p *model.Page) ([]*Model, error)
+}
@@ -0,0 +1,94 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github/demo/model"
+	"github/demo/model/device"
+)
+
+// Statuses of a command. A pending command is handed out to its device until
+// the device reports it delivered, succeeded or failed, or until it expires.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusExpired   = "expired"
+)
+
+// From are the statuses a command moves to each status from. A command
+// succeeded, failed or expired stays so.
+var From = map[string][]string{
+	StatusDelivered: {StatusPending},
+	StatusSucceeded: {StatusPending, StatusDelivered},
+	StatusFailed:    {StatusPending, StatusDelivered},
+	StatusExpired:   {StatusPending, StatusDelivered},
+}
+
+// IsStatus reports whether s is a status of a command
+func IsStatus(s string) bool {
+	_, ok := From[s]
+	return ok || s == StatusPending
+}
+
+// Open are the statuses of the commands a device still has to carry out
+var Open = []string{StatusPending, StatusDelivered}
+
+// maximum length of a command name
+const maxNameLen = 63
+
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+// ValidateName returns why name can't be the name of a command, or nil.
+// Command names follow the rules of metric names.
+func ValidateName(name string) error {
+	if len(name) == 0 || len(name) > maxNameLen || !nameRegexp.MatchString(name) {
+		return fmt.Errorf("command name %q invalid", name)
+	}
+	return nil
+}
+
+// Command is a command queued for a device, such as a reboot
+type Command struct {
+	Id       device.UUID `gorm:"column:id;type:uuid;primary_key"`
+	DeviceId device.UUID `gorm:"column:device_id;type:uuid;not null;index:idx_device_command_device_id"`
+	Name     string      `gorm:"column:name;not null"`
+	// Payload is the JSON object of the arguments, empty for none
+	Payload string `gorm:"column:payload;type:text;not null"`
+	Status  string `gorm:"column:status;not null;index:idx_device_command_status"`
+	// Result is what the device reported with the status
+	Result     string `gorm:"column:result;type:text;not null"`
+	CreateTime int64  `gorm:"column:create_time;not null"`
+	UpdateTime int64  `gorm:"column:update_time;not null"`
+	// ExpireTime is when the command expires unless it is succeeded or
+	// failed by then
+	ExpireTime int64 `gorm:"column:expire_time;not null;index:idx_device_command_expire_time"`
+}
+
+func (Command) TableName() string {
+	return "device_command"
+}
+
+type Repository interface {
+	Create(ctx context.Context, c *Command) (*Command, error)
+	Get(ctx context.Context, id device.UUID) (*Command, error)
+	// Next returns the oldest pending command of device id not expired at
+	// now, nil when there is none
+	Next(ctx context.Context, id device.UUID, now int64) (*Command, error)
+	// SetStatus moves command id to status to with result if it is in any of
+	// the statuses from and not expired at now, and returns 0 when it isn't
+	// or there is no command id
+	SetStatus(ctx context.Context, id device.UUID, from []string, to, result string, now int64) (int64, error)
+	// Find returns the commands of device id, in status unless it is empty,
+	// newest first
+	Find(ctx context.Context, id device.UUID, status string, p *model.Page) ([]*Command, error)
+	// Expire moves the open commands expiring before now to expired and
+	// returns how many were moved
+	Expire(ctx context.Context, now int64) (int64, error)
+	// Purge deletes the commands that are neither pending nor delivered, last
+	// updated before before, and returns how many were deleted
+	Purge(ctx context.Context, before int64) (int64, error)
+}
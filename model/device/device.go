@@ -1,6 +1,8 @@
 package device
 
 import (
+	"context"
+
 	"github/demo/model"
 
 	"github.com/jinzhu/gorm"
@@ -17,18 +19,108 @@ type Device struct {
 	Version    string `gorm:"column:version;not null" mapKey:"version,omitempty"`
 	CreateTime int64  `gorm:"column:create_time;not null" mapKey:"ignore"`
 	UpdateTime int64  `gorm:"column:update_time;not null" mapKey:"update_time"`
+	// State is the lifecycle state, it only changes through SetState
+	State string `gorm:"column:state;index:idx_device_state" mapKey:"ignore"`
+	// LastSeen is the time of the last heartbeat, 0 when there was none. It
+	// and the reported Firmware only change through Heartbeat.
+	LastSeen int64  `gorm:"column:last_seen;not null;default:0;index:idx_device_last_seen" mapKey:"ignore"`
+	Firmware string `gorm:"column:firmware" mapKey:"ignore"`
+	// DesiredColor and DesiredVersion are the config an operator wants the
+	// device to run, empty when there is none, Color and Version are the
+	// config it reports. They and ShadowVersion only change through
+	// AdvanceShadow.
+	DesiredColor   string `gorm:"column:desired_color" mapKey:"ignore"`
+	DesiredVersion string `gorm:"column:desired_version" mapKey:"ignore"`
+	ShadowVersion  int64  `gorm:"column:shadow_version;not null;default:0" mapKey:"ignore"`
+
+	// Selector narrows a filter down to the devices whose labels it selects,
+	// it is never stored
+	Selector *Selector `gorm:"-" mapKey:"ignore"`
+	// Membership narrows a filter down to the members of groups, it is never
+	// stored
+	Membership *Membership `gorm:"-" mapKey:"ignore"`
+	// Seen narrows a filter down to the devices last seen in a time range,
+	// it is never stored
+	Seen *SeenRange `gorm:"-" mapKey:"ignore"`
+}
+
+// Desired is the config an operator wants a device to run, an empty field
+// wants nothing
+type Desired struct {
+	Color   string
+	Version string
+}
+
+// SeenRange selects the devices last seen at or after Since and before
+// Before, a zero bound is open. A device never seen was last seen at 0.
+type SeenRange struct {
+	Since  int64
+	Before int64
+}
+
+// Membership selects the devices that are members of any of GroupIds
+type Membership struct {
+	GroupIds []UUID
+}
+
+// Member makes a device a member of a group, a device can be in many groups
+type Member struct {
+	GroupId  UUID `gorm:"column:group_id;type:uuid;primary_key"`
+	DeviceId UUID `gorm:"column:device_id;type:uuid;primary_key;index:idx_device_group_member_device_id"`
+}
+
+func (Member) TableName() string {
+	return "device_group_member"
 }
 
 func (Device) TableName() string {
 	return "device"
 }
 
+// Count is the number of devices of one model and version
+type Count struct {
+	Model   string `gorm:"column:model"`
+	Version string `gorm:"column:version"`
+	Total   int64  `gorm:"column:total"`
+}
+
 type Repository interface {
-	Get(id UUID) (*Device, error)
-	Create(d *Device) (*Device, error)
-	Update(d *Device) (*Device, int64, error)
-	Delete(id UUID) (int64, error)
-	List(d *Device) ([]*Device, error)
-	Find(d *Device, p *model.Page) ([]*Device, error)
+	Get(ctx context.Context, id UUID) (*Device, error)
+	Create(ctx context.Context, d *Device) (*Device, error)
+	Update(ctx context.Context, d *Device) (*Device, int64, error)
+	Delete(ctx context.Context, id UUID) (int64, error)
+	List(ctx context.Context, d *Device) ([]*Device, error)
+	Find(ctx context.Context, d *Device, p *model.Page) ([]*Device, error)
+	// Iterate calls fn with the devices matching the non-zero fields of d one
+	// at a time, reading them from the database as fn goes. A nil p or a zero
+	// p.Limit iterates all of them. Iterate stops at the first error of fn and
+	// returns it.
+	Iterate(ctx context.Context, d *Device, p *model.Page, fn func(*Device) error) error
+	Count(ctx context.Context) ([]*Count, error)
+	// SetLabels adds labels to device id, replacing the values of the keys
+	// it already has
+	SetLabels(ctx context.Context, id UUID, labels map[string]string) error
+	// RemoveLabels removes the labels keys of device id, all of them when
+	// keys is empty, and returns how many were removed
+	RemoveLabels(ctx context.Context, id UUID, keys ...string) (int64, error)
+	// Labels returns the labels of the devices ids, by id. A device without
+	// labels is left out.
+	Labels(ctx context.Context, ids ...UUID) (map[UUID]map[string]string, error)
+	// AddMembers makes the devices ids members of group, adding a member
+	// again is not an error
+	AddMembers(ctx context.Context, group UUID, ids ...UUID) error
+	// RemoveMembers removes the devices ids from group, all of its members
+	// when ids is empty, and returns how many were removed
+	RemoveMembers(ctx context.Context, group UUID, ids ...UUID) (int64, error)
+	// SetState moves device id to state to if it is in any of the states
+	// from, and returns 0 when it isn't or there is no device id
+	SetState(ctx context.Context, id UUID, from []string, to string) (int64, error)
+	// Heartbeat records that device id was seen at seen, running firmware
+	// unless it is empty, and returns 0 when there is no device id
+	Heartbeat(ctx context.Context, id UUID, seen int64, firmware string) (int64, error)
+	// AdvanceShadow moves the shadow of device id from version from to
+	// from+1, replacing its desired config unless desired is nil, and returns
+	// 0 when it isn't at from or there is no device id
+	AdvanceShadow(ctx context.Context, id UUID, from int64, desired *Desired) (int64, error)
 	Query(query interface{}, args ...interface{}) *gorm.DB
 }
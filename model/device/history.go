@@ -0,0 +1,37 @@
+package device
+
+import (
+	"context"
+
+	"github/demo/model"
+)
+
+// Actions recorded in the history of a device
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// History is one change of a device, kept after the device is deleted
+type History struct {
+	Id        uint64 `gorm:"column:id;primary_key"`
+	DeviceId  UUID   `gorm:"column:device_id;type:uuid;not null;index:idx_device_history_device_id"`
+	Action    string `gorm:"column:action;not null"`
+	Actor     string `gorm:"column:actor;not null"`
+	RequestId string `gorm:"column:request_id;not null"`
+	// Changes is the JSON object of the changed fields, each with its value
+	// before and after
+	Changes    string `gorm:"column:changes;type:text;not null"`
+	CreateTime int64  `gorm:"column:create_time;not null"`
+}
+
+func (History) TableName() string {
+	return "device_history"
+}
+
+type HistoryRepository interface {
+	Create(ctx context.Context, h *History) error
+	// Find returns the history of a device, newest first
+	Find(ctx context.Context, id UUID, p *model.Page) ([]*History, error)
+}
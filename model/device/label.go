@@ -0,0 +1,39 @@
+package device
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Label is one key/value mark of a device
+type Label struct {
+	DeviceId UUID   `gorm:"column:device_id;type:uuid;primary_key"`
+	Key      string `gorm:"column:label_key;primary_key;index:idx_device_label_key_value"`
+	Value    string `gorm:"column:label_value;not null;index:idx_device_label_key_value"`
+}
+
+func (Label) TableName() string {
+	return "device_label"
+}
+
+// maximum length of a label key or value
+const maxLabelLen = 63
+
+var (
+	labelKeyRegexp   = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_./]*[A-Za-z0-9])?$`)
+	labelValueRegexp = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?)?$`)
+)
+
+// ValidateLabel returns why key and value can't be a label, or nil. Keys and
+// values follow the Kubernetes rules: up to 63 alphanumerics, '-', '_' or
+// '.', starting and ending with an alphanumeric, keys may hold a '/' too and
+// values may be empty.
+func ValidateLabel(key, value string) error {
+	if len(key) == 0 || len(key) > maxLabelLen || !labelKeyRegexp.MatchString(key) {
+		return fmt.Errorf("label key %q invalid", key)
+	}
+	if len(value) > maxLabelLen || !labelValueRegexp.MatchString(value) {
+		return fmt.Errorf("label value %q of %q invalid", value, key)
+	}
+	return nil
+}
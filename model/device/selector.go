@@ -0,0 +1,202 @@
+package device
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Operator of a selector requirement
+type Operator string
+
+const (
+	Equals       Operator = "="
+	NotEquals    Operator = "!="
+	In           Operator = "in"
+	NotIn        Operator = "notin"
+	Exists       Operator = "exists"
+	DoesNotExist Operator = "!"
+)
+
+// Requirement is one condition of a selector on the label Key
+type Requirement struct {
+	Key      string
+	Operator Operator
+	// Values holds one value for Equals and NotEquals, none for Exists and
+	// DoesNotExist
+	Values []string
+}
+
+// Matches reports whether labels meet r. As in Kubernetes, a device without
+// the label meets NotEquals and NotIn.
+func (r *Requirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case Exists:
+		return ok
+	case DoesNotExist:
+		return !ok
+	case Equals, In:
+		return ok && r.has(value)
+	case NotEquals, NotIn:
+		return !ok || !r.has(value)
+	}
+	return false
+}
+
+func (r *Requirement) has(value string) bool {
+	for _, v := range r.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Requirement) String() string {
+	switch r.Operator {
+	case Exists:
+		return r.Key
+	case DoesNotExist:
+		return "!" + r.Key
+	case In, NotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+	}
+	return r.Key + string(r.Operator) + r.Values[0]
+}
+
+// Selector selects the devices whose labels meet all of its requirements
+type Selector struct {
+	Requirements []*Requirement
+}
+
+// Matches reports whether labels meet every requirement of s
+func (s *Selector) Matches(labels map[string]string) bool {
+	for _, r := range s.Requirements {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Selector) String() string {
+	parts := make([]string, 0, len(s.Requirements))
+	for _, r := range s.Requirements {
+		parts = append(parts, r.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+var setRegexp = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// ParseSelector parses a Kubernetes style label selector, a comma separated
+// list of requirements:
+//
+//	site=tpe,env!=lab,batch in (a,b),tier notin (x),gpu,!deprecated
+//
+// An empty selector returns nil, which selects every device.
+func ParseSelector(selector string) (*Selector, error) {
+	parts, err := splitSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	s := &Selector{}
+	for _, part := range parts {
+		r, err := parseRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		s.Requirements = append(s.Requirements, r)
+	}
+	return s, nil
+}
+
+// splitSelector splits selector on the commas outside of parentheses
+func splitSelector(selector string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range selector {
+		switch c {
+		case '(':
+			if depth++; depth > 1 {
+				return nil, fmt.Errorf("selector %q has nested parentheses", selector)
+			}
+		case ')':
+			if depth--; depth < 0 {
+				return nil, fmt.Errorf("selector %q has unbalanced parentheses", selector)
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("selector %q has unbalanced parentheses", selector)
+	}
+	parts = append(parts, selector[start:])
+
+	if len(parts) == 1 && len(strings.TrimSpace(parts[0])) == 0 {
+		return nil, nil
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+		if len(parts[i]) == 0 {
+			return nil, fmt.Errorf("selector %q has an empty requirement", selector)
+		}
+	}
+	return parts, nil
+}
+
+func parseRequirement(part string) (*Requirement, error) {
+	r := &Requirement{}
+	switch {
+	case setRegexp.MatchString(part):
+		m := setRegexp.FindStringSubmatch(part)
+		r.Key, r.Operator = m[1], Operator(m[2])
+		if len(strings.TrimSpace(m[3])) == 0 {
+			return nil, fmt.Errorf("requirement %q has no values", part)
+		}
+		for _, v := range strings.Split(m[3], ",") {
+			r.Values = append(r.Values, strings.TrimSpace(v))
+		}
+		sort.Strings(r.Values)
+	case strings.HasPrefix(part, "!") && !strings.Contains(part, "="):
+		r.Key, r.Operator = strings.TrimSpace(part[1:]), DoesNotExist
+	case strings.Contains(part, "!="):
+		i := strings.Index(part, "!=")
+		r.Key, r.Operator = strings.TrimSpace(part[:i]), NotEquals
+		r.Values = []string{strings.TrimSpace(part[i+2:])}
+	case strings.Contains(part, "=="):
+		i := strings.Index(part, "==")
+		r.Key, r.Operator = strings.TrimSpace(part[:i]), Equals
+		r.Values = []string{strings.TrimSpace(part[i+2:])}
+	case strings.Contains(part, "="):
+		i := strings.Index(part, "=")
+		r.Key, r.Operator = strings.TrimSpace(part[:i]), Equals
+		r.Values = []string{strings.TrimSpace(part[i+1:])}
+	default:
+		r.Key, r.Operator = part, Exists
+	}
+
+	if len(r.Values) == 0 {
+		r.Values = nil
+		if err := ValidateLabel(r.Key, ""); err != nil {
+			return nil, fmt.Errorf("requirement %q: %v", part, err)
+		}
+		return r, nil
+	}
+	for _, v := range r.Values {
+		if err := ValidateLabel(r.Key, v); err != nil {
+			return nil, fmt.Errorf("requirement %q: %v", part, err)
+		}
+	}
+	return r, nil
+}
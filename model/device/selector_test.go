@@ -0,0 +1,92 @@
+package device_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/model/device"
+)
+
+func TestParseSelector(t *testing.T) {
+	tt := []struct {
+		description string
+		selector    string
+		expected    *device.Selector
+		wantErr     bool
+	}{
+		{
+			description: "empty",
+			selector:    " ",
+			expected:    nil,
+		},
+		{
+			description: "every operator",
+			selector:    "site=tpe, env!=lab,batch in (b, a),tier notin (x),gpu,!old,zone==1",
+			expected: &device.Selector{Requirements: []*device.Requirement{
+				{Key: "site", Operator: device.Equals, Values: []string{"tpe"}},
+				{Key: "env", Operator: device.NotEquals, Values: []string{"lab"}},
+				{Key: "batch", Operator: device.In, Values: []string{"a", "b"}},
+				{Key: "tier", Operator: device.NotIn, Values: []string{"x"}},
+				{Key: "gpu", Operator: device.Exists},
+				{Key: "old", Operator: device.DoesNotExist},
+				{Key: "zone", Operator: device.Equals, Values: []string{"1"}},
+			}},
+		},
+		{
+			description: "empty value",
+			selector:    "site=",
+			expected: &device.Selector{Requirements: []*device.Requirement{
+				{Key: "site", Operator: device.Equals, Values: []string{""}},
+			}},
+		},
+		{description: "empty requirement", selector: "site=tpe,,env", wantErr: true},
+		{description: "unbalanced", selector: "batch in (a,b", wantErr: true},
+		{description: "no values", selector: "batch in ()", wantErr: true},
+		{description: "invalid key", selector: "-site=tpe", wantErr: true},
+		{description: "invalid value", selector: "site=t p e", wantErr: true},
+		{description: "too long", selector: "site=" + string(make([]byte, 64)), wantErr: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			s, err := device.ParseSelector(tc.selector)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, s)
+		})
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	labels := map[string]string{"site": "tpe", "env": "prod"}
+
+	tt := []struct {
+		selector string
+		expected bool
+	}{
+		{"site=tpe", true},
+		{"site=khh", false},
+		{"site=tpe,env!=lab", true},
+		{"batch!=a", true},
+		{"env in (lab,prod)", true},
+		{"env notin (prod)", false},
+		{"batch notin (a)", true},
+		{"site", true},
+		{"batch", false},
+		{"!batch", true},
+		{"!site", false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.selector, func(t *testing.T) {
+			s, err := device.ParseSelector(tc.selector)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, s.Matches(labels))
+			assert.Equal(t, tc.selector, s.String())
+		})
+	}
+}
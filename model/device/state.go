@@ -0,0 +1,40 @@
+package device
+
+// Lifecycle states of a device
+const (
+	StateProvisioned    = "provisioned"
+	StateActive         = "active"
+	StateSuspended      = "suspended"
+	StateDecommissioned = "decommissioned"
+)
+
+// Transitions of the lifecycle, recorded in the history as their action
+const (
+	ActionActivate     = "activate"
+	ActionSuspend      = "suspend"
+	ActionDecommission = "decommission"
+)
+
+// Transition moves a device from any of the states From to To
+type Transition struct {
+	From []string
+	To   string
+}
+
+// Transitions are the allowed transitions by action. A decommissioned device
+// stays so.
+var Transitions = map[string]*Transition{
+	ActionActivate:     {From: []string{StateProvisioned, StateSuspended}, To: StateActive},
+	ActionSuspend:      {From: []string{StateActive}, To: StateSuspended},
+	ActionDecommission: {From: []string{StateProvisioned, StateActive, StateSuspended}, To: StateDecommissioned},
+}
+
+// Allows reports whether t moves a device in state
+func (t *Transition) Allows(state string) bool {
+	for _, s := range t.From {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package firmware
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github/demo/model"
+	"github/demo/model/device"
+)
+
+// maximum length of a model and of a version of a release
+const maxNameLen = 63
+
+var (
+	modelRegexp   = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	versionRegexp = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.+]*[A-Za-z0-9])?$`)
+)
+
+// Release is a firmware version of a model, its artifact is kept in the
+// artifact store under its id
+type Release struct {
+	Id      device.UUID `gorm:"column:id;type:uuid;primary_key"`
+	Model   string      `gorm:"column:model;not null;unique_index:uix_firmware_release_model_version"`
+	Version string      `gorm:"column:version;not null;unique_index:uix_firmware_release_model_version"`
+	// Checksum is the SHA-256 digest of the artifact, in hex
+	Checksum   string `gorm:"column:checksum;not null"`
+	Size       int64  `gorm:"column:size;not null"`
+	Notes      string `gorm:"column:notes;type:text;not null"`
+	CreateTime int64  `gorm:"column:create_time;not null"`
+	// Signature is the Ed25519 signature of SignedMessage by key KeyId, in
+	// base64, both empty for a release uploaded before releases were signed
+	Signature string `gorm:"column:signature;type:text;not null;default:''"`
+	KeyId     string `gorm:"column:key_id;not null;default:''"`
+}
+
+func (Release) TableName() string {
+	return "firmware_release"
+}
+
+// SignedMessage returns what the signature of r signs, its model, version,
+// size and checksum one per line. An artifact signed for another model or
+// version doesn't pass as r.
+func (r *Release) SignedMessage() []byte {
+	return []byte(fmt.Sprintf("%s\n%s\n%d\n%s", r.Model, r.Version, r.Size, r.Checksum))
+}
+
+// Validate returns why r can't be stored, or nil
+func (r *Release) Validate() error {
+	if len(r.Model) == 0 || len(r.Model) > maxNameLen || !modelRegexp.MatchString(r.Model) {
+		return fmt.Errorf("release model %q invalid", r.Model)
+	}
+	if len(r.Version) == 0 || len(r.Version) > maxNameLen || !versionRegexp.MatchString(r.Version) {
+		return fmt.Errorf("release version %q invalid", r.Version)
+	}
+	return nil
+}
+
+// Statuses of a campaign. A running campaign rolls its release out wave by
+// wave, until it completes or is paused or cancelled.
+const (
+	CampaignRunning   = "running"
+	CampaignPaused    = "paused"
+	CampaignCompleted = "completed"
+	CampaignCancelled = "cancelled"
+)
+
+// CampaignFrom are the statuses a campaign moves to each status from. A
+// campaign completed or cancelled stays so.
+var CampaignFrom = map[string][]string{
+	CampaignRunning:   {CampaignPaused},
+	CampaignPaused:    {CampaignRunning},
+	CampaignCompleted: {CampaignRunning},
+	CampaignCancelled: {CampaignRunning, CampaignPaused},
+}
+
+// Campaign rolls a release out to the devices of its model its selector
+// selects, in waves
+type Campaign struct {
+	Id        device.UUID `gorm:"column:id;type:uuid;primary_key"`
+	ReleaseId device.UUID `gorm:"column:release_id;type:uuid;not null;index:idx_firmware_campaign_release_id"`
+	// Selector is the label selector of the devices, empty for all of them
+	Selector string `gorm:"column:selector;not null"`
+	// Waves are the percentages of the devices updated by the end of each
+	// wave, such as 10,50,100, see ParseWaves
+	Waves string `gorm:"column:waves;not null"`
+	// Wave is the number of waves started
+	Wave   int    `gorm:"column:wave;not null"`
+	Status string `gorm:"column:status;not null;index:idx_firmware_campaign_status"`
+	// FailureThreshold is the rate of failed devices, in [0, 1], past which
+	// the campaign is paused
+	FailureThreshold float64 `gorm:"column:failure_threshold;not null"`
+	// Timeout is how long a device has to run the release, in milliseconds,
+	// before it fails
+	Timeout int64 `gorm:"column:timeout;not null"`
+	// Reason is why the campaign was last paused
+	Reason     string `gorm:"column:reason;not null"`
+	CreateTime int64  `gorm:"column:create_time;not null"`
+	UpdateTime int64  `gorm:"column:update_time;not null"`
+}
+
+func (Campaign) TableName() string {
+	return "firmware_campaign"
+}
+
+// ParseWaves parses waves such as "10,50,100", percentages rising up to 100
+func ParseWaves(waves string) ([]int, error) {
+	parts := strings.Split(waves, ",")
+	percents := make([]int, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n <= 0 || n > 100 || (len(percents) > 0 && n <= percents[len(percents)-1]) {
+			return nil, fmt.Errorf("waves %q invalid", waves)
+		}
+		percents = append(percents, n)
+	}
+	return percents, nil
+}
+
+// FormatWaves returns the waves of percents as ParseWaves parses them
+func FormatWaves(percents []int) string {
+	parts := make([]string, 0, len(percents))
+	for _, n := range percents {
+		parts = append(parts, strconv.Itoa(n))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Statuses of a device of a campaign. An updating device succeeds once it
+// reports the version of the release in a heartbeat, and fails when it
+// doesn't in time.
+const (
+	TargetUpdating  = "updating"
+	TargetSucceeded = "succeeded"
+	TargetFailed    = "failed"
+)
+
+// Target is a device a campaign updates, in wave Wave from 1
+type Target struct {
+	CampaignId device.UUID `gorm:"column:campaign_id;type:uuid;primary_key"`
+	DeviceId   device.UUID `gorm:"column:device_id;type:uuid;primary_key;index:idx_firmware_campaign_device_device_id"`
+	Wave       int         `gorm:"column:wave;not null"`
+	Status     string      `gorm:"column:status;not null"`
+	// StartTime is when the device was told to update
+	StartTime  int64 `gorm:"column:start_time;not null"`
+	UpdateTime int64 `gorm:"column:update_time;not null"`
+}
+
+func (Target) TableName() string {
+	return "firmware_campaign_device"
+}
+
+type Repository interface {
+	Create(ctx context.Context, r *Release) (*Release, error)
+	Get(ctx context.Context, id device.UUID) (*Release, error)
+	// Find returns the releases of model m and version, any of them when it
+	// is empty, newest first
+	Find(ctx context.Context, m, version string, p *model.Page) ([]*Release, error)
+	Delete(ctx context.Context, id device.UUID) (int64, error)
+}
+
+type CampaignRepository interface {
+	Create(ctx context.Context, c *Campaign) (*Campaign, error)
+	Get(ctx context.Context, id device.UUID) (*Campaign, error)
+	// Find returns the campaigns of release and in status, any of them when
+	// it is empty, newest first
+	Find(ctx context.Context, release device.UUID, status string, p *model.Page) ([]*Campaign, error)
+	// Update stores the status, wave, failure threshold, reason and update
+	// time of c if it is in any of the statuses from at wave wave, and
+	// returns 0 when it isn't or there is no campaign c
+	Update(ctx context.Context, c *Campaign, from []string, wave int) (int64, error)
+	// AddTargets adds the targets of a campaign, those already added are
+	// skipped, and returns how many were added
+	AddTargets(ctx context.Context, targets []*Target) (int64, error)
+	// Targets returns the targets of campaign id in status, all of them when
+	// it is empty, by wave and device id. A nil p returns all of them.
+	Targets(ctx context.Context, id device.UUID, status string, p *model.Page) ([]*Target, error)
+	// SetTargetStatus moves device deviceId of campaign id to status to if it
+	// is in status from, and returns 0 when it isn't
+	SetTargetStatus(ctx context.Context, id, deviceId device.UUID, from, to string, now int64) (int64, error)
+	// CountTargets returns the number of targets of campaign id by status
+	CountTargets(ctx context.Context, id device.UUID) (map[string]int64, error)
+}
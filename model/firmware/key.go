@@ -0,0 +1,42 @@
+package firmware
+
+import "context"
+
+// Statuses of a signing key. The active key signs the new releases, a key
+// retired by a rotation only verifies those it signed.
+const (
+	KeyActive  = "active"
+	KeyRetired = "retired"
+)
+
+// Key is an Ed25519 key pair signing the releases
+type Key struct {
+	// Id is the first 8 bytes of the SHA-256 digest of the public key, in
+	// hex
+	Id string `gorm:"column:id;primary_key"`
+	// PublicKey is in base64
+	PublicKey string `gorm:"column:public_key;type:text;not null"`
+	// WrappedKey is the private key sealed by the key-encryption key of the
+	// service, never stored in the clear
+	WrappedKey string `gorm:"column:wrapped_key;type:text;not null"`
+	Status     string `gorm:"column:status;not null;index:idx_firmware_signing_key_status"`
+	CreateTime int64  `gorm:"column:create_time;not null"`
+	// RetireTime is when the key was retired, 0 while it is active
+	RetireTime int64 `gorm:"column:retire_time;not null"`
+}
+
+func (Key) TableName() string {
+	return "firmware_signing_key"
+}
+
+type KeyRepository interface {
+	Get(ctx context.Context, id string) (*Key, error)
+	// Active returns the newest active key, gorm.ErrRecordNotFound when
+	// there is none
+	Active(ctx context.Context) (*Key, error)
+	// Find returns all the keys, newest first
+	Find(ctx context.Context) ([]*Key, error)
+	// Rotate retires the active keys at the create time of k and adds k as
+	// the active one, at once
+	Rotate(ctx context.Context, k *Key) error
+}
@@ -0,0 +1,37 @@
+package group
+
+import (
+	"context"
+
+	"github/demo/model"
+	"github/demo/model/device"
+)
+
+// Group is a fleet of devices, it may be nested in a parent group
+type Group struct {
+	Id device.UUID `gorm:"column:id;unique;type:uuid;primary_key"`
+	// ParentId is nil for a top level group
+	ParentId   *device.UUID `gorm:"column:parent_id;type:uuid;index:idx_device_group_parent_id"`
+	Name       string       `gorm:"column:name;not null"`
+	CreateTime int64        `gorm:"column:create_time;not null"`
+	UpdateTime int64        `gorm:"column:update_time;not null"`
+}
+
+// group is a reserved word in SQL
+func (Group) TableName() string {
+	return "device_group"
+}
+
+type Repository interface {
+	Get(ctx context.Context, id device.UUID) (*Group, error)
+	Create(ctx context.Context, g *Group) (*Group, error)
+	// Update sets the name and the parent of g, a nil ParentId makes it a
+	// top level group
+	Update(ctx context.Context, g *Group) (int64, error)
+	Delete(ctx context.Context, id device.UUID) (int64, error)
+	// Find returns the groups in parent, every group when parent is nil
+	Find(ctx context.Context, parent *device.UUID, p *model.Page) ([]*Group, error)
+	// Descendants returns id and the ids of every group nested in it, at any
+	// depth, or none when there is no group id
+	Descendants(ctx context.Context, id device.UUID) ([]device.UUID, error)
+}
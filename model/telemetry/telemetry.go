@@ -0,0 +1,95 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github/demo/model/device"
+)
+
+// Resolutions of the rollups, in milliseconds
+const (
+	Minute int64 = 60 * 1000
+	Hour   int64 = 60 * Minute
+)
+
+// maximum length of a metric name
+const maxMetricLen = 63
+
+var metricRegexp = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+// ValidateMetric returns why name can't be a metric, or nil. Metric names
+// follow the rules of label values, but can't be empty.
+func ValidateMetric(name string) error {
+	if len(name) == 0 || len(name) > maxMetricLen || !metricRegexp.MatchString(name) {
+		return fmt.Errorf("metric %q invalid", name)
+	}
+	return nil
+}
+
+// Point is one value of a metric reported by a device, at Time in
+// milliseconds. A device reports at most one value of a metric at a time.
+type Point struct {
+	DeviceId device.UUID `gorm:"column:device_id;type:uuid;primary_key"`
+	Metric   string      `gorm:"column:metric;primary_key"`
+	Time     int64       `gorm:"column:point_time;primary_key;auto_increment:false;index:idx_device_telemetry_time"`
+	Value    float64     `gorm:"column:value;not null"`
+}
+
+func (Point) TableName() string {
+	return "device_telemetry"
+}
+
+// Rollup sums up the points of a metric of a device in the bucket of Step
+// milliseconds starting at Time
+type Rollup struct {
+	DeviceId device.UUID `gorm:"column:device_id;type:uuid;primary_key"`
+	Metric   string      `gorm:"column:metric;primary_key"`
+	Step     int64       `gorm:"column:step;primary_key;auto_increment:false;index:idx_device_telemetry_rollup_time"`
+	Time     int64       `gorm:"column:bucket_time;primary_key;auto_increment:false;index:idx_device_telemetry_rollup_time"`
+	Count    int64       `gorm:"column:total;not null"`
+	Sum      float64     `gorm:"column:sum_value;not null"`
+	Min      float64     `gorm:"column:min_value;not null"`
+	Max      float64     `gorm:"column:max_value;not null"`
+}
+
+func (Rollup) TableName() string {
+	return "device_telemetry_rollup"
+}
+
+// Bucket sums up the points of a series starting at Time
+type Bucket struct {
+	Time  int64   `gorm:"column:bucket_time"`
+	Count int64   `gorm:"column:total"`
+	Sum   float64 `gorm:"column:sum_value"`
+	Min   float64 `gorm:"column:min_value"`
+	Max   float64 `gorm:"column:max_value"`
+}
+
+// Query selects the points of Metric of device DeviceId in [From, To), summed
+// up in buckets of Step. They are read from the rollups of Source, or the raw
+// points when Source is 0, Step must be a multiple of Source.
+type Query struct {
+	DeviceId device.UUID
+	Metric   string
+	From     int64
+	To       int64
+	Step     int64
+	Source   int64
+}
+
+type Repository interface {
+	// Append stores points and returns how many were stored, a point of a
+	// device, metric and time already stored is kept as it is
+	Append(ctx context.Context, points []*Point) (int64, error)
+	// Rollup recomputes the buckets of step of metrics of device id covering
+	// [from, to), from the rollups of source or the raw points when source is
+	// 0. from and to are multiples of step.
+	Rollup(ctx context.Context, id device.UUID, metrics []string, source, step, from, to int64) error
+	// Series returns the buckets of q holding points, by time
+	Series(ctx context.Context, q *Query) ([]*Bucket, error)
+	// Purge deletes the raw points before before, or the rollups of step
+	// when it isn't 0, and returns how many were deleted
+	Purge(ctx context.Context, step, before int64) (int64, error)
+}
@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"context"
+
 	"github.com/jinzhu/gorm"
 
 	"github/demo/config"
 	"github/demo/database"
+	"github/demo/migration"
 	"github/demo/utils/log"
 )
 
@@ -13,8 +16,9 @@ type Engine struct {
 	GormDB   *gorm.DB
 }
 
-func NewEngine(c *config.Config) (*Engine, error) {
-	db, err := database.NewDatabase(c.Database)
+// NewEngine connects to the database of c, giving up once ctx is done
+func NewEngine(ctx context.Context, c *config.Config) (*Engine, error) {
+	db, err := database.NewDatabase(ctx, c.Database)
 	if err != nil {
 		return nil, err
 	}
@@ -27,3 +31,13 @@ func NewEngine(c *config.Config) (*Engine, error) {
 	log.Info("Create engine success")
 	return e, nil
 }
+
+// Migrate applies the pending migrations, no statement starts once ctx is
+// done. The memory dialect has nothing to migrate.
+func (e *Engine) Migrate(ctx context.Context) error {
+	if e.GormDB == nil {
+		return nil
+	}
+	_, err := migration.Up(database.WithContext(e.GormDB, ctx))
+	return err
+}
@@ -0,0 +1,155 @@
+package catalog
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github/demo/rest/content"
+	"github/demo/rest/device"
+	"github/demo/service"
+	"github/demo/utils/trace"
+)
+
+type Model struct {
+	Name       string
+	Colors     []string
+	Versions   []string
+	CreateTime int64
+	UpdateTime int64
+}
+
+// Mismatch is a device that doesn't match the catalog, and the fields that
+// don't
+type Mismatch struct {
+	Device *device.Device
+	Fields []string
+}
+
+// Endpoint serves the model catalog routes with the services of one app
+type Endpoint struct {
+	Catalog service.ICatalogService
+}
+
+func (m *Model) serviceType() *service.Model {
+	return &service.Model{
+		Name:     m.Name,
+		Colors:   m.Colors,
+		Versions: m.Versions,
+	}
+}
+
+func (m *Model) Assemble(s *service.Model) {
+	m.Name = s.Name
+	m.Colors = s.Colors
+	m.Versions = s.Versions
+	m.CreateTime = s.CreateTime
+	m.UpdateTime = s.UpdateTime
+}
+
+func (e *Endpoint) FindModel(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "FindModel bind")
+	page := &service.Page{}
+	c.ShouldBindQuery(page)
+	span.Finish()
+
+	rows, code := e.Catalog.Find(c.Request.Context(), page)
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := []*Model{}
+		for _, v := range rows {
+			m := &Model{}
+			m.Assemble(v)
+			re = append(re, m)
+		}
+		resp.Data(&service.PagingContent{
+			Page:  page,
+			Datas: re,
+		})
+	}
+
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) GetModel(c *gin.Context) {
+	m, code := e.Catalog.Get(c.Request.Context(), c.Param("name"))
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := &Model{}
+		re.Assemble(m)
+		resp.Data(re)
+	}
+
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) CreateModel(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "CreateModel bind")
+	m := &Model{}
+	c.ShouldBindJSON(m)
+	span.Finish()
+
+	created, code := e.Catalog.Create(c.Request.Context(), m.serviceType())
+	resp := content.NewContent()
+
+	var re *Model
+	if code == service.ErrorCodeSuccess {
+		re = &Model{}
+		re.Assemble(created)
+	}
+	resp.Data(re)
+
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// UpdateModel replaces the colors and the versions of a model
+func (e *Endpoint) UpdateModel(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "UpdateModel bind")
+	m := &Model{}
+	c.ShouldBindJSON(m)
+	m.Name = c.Param("name")
+	span.Finish()
+
+	affect, code := e.Catalog.Update(c.Request.Context(), m.serviceType())
+	resp := content.NewContent()
+	resp.Data(map[string]int64{
+		"affect": affect,
+	})
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) DeleteModel(c *gin.Context) {
+	code := e.Catalog.Delete(c.Request.Context(), c.Param("name"))
+	resp := content.NewContent()
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// FindMismatch reports the devices that don't match the catalog, all of them
+// unless both page and number are given
+func (e *Endpoint) FindMismatch(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "FindMismatch bind")
+	page := &service.Page{}
+	c.ShouldBindQuery(page)
+	span.Finish()
+
+	rows, code := e.Catalog.Mismatches(c.Request.Context(), page)
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := []*Mismatch{}
+		for _, v := range rows {
+			d := &device.Device{}
+			d.Assemble(v.Device)
+			re = append(re, &Mismatch{Device: d, Fields: v.Fields})
+		}
+		resp.Data(&service.PagingContent{
+			Page:  page,
+			Datas: re,
+		})
+	}
+
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
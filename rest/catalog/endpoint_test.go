@@ -0,0 +1,181 @@
+package catalog_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/config"
+	"github/demo/daos"
+	"github/demo/database"
+	"github/demo/model/catalog"
+	"github/demo/model/device"
+	routeCatalog "github/demo/rest/catalog"
+	routeDevice "github/demo/rest/device"
+	"github/demo/service"
+)
+
+type CatalogTestCaseSuite struct {
+	db database.IDatabase
+	c  *gin.Engine
+}
+
+func setupCatalogTestCaseSuite(t *testing.T) (CatalogTestCaseSuite, func(t *testing.T)) {
+	s := CatalogTestCaseSuite{
+		c: gin.New(),
+	}
+	s.c.Use(gin.Recovery())
+
+	name := filepath.Join(os.TempDir(), "gorm"+uuid.Must(uuid.NewV4()).String()+".db")
+	df, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if df == nil || err != nil {
+		panic(fmt.Sprintf("No error should happen when creating db file, but got %+v", err))
+	}
+
+	c := &config.Database{
+		Dialect: "sqlite",
+		Host:    df.Name(),
+	}
+
+	s.db, err = database.NewDatabase(context.Background(), c)
+	s.db.GetDB().AutoMigrate(&device.Device{}, &device.History{}, &device.Label{}, &catalog.Model{}, &catalog.Color{}, &catalog.Version{})
+	deviceRepo := daos.NewDeviceRepo(s.db.GetDB())
+	catalogRepo := daos.NewCatalogRepo(s.db.GetDB())
+	v1 := s.c.Group("/v1")
+	routeDevice.MakeHandler(v1, service.NewDeviceService(deviceRepo, daos.NewHistoryRepo(s.db.GetDB()), catalogRepo, nil))
+	routeCatalog.MakeHandler(v1, service.NewCatalogService(catalogRepo, deviceRepo))
+
+	return s, func(t *testing.T) {
+		s.db.Close()
+		os.Remove(df.Name())
+	}
+}
+
+func TestCatalogHandler(t *testing.T) {
+	s, teardownTestCase := setupCatalogTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	s.db.GetDB().Create(&device.Device{Id: "c9d7c314-fd95-448a-8db9-4756cc774f7d", Model: "PRO ", Color: "White", Version: "v1.2"})
+
+	tt := []struct {
+		description  string
+		route        string
+		method       string
+		body         string
+		expected     string
+		expectedCode int
+	}{
+		{
+			description:  "create model",
+			route:        "/v1/model",
+			method:       "POST",
+			body:         `{"Name":"Pro","Colors":["White","Black"],"Versions":["v1.2"]}`,
+			expected:     `^{"code":2000000,"data":{"Name":"Pro","Colors":\["Black","White"\],"Versions":\["v1.2"\],"CreateTime":[0-9]+,"UpdateTime":[0-9]+},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "create existing model",
+			route:        "/v1/model",
+			method:       "POST",
+			body:         `{"Name":"Pro"}`,
+			expected:     `^{"code":4090002,"data":null,"msg":"Model already exists"}$`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			description:  "register device in the catalog",
+			route:        "/v1/device",
+			method:       "POST",
+			body:         `{"Model":"Pro","Color":"Black","Version":"v1.2"}`,
+			expected:     `^{"code":2000000,"data":{"Id":"[0-9a-f-]{36}","Model":"Pro",.*},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "register device out of the catalog",
+			route:        "/v1/device",
+			method:       "POST",
+			body:         `{"Model":"Lite","Color":"Black","Version":"v1.2"}`,
+			expected:     `^{"code":4000007,"data":null,"msg":"Device not in model catalog"}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "update device out of the catalog",
+			route:        "/v1/device",
+			method:       "PUT",
+			body:         `{"Id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Version":"v1.3"}`,
+			expected:     `^{"code":4000007,"data":{"affect":0},"msg":"Device not in model catalog"}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "report mismatches",
+			route:        "/v1/model/mismatch",
+			method:       "GET",
+			expected:     `^{"code":2000000,"data":{"page":{"page":0,"number":0},"datas":\[{"Device":{"Id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Model":"PRO ","Color":"White","Version":"v1.2","CreateTime":0,"UpdateTime":0},"Fields":\["model"\]}\]},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "remove a color in use",
+			route:        "/v1/model/Pro",
+			method:       "PUT",
+			body:         `{"Colors":["White"],"Versions":["v1.2"]}`,
+			expected:     `^{"code":4090001,"data":{"affect":0},"msg":"Model in use"}$`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			description:  "add a version",
+			route:        "/v1/model/Pro",
+			method:       "PUT",
+			body:         `{"Colors":["White","Black"],"Versions":["v1.2","v1.3"]}`,
+			expected:     `^{"code":2000000,"data":{"affect":1},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "get model",
+			route:        "/v1/model/Pro",
+			method:       "GET",
+			expected:     `^{"code":2000000,"data":{"Name":"Pro","Colors":\["Black","White"\],"Versions":\["v1.2","v1.3"\],.*},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "find models",
+			route:        "/v1/model?page=1&number=10",
+			method:       "GET",
+			expected:     `^{"code":2000000,"data":{"page":{"page":1,"number":10},"datas":\[{"Name":"Pro",.*}\]},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "delete model in use",
+			route:        "/v1/model/Pro",
+			method:       "DELETE",
+			expected:     `^{"code":4090001,"msg":"Model in use"}$`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			description:  "get unknown model",
+			route:        "/v1/model/Lite",
+			method:       "GET",
+			expected:     `^{"code":4040000,"msg":"Not found"}$`,
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.route, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", gin.MIMEJSON)
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, req)
+			assert.Equal(t, tc.expectedCode, actul.Code)
+			assert.Regexp(t, regexp.MustCompile(tc.expected), strings.Replace(actul.Body.String(), "\n", "", -1))
+		})
+	}
+}
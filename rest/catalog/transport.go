@@ -0,0 +1,21 @@
+package catalog
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github/demo/service"
+)
+
+func MakeHandler(r *gin.RouterGroup, s service.ICatalogService) {
+	e := &Endpoint{Catalog: s}
+
+	g := r.Group("/model")
+	{
+		g.GET("", e.FindModel)
+		g.GET("/mismatch", e.FindMismatch)
+		g.GET("/:name", e.GetModel)
+		g.POST("", e.CreateModel)
+		g.PUT("/:name", e.UpdateModel)
+		g.DELETE("/:name", e.DeleteModel)
+	}
+}
@@ -0,0 +1,188 @@
+package command
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github/demo/rest/content"
+	"github/demo/service"
+	"github/demo/utils/trace"
+)
+
+// Request queues command Name with the arguments of Payload, a JSON object.
+// TTL is a duration such as 10m, the default TTL when empty.
+type Request struct {
+	Name    string
+	Payload json.RawMessage
+	TTL     string
+}
+
+// Report is the status a device reports command Id in, delivered, succeeded
+// or failed
+type Report struct {
+	Id     string
+	Status string
+	Result string
+}
+
+type Command struct {
+	Id         string
+	DeviceId   string
+	Name       string
+	Payload    json.RawMessage `json:",omitempty"`
+	Status     string
+	Result     string
+	CreateTime int64
+	UpdateTime int64
+	ExpireTime int64
+}
+
+// HistoryQuery selects the commands of a device in Status, all of them when
+// it is empty
+type HistoryQuery struct {
+	Status string `form:"status"`
+	service.Page
+}
+
+// Endpoint serves the command routes with the services of one app
+type Endpoint struct {
+	Command service.ICommandService
+}
+
+// serviceType returns the request of r, false when its TTL isn't a duration
+func (r *Request) serviceType() (*service.CommandRequest, bool) {
+	var ttl time.Duration
+	if len(r.TTL) > 0 {
+		d, err := time.ParseDuration(r.TTL)
+		if err != nil || d <= 0 {
+			return nil, false
+		}
+		ttl = d
+	}
+	return &service.CommandRequest{
+		Name:    r.Name,
+		Payload: r.Payload,
+		TTL:     ttl,
+	}, true
+}
+
+func (c *Command) Assemble(r *service.Command) {
+	c.Id = r.Id
+	c.DeviceId = r.DeviceId
+	c.Name = r.Name
+	c.Payload = r.Payload
+	c.Status = r.Status
+	c.Result = r.Result
+	c.CreateTime = r.CreateTime
+	c.UpdateTime = r.UpdateTime
+	c.ExpireTime = r.ExpireTime
+}
+
+// EnqueueCommand queues a command for a device
+func (e *Endpoint) EnqueueCommand(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "EnqueueCommand bind")
+	r := &Request{}
+	err := c.ShouldBindJSON(r)
+	request, ok := r.serviceType()
+	span.Finish()
+
+	resp := content.NewContent()
+	if err != nil || !ok {
+		code := service.ErrorCodeCommandInvalid
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+		return
+	}
+
+	queued, code := e.Command.Enqueue(c.Request.Context(), c.Param("id"), request)
+	if code == service.ErrorCodeSuccess {
+		re := &Command{}
+		re.Assemble(queued)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// NextCommand returns the next command of a device. With wait, a duration
+// such as 20s, it waits for one to be queued when there is none.
+func (e *Endpoint) NextCommand(c *gin.Context) {
+	var wait time.Duration
+	if w := c.Query("wait"); len(w) > 0 {
+		d, err := time.ParseDuration(w)
+		if err != nil || d < 0 {
+			code := service.ErrorCodeBadRequest
+			resp := content.NewContent()
+			resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+			content.JSON(c, service.ErrorStatusCode(code), resp)
+			return
+		}
+		wait = d
+	}
+
+	next, code := e.Command.Next(c.Request.Context(), c.Param("id"), wait)
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := &Command{}
+		re.Assemble(next)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// ReportCommand moves a command of a device to the status the device
+// reports
+func (e *Endpoint) ReportCommand(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "ReportCommand bind")
+	r := &Report{}
+	err := c.ShouldBindJSON(r)
+	span.Finish()
+
+	resp := content.NewContent()
+	if err != nil {
+		code := service.ErrorCodeCommandInvalid
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+		return
+	}
+
+	reported, code := e.Command.Report(c.Request.Context(), c.Param("id"), r.Id, &service.CommandReport{
+		Status: r.Status,
+		Result: r.Result,
+	})
+	if code == service.ErrorCodeSuccess {
+		re := &Command{}
+		re.Assemble(reported)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// CommandHistory returns the commands of a device, newest first
+func (e *Endpoint) CommandHistory(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "CommandHistory bind")
+	q := &HistoryQuery{}
+	c.ShouldBindQuery(q)
+	span.Finish()
+
+	commands, code := e.Command.History(c.Request.Context(), c.Param("id"), q.Status, &q.Page)
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		datas := make([]*Command, 0, len(commands))
+		for _, v := range commands {
+			re := &Command{}
+			re.Assemble(v)
+			datas = append(datas, re)
+		}
+		resp.Data(&service.PagingContent{
+			Page:  &q.Page,
+			Datas: datas,
+		})
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
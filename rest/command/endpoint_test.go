@@ -0,0 +1,182 @@
+package command_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/config"
+	"github/demo/daos"
+	"github/demo/database"
+	"github/demo/model/command"
+	"github/demo/model/device"
+	routeCommand "github/demo/rest/command"
+	"github/demo/service"
+)
+
+type CommandTestCaseSuite struct {
+	db database.IDatabase
+	c  *gin.Engine
+}
+
+func setupCommandTestCaseSuite(t *testing.T) (CommandTestCaseSuite, func(t *testing.T)) {
+	s := CommandTestCaseSuite{
+		c: gin.New(),
+	}
+	s.c.Use(gin.Recovery())
+
+	name := filepath.Join(os.TempDir(), "gorm"+uuid.Must(uuid.NewV4()).String()+".db")
+	df, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if df == nil || err != nil {
+		panic(fmt.Sprintf("No error should happen when creating db file, but got %+v", err))
+	}
+
+	c := &config.Database{
+		Dialect: "sqlite",
+		Host:    df.Name(),
+	}
+
+	s.db, err = database.NewDatabase(context.Background(), c)
+	s.db.GetDB().AutoMigrate(&device.Device{}, &command.Command{})
+	deviceRepo := daos.NewDeviceRepo(s.db.GetDB())
+	commandRepo := daos.NewCommandRepo(s.db.GetDB())
+	routeCommand.MakeHandler(s.c.Group("/v1"), service.NewCommandService(commandRepo, deviceRepo, nil))
+
+	return s, func(t *testing.T) {
+		s.db.Close()
+		os.Remove(df.Name())
+	}
+}
+
+func TestCommandHandler(t *testing.T) {
+	s, teardownTestCase := setupCommandTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	s.db.GetDB().Create(&device.Device{
+		Id:      "c9d7c314-fd95-448a-8db9-4756cc774f7d",
+		Model:   "Pro",
+		Color:   "White",
+		Version: "v1.2",
+	})
+	// a command queued a second ago, next before any queued by the test
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	s.db.GetDB().Create(&command.Command{
+		Id:         "6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0001",
+		DeviceId:   "c9d7c314-fd95-448a-8db9-4756cc774f7d",
+		Name:       "reboot",
+		Status:     command.StatusPending,
+		CreateTime: now - 1000,
+		UpdateTime: now - 1000,
+		ExpireTime: now + 60*1000,
+	})
+	route := "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/command"
+
+	tt := []struct {
+		description  string
+		route        string
+		method       string
+		body         string
+		expected     string
+		expectedCode int
+	}{
+		{
+			description:  "enqueue",
+			route:        route,
+			method:       "POST",
+			body:         `{"name":"config","payload":{"interval":60},"ttl":"10m"}`,
+			expected:     `^\{"code":2000000,"data":\{"Id":"[-0-9a-f]{36}","DeviceId":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Name":"config","Payload":\{"interval":60\},"Status":"pending","Result":"",.*\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "enqueue invalid ttl",
+			route:        route,
+			method:       "POST",
+			body:         `{"name":"config","ttl":"soon"}`,
+			expected:     `^\{"code":4000011,"msg":"Command invalid"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "enqueue unknown device",
+			route:        "/v1/device/5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60/command",
+			method:       "POST",
+			body:         `{"name":"reboot"}`,
+			expected:     `^\{"code":4040000,"msg":"Not found"\}$`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			description:  "next",
+			route:        route + "/next",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"Id":"6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0001",.*"Name":"reboot","Status":"pending",.*\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "next invalid wait",
+			route:        route + "/next?wait=long",
+			method:       "GET",
+			expected:     `^\{"code":4000000,"msg":"Bad request"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "report delivered",
+			route:        route + "/report",
+			method:       "POST",
+			body:         `{"id":"6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0001","status":"delivered"}`,
+			expected:     `^\{"code":2000000,"data":\{"Id":"6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0001",.*"Status":"delivered",.*\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "report delivered again",
+			route:        route + "/report",
+			method:       "POST",
+			body:         `{"id":"6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0001","status":"delivered"}`,
+			expected:     `^\{"code":4090005,"msg":"Command status transition invalid"\}$`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			description:  "next once delivered",
+			route:        route + "/next?wait=10ms",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"Id":"[-0-9a-f]{36}",.*"Name":"config",.*\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "history by status",
+			route:        route + "?status=delivered",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"page":\{"page":1,"number":50\},"datas":\[\{"Id":"6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0001",.*\}\]\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "history invalid status",
+			route:        route + "?status=done",
+			method:       "GET",
+			expected:     `^\{"code":4000011,"msg":"Command invalid"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.route, strings.NewReader(tc.body))
+			if len(tc.body) > 0 {
+				req.Header.Set("Content-Type", gin.MIMEJSON)
+			}
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, req)
+			assert.Equal(t, tc.expectedCode, actul.Code)
+			assert.Regexp(t, regexp.MustCompile(tc.expected), strings.TrimSpace(actul.Body.String()))
+		})
+	}
+}
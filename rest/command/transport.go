@@ -0,0 +1,19 @@
+package command
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github/demo/service"
+)
+
+func MakeHandler(r *gin.RouterGroup, s service.ICommandService) {
+	e := &Endpoint{Command: s}
+
+	g := r.Group("/device")
+	{
+		g.GET("/:id/command", e.CommandHistory)
+		g.POST("/:id/command", e.EnqueueCommand)
+		g.GET("/:id/command/next", e.NextCommand)
+		g.POST("/:id/command/report", e.ReportCommand)
+	}
+}
@@ -0,0 +1,16 @@
+package content
+
+import "github.com/gin-gonic/gin"
+
+// CodeKey is the gin context key holding the code of the written envelope
+const CodeKey = "content.code"
+
+// JSON writes resp as the response body and records its code on the context
+func JSON(c *gin.Context, status int, resp Content) {
+	if m, ok := resp.(content); ok {
+		if code, ok := m["code"]; ok {
+			c.Set(CodeKey, code)
+		}
+	}
+	c.JSON(status, resp)
+}
@@ -1,10 +1,17 @@
 package device
 
 import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+
 	"github.com/gin-gonic/gin"
 
 	"github/demo/rest/content"
 	"github/demo/service"
+	"github/demo/utils/trace"
 )
 
 type Device struct {
@@ -12,16 +19,33 @@ type Device struct {
 	Model      string `form:"model"`
 	Color      string `form:"color"`
 	Version    string `form:"version"`
+	State      string `form:"state" json:",omitempty"`
 	CreateTime int64  `form:"create_time"`
 	UpdateTime int64  `form:"update_time"`
+	LastSeen   int64  `json:",omitempty"`
+	Firmware   string `json:",omitempty"`
+	// Status is online, stale or offline, by the time since LastSeen
+	Status string `form:"status" json:",omitempty"`
+
+	Labels map[string]string `json:",omitempty"`
+	// Selector is a label selector, such as site=tpe,env!=lab
+	Selector string `form:"selector" json:"-"`
+}
+
+// Endpoint serves the device routes with the services of one app
+type Endpoint struct {
+	Device service.IDeviceService
 }
 
 func (d *Device) serviceType() *service.Device {
 	return &service.Device{
-		Id:      d.Id,
-		Model:   d.Model,
-		Color:   d.Color,
-		Version: d.Version,
+		Id:       d.Id,
+		Model:    d.Model,
+		Color:    d.Color,
+		Version:  d.Version,
+		State:    d.State,
+		Status:   d.Status,
+		Selector: d.Selector,
 	}
 }
 
@@ -30,17 +54,29 @@ func (d *Device) Assemble(s *service.Device) {
 	d.Model = s.Model
 	d.Color = s.Color
 	d.Version = s.Version
+	d.State = s.State
 	d.CreateTime = s.CreateTime
 	d.UpdateTime = s.UpdateTime
+	d.LastSeen = s.LastSeen
+	d.Firmware = s.Firmware
+	d.Status = s.Status
+	d.Labels = s.Labels
 }
 
-func FindDevice(c *gin.Context) {
+func (e *Endpoint) FindDevice(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "FindDevice bind")
 	page := &service.Page{}
 	c.ShouldBind(page)
 	device := &Device{}
 	c.ShouldBind(device)
+	span.Finish()
+
+	if streamRequested(c) {
+		e.streamDevice(c, device, page)
+		return
+	}
 
-	rows, code := service.DeviceService.Find(device.serviceType(), page)
+	rows, code := e.Device.Find(c.Request.Context(), device.serviceType(), page)
 	resp := content.NewContent()
 	if code == service.ErrorCodeSuccess {
 		data := make(map[string]interface{})
@@ -58,13 +94,70 @@ func FindDevice(c *gin.Context) {
 	}
 
 	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
-	c.JSON(service.ErrorStatusCode(code), resp)
+	content.JSON(c, service.ErrorStatusCode(code), resp)
 }
 
-func RegisterDevice(c *gin.Context) {
+// number of devices written to a stream between two flushes
+const streamFlush = 100
+
+// streamRequested reports whether the devices are asked for as NDJSON, by
+// the format query or the Accept header
+func streamRequested(c *gin.Context) bool {
+	if format, ok := c.GetQuery("format"); ok {
+		return format == service.FormatNDJSON
+	}
+	return c.NegotiateFormat(gin.MIMEJSON, service.FormatContentType(service.FormatNDJSON)) ==
+		service.FormatContentType(service.FormatNDJSON)
+}
+
+// streamDevice writes the devices one JSON object per line as they are read,
+// a page is honoured when both of its fields are set
+func (e *Endpoint) streamDevice(c *gin.Context, device *Device, page *service.Page) {
+	c.Header("Content-Type", service.FormatContentType(service.FormatNDJSON))
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	n := 0
+	code := e.Device.Iterate(c.Request.Context(), device.serviceType(), page, func(v *service.Device) error {
+		re := &Device{}
+		re.Assemble(v)
+		if err := enc.Encode(re); err != nil {
+			return err
+		}
+		if n++; n%streamFlush == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	streamDone(c, code)
+}
+
+// streamDone ends a streamed response with code. A failure before anything
+// was written still gets a JSON error, a later one can only cut the stream
+// short.
+func streamDone(c *gin.Context, code service.ErrorCode) {
+	if code != service.ErrorCodeSuccess && !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		resp := content.NewContent()
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+		return
+	}
+
+	c.Set(content.CodeKey, code.Int())
+	if code != service.ErrorCodeSuccess {
+		c.Error(fmt.Errorf("stream fail: %s", service.ErrorMsg(code)))
+	}
+}
+
+func (e *Endpoint) RegisterDevice(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "RegisterDevice bind")
 	device := &Device{}
 	c.ShouldBind(device)
-	m, code := service.DeviceService.Register(device.serviceType())
+	span.Finish()
+
+	m, code := e.Device.Register(c.Request.Context(), device.serviceType())
 	resp := content.NewContent()
 
 	var re *Device
@@ -75,26 +168,185 @@ func RegisterDevice(c *gin.Context) {
 	resp.Data(re)
 
 	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
-	c.JSON(service.ErrorStatusCode(code), resp)
+	content.JSON(c, service.ErrorStatusCode(code), resp)
 }
 
-func DeleteDevice(c *gin.Context) {
+func (e *Endpoint) DeleteDevice(c *gin.Context) {
 	d := c.Param("id")
-	code := service.DeviceService.Delete(d)
+	code := e.Device.Delete(c.Request.Context(), d)
 	resp := content.NewContent()
 	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
-	c.JSON(service.ErrorStatusCode(code), resp)
+	content.JSON(c, service.ErrorStatusCode(code), resp)
 }
 
-func UpdateDevice(c *gin.Context) {
+func (e *Endpoint) UpdateDevice(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "UpdateDevice bind")
 	device := &Device{}
 	c.ShouldBind(device)
-	affect, code := service.DeviceService.Update(device.serviceType())
+	span.Finish()
+
+	affect, code := e.Device.Update(c.Request.Context(), device.serviceType())
 	resp := content.NewContent()
 	m := map[string]int64{
 		"affect": affect,
 	}
 	resp.Data(m)
 	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
-	c.JSON(service.ErrorStatusCode(code), resp)
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// TransitionDevice returns the handler applying the lifecycle transition
+// action to the device of the route
+func (e *Endpoint) TransitionDevice(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m, code := e.Device.Transition(c.Request.Context(), c.Param("id"), action)
+		resp := content.NewContent()
+
+		var re *Device
+		if code == service.ErrorCodeSuccess {
+			re = &Device{}
+			re.Assemble(m)
+		}
+		resp.Data(re)
+
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+	}
+}
+
+type Heartbeat struct {
+	Firmware string `form:"firmware"`
+}
+
+func (e *Endpoint) DeviceHeartbeat(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "DeviceHeartbeat bind")
+	h := &Heartbeat{}
+	// the body is optional, a bare heartbeat reports nothing
+	c.ShouldBind(h)
+	span.Finish()
+
+	seen, code := e.Device.Heartbeat(c.Request.Context(), c.Param("id"), &service.Heartbeat{Firmware: h.Firmware})
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		resp.Data(map[string]int64{
+			"last_seen": seen,
+		})
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) DeviceHistory(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "DeviceHistory bind")
+	page := &service.Page{}
+	c.ShouldBindQuery(page)
+	span.Finish()
+
+	history, code := e.Device.History(c.Request.Context(), c.Param("id"), page)
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		resp.Data(&service.PagingContent{
+			Page:  page,
+			Datas: history,
+		})
+	}
+
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) SetDeviceLabels(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "SetDeviceLabels bind")
+	labels := map[string]string{}
+	err := c.ShouldBindJSON(&labels)
+	span.Finish()
+
+	resp := content.NewContent()
+	if err != nil {
+		code := service.ErrorCodeBadRequest
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+		return
+	}
+
+	labels, code := e.Device.SetLabels(c.Request.Context(), c.Param("id"), labels)
+	if code == service.ErrorCodeSuccess {
+		resp.Data(map[string]interface{}{
+			"labels": labels,
+		})
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) RemoveDeviceLabel(c *gin.Context) {
+	labels, code := e.Device.RemoveLabels(c.Request.Context(), c.Param("id"), c.Param("key"))
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		resp.Data(map[string]interface{}{
+			"labels": labels,
+		})
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// maximum size of an import body
+const maxImportSize = 32 << 20
+
+func (e *Endpoint) ExportDevice(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "ExportDevice bind")
+	device := &Device{}
+	c.ShouldBind(device)
+	format := c.DefaultQuery("format", service.FormatCSV)
+	span.Finish()
+
+	enc, err := service.NewDeviceEncoder(format, c.Writer)
+	if err != nil {
+		code := service.ErrorCodeFormatNotSupport
+		resp := content.NewContent()
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+		return
+	}
+
+	c.Header("Content-Type", service.FormatContentType(format))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "devices." + format}))
+	c.Status(http.StatusOK)
+
+	code := e.Device.Export(c.Request.Context(), device.serviceType(), enc)
+	streamDone(c, code)
+}
+
+func (e *Endpoint) ImportDevice(c *gin.Context) {
+	format := c.Query("format")
+	if len(format) == 0 {
+		format = importFormat(c.ContentType())
+	}
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+
+	resp := content.NewContent()
+	dec, err := service.NewDeviceDecoder(format, http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	if err != nil {
+		code := service.ErrorCodeFormatNotSupport
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+		return
+	}
+
+	result, code := e.Device.Import(c.Request.Context(), dec, dryRun)
+	resp.Data(result)
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// importFormat returns the format of the media type of an import body
+func importFormat(contentType string) string {
+	switch contentType {
+	case "text/csv":
+		return service.FormatCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return service.FormatNDJSON
+	}
+	return ""
 }
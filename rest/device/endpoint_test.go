@@ -1,11 +1,13 @@
 package device_test
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -44,11 +46,11 @@ func setupDeviceTestCaseSuite(t *testing.T) (DeviceTestCaseSuite, func(t *testin
 		Host:    df.Name(),
 	}
 
-	s.db, err = database.NewDatabase(c)
+	s.db, err = database.NewDatabase(context.Background(), c)
+	s.db.GetDB().AutoMigrate(&device.History{}, &device.Label{})
 	deviceRepo := daos.NewDeviceRepo(s.db.GetDB())
-	service.DeviceService = service.NewDeviceService(deviceRepo)
-
-	routeDevice.MakeHandler(s.c.Group("/v1"))
+	historyRepo := daos.NewHistoryRepo(s.db.GetDB())
+	routeDevice.MakeHandler(s.c.Group("/v1"), service.NewDeviceService(deviceRepo, historyRepo, nil, nil))
 
 	return s, func(t *testing.T) {
 		s.db.Close()
@@ -95,7 +97,7 @@ func TestDeviceFindHandler(t *testing.T) {
 				"page":   "1",
 				"number": "2",
 			},
-			expected:     `{"code":2000000,"data":{"datas":[{"Id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Model":"Pro","Color":"White","Version":"v1.2","CreateTime":0,"UpdateTime":0},{"Id":"99f970f5-b876-4c94-9190-34ee11d54edb","Model":"Normal","Color":"Black","Version":"v1.2","CreateTime":0,"UpdateTime":0}],"page":{"page":1,"number":2}},"msg":"Success"}`,
+			expected:     `{"code":2000000,"data":{"datas":[{"Id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Model":"Pro","Color":"White","Version":"v1.2","CreateTime":0,"UpdateTime":0,"Status":"offline"},{"Id":"99f970f5-b876-4c94-9190-34ee11d54edb","Model":"Normal","Color":"Black","Version":"v1.2","CreateTime":0,"UpdateTime":0,"Status":"offline"}],"page":{"page":1,"number":2}},"msg":"Success"}`,
 			expectedCode: http.StatusOK,
 			setupSubTest: func(t *testing.T) func(t *testing.T) {
 				s.db.GetDB().DropTable(&device.Device{})
@@ -130,6 +132,89 @@ func TestDeviceFindHandler(t *testing.T) {
 	}
 }
 
+func TestDeviceStreamHandler(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	seed := func(t *testing.T) func(t *testing.T) {
+		s.db.GetDB().DropTable(&device.Device{})
+		s.db.GetDB().AutoMigrate(&device.Device{})
+		s.db.GetDB().Create(GetDevice1())
+		s.db.GetDB().Create(GetDevice2())
+
+		return func(t *testing.T) {
+		}
+	}
+
+	tt := []struct {
+		description  string
+		route        string
+		accept       string
+		expected     string
+		contentType  string
+		expectedCode int
+		setupSubTest test.SetupSubTest
+	}{
+		{
+			description: "format ndjson",
+			route:       "/v1/device?format=ndjson",
+			expected: `{"Id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Model":"Pro","Color":"White","Version":"v1.2","CreateTime":0,"UpdateTime":0,"Status":"offline"}` + "\n" +
+				`{"Id":"99f970f5-b876-4c94-9190-34ee11d54edb","Model":"Normal","Color":"Black","Version":"v1.2","CreateTime":0,"UpdateTime":0,"Status":"offline"}` + "\n",
+			contentType:  "application/x-ndjson",
+			expectedCode: http.StatusOK,
+			setupSubTest: seed,
+		},
+		{
+			description: "accept ndjson with page",
+			route:       "/v1/device?page=2&number=1",
+			accept:      "application/x-ndjson",
+			expected: `{"Id":"99f970f5-b876-4c94-9190-34ee11d54edb","Model":"Normal","Color":"Black","Version":"v1.2","CreateTime":0,"UpdateTime":0,"Status":"offline"}` +
+				"\n",
+			contentType:  "application/x-ndjson",
+			expectedCode: http.StatusOK,
+			setupSubTest: seed,
+		},
+		{
+			description:  "no data",
+			route:        "/v1/device?format=ndjson&model=None",
+			expected:     "",
+			contentType:  "application/x-ndjson",
+			expectedCode: http.StatusOK,
+			setupSubTest: seed,
+		},
+		{
+			description:  "database fail",
+			route:        "/v1/device?format=ndjson",
+			expected:     `{"code":5000100,"msg":"Device find fail"}`,
+			contentType:  "application/json; charset=utf-8",
+			expectedCode: http.StatusInternalServerError,
+			setupSubTest: func(t *testing.T) func(t *testing.T) {
+				s.db.GetDB().DropTable(&device.Device{})
+
+				return func(t *testing.T) {
+				}
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			teardownSubTest := tc.setupSubTest(t)
+			defer teardownSubTest(t)
+
+			req := httptest.NewRequest("GET", tc.route, nil)
+			if len(tc.accept) > 0 {
+				req.Header.Set("Accept", tc.accept)
+			}
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, req)
+			assert.Equal(t, tc.expectedCode, actul.Code)
+			assert.Equal(t, tc.contentType, actul.Header().Get("Content-Type"))
+			assert.Equal(t, tc.expected, actul.Body.String())
+		})
+	}
+}
+
 func TestDeviceRegisterHandler(t *testing.T) {
 	s, teardownTestCase := setupDeviceTestCaseSuite(t)
 	defer teardownTestCase(t)
@@ -242,6 +327,24 @@ func TestDeviceUpdateHandler(t *testing.T) {
 				}
 			},
 		},
+		{
+			description:  "state",
+			route:        "/v1/device",
+			method:       "PUT",
+			body:         `{"id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","state":"active"}`,
+			expectedCode: http.StatusBadRequest,
+			setupSubTest: func(t *testing.T) func(t *testing.T) {
+				s.db.GetDB().DropTable(&device.Device{})
+				s.db.GetDB().AutoMigrate(&device.Device{})
+				s.db.GetDB().Create(GetDevice1())
+
+				return func(t *testing.T) {
+					var d device.Device
+					s.db.GetDB().First(&d, "id = ?", GetDevice1().Id)
+					assert.Equal(t, "", d.State)
+				}
+			},
+		},
 	}
 
 	for _, tc := range tt {
@@ -257,3 +360,399 @@ func TestDeviceUpdateHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestDeviceHistoryHandler(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	s.db.GetDB().DropTable(&device.Device{})
+	s.db.GetDB().AutoMigrate(&device.Device{})
+	s.db.GetDB().Create(GetDevice1())
+
+	update := httptest.NewRequest("PUT", "/v1/device", strings.NewReader(`{"id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","color":"Red"}`))
+	update.Header.Set("Content-Type", gin.MIMEJSON)
+	s.c.ServeHTTP(httptest.NewRecorder(), update)
+	s.c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d", nil))
+
+	tt := []struct {
+		description  string
+		route        string
+		expected     string
+		expectedCode int
+	}{
+		{
+			description:  "input page=1, number=1",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/history?page=1&number=1",
+			expected:     `{"code":2000000,"data":{"page":{"page":1,"number":1},"datas":[{"id":2,"device_id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","action":"delete","actor":"anonymous","request_id":"","changes":{"color":{"before":"Red","after":""},"model":{"before":"Pro","after":""},"version":{"before":"v1.2","after":""}},"create_time":0}]},"msg":"Success"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "input page=2, number=1",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/history?page=2&number=1",
+			expected:     `{"code":2000000,"data":{"page":{"page":2,"number":1},"datas":[{"id":1,"device_id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","action":"update","actor":"anonymous","request_id":"","changes":{"color":{"before":"White","after":"Red"}},"create_time":0}]},"msg":"Success"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "no history",
+			route:        "/v1/device/99f970f5-b876-4c94-9190-34ee11d54edb/history",
+			expected:     `{"code":2000000,"data":{"page":{"page":1,"number":50},"datas":[]},"msg":"Success"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "invalid id",
+			route:        "/v1/device/1234/history",
+			expected:     `{"code":4000001,"msg":"Had a error in uuid parsing"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, httptest.NewRequest("GET", tc.route, nil))
+			assert.Equal(t, tc.expectedCode, actul.Code)
+			body := regexp.MustCompile(`"create_time":\d+`).ReplaceAllString(actul.Body.String(), `"create_time":0`)
+			assert.Equal(t, tc.expected, strings.Replace(body, "\n", "", -1))
+		})
+	}
+}
+
+func TestDeviceLabelHandler(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	s.db.GetDB().DropTable(&device.Device{})
+	s.db.GetDB().AutoMigrate(&device.Device{})
+	s.db.GetDB().Create(GetDevice1())
+	s.db.GetDB().Create(GetDevice2())
+
+	tt := []struct {
+		description  string
+		route        string
+		method       string
+		body         string
+		expected     string
+		expectedCode int
+	}{
+		{
+			description:  "add labels",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/labels",
+			method:       "POST",
+			body:         `{"site":"tpe","env":"lab"}`,
+			expected:     `{"code":2000000,"data":{"labels":{"env":"lab","site":"tpe"}},"msg":"Success"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "replace a label",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/labels",
+			method:       "POST",
+			body:         `{"env":"prod"}`,
+			expected:     `{"code":2000000,"data":{"labels":{"env":"prod","site":"tpe"}},"msg":"Success"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "label other device",
+			route:        "/v1/device/99f970f5-b876-4c94-9190-34ee11d54edb/labels",
+			method:       "POST",
+			body:         `{"site":"tpe","env":"lab"}`,
+			expected:     `{"code":2000000,"data":{"labels":{"env":"lab","site":"tpe"}},"msg":"Success"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "invalid label",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/labels",
+			method:       "POST",
+			body:         `{"site":"t p e"}`,
+			expected:     `{"code":4000005,"msg":"Label invalid"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "not a label object",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/labels",
+			method:       "POST",
+			body:         `["site"]`,
+			expected:     `{"code":4000000,"msg":"Bad request"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "unknown device",
+			route:        "/v1/device/5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60/labels",
+			method:       "POST",
+			body:         `{"site":"tpe"}`,
+			expected:     `{"code":4040000,"msg":"Not found"}`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			description:  "select devices",
+			route:        "/v1/device?page=1&number=10&selector=site%3Dtpe,env+in+(prod,test)",
+			method:       "GET",
+			expected:     `{"code":2000000,"data":{"datas":[{"Id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Model":"Pro","Color":"White","Version":"v1.2","CreateTime":0,"UpdateTime":0,"Status":"offline","Labels":{"env":"prod","site":"tpe"}}],"page":{"page":1,"number":10}},"msg":"Success"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "invalid selector",
+			route:        "/v1/device?page=1&number=10&selector=env+in+(prod",
+			method:       "GET",
+			expected:     `{"code":4000004,"msg":"Label selector invalid"}`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "remove a label",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/labels/env",
+			method:       "DELETE",
+			expected:     `{"code":2000000,"data":{"labels":{"site":"tpe"}},"msg":"Success"}`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "select devices without a label",
+			route:        "/v1/device?page=1&number=10&selector=!env",
+			method:       "GET",
+			expected:     `{"code":2000000,"data":{"datas":[{"Id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Model":"Pro","Color":"White","Version":"v1.2","CreateTime":0,"UpdateTime":0,"Status":"offline","Labels":{"site":"tpe"}}],"page":{"page":1,"number":10}},"msg":"Success"}`,
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.route, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", gin.MIMEJSON)
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, req)
+			assert.Equal(t, tc.expectedCode, actul.Code)
+			assert.Equal(t, tc.expected, strings.Replace(actul.Body.String(), "\n", "", -1))
+		})
+	}
+}
+
+func TestDeviceTransitionHandler(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	s.db.GetDB().DropTable(&device.Device{})
+	s.db.GetDB().AutoMigrate(&device.Device{})
+	d := GetDevice1()
+	d.State = device.StateProvisioned
+	s.db.GetDB().Create(d)
+
+	tt := []struct {
+		description  string
+		route        string
+		expected     string
+		expectedCode int
+	}{
+		{
+			description:  "activate",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/activate",
+			expected:     `^\{"code":2000000,"data":\{"Id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Model":"Pro","Color":"White","Version":"v1.2","State":"active","CreateTime":0,"UpdateTime":\d+,"Status":"offline"\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "activate an active device",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/activate",
+			expected:     `^\{"code":4090003,"data":null,"msg":"Device state transition invalid"\}$`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			description:  "suspend",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/suspend",
+			expected:     `^\{"code":2000000,"data":\{.*"State":"suspended".*\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "decommission",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/decommission",
+			expected:     `^\{"code":2000000,"data":\{.*"State":"decommissioned".*\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "activate a decommissioned device",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/activate",
+			expected:     `^\{"code":4090003,"data":null,"msg":"Device state transition invalid"\}$`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			description:  "unknown device",
+			route:        "/v1/device/5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60/activate",
+			expected:     `^\{"code":4040000,"data":null,"msg":"Not found"\}$`,
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, httptest.NewRequest("POST", tc.route, nil))
+			assert.Equal(t, tc.expectedCode, actul.Code)
+			assert.Regexp(t, regexp.MustCompile(tc.expected), strings.TrimSpace(actul.Body.String()))
+		})
+	}
+}
+
+func TestDeviceHeartbeatHandler(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	s.db.GetDB().DropTable(&device.Device{})
+	s.db.GetDB().AutoMigrate(&device.Device{})
+	s.db.GetDB().Create(GetDevice1())
+	s.db.GetDB().Create(GetDevice2())
+
+	tt := []struct {
+		description  string
+		route        string
+		method       string
+		body         string
+		expected     string
+		expectedCode int
+	}{
+		{
+			description:  "heartbeat with firmware",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/heartbeat",
+			method:       "POST",
+			body:         `{"firmware":"fw-2.0"}`,
+			expected:     `^\{"code":2000000,"data":\{"last_seen":\d+\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "heartbeat without body",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/heartbeat",
+			method:       "POST",
+			expected:     `^\{"code":2000000,"data":\{"last_seen":\d+\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "unknown device",
+			route:        "/v1/device/5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60/heartbeat",
+			method:       "POST",
+			expected:     `^\{"code":4040000,"msg":"Not found"\}$`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			description:  "find online devices",
+			route:        "/v1/device?page=1&number=10&status=online",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"datas":\[\{"Id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Model":"Pro","Color":"White","Version":"v1.2","CreateTime":0,"UpdateTime":0,"LastSeen":\d+,"Firmware":"fw-2.0","Status":"online"\}\],"page":\{"page":1,"number":10\}\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "find offline devices",
+			route:        "/v1/device?page=1&number=10&status=offline",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"datas":\[\{"Id":"99f970f5-b876-4c94-9190-34ee11d54edb",.*"Status":"offline"\}\],"page":\{"page":1,"number":10\}\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "invalid status",
+			route:        "/v1/device?page=1&number=10&status=asleep",
+			method:       "GET",
+			expected:     `^\{"code":4000008,"msg":"Device status invalid"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.route, strings.NewReader(tc.body))
+			if len(tc.body) > 0 {
+				req.Header.Set("Content-Type", gin.MIMEJSON)
+			}
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, req)
+			assert.Equal(t, tc.expectedCode, actul.Code)
+			assert.Regexp(t, regexp.MustCompile(tc.expected), strings.TrimSpace(actul.Body.String()))
+		})
+	}
+}
+
+func TestDeviceShadowHandler(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	s.db.GetDB().DropTable(&device.Device{})
+	s.db.GetDB().AutoMigrate(&device.Device{})
+	s.db.GetDB().Create(GetDevice1())
+
+	tt := []struct {
+		description  string
+		route        string
+		method       string
+		body         string
+		expected     string
+		expectedCode int
+	}{
+		{
+			description:  "get shadow",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/shadow",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"Id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Desired":\{\},"Reported":\{"Color":"White","Version":"v1.2"\},"Delta":\{\},"Version":0\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "set desired",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/shadow",
+			method:       "PUT",
+			body:         `{"desired":{"version":"v1.3"},"version":0}`,
+			expected:     `^\{"code":2000000,"data":\{"Id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Desired":\{"Version":"v1.3"\},"Reported":\{"Color":"White","Version":"v1.2"\},"Delta":\{"Version":"v1.3"\},"Version":1\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "set desired at a stale version",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/shadow",
+			method:       "PUT",
+			body:         `{"desired":{"version":"v1.4"},"version":0}`,
+			expected:     `^\{"code":4090004,"msg":"Device shadow version conflict"\}$`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			description:  "set desired without desired",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/shadow",
+			method:       "PUT",
+			body:         `{"version":1}`,
+			expected:     `^\{"code":4000000,"msg":"Bad request"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "get delta",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/shadow/delta",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"Delta":\{"Version":"v1.3"\},"Version":1\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "acknowledge without version",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/shadow/ack",
+			method:       "POST",
+			body:         `{}`,
+			expected:     `^\{"code":4000000,"msg":"Bad request"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "acknowledge",
+			route:        "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/shadow/ack",
+			method:       "POST",
+			body:         `{"version":1}`,
+			expected:     `^\{"code":2000000,"data":\{"Id":"c9d7c314-fd95-448a-8db9-4756cc774f7d","Desired":\{"Version":"v1.3"\},"Reported":\{"Color":"White","Version":"v1.3"\},"Delta":\{\},"Version":2\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "unknown device",
+			route:        "/v1/device/5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60/shadow/delta",
+			method:       "GET",
+			expected:     `^\{"code":4040000,"msg":"Not found"\}$`,
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.route, strings.NewReader(tc.body))
+			if len(tc.body) > 0 {
+				req.Header.Set("Content-Type", gin.MIMEJSON)
+			}
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, req)
+			assert.Equal(t, tc.expectedCode, actul.Code)
+			assert.Regexp(t, regexp.MustCompile(tc.expected), strings.TrimSpace(actul.Body.String()))
+		})
+	}
+}
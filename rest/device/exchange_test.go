@@ -0,0 +1,208 @@
+package device_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/model/device"
+	"github/demo/test"
+)
+
+func TestDeviceExportHandler(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	seed := func(t *testing.T) func(t *testing.T) {
+		s.db.GetDB().DropTable(&device.Device{})
+		s.db.GetDB().AutoMigrate(&device.Device{})
+		s.db.GetDB().Create(GetDevice1())
+		s.db.GetDB().Create(GetDevice2())
+
+		return func(t *testing.T) {
+		}
+	}
+
+	tt := []struct {
+		description  string
+		route        string
+		expected     string
+		contentType  string
+		expectedCode int
+		setupSubTest test.SetupSubTest
+	}{
+		{
+			description: "csv",
+			route:       "/v1/device/export?format=csv",
+			expected: "id,model,color,version,create_time,update_time\n" +
+				"c9d7c314-fd95-448a-8db9-4756cc774f7d,Pro,White,v1.2,0,0\n" +
+				"99f970f5-b876-4c94-9190-34ee11d54edb,Normal,Black,v1.2,0,0\n",
+			contentType:  "text/csv; charset=utf-8",
+			expectedCode: http.StatusOK,
+			setupSubTest: seed,
+		},
+		{
+			description: "ndjson with filter",
+			route:       "/v1/device/export?format=ndjson&model=Normal",
+			expected: `{"id":"99f970f5-b876-4c94-9190-34ee11d54edb","model":"Normal","color":"Black","version":"v1.2","state":"","create_time":0,"update_time":0,"status":"offline"}` +
+				"\n",
+			contentType:  "application/x-ndjson",
+			expectedCode: http.StatusOK,
+			setupSubTest: seed,
+		},
+		{
+			description:  "no data",
+			route:        "/v1/device/export",
+			expected:     "id,model,color,version,create_time,update_time\n",
+			contentType:  "text/csv; charset=utf-8",
+			expectedCode: http.StatusOK,
+			setupSubTest: func(t *testing.T) func(t *testing.T) {
+				s.db.GetDB().DropTable(&device.Device{})
+				s.db.GetDB().AutoMigrate(&device.Device{})
+
+				return func(t *testing.T) {
+				}
+			},
+		},
+		{
+			description:  "format not support",
+			route:        "/v1/device/export?format=xml",
+			expected:     `{"code":4000002,"msg":"Format not support"}`,
+			contentType:  "application/json; charset=utf-8",
+			expectedCode: http.StatusBadRequest,
+			setupSubTest: seed,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			teardownSubTest := tc.setupSubTest(t)
+			defer teardownSubTest(t)
+
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, httptest.NewRequest("GET", tc.route, nil))
+
+			assert.Equal(t, tc.expectedCode, actul.Code)
+			assert.Equal(t, tc.contentType, actul.Header().Get("Content-Type"))
+			assert.Equal(t, tc.expected, actul.Body.String())
+		})
+	}
+}
+
+func TestDeviceImportHandler(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	seed := func(t *testing.T) func(t *testing.T) {
+		s.db.GetDB().DropTable(&device.Device{})
+		s.db.GetDB().AutoMigrate(&device.Device{})
+		s.db.GetDB().Create(GetDevice1())
+
+		return func(t *testing.T) {
+		}
+	}
+
+	type result struct {
+		DryRun  bool `json:"dry_run"`
+		Total   int  `json:"total"`
+		Created int  `json:"created"`
+		Updated int  `json:"updated"`
+		Failed  int  `json:"failed"`
+		Errors  []struct {
+			Row     int    `json:"row"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	csvBody := "model,color,version,id\n" +
+		"Pro,White,v2.0,c9d7c314-fd95-448a-8db9-4756cc774f7d\n" +
+		"Normal,Black,v1.0,\n" +
+		",Black,v1.0,\n" +
+		"Mini,Red,v1.0,not-a-uuid\n"
+
+	tt := []struct {
+		description  string
+		route        string
+		contentType  string
+		body         string
+		expected     result
+		expectedCode int
+		wantDevices  int
+	}{
+		{
+			description: "csv",
+			route:       "/v1/device/import",
+			contentType: "text/csv",
+			body:        csvBody,
+			expected: result{Total: 4, Created: 1, Updated: 1, Failed: 2, Errors: []struct {
+				Row     int    `json:"row"`
+				Message string `json:"message"`
+			}{{Row: 4, Message: "model is required"}, {Row: 5, Message: `id "not-a-uuid" is not a uuid`}}},
+			expectedCode: http.StatusOK,
+			wantDevices:  2,
+		},
+		{
+			description: "dry run",
+			route:       "/v1/device/import?format=csv&dry_run=true",
+			contentType: "text/plain",
+			body:        csvBody,
+			expected: result{DryRun: true, Total: 4, Created: 1, Updated: 1, Failed: 2, Errors: []struct {
+				Row     int    `json:"row"`
+				Message string `json:"message"`
+			}{{Row: 4, Message: "model is required"}, {Row: 5, Message: `id "not-a-uuid" is not a uuid`}}},
+			expectedCode: http.StatusOK,
+			wantDevices:  1,
+		},
+		{
+			description: "ndjson",
+			route:       "/v1/device/import?format=ndjson",
+			body: `{"model":"Mini","color":"Red","version":"v1.0"}` + "\n\n" +
+				`{"id":"5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60","model":"Mini","color":"Red","version":"v1.0"}` + "\n" +
+				`{"model":` + "\n",
+			expected: result{Total: 3, Created: 2, Failed: 1, Errors: []struct {
+				Row     int    `json:"row"`
+				Message string `json:"message"`
+			}{{Row: 4, Message: "unexpected end of JSON input"}}},
+			expectedCode: http.StatusOK,
+			wantDevices:  3,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			teardownSubTest := seed(t)
+			defer teardownSubTest(t)
+
+			req := httptest.NewRequest("POST", tc.route, strings.NewReader(tc.body))
+			if len(tc.contentType) > 0 {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, req)
+			assert.Equal(t, tc.expectedCode, actul.Code)
+
+			var resp struct {
+				Code int    `json:"code"`
+				Data result `json:"data"`
+			}
+			assert.NoError(t, json.Unmarshal(actul.Body.Bytes(), &resp))
+			assert.Equal(t, 2000000, resp.Code)
+			assert.Equal(t, tc.expected, resp.Data)
+
+			var count int
+			s.db.GetDB().Model(&device.Device{}).Count(&count)
+			assert.Equal(t, tc.wantDevices, count)
+		})
+	}
+
+	// an unreadable input fails as a whole
+	req := httptest.NewRequest("POST", "/v1/device/import?format=csv", strings.NewReader("name\nx\n"))
+	actul := httptest.NewRecorder()
+	s.c.ServeHTTP(actul, req)
+	assert.Equal(t, http.StatusBadRequest, actul.Code)
+	assert.Contains(t, actul.Body.String(), `"code":4000003`)
+}
@@ -0,0 +1,137 @@
+package device
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github/demo/rest/content"
+	"github/demo/service"
+	"github/demo/utils/trace"
+)
+
+type ShadowState struct {
+	Color   string `json:",omitempty"`
+	Version string `json:",omitempty"`
+}
+
+type Shadow struct {
+	Id       string
+	Desired  *ShadowState
+	Reported *ShadowState
+	Delta    *ShadowState
+	Version  int64
+}
+
+// Desired replaces the desired config of a shadow, at Version unless it is
+// nil
+type Desired struct {
+	Desired *ShadowState
+	Version *int64
+}
+
+// Acknowledgement reports that a device applied the delta of its shadow at
+// Version, running Reported or the delta itself when it is nil
+type Acknowledgement struct {
+	Version  *int64
+	Reported *ShadowState
+}
+
+func (s *ShadowState) serviceType() *service.ShadowState {
+	if s == nil {
+		return nil
+	}
+	return &service.ShadowState{
+		Color:   s.Color,
+		Version: s.Version,
+	}
+}
+
+func (s *Shadow) Assemble(r *service.Shadow) {
+	s.Id = r.Id
+	s.Desired = &ShadowState{Color: r.Desired.Color, Version: r.Desired.Version}
+	s.Reported = &ShadowState{Color: r.Reported.Color, Version: r.Reported.Version}
+	s.Delta = &ShadowState{Color: r.Delta.Color, Version: r.Delta.Version}
+	s.Version = r.Version
+}
+
+func (e *Endpoint) GetDeviceShadow(c *gin.Context) {
+	shadow, code := e.Device.Shadow(c.Request.Context(), c.Param("id"))
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := &Shadow{}
+		re.Assemble(shadow)
+		resp.Data(re)
+	}
+
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// DeviceShadowDelta returns what a device has to apply, and the version to
+// acknowledge it with
+func (e *Endpoint) DeviceShadowDelta(c *gin.Context) {
+	shadow, code := e.Device.Shadow(c.Request.Context(), c.Param("id"))
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := &Shadow{}
+		re.Assemble(shadow)
+		resp.Data(map[string]interface{}{
+			"Delta":   re.Delta,
+			"Version": re.Version,
+		})
+	}
+
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) SetDeviceDesired(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "SetDeviceDesired bind")
+	d := &Desired{}
+	err := c.ShouldBindJSON(d)
+	span.Finish()
+
+	resp := content.NewContent()
+	if err != nil || d.Desired == nil {
+		code := service.ErrorCodeBadRequest
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+		return
+	}
+
+	version := service.AnyVersion
+	if d.Version != nil {
+		version = *d.Version
+	}
+	shadow, code := e.Device.SetDesired(c.Request.Context(), c.Param("id"), d.Desired.serviceType(), version)
+	if code == service.ErrorCodeSuccess {
+		re := &Shadow{}
+		re.Assemble(shadow)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) AcknowledgeDeviceShadow(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "AcknowledgeDeviceShadow bind")
+	a := &Acknowledgement{}
+	err := c.ShouldBindJSON(a)
+	span.Finish()
+
+	resp := content.NewContent()
+	if err != nil || a.Version == nil {
+		code := service.ErrorCodeBadRequest
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+		return
+	}
+
+	shadow, code := e.Device.Acknowledge(c.Request.Context(), c.Param("id"), *a.Version, a.Reported.serviceType())
+	if code == service.ErrorCodeSuccess {
+		re := &Shadow{}
+		re.Assemble(shadow)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
@@ -1,13 +1,33 @@
 package device
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+
+	"github/demo/model/device"
+	"github/demo/service"
+)
+
+func MakeHandler(r *gin.RouterGroup, s service.IDeviceService) {
+	e := &Endpoint{Device: s}
 
-func MakeHandler(r *gin.RouterGroup) {
 	g := r.Group("/device")
 	{
-		g.GET("", FindDevice)
-		g.POST("", RegisterDevice)
-		g.DELETE("/:id", DeleteDevice)
-		g.PUT("", UpdateDevice)
+		g.GET("", e.FindDevice)
+		g.GET("/export", e.ExportDevice)
+		g.GET("/:id/history", e.DeviceHistory)
+		g.POST("", e.RegisterDevice)
+		g.POST("/import", e.ImportDevice)
+		g.DELETE("/:id", e.DeleteDevice)
+		g.POST("/:id/heartbeat", e.DeviceHeartbeat)
+		g.GET("/:id/shadow", e.GetDeviceShadow)
+		g.PUT("/:id/shadow", e.SetDeviceDesired)
+		g.GET("/:id/shadow/delta", e.DeviceShadowDelta)
+		g.POST("/:id/shadow/ack", e.AcknowledgeDeviceShadow)
+		g.POST("/:id/activate", e.TransitionDevice(device.ActionActivate))
+		g.POST("/:id/suspend", e.TransitionDevice(device.ActionSuspend))
+		g.POST("/:id/decommission", e.TransitionDevice(device.ActionDecommission))
+		g.POST("/:id/labels", e.SetDeviceLabels)
+		g.DELETE("/:id/labels/:key", e.RemoveDeviceLabel)
+		g.PUT("", e.UpdateDevice)
 	}
 }
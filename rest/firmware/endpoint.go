@@ -0,0 +1,459 @@
+package firmware
+
+import (
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github/demo/model/firmware"
+	"github/demo/rest/content"
+	"github/demo/service"
+	"github/demo/utils/trace"
+)
+
+// ReleaseQuery describes a release uploaded as the body of the request,
+// Checksum is the SHA-256 digest of the body in hex, unchecked when empty
+type ReleaseQuery struct {
+	Model    string `form:"model"`
+	Version  string `form:"version"`
+	Notes    string `form:"notes"`
+	Checksum string `form:"checksum"`
+}
+
+type Release struct {
+	Id         string
+	Model      string
+	Version    string
+	Checksum   string
+	Size       int64
+	Signature  string
+	KeyId      string
+	Notes      string
+	CreateTime int64
+}
+
+type SigningKey struct {
+	Id         string
+	PublicKey  string
+	Status     string
+	CreateTime int64
+	RetireTime int64
+}
+
+// Verification tells whether the artifact of a release matches its digest
+// and signature, Reason is why it doesn't
+type Verification struct {
+	ReleaseId string
+	KeyId     string
+	Checksum  string
+	Digest    string
+	Signature string
+	Valid     bool
+	Reason    string `json:",omitempty"`
+}
+
+// FindReleaseQuery selects the releases of Model, of all models when it is
+// empty
+type FindReleaseQuery struct {
+	Model string `form:"model"`
+	service.Page
+}
+
+// CampaignRequest rolls release ReleaseId out to the devices Selector
+// selects, in waves of the percentages of Waves such as [10, 50, 100].
+// FailureThreshold is the default one when absent, Timeout is a duration
+// such as 30m, the default timeout when empty.
+type CampaignRequest struct {
+	ReleaseId        string
+	Selector         string
+	Waves            []int
+	FailureThreshold *float64
+	Timeout          string
+}
+
+// ResumeRequest resumes a campaign, with a new failure threshold unless it
+// is absent
+type ResumeRequest struct {
+	FailureThreshold *float64
+}
+
+type Campaign struct {
+	Id               string
+	ReleaseId        string
+	Selector         string
+	Waves            []int
+	Wave             int
+	Status           string
+	FailureThreshold float64
+	Timeout          int64
+	Reason           string
+	CreateTime       int64
+	UpdateTime       int64
+	Progress         map[string]int64 `json:",omitempty"`
+}
+
+type CampaignDevice struct {
+	DeviceId   string
+	Wave       int
+	Status     string
+	StartTime  int64
+	UpdateTime int64
+}
+
+// StatusQuery selects the campaigns or the devices of a campaign in Status,
+// all of them when it is empty
+type StatusQuery struct {
+	Status string `form:"status"`
+	service.Page
+}
+
+// Endpoint serves the firmware routes with the services of one app
+type Endpoint struct {
+	Firmware service.IFirmwareService
+}
+
+func (r *Release) Assemble(x *service.Release) {
+	r.Id = x.Id
+	r.Model = x.Model
+	r.Version = x.Version
+	r.Checksum = x.Checksum
+	r.Size = x.Size
+	r.Signature = x.Signature
+	r.KeyId = x.KeyId
+	r.Notes = x.Notes
+	r.CreateTime = x.CreateTime
+}
+
+func (k *SigningKey) Assemble(x *service.SigningKey) {
+	k.Id = x.Id
+	k.PublicKey = x.PublicKey
+	k.Status = x.Status
+	k.CreateTime = x.CreateTime
+	k.RetireTime = x.RetireTime
+}
+
+func (v *Verification) Assemble(x *service.Verification) {
+	v.ReleaseId = x.ReleaseId
+	v.KeyId = x.KeyId
+	v.Checksum = x.Checksum
+	v.Digest = x.Digest
+	v.Signature = x.Signature
+	v.Valid = x.Valid
+	v.Reason = x.Reason
+}
+
+// serviceType returns the request of r, false when its timeout isn't a
+// duration
+func (r *CampaignRequest) serviceType() (*service.CampaignRequest, bool) {
+	var timeout time.Duration
+	if len(r.Timeout) > 0 {
+		d, err := time.ParseDuration(r.Timeout)
+		if err != nil || d <= 0 {
+			return nil, false
+		}
+		timeout = d
+	}
+	threshold := service.DefaultFailureThreshold
+	if r.FailureThreshold != nil {
+		threshold = *r.FailureThreshold
+	}
+	return &service.CampaignRequest{
+		ReleaseId:        r.ReleaseId,
+		Selector:         r.Selector,
+		Waves:            r.Waves,
+		FailureThreshold: threshold,
+		Timeout:          timeout,
+	}, true
+}
+
+func (c *Campaign) Assemble(x *service.Campaign) {
+	c.Id = x.Id
+	c.ReleaseId = x.ReleaseId
+	c.Selector = x.Selector
+	c.Waves = x.Waves
+	c.Wave = x.Wave
+	c.Status = x.Status
+	c.FailureThreshold = x.FailureThreshold
+	c.Timeout = x.Timeout
+	c.Reason = x.Reason
+	c.CreateTime = x.CreateTime
+	c.UpdateTime = x.UpdateTime
+	c.Progress = x.Progress
+}
+
+func (d *CampaignDevice) Assemble(x *service.CampaignDevice) {
+	d.DeviceId = x.DeviceId
+	d.Wave = x.Wave
+	d.Status = x.Status
+	d.StartTime = x.StartTime
+	d.UpdateTime = x.UpdateTime
+}
+
+// CreateRelease registers a release, its artifact is the body of the request
+func (e *Endpoint) CreateRelease(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "CreateRelease bind")
+	q := &ReleaseQuery{}
+	c.ShouldBindQuery(q)
+	span.Finish()
+
+	created, code := e.Firmware.CreateRelease(c.Request.Context(), &service.ReleaseRequest{
+		Model:    q.Model,
+		Version:  q.Version,
+		Notes:    q.Notes,
+		Checksum: q.Checksum,
+	}, c.Request.Body)
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := &Release{}
+		re.Assemble(created)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) GetRelease(c *gin.Context) {
+	release, code := e.Firmware.GetRelease(c.Request.Context(), c.Param("id"))
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := &Release{}
+		re.Assemble(release)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// FindRelease returns the releases, newest first
+func (e *Endpoint) FindRelease(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "FindRelease bind")
+	q := &FindReleaseQuery{}
+	c.ShouldBindQuery(q)
+	span.Finish()
+
+	releases, code := e.Firmware.FindReleases(c.Request.Context(), q.Model, &q.Page)
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		datas := make([]*Release, 0, len(releases))
+		for _, v := range releases {
+			re := &Release{}
+			re.Assemble(v)
+			datas = append(datas, re)
+		}
+		resp.Data(&service.PagingContent{
+			Page:  &q.Page,
+			Datas: datas,
+		})
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) DeleteRelease(c *gin.Context) {
+	code := e.Firmware.DeleteRelease(c.Request.Context(), c.Param("id"))
+	resp := content.NewContent()
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// DownloadArtifact streams the artifact of a release, its digest is in the
+// X-Checksum-Sha256 header and its signature, if signed, in the
+// X-Signature-Ed25519 one
+func (e *Endpoint) DownloadArtifact(c *gin.Context) {
+	release, r, code := e.Firmware.Artifact(c.Request.Context(), c.Param("id"))
+	if code != service.ErrorCodeSuccess {
+		resp := content.NewContent()
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+		return
+	}
+	defer r.Close()
+
+	headers := map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": release.Model + "-" + release.Version + ".bin"}),
+		"X-Checksum-Sha256":   release.Checksum,
+	}
+	// an unsigned release has no signature headers
+	if len(release.Signature) > 0 {
+		headers["X-Signature-Ed25519"] = release.Signature
+		headers["X-Signature-Key-Id"] = release.KeyId
+	}
+	c.Set(content.CodeKey, code.Int())
+	c.DataFromReader(http.StatusOK, release.Size, "application/octet-stream", r, headers)
+}
+
+// VerifyRelease checks the stored artifact of a release against its digest
+// and signature
+func (e *Endpoint) VerifyRelease(c *gin.Context) {
+	v, code := e.Firmware.VerifyRelease(c.Request.Context(), c.Param("id"))
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := &Verification{}
+		re.Assemble(v)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// FindKey returns the signing keys, newest first
+func (e *Endpoint) FindKey(c *gin.Context) {
+	keys, code := e.Firmware.Keys(c.Request.Context())
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		datas := make([]*SigningKey, 0, len(keys))
+		for _, v := range keys {
+			re := &SigningKey{}
+			re.Assemble(v)
+			datas = append(datas, re)
+		}
+		resp.Data(datas)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// RotateKey makes a new key sign the releases, the retired one still
+// verifies those it signed
+func (e *Endpoint) RotateKey(c *gin.Context) {
+	k, code := e.Firmware.RotateKey(c.Request.Context())
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := &SigningKey{}
+		re.Assemble(k)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// CreateCampaign starts rolling a release out
+func (e *Endpoint) CreateCampaign(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "CreateCampaign bind")
+	r := &CampaignRequest{}
+	err := c.ShouldBindJSON(r)
+	request, ok := r.serviceType()
+	span.Finish()
+
+	resp := content.NewContent()
+	if err != nil || !ok {
+		code := service.ErrorCodeCampaignInvalid
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+		return
+	}
+
+	created, code := e.Firmware.CreateCampaign(c.Request.Context(), request)
+	if code == service.ErrorCodeSuccess {
+		re := &Campaign{}
+		re.Assemble(created)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// GetCampaign returns a campaign with the number of its devices by status
+func (e *Endpoint) GetCampaign(c *gin.Context) {
+	campaign, code := e.Firmware.GetCampaign(c.Request.Context(), c.Param("id"))
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := &Campaign{}
+		re.Assemble(campaign)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// FindCampaign returns the campaigns, newest first
+func (e *Endpoint) FindCampaign(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "FindCampaign bind")
+	q := &StatusQuery{}
+	c.ShouldBindQuery(q)
+	span.Finish()
+
+	campaigns, code := e.Firmware.FindCampaigns(c.Request.Context(), q.Status, &q.Page)
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		datas := make([]*Campaign, 0, len(campaigns))
+		for _, v := range campaigns {
+			re := &Campaign{}
+			re.Assemble(v)
+			datas = append(datas, re)
+		}
+		resp.Data(&service.PagingContent{
+			Page:  &q.Page,
+			Datas: datas,
+		})
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// CampaignDevices returns the devices of a campaign, by wave
+func (e *Endpoint) CampaignDevices(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "CampaignDevices bind")
+	q := &StatusQuery{}
+	c.ShouldBindQuery(q)
+	span.Finish()
+
+	devices, code := e.Firmware.CampaignDevices(c.Request.Context(), c.Param("id"), q.Status, &q.Page)
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		datas := make([]*CampaignDevice, 0, len(devices))
+		for _, v := range devices {
+			re := &CampaignDevice{}
+			re.Assemble(v)
+			datas = append(datas, re)
+		}
+		resp.Data(&service.PagingContent{
+			Page:  &q.Page,
+			Datas: datas,
+		})
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) PauseCampaign(c *gin.Context) {
+	e.updateCampaign(c, firmware.CampaignPaused, nil)
+}
+
+// ResumeCampaign resumes a paused campaign, the body may raise its failure
+// threshold
+func (e *Endpoint) ResumeCampaign(c *gin.Context) {
+	r := &ResumeRequest{}
+	if c.Request.ContentLength != 0 {
+		_, span := trace.Start(c.Request.Context(), "ResumeCampaign bind")
+		err := c.ShouldBindJSON(r)
+		span.Finish()
+		if err != nil {
+			code := service.ErrorCodeCampaignInvalid
+			resp := content.NewContent()
+			resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+			content.JSON(c, service.ErrorStatusCode(code), resp)
+			return
+		}
+	}
+	e.updateCampaign(c, firmware.CampaignRunning, r.FailureThreshold)
+}
+
+func (e *Endpoint) CancelCampaign(c *gin.Context) {
+	e.updateCampaign(c, firmware.CampaignCancelled, nil)
+}
+
+// updateCampaign moves the campaign of the request to status
+func (e *Endpoint) updateCampaign(c *gin.Context, status string, threshold *float64) {
+	campaign, code := e.Firmware.UpdateCampaign(c.Request.Context(), c.Param("id"), status, threshold)
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := &Campaign{}
+		re.Assemble(campaign)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
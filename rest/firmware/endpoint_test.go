@@ -0,0 +1,327 @@
+package firmware_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/config"
+	"github/demo/daos"
+	"github/demo/database"
+	"github/demo/model/command"
+	"github/demo/model/device"
+	"github/demo/model/firmware"
+	routeFirmware "github/demo/rest/firmware"
+	"github/demo/service"
+	"github/demo/utils/artifact"
+	"github/demo/utils/keywrap"
+)
+
+// "hello" and its SHA-256 digest
+const (
+	helloArtifact = "hello"
+	helloDigest   = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+)
+
+type FirmwareTestCaseSuite struct {
+	db    database.IDatabase
+	c     *gin.Engine
+	store *artifact.Store
+}
+
+func setupFirmwareTestCaseSuite(t *testing.T) (FirmwareTestCaseSuite, func(t *testing.T)) {
+	s := FirmwareTestCaseSuite{
+		c: gin.New(),
+	}
+	s.c.Use(gin.Recovery())
+
+	name := filepath.Join(os.TempDir(), "gorm"+uuid.Must(uuid.NewV4()).String()+".db")
+	df, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if df == nil || err != nil {
+		panic(fmt.Sprintf("No error should happen when creating db file, but got %+v", err))
+	}
+	dir, err := ioutil.TempDir("", "firmware")
+	if err != nil {
+		panic(fmt.Sprintf("No error should happen when creating artifact dir, but got %+v", err))
+	}
+
+	c := &config.Database{
+		Dialect: "sqlite",
+		Host:    df.Name(),
+	}
+
+	s.db, err = database.NewDatabase(context.Background(), c)
+	s.db.GetDB().AutoMigrate(&device.Device{}, &command.Command{}, &firmware.Release{}, &firmware.Campaign{}, &firmware.Target{}, &firmware.Key{})
+	deviceRepo := daos.NewDeviceRepo(s.db.GetDB())
+	s.store = artifact.NewStore(dir)
+	kek, err := keywrap.New(bytes.Repeat([]byte{7}, keywrap.Size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	routeFirmware.MakeHandler(s.c.Group("/v1"), service.NewFirmwareService(
+		daos.NewFirmwareRepo(s.db.GetDB()),
+		daos.NewCampaignRepo(s.db.GetDB()),
+		daos.NewKeyRepo(s.db.GetDB()),
+		kek,
+		deviceRepo,
+		s.store,
+		service.NewCommandService(daos.NewCommandRepo(s.db.GetDB()), deviceRepo, nil),
+	))
+
+	return s, func(t *testing.T) {
+		s.db.Close()
+		os.Remove(df.Name())
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFirmwareHandler(t *testing.T) {
+	s, teardownTestCase := setupFirmwareTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	s.db.GetDB().Create(&firmware.Release{
+		Id:         "3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001",
+		Model:      "Pro",
+		Version:    "v1.0",
+		Checksum:   helloDigest,
+		Size:       int64(len(helloArtifact)),
+		CreateTime: 1,
+	})
+	_, err := s.store.Put(context.Background(), "3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001", strings.NewReader(helloArtifact), 0)
+	assert.NoError(t, err)
+	s.db.GetDB().Create(&firmware.Campaign{
+		Id:               "3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0002",
+		ReleaseId:        "3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001",
+		Waves:            "50,100",
+		Status:           firmware.CampaignRunning,
+		FailureThreshold: 0.1,
+		Timeout:          3600000,
+		CreateTime:       1,
+		UpdateTime:       1,
+	})
+	release := "/v1/firmware/release"
+	campaign := "/v1/firmware/campaign"
+
+	tt := []struct {
+		description  string
+		route        string
+		method       string
+		contentType  string
+		body         string
+		expected     string
+		expectedCode int
+	}{
+		{
+			description:  "upload",
+			route:        release + "?model=Pro&version=v2.0&notes=fixes&checksum=" + helloDigest,
+			method:       "POST",
+			contentType:  "application/octet-stream",
+			body:         helloArtifact,
+			expected:     `^\{"code":2000000,"data":\{"Id":"[-0-9a-f]{36}","Model":"Pro","Version":"v2.0","Checksum":"` + helloDigest + `","Size":5,"Signature":"[+/0-9A-Za-z]{86}==","KeyId":"[0-9a-f]{16}","Notes":"fixes","CreateTime":\d+\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "upload version again",
+			route:        release + "?model=Pro&version=v2.0",
+			method:       "POST",
+			contentType:  "application/octet-stream",
+			body:         helloArtifact,
+			expected:     `^\{"code":4090006,"msg":"Firmware release already exists"\}$`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			description:  "upload checksum mismatch",
+			route:        release + "?model=Pro&version=v2.1&checksum=" + strings.Repeat("0", 64),
+			method:       "POST",
+			contentType:  "application/octet-stream",
+			body:         helloArtifact,
+			expected:     `^\{"code":4000012,"msg":"Firmware release invalid"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "find by model",
+			route:        release + "?model=Pro",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"page":\{"page":1,"number":50\},"datas":\[\{"Id":"[-0-9a-f]{36}","Model":"Pro","Version":"v2.0",.*\},\{"Id":"3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001",.*\}\]\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "get",
+			route:        release + "/3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"Id":"3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001","Model":"Pro","Version":"v1.0",.*\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "get invalid uuid",
+			route:        release + "/1234",
+			method:       "GET",
+			expected:     `^\{"code":4000001,"msg":"Had a error in uuid parsing"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "download",
+			route:        release + "/3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001/artifact",
+			method:       "GET",
+			expected:     `^hello$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "download unknown release",
+			route:        release + "/5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60/artifact",
+			method:       "GET",
+			expected:     `^\{"code":4040000,"msg":"Not found"\}$`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			description:  "verify unsigned",
+			route:        release + "/3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001/verify",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"ReleaseId":"3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001","KeyId":"","Checksum":"` + helloDigest + `","Digest":"` + helloDigest + `","Signature":"","Valid":false,"Reason":"release not signed"\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "verify unknown release",
+			route:        release + "/5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60/verify",
+			method:       "GET",
+			expected:     `^\{"code":4040000,"msg":"Not found"\}$`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			description:  "find key",
+			route:        "/v1/firmware/key",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\[\{"Id":"[0-9a-f]{16}","PublicKey":"[+/0-9A-Za-z]{43}=","Status":"active","CreateTime":\d+,"RetireTime":0\}\],"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "rotate key",
+			route:        "/v1/firmware/key/rotate",
+			method:       "POST",
+			expected:     `^\{"code":2000000,"data":\{"Id":"[0-9a-f]{16}",.*"Status":"active",.*\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "find key after rotation",
+			route:        "/v1/firmware/key",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\[\{.*"Status":"active",.*\},\{.*"Status":"retired",.*\}\],"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "delete in use",
+			route:        release + "/3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001",
+			method:       "DELETE",
+			expected:     `^\{"code":4090007,"msg":"Firmware release in use"\}$`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			description:  "create campaign",
+			route:        campaign,
+			method:       "POST",
+			body:         `{"releaseid":"3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001","selector":"site=tpe","waves":[10,100]}`,
+			expected:     `^\{"code":2000000,"data":\{"Id":"[-0-9a-f]{36}","ReleaseId":"3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001","Selector":"site=tpe","Waves":\[10,100\],"Wave":0,"Status":"running","FailureThreshold":0.1,"Timeout":3600000,.*\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "create campaign invalid timeout",
+			route:        campaign,
+			method:       "POST",
+			body:         `{"releaseid":"3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0001","waves":[100],"timeout":"soon"}`,
+			expected:     `^\{"code":4000013,"msg":"Rollout campaign invalid"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "create campaign unknown release",
+			route:        campaign,
+			method:       "POST",
+			body:         `{"releaseid":"5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60","waves":[100]}`,
+			expected:     `^\{"code":4040000,"msg":"Not found"\}$`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			description:  "get campaign",
+			route:        campaign + "/3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0002",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"Id":"3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0002",.*"Progress":\{"failed":0,"succeeded":0,"updating":0\}\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "find campaign by status",
+			route:        campaign + "?status=running&number=1",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"page":\{"page":1,"number":1\},"datas":\[\{"Id":"[-0-9a-f]{36}",.*"Status":"running",.*\}\]\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "campaign devices",
+			route:        campaign + "/3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0002/devices?status=failed",
+			method:       "GET",
+			expected:     `^\{"code":2000000,"data":\{"page":\{"page":1,"number":50\},"datas":\[\]\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "campaign devices invalid status",
+			route:        campaign + "/3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0002/devices?status=done",
+			method:       "GET",
+			expected:     `^\{"code":4000013,"msg":"Rollout campaign invalid"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "pause",
+			route:        campaign + "/3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0002/pause",
+			method:       "POST",
+			expected:     `^\{"code":2000000,"data":\{.*"Status":"paused",.*"Reason":"paused by anonymous",.*\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "pause again",
+			route:        campaign + "/3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0002/pause",
+			method:       "POST",
+			expected:     `^\{"code":4090008,"msg":"Rollout campaign status transition invalid"\}$`,
+			expectedCode: http.StatusConflict,
+		},
+		{
+			description:  "resume with threshold",
+			route:        campaign + "/3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0002/resume",
+			method:       "POST",
+			body:         `{"failurethreshold":0.3}`,
+			expected:     `^\{"code":2000000,"data":\{.*"Status":"running","FailureThreshold":0.3,.*\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "cancel",
+			route:        campaign + "/3e0f5b8a-6c1d-4a2e-9f3b-0a1b2c3d0002/cancel",
+			method:       "POST",
+			expected:     `^\{"code":2000000,"data":\{.*"Status":"cancelled",.*\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.route, strings.NewReader(tc.body))
+			if len(tc.contentType) > 0 {
+				req.Header.Set("Content-Type", tc.contentType)
+			} else if len(tc.body) > 0 {
+				req.Header.Set("Content-Type", gin.MIMEJSON)
+			}
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, req)
+			assert.Equal(t, tc.expectedCode, actul.Code)
+			assert.Regexp(t, regexp.MustCompile(tc.expected), strings.TrimSpace(actul.Body.String()))
+		})
+	}
+}
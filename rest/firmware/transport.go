@@ -0,0 +1,32 @@
+package firmware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github/demo/service"
+)
+
+func MakeHandler(r *gin.RouterGroup, s service.IFirmwareService) {
+	e := &Endpoint{Firmware: s}
+
+	g := r.Group("/firmware")
+	{
+		g.GET("/release", e.FindRelease)
+		g.POST("/release", e.CreateRelease)
+		g.GET("/release/:id", e.GetRelease)
+		g.DELETE("/release/:id", e.DeleteRelease)
+		g.GET("/release/:id/artifact", e.DownloadArtifact)
+		g.GET("/release/:id/verify", e.VerifyRelease)
+
+		g.GET("/key", e.FindKey)
+		g.POST("/key/rotate", e.RotateKey)
+
+		g.GET("/campaign", e.FindCampaign)
+		g.POST("/campaign", e.CreateCampaign)
+		g.GET("/campaign/:id", e.GetCampaign)
+		g.GET("/campaign/:id/devices", e.CampaignDevices)
+		g.POST("/campaign/:id/pause", e.PauseCampaign)
+		g.POST("/campaign/:id/resume", e.ResumeCampaign)
+		g.POST("/campaign/:id/cancel", e.CancelCampaign)
+	}
+}
@@ -0,0 +1,215 @@
+package group
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github/demo/rest/content"
+	"github/demo/rest/device"
+	"github/demo/service"
+	"github/demo/utils/trace"
+)
+
+type Group struct {
+	Id         string `form:"id"`
+	ParentId   string `form:"parent_id"`
+	Name       string `form:"name"`
+	CreateTime int64  `form:"create_time"`
+	UpdateTime int64  `form:"update_time"`
+}
+
+// Members are the devices added to or removed from a group
+type Members struct {
+	Ids []string `json:"ids"`
+}
+
+// Endpoint serves the group routes with the services of one app
+type Endpoint struct {
+	Group service.IGroupService
+}
+
+func (g *Group) serviceType() *service.Group {
+	return &service.Group{
+		Id:       g.Id,
+		ParentId: g.ParentId,
+		Name:     g.Name,
+	}
+}
+
+func (g *Group) Assemble(s *service.Group) {
+	g.Id = s.Id
+	g.ParentId = s.ParentId
+	g.Name = s.Name
+	g.CreateTime = s.CreateTime
+	g.UpdateTime = s.UpdateTime
+}
+
+// recursive reports whether the devices of the subgroups are asked for too
+func recursive(c *gin.Context) bool {
+	r, _ := strconv.ParseBool(c.Query("recursive"))
+	return r
+}
+
+func (e *Endpoint) FindGroup(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "FindGroup bind")
+	page := &service.Page{}
+	c.ShouldBindQuery(page)
+	span.Finish()
+
+	rows, code := e.Group.Find(c.Request.Context(), c.Query("parent_id"), page)
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := []*Group{}
+		for _, v := range rows {
+			g := &Group{}
+			g.Assemble(v)
+			re = append(re, g)
+		}
+		resp.Data(&service.PagingContent{
+			Page:  page,
+			Datas: re,
+		})
+	}
+
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) GetGroup(c *gin.Context) {
+	m, code := e.Group.Get(c.Request.Context(), c.Param("id"))
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		re := &Group{}
+		re.Assemble(m)
+		resp.Data(re)
+	}
+
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) CreateGroup(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "CreateGroup bind")
+	group := &Group{}
+	c.ShouldBind(group)
+	span.Finish()
+
+	m, code := e.Group.Create(c.Request.Context(), group.serviceType())
+	resp := content.NewContent()
+
+	var re *Group
+	if code == service.ErrorCodeSuccess {
+		re = &Group{}
+		re.Assemble(m)
+	}
+	resp.Data(re)
+
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// UpdateGroup replaces the name and the parent of a group, a group without
+// ParentId moves to the top level
+func (e *Endpoint) UpdateGroup(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "UpdateGroup bind")
+	group := &Group{}
+	c.ShouldBind(group)
+	group.Id = c.Param("id")
+	span.Finish()
+
+	affect, code := e.Group.Update(c.Request.Context(), group.serviceType())
+	resp := content.NewContent()
+	resp.Data(map[string]int64{
+		"affect": affect,
+	})
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) DeleteGroup(c *gin.Context) {
+	code := e.Group.Delete(c.Request.Context(), c.Param("id"))
+	resp := content.NewContent()
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) AddGroupDevices(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "AddGroupDevices bind")
+	members := &Members{}
+	err := c.ShouldBindJSON(members)
+	span.Finish()
+
+	code := service.ErrorCodeBadRequest
+	if err == nil {
+		code = e.Group.AddDevices(c.Request.Context(), c.Param("id"), members.Ids)
+	}
+	resp := content.NewContent()
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+func (e *Endpoint) RemoveGroupDevice(c *gin.Context) {
+	affect, code := e.Group.RemoveDevices(c.Request.Context(), c.Param("id"), []string{c.Param("device_id")})
+	resp := content.NewContent()
+	resp.Data(map[string]int64{
+		"affect": affect,
+	})
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// FindGroupDevices returns the devices of a group, with those of its
+// subgroups with recursive=true. The device filters of GET /v1/device apply.
+func (e *Endpoint) FindGroupDevices(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "FindGroupDevices bind")
+	page := &service.Page{}
+	c.ShouldBindQuery(page)
+	filter := &device.Device{}
+	c.ShouldBindQuery(filter)
+	span.Finish()
+
+	rows, code := e.Group.Devices(c.Request.Context(), c.Param("id"), recursive(c), &service.Device{
+		Model:    filter.Model,
+		Color:    filter.Color,
+		Version:  filter.Version,
+		Selector: filter.Selector,
+	}, page)
+	resp := content.NewContent()
+	if code == service.ErrorCodeSuccess {
+		var re []*device.Device
+		for _, v := range rows {
+			d := &device.Device{}
+			d.Assemble(v)
+			re = append(re, d)
+		}
+		resp.Data(&service.PagingContent{
+			Page:  page,
+			Datas: re,
+		})
+	}
+
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// UpdateGroupDevices updates every device of a group, and of its subgroups
+// with recursive=true, as PUT /v1/device does one
+func (e *Endpoint) UpdateGroupDevices(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "UpdateGroupDevices bind")
+	fields := &device.Device{}
+	c.ShouldBind(fields)
+	span.Finish()
+
+	affect, code := e.Group.UpdateDevices(c.Request.Context(), c.Param("id"), recursive(c), &service.Device{
+		Model:   fields.Model,
+		Color:   fields.Color,
+		Version: fields.Version,
+	})
+	resp := content.NewContent()
+	resp.Data(map[string]int64{
+		"affect": affect,
+	})
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
@@ -0,0 +1,201 @@
+package group_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/config"
+	"github/demo/daos"
+	"github/demo/database"
+	"github/demo/model/device"
+	"github/demo/model/group"
+	routeGroup "github/demo/rest/group"
+	"github/demo/service"
+)
+
+type GroupTestCaseSuite struct {
+	db database.IDatabase
+	c  *gin.Engine
+}
+
+func setupGroupTestCaseSuite(t *testing.T) (GroupTestCaseSuite, func(t *testing.T)) {
+	s := GroupTestCaseSuite{
+		c: gin.New(),
+	}
+	s.c.Use(gin.Recovery())
+
+	name := filepath.Join(os.TempDir(), "gorm"+uuid.Must(uuid.NewV4()).String()+".db")
+	df, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if df == nil || err != nil {
+		panic(fmt.Sprintf("No error should happen when creating db file, but got %+v", err))
+	}
+
+	c := &config.Database{
+		Dialect: "sqlite",
+		Host:    df.Name(),
+	}
+
+	s.db, err = database.NewDatabase(context.Background(), c)
+	s.db.GetDB().AutoMigrate(&device.Device{}, &device.History{}, &device.Label{}, &device.Member{}, &group.Group{})
+	deviceRepo := daos.NewDeviceRepo(s.db.GetDB())
+	deviceService := service.NewDeviceService(deviceRepo, daos.NewHistoryRepo(s.db.GetDB()), nil, nil)
+	routeGroup.MakeHandler(s.c.Group("/v1"), service.NewGroupService(daos.NewGroupRepo(s.db.GetDB()), deviceRepo, deviceService))
+
+	return s, func(t *testing.T) {
+		s.db.Close()
+		os.Remove(df.Name())
+	}
+}
+
+const (
+	fleet = device.UUID("0b5d2c3e-8a3f-4b4e-9d4a-6f1e2d3c4b5a")
+	site  = device.UUID("1c6e3d4f-9b4a-4c5f-8e5b-7a2f3e4d5c6b")
+)
+
+func TestGroupHandler(t *testing.T) {
+	s, teardownTestCase := setupGroupTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	parent := fleet
+	s.db.GetDB().Create(&group.Group{Id: fleet, Name: "fleet", CreateTime: 1})
+	s.db.GetDB().Create(&group.Group{Id: site, ParentId: &parent, Name: "site", CreateTime: 2})
+	s.db.GetDB().Create(&device.Device{Id: "c9d7c314-fd95-448a-8db9-4756cc774f7d", Model: "Pro", Color: "White", Version: "v1.2"})
+	s.db.GetDB().Create(&device.Device{Id: "99f970f5-b876-4c94-9190-34ee11d54edb", Model: "Normal", Color: "Black", Version: "v1.2"})
+
+	tt := []struct {
+		description  string
+		route        string
+		method       string
+		body         string
+		expected     string
+		expectedCode int
+	}{
+		{
+			description:  "find top level groups",
+			route:        "/v1/group",
+			method:       "GET",
+			expected:     `^{"code":2000000,"data":{"page":{"page":1,"number":50},"datas":\[{"Id":"0b5d2c3e-8a3f-4b4e-9d4a-6f1e2d3c4b5a","ParentId":"","Name":"fleet","CreateTime":1,"UpdateTime":0},{"Id":"1c6e3d4f-9b4a-4c5f-8e5b-7a2f3e4d5c6b","ParentId":"0b5d2c3e-8a3f-4b4e-9d4a-6f1e2d3c4b5a","Name":"site","CreateTime":2,"UpdateTime":0}\]},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "find subgroups",
+			route:        "/v1/group?parent_id=0b5d2c3e-8a3f-4b4e-9d4a-6f1e2d3c4b5a&page=1&number=10",
+			method:       "GET",
+			expected:     `^{"code":2000000,"data":{"page":{"page":1,"number":10},"datas":\[{"Id":"1c6e3d4f-9b4a-4c5f-8e5b-7a2f3e4d5c6b",.*"Name":"site".*}\]},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "create group",
+			route:        "/v1/group",
+			method:       "POST",
+			body:         `{"Name":"room","ParentId":"1c6e3d4f-9b4a-4c5f-8e5b-7a2f3e4d5c6b"}`,
+			expected:     `^{"code":2000000,"data":{"Id":"[0-9a-f-]{36}","ParentId":"1c6e3d4f-9b4a-4c5f-8e5b-7a2f3e4d5c6b","Name":"room","CreateTime":[0-9]+,"UpdateTime":[0-9]+},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "create group under unknown parent",
+			route:        "/v1/group",
+			method:       "POST",
+			body:         `{"Name":"room","ParentId":"99f970f5-b876-4c94-9190-34ee11d54edb"}`,
+			expected:     `^{"code":4000006,"data":null,"msg":"Group parent invalid"}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "move group under its subgroup",
+			route:        "/v1/group/0b5d2c3e-8a3f-4b4e-9d4a-6f1e2d3c4b5a",
+			method:       "PUT",
+			body:         `{"Name":"fleet","ParentId":"1c6e3d4f-9b4a-4c5f-8e5b-7a2f3e4d5c6b"}`,
+			expected:     `^{"code":4000006,"data":{"affect":0},"msg":"Group parent invalid"}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "rename group",
+			route:        "/v1/group/1c6e3d4f-9b4a-4c5f-8e5b-7a2f3e4d5c6b",
+			method:       "PUT",
+			body:         `{"Name":"tpe","ParentId":"0b5d2c3e-8a3f-4b4e-9d4a-6f1e2d3c4b5a"}`,
+			expected:     `^{"code":2000000,"data":{"affect":1},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "get group",
+			route:        "/v1/group/1c6e3d4f-9b4a-4c5f-8e5b-7a2f3e4d5c6b",
+			method:       "GET",
+			expected:     `^{"code":2000000,"data":{"Id":"1c6e3d4f-9b4a-4c5f-8e5b-7a2f3e4d5c6b","ParentId":"0b5d2c3e-8a3f-4b4e-9d4a-6f1e2d3c4b5a","Name":"tpe","CreateTime":2,"UpdateTime":[0-9]+},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "add devices",
+			route:        "/v1/group/1c6e3d4f-9b4a-4c5f-8e5b-7a2f3e4d5c6b/devices",
+			method:       "POST",
+			body:         `{"ids":["c9d7c314-fd95-448a-8db9-4756cc774f7d","99f970f5-b876-4c94-9190-34ee11d54edb"]}`,
+			expected:     `^{"code":2000000,"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "add unknown device",
+			route:        "/v1/group/1c6e3d4f-9b4a-4c5f-8e5b-7a2f3e4d5c6b/devices",
+			method:       "POST",
+			body:         `{"ids":["5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60"]}`,
+			expected:     `^{"code":4040000,"msg":"Not found"}$`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			description:  "find direct devices",
+			route:        "/v1/group/0b5d2c3e-8a3f-4b4e-9d4a-6f1e2d3c4b5a/devices?page=1&number=10",
+			method:       "GET",
+			expected:     `^{"code":2000001,"msg":"Success with no affect rows"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "find devices recursively",
+			route:        "/v1/group/0b5d2c3e-8a3f-4b4e-9d4a-6f1e2d3c4b5a/devices?recursive=true&page=1&number=10&color=Black",
+			method:       "GET",
+			expected:     `^{"code":2000000,"data":{"page":{"page":1,"number":10},"datas":\[{"Id":"99f970f5-b876-4c94-9190-34ee11d54edb","Model":"Normal","Color":"Black","Version":"v1.2","CreateTime":0,"UpdateTime":0,"Status":"offline"}\]},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "update devices recursively",
+			route:        "/v1/group/0b5d2c3e-8a3f-4b4e-9d4a-6f1e2d3c4b5a/devices?recursive=true",
+			method:       "PUT",
+			body:         `{"Version":"v1.3"}`,
+			expected:     `^{"code":2000000,"data":{"affect":2},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "remove device",
+			route:        "/v1/group/1c6e3d4f-9b4a-4c5f-8e5b-7a2f3e4d5c6b/devices/99f970f5-b876-4c94-9190-34ee11d54edb",
+			method:       "DELETE",
+			expected:     `^{"code":2000000,"data":{"affect":1},"msg":"Success"}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "delete group with subgroups",
+			route:        "/v1/group/0b5d2c3e-8a3f-4b4e-9d4a-6f1e2d3c4b5a",
+			method:       "DELETE",
+			expected:     `^{"code":4090000,"msg":"Group has subgroups"}$`,
+			expectedCode: http.StatusConflict,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.route, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", gin.MIMEJSON)
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, req)
+			assert.Equal(t, tc.expectedCode, actul.Code)
+			assert.Regexp(t, regexp.MustCompile(tc.expected), strings.Replace(actul.Body.String(), "\n", "", -1))
+		})
+	}
+}
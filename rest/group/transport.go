@@ -0,0 +1,24 @@
+package group
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github/demo/service"
+)
+
+func MakeHandler(r *gin.RouterGroup, s service.IGroupService) {
+	e := &Endpoint{Group: s}
+
+	g := r.Group("/group")
+	{
+		g.GET("", e.FindGroup)
+		g.GET("/:id", e.GetGroup)
+		g.GET("/:id/devices", e.FindGroupDevices)
+		g.POST("", e.CreateGroup)
+		g.POST("/:id/devices", e.AddGroupDevices)
+		g.PUT("/:id", e.UpdateGroup)
+		g.PUT("/:id/devices", e.UpdateGroupDevices)
+		g.DELETE("/:id", e.DeleteGroup)
+		g.DELETE("/:id/devices/:device_id", e.RemoveGroupDevice)
+	}
+}
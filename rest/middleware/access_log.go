@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github/demo/rest/content"
+	"github/demo/utils/log"
+)
+
+// AccessLogOptions configures which requests are written to the access log
+type AccessLogOptions struct {
+	// Skip lists the routes or paths that are never logged, e.g. health checks
+	Skip []string
+	// Sample maps a route or path to the ratio of requests logged, in [0, 1].
+	// Routes not listed are always logged, server errors are never sampled.
+	Sample map[string]float64
+}
+
+func (o *AccessLogOptions) skip(route, path string) bool {
+	for _, s := range o.Skip {
+		if s == route || s == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *AccessLogOptions) sampled(route, path string) bool {
+	rate, ok := o.Sample[route]
+	if !ok {
+		rate, ok = o.Sample[path]
+	}
+	if !ok {
+		return true
+	}
+	return rand.Float64() < rate
+}
+
+// AccessLog writes one line per request through utils/log
+func AccessLog(o AccessLogOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		path := c.Request.URL.Path
+		status := c.Writer.Status()
+		if o.skip(route, path) {
+			return
+		}
+		if status < 500 && !o.sampled(route, path) {
+			return
+		}
+
+		code, _ := c.Get(content.CodeKey)
+		entry := log.WithContext(c.Request.Context()).
+			WithField("method", c.Request.Method).
+			WithField("route", route).
+			WithField("path", path).
+			WithField("status", status).
+			WithField("code", code).
+			WithField("latency", time.Since(start).String()).
+			WithField("bytes", c.Writer.Size()).
+			WithField("client_ip", c.ClientIP())
+
+		switch {
+		case status >= 500:
+			entry.Error("access")
+		case status >= 400:
+			entry.Warn("access")
+		default:
+			entry.Info("access")
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/rest/content"
+	"github/demo/rest/middleware"
+	"github/demo/utils/log"
+)
+
+func TestAccessLog(t *testing.T) {
+	tt := []struct {
+		description string
+		route       string
+		status      int
+		options     middleware.AccessLogOptions
+		logged      bool
+	}{
+		{
+			description: "logged",
+			route:       "/v1/device/abc",
+			status:      http.StatusNotFound,
+			logged:      true,
+		},
+		{
+			description: "skip health check",
+			route:       "/healthz",
+			status:      http.StatusOK,
+			options:     middleware.AccessLogOptions{Skip: []string{"/healthz"}},
+			logged:      false,
+		},
+		{
+			description: "sampled out by route template",
+			route:       "/v1/device/abc",
+			status:      http.StatusOK,
+			options:     middleware.AccessLogOptions{Sample: map[string]float64{"/v1/device/:id": 0}},
+			logged:      false,
+		},
+		{
+			description: "server error is never sampled out",
+			route:       "/v1/device/abc",
+			status:      http.StatusInternalServerError,
+			options:     middleware.AccessLogOptions{Sample: map[string]float64{"/v1/device/:id": 0}},
+			logged:      true,
+		},
+	}
+
+	log.Setup(log.Options{Env: "development", Level: "debug", Format: log.FormatJSON})
+	defer log.Setup(log.Options{Env: "development", Level: "debug"})
+	defer log.SetOutput(os.Stderr)
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			log.SetOutput(buf)
+
+			status := tc.status
+			r := gin.New()
+			r.Use(middleware.RequestID())
+			r.Use(middleware.AccessLog(tc.options))
+			handler := func(c *gin.Context) {
+				resp := content.NewContent()
+				resp.Code(status * 10000).Msg("msg")
+				content.JSON(c, status, resp)
+			}
+			r.GET("/healthz", handler)
+			r.GET("/v1/device/:id", handler)
+
+			req := httptest.NewRequest("GET", tc.route, nil)
+			req.Header.Set(middleware.HeaderRequestID, "req-1")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if !tc.logged {
+				assert.Empty(t, buf.String())
+				return
+			}
+			m := make(map[string]interface{})
+			assert.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(buf.String())), &m))
+			assert.Equal(t, "GET", m["method"])
+			assert.Equal(t, "/v1/device/:id", m["route"])
+			assert.Equal(t, float64(tc.status), m["status"])
+			assert.Equal(t, float64(tc.status*10000), m["code"])
+			assert.Equal(t, "req-1", m["request_id"])
+			assert.Contains(t, m, "latency")
+			assert.Contains(t, m, "bytes")
+			assert.Contains(t, m, "client_ip")
+		})
+	}
+}
+
+func TestAccessLog_Panic(t *testing.T) {
+	log.Setup(log.Options{Env: "development", Level: "debug", Format: log.FormatJSON})
+	defer log.Setup(log.Options{Env: "development", Level: "debug"})
+	defer log.SetOutput(os.Stderr)
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+
+	// the order of rest.Init, recovered inside the access log
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	r.Use(middleware.AccessLog(middleware.AccessLogOptions{}))
+	r.Use(gin.RecoveryWithWriter(ioutil.Discard))
+	r.GET("/v1/device/:id", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest("GET", "/v1/device/abc", nil)
+	req.Header.Set(middleware.HeaderRequestID, "req-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	m := make(map[string]interface{})
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(buf.String())), &m))
+	assert.Equal(t, "error", m["level"])
+	assert.Equal(t, "/v1/device/:id", m["route"])
+	assert.Equal(t, float64(http.StatusInternalServerError), m["status"])
+	assert.Equal(t, "req-1", m["request_id"])
+}
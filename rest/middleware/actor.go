@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github/demo/utils/audit"
+)
+
+const HeaderActor = "X-Actor"
+
+// maximum length of an actor accepted from the client
+const maxActorLen = 128
+
+// Actor stores the X-Actor header in the request context, as who makes the
+// changes of the request. It is accepted on the terms of a client request id,
+// as it ends up in the logs and the device history, otherwise the request is
+// left anonymous.
+func Actor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := c.GetHeader(HeaderActor)
+		if validToken(actor, maxActorLen) {
+			c.Request = c.Request.WithContext(audit.NewContext(c.Request.Context(), actor))
+		}
+		c.Next()
+	}
+}
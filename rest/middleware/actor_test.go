@@ -0,0 +1,79 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/rest/middleware"
+	"github/demo/utils/audit"
+)
+
+func TestActor(t *testing.T) {
+	tt := []struct {
+		description string
+		header      string
+		expected    string
+	}{
+		{
+			description: "accept client actor",
+			header:      "alice",
+			expected:    "alice",
+		},
+		{
+			description: "no actor",
+			header:      "",
+			expected:    audit.Anonymous,
+		},
+		{
+			description: "accept client actor of the request id charset",
+			header:      "ci-bot_2.0",
+			expected:    "ci-bot_2.0",
+		},
+		{
+			description: "actor with a space",
+			header:      "alice admin",
+			expected:    audit.Anonymous,
+		},
+		{
+			description: "actor with a control character",
+			header:      "alice\x1b[31m",
+			expected:    audit.Anonymous,
+		},
+		{
+			description: "actor not in ascii",
+			header:      "ålice",
+			expected:    audit.Anonymous,
+		},
+		{
+			description: "actor too long",
+			header:      strings.Repeat("a", 129),
+			expected:    audit.Anonymous,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			var actor string
+			r := gin.New()
+			r.Use(middleware.Actor())
+			r.GET("/", func(c *gin.Context) {
+				actor = audit.Actor(c.Request.Context())
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if len(tc.header) > 0 {
+				req.Header.Set(middleware.HeaderActor, tc.header)
+			}
+			actul := httptest.NewRecorder()
+			r.ServeHTTP(actul, req)
+
+			assert.Equal(t, http.StatusOK, actul.Code)
+			assert.Equal(t, tc.expected, actor)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github/demo/rest/content"
+	"github/demo/utils/metrics"
+)
+
+// route label of the requests matching no route
+const unmatchedRoute = "unmatched"
+
+// Metrics counts the requests, their latency and the service error codes
+func Metrics(reg *metrics.Registry) gin.HandlerFunc {
+	requests := reg.Counter("demo_http_requests_total",
+		"Number of HTTP requests by method, route and status.", "method", "route", "status")
+	latency := reg.Histogram("demo_http_request_duration_seconds",
+		"HTTP request latency by method, route and status.", metrics.DefBuckets, "method", "route", "status")
+	codes := reg.Counter("demo_service_error_codes_total",
+		"Number of responses by service error code.", "code")
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if len(route) == 0 {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		requests.Inc(c.Request.Method, route, status)
+		latency.Observe(time.Since(start).Seconds(), c.Request.Method, route, status)
+		if code, ok := c.Get(content.CodeKey); ok {
+			codes.Inc(fmt.Sprintf("%v", code))
+		}
+	}
+}
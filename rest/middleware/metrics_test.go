@@ -0,0 +1,38 @@
+package middleware_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/rest/content"
+	"github/demo/rest/middleware"
+	"github/demo/utils/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	r := gin.New()
+	r.Use(middleware.Metrics(reg))
+	r.GET("/v1/device/:id", func(c *gin.Context) {
+		resp := content.NewContent()
+		resp.Code(4040000).Msg("Not found")
+		content.JSON(c, http.StatusNotFound, resp)
+	})
+
+	for _, route := range []string{"/v1/device/a", "/v1/device/b", "/nothing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", route, nil))
+	}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, reg.Write(buf))
+	out := buf.String()
+	assert.Contains(t, out, `demo_http_requests_total{method="GET",route="/v1/device/:id",status="404"} 2`)
+	assert.Contains(t, out, `demo_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, out, `demo_http_request_duration_seconds_count{method="GET",route="/v1/device/:id",status="404"} 2`)
+	assert.Contains(t, out, `demo_service_error_codes_total{code="4040000"} 2`)
+}
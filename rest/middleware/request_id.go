@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+
+	"github/demo/utils/log"
+)
+
+const HeaderRequestID = "X-Request-ID"
+
+// maximum length of a request id accepted from the client
+const maxRequestIDLen = 128
+
+// RequestID accepts the X-Request-ID header or generates a new one, returns
+// it in the response and stores it in the request context for the logger. A
+// client id is accepted only when it is made of letters, digits, '.', '_'
+// and '-', as it ends up in the logs, the headers and the device history.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if !validToken(id, maxRequestIDLen) {
+			id = uuid.Must(uuid.NewV4()).String()
+		}
+
+		c.Header(HeaderRequestID, id)
+		c.Request = c.Request.WithContext(log.NewContext(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// validToken reports whether a value of the client, of at most max bytes,
+// can be used as it is. It is made of letters, digits, '.', '_' and '-' only.
+func validToken(v string, max int) bool {
+	if len(v) == 0 || len(v) > max {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		switch b := v[i]; {
+		case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9':
+		case b == '.', b == '_', b == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
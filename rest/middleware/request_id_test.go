@@ -0,0 +1,85 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/rest/middleware"
+	"github/demo/utils/log"
+)
+
+func TestRequestID(t *testing.T) {
+	tt := []struct {
+		description string
+		header      string
+		generated   bool
+	}{
+		{
+			description: "accept client id",
+			header:      "abc-123",
+			generated:   false,
+		},
+		{
+			description: "generate id",
+			header:      "",
+			generated:   true,
+		},
+		{
+			description: "replace id too long",
+			header:      strings.Repeat("a", 129),
+			generated:   true,
+		},
+		{
+			description: "replace id with spaces",
+			header:      "abc 123",
+			generated:   true,
+		},
+		{
+			description: "replace id with log fields",
+			header:      `abc" level=error msg="forged`,
+			generated:   true,
+		},
+		{
+			description: "replace id with control characters",
+			header:      "abc\x1b[31m",
+			generated:   true,
+		},
+		{
+			description: "accept dotted id",
+			header:      "Trace_01.abc-123",
+			generated:   false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			var ctxID string
+			r := gin.New()
+			r.Use(middleware.RequestID())
+			r.GET("/", func(c *gin.Context) {
+				ctxID = log.RequestID(c.Request.Context())
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if len(tc.header) > 0 {
+				req.Header.Set(middleware.HeaderRequestID, tc.header)
+			}
+			actul := httptest.NewRecorder()
+			r.ServeHTTP(actul, req)
+
+			assert.Equal(t, http.StatusOK, actul.Code)
+			respID := actul.Header().Get(middleware.HeaderRequestID)
+			assert.Equal(t, respID, ctxID)
+			if tc.generated {
+				assert.Len(t, respID, 36)
+			} else {
+				assert.Equal(t, tc.header, respID)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/rest/middleware"
+)
+
+func TestTimeout(t *testing.T) {
+	tt := []struct {
+		description string
+		timeout     time.Duration
+		deadline    bool
+	}{
+		{
+			description: "bound request",
+			timeout:     time.Minute,
+			deadline:    true,
+		},
+		{
+			description: "disabled",
+			timeout:     0,
+			deadline:    false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			var deadline time.Time
+			var ok bool
+			r := gin.New()
+			r.Use(middleware.Timeout(tc.timeout))
+			r.GET("/", func(c *gin.Context) {
+				deadline, ok = c.Request.Context().Deadline()
+			})
+
+			actul := httptest.NewRecorder()
+			r.ServeHTTP(actul, httptest.NewRequest("GET", "/", nil))
+
+			assert.Equal(t, http.StatusOK, actul.Code)
+			assert.Equal(t, tc.deadline, ok)
+			if tc.deadline {
+				assert.WithinDuration(t, time.Now().Add(tc.timeout), deadline, time.Second)
+			}
+		})
+	}
+}
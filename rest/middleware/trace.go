@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"github/demo/rest/content"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+)
+
+// Trace starts a server span per request, continuing the trace of the
+// traceparent header when present, and returns the span in traceparent
+func Trace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := trace.Extract(c.Request.Context(), c.Request.Header)
+
+		route := c.FullPath()
+		if len(route) == 0 {
+			route = unmatchedRoute
+		}
+		ctx, span := trace.StartKind(ctx, c.Request.Method+" "+route, trace.KindServer)
+		defer span.Finish()
+
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", c.Request.URL.RequestURI())
+		span.SetAttribute("http.client_ip", c.ClientIP())
+		if id := log.RequestID(ctx); len(id) > 0 {
+			span.SetAttribute("http.request_id", id)
+		}
+
+		trace.Inject(ctx, c.Writer.Header())
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttribute("http.status_code", status)
+		if code, ok := c.Get(content.CodeKey); ok {
+			span.SetAttribute("service.code", code)
+		}
+		if status >= 500 {
+			span.SetStatus(trace.StatusError, fmt.Sprintf("HTTP %d", status))
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/rest/middleware"
+	"github/demo/utils/trace"
+)
+
+func TestTrace(t *testing.T) {
+	tt := []struct {
+		description string
+		traceparent string
+		traceID     string
+	}{
+		{
+			description: "continue remote trace",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			traceID:     "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{
+			description: "new trace on invalid header",
+			traceparent: "garbage",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			name := filepath.Join(os.TempDir(), "trace"+uuid.Must(uuid.NewV4()).String()+".json")
+			defer os.Remove(name)
+			assert.NoError(t, trace.Setup(trace.Options{Exporter: trace.ExporterFile, Filename: name, SampleRatio: 1}))
+
+			var span *trace.Span
+			r := gin.New()
+			r.Use(middleware.Trace())
+			r.GET("/v1/device/:id", func(c *gin.Context) {
+				span = trace.FromContext(c.Request.Context())
+			})
+
+			req := httptest.NewRequest("GET", "/v1/device/abc", nil)
+			req.Header.Set(trace.HeaderTraceparent, tc.traceparent)
+			actul := httptest.NewRecorder()
+			r.ServeHTTP(actul, req)
+			// flushes the spans to the file
+			assert.NoError(t, trace.Setup(trace.Options{}))
+
+			assert.NotNil(t, span)
+			sc := span.SpanContext()
+			if len(tc.traceID) > 0 {
+				assert.Equal(t, tc.traceID, sc.TraceID().String())
+			}
+			parts := strings.Split(actul.Header().Get(trace.HeaderTraceparent), "-")
+			assert.Equal(t, []string{"00", sc.TraceID().String(), sc.SpanID().String(), "01"}, parts)
+
+			b, err := ioutil.ReadFile(name)
+			assert.NoError(t, err)
+			m := make(map[string]interface{})
+			assert.NoError(t, json.Unmarshal(b, &m))
+			assert.Equal(t, "GET /v1/device/:id", m["name"])
+			assert.Equal(t, trace.KindServer, m["kind"])
+			assert.Equal(t, sc.SpanID().String(), m["span_id"])
+			if len(tc.traceID) > 0 {
+				assert.Equal(t, "00f067aa0ba902b7", m["parent_span_id"])
+			} else {
+				assert.NotContains(t, m, "parent_span_id")
+			}
+			attrs := m["attributes"].(map[string]interface{})
+			assert.Equal(t, float64(200), attrs["http.status_code"])
+		})
+	}
+}
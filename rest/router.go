@@ -1,20 +1,85 @@
 package rest
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/gin-gonic/gin"
 
+	"github/demo/app"
+	"github/demo/config"
+	"github/demo/rest/catalog"
+	"github/demo/rest/command"
+	"github/demo/rest/content"
 	"github/demo/rest/device"
+	"github/demo/rest/firmware"
+	"github/demo/rest/group"
+	"github/demo/rest/middleware"
+	"github/demo/rest/telemetry"
+	"github/demo/service"
+	"github/demo/utils/log"
+	"github/demo/utils/metrics"
 )
 
-func Init() *gin.Engine {
+func Init(a *app.App) *gin.Engine {
+	cf, reg := a.Config, a.Metrics
 	r := gin.New()
 
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Actor())
+	r.Use(middleware.Trace())
+	r.Use(middleware.AccessLog(middleware.AccessLogOptions{
+		Skip:   cf.Access.Skip,
+		Sample: cf.Access.Sample,
+	}))
+	r.Use(middleware.Metrics(reg))
+	// recover inside the access log and the metrics, a panic is logged and
+	// counted as the 500 it answers
 	r.Use(gin.Recovery())
+	r.Use(middleware.Timeout(requestTimeout(cf.Server)))
+
+	r.GET("/healthz", Health)
+	r.GET("/metrics", Metrics(reg))
 
 	v1 := r.Group("/v1")
 	{
-		device.MakeHandler(v1)
+		device.MakeHandler(v1, a.DeviceService)
+		group.MakeHandler(v1, a.GroupService)
+		catalog.MakeHandler(v1, a.CatalogService)
+		telemetry.MakeHandler(v1, a.TelemetryService)
+		command.MakeHandler(v1, a.CommandService)
+		firmware.MakeHandler(v1, a.FirmwareService)
 	}
 
 	return r
 }
+
+func requestTimeout(s *config.Server) time.Duration {
+	if len(s.RequestTimeout) == 0 {
+		return 0
+	}
+	d, err := time.ParseDuration(s.RequestTimeout)
+	if err != nil {
+		log.Errorf("config request timeout %q invalid => %+v", s.RequestTimeout, err)
+		return 0
+	}
+	return d
+}
+
+func Health(c *gin.Context) {
+	code := service.ErrorCodeSuccess
+	resp := content.NewContent()
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, http.StatusOK, resp)
+}
+
+// Metrics exposes reg in the Prometheus text format
+func Metrics(reg *metrics.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", metrics.ContentType)
+		c.Status(http.StatusOK)
+		if err := reg.Write(c.Writer); err != nil {
+			log.WithContext(c.Request.Context()).Errorf("metrics write fail => %+v", err)
+		}
+	}
+}
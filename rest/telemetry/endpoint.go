@@ -0,0 +1,172 @@
+package telemetry
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github/demo/rest/content"
+	"github/demo/service"
+	"github/demo/utils/trace"
+)
+
+// Point is one value of a metric, at Time in milliseconds or when it is
+// received
+type Point struct {
+	Metric string
+	Time   int64
+	Value  float64
+}
+
+// Batch is the points a device sends at once
+type Batch struct {
+	Points []*Point
+}
+
+// Result is the outcome of a batch
+type Result struct {
+	Stored  int64
+	Dropped int
+}
+
+// SeriesQuery selects a series, From and To are in milliseconds, Step is a
+// duration such as 5m or a number of milliseconds
+type SeriesQuery struct {
+	Metric string `form:"metric"`
+	From   int64  `form:"from"`
+	To     int64  `form:"to"`
+	Step   string `form:"step"`
+}
+
+type Series struct {
+	Metric string
+	From   int64
+	To     int64
+	Step   int64
+	Points []*SeriesPoint
+}
+
+type SeriesPoint struct {
+	Time  int64
+	Count int64
+	Avg   float64
+	Min   float64
+	Max   float64
+	Sum   float64
+}
+
+// Endpoint serves the telemetry routes with the services of one app
+type Endpoint struct {
+	Telemetry service.ITelemetryService
+}
+
+func (b *Batch) serviceType() []*service.TelemetryPoint {
+	points := make([]*service.TelemetryPoint, 0, len(b.Points))
+	for _, p := range b.Points {
+		if p == nil {
+			points = append(points, nil)
+			continue
+		}
+		points = append(points, &service.TelemetryPoint{
+			Metric: p.Metric,
+			Time:   p.Time,
+			Value:  p.Value,
+		})
+	}
+	return points
+}
+
+// serviceType returns the query of q, false when its step is neither a
+// duration nor a number
+func (q *SeriesQuery) serviceType() (*service.SeriesQuery, bool) {
+	var step int64
+	if len(q.Step) > 0 {
+		if ms, err := strconv.ParseInt(q.Step, 10, 64); err == nil {
+			step = ms
+		} else if d, err := time.ParseDuration(q.Step); err == nil {
+			step = int64(d / time.Millisecond)
+		} else {
+			return nil, false
+		}
+		if step <= 0 {
+			return nil, false
+		}
+	}
+	return &service.SeriesQuery{
+		Metric: q.Metric,
+		From:   q.From,
+		To:     q.To,
+		Step:   step,
+	}, true
+}
+
+func (s *Series) Assemble(r *service.Series) {
+	s.Metric = r.Metric
+	s.From = r.From
+	s.To = r.To
+	s.Step = r.Step
+	s.Points = make([]*SeriesPoint, 0, len(r.Points))
+	for _, p := range r.Points {
+		s.Points = append(s.Points, &SeriesPoint{
+			Time:  p.Time,
+			Count: p.Count,
+			Avg:   p.Avg,
+			Min:   p.Min,
+			Max:   p.Max,
+			Sum:   p.Sum,
+		})
+	}
+}
+
+// IngestTelemetry stores a batch of points of a device
+func (e *Endpoint) IngestTelemetry(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "IngestTelemetry bind")
+	b := &Batch{}
+	err := c.ShouldBindJSON(b)
+	span.Finish()
+
+	resp := content.NewContent()
+	if err != nil {
+		code := service.ErrorCodeTelemetryInvalid
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+		return
+	}
+
+	result, code := e.Telemetry.Ingest(c.Request.Context(), c.Param("id"), b.serviceType())
+	if code == service.ErrorCodeSuccess {
+		resp.Data(&Result{
+			Stored:  result.Stored,
+			Dropped: result.Dropped,
+		})
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
+
+// FindSeries returns a metric of a device summed up in buckets
+func (e *Endpoint) FindSeries(c *gin.Context) {
+	_, span := trace.Start(c.Request.Context(), "FindSeries bind")
+	q := &SeriesQuery{}
+	err := c.ShouldBindQuery(q)
+	query, ok := q.serviceType()
+	span.Finish()
+
+	resp := content.NewContent()
+	if err != nil || !ok {
+		code := service.ErrorCodeTelemetryQueryInvalid
+		resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+		content.JSON(c, service.ErrorStatusCode(code), resp)
+		return
+	}
+
+	series, code := e.Telemetry.Series(c.Request.Context(), c.Param("id"), query)
+	if code == service.ErrorCodeSuccess {
+		re := &Series{}
+		re.Assemble(series)
+		resp.Data(re)
+	}
+	resp.Code(code.Int()).Msg(service.ErrorMsg(code))
+	content.JSON(c, service.ErrorStatusCode(code), resp)
+}
@@ -0,0 +1,167 @@
+package telemetry_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/config"
+	"github/demo/daos"
+	"github/demo/database"
+	"github/demo/model/device"
+	"github/demo/model/telemetry"
+	routeTelemetry "github/demo/rest/telemetry"
+	"github/demo/service"
+)
+
+type TelemetryTestCaseSuite struct {
+	db database.IDatabase
+	c  *gin.Engine
+}
+
+func setupTelemetryTestCaseSuite(t *testing.T) (TelemetryTestCaseSuite, func(t *testing.T)) {
+	s := TelemetryTestCaseSuite{
+		c: gin.New(),
+	}
+	s.c.Use(gin.Recovery())
+
+	name := filepath.Join(os.TempDir(), "gorm"+uuid.Must(uuid.NewV4()).String()+".db")
+	df, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if df == nil || err != nil {
+		panic(fmt.Sprintf("No error should happen when creating db file, but got %+v", err))
+	}
+
+	c := &config.Database{
+		Dialect: "sqlite",
+		Host:    df.Name(),
+	}
+
+	s.db, err = database.NewDatabase(context.Background(), c)
+	s.db.GetDB().AutoMigrate(&device.Device{}, &telemetry.Point{}, &telemetry.Rollup{})
+	deviceRepo := daos.NewDeviceRepo(s.db.GetDB())
+	telemetryRepo := daos.NewTelemetryRepo(s.db.GetDB())
+	routeTelemetry.MakeHandler(s.c.Group("/v1"), service.NewTelemetryService(telemetryRepo, deviceRepo, nil))
+
+	return s, func(t *testing.T) {
+		s.db.Close()
+		os.Remove(df.Name())
+	}
+}
+
+func TestTelemetryHandler(t *testing.T) {
+	s, teardownTestCase := setupTelemetryTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	s.db.GetDB().Create(&device.Device{
+		Id:      "c9d7c314-fd95-448a-8db9-4756cc774f7d",
+		Model:   "Pro",
+		Color:   "White",
+		Version: "v1.2",
+	})
+
+	// the start of an hour within the raw retention
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	hour := now - telemetry.Hour
+	hour -= hour % telemetry.Hour
+	route := "/v1/device/c9d7c314-fd95-448a-8db9-4756cc774f7d/telemetry"
+
+	tt := []struct {
+		description  string
+		route        string
+		method       string
+		body         string
+		expected     string
+		expectedCode int
+	}{
+		{
+			description: "ingest",
+			route:       route,
+			method:      "POST",
+			body: fmt.Sprintf(`{"points":[{"metric":"temperature","time":%d,"value":20},{"metric":"temperature","time":%d,"value":22},{"metric":"temperature","time":%d,"value":30},{"metric":"temperature","time":1,"value":1}]}`,
+				hour, hour+30*1000, hour+61*1000),
+			expected:     `^\{"code":2000000,"data":\{"Stored":3,"Dropped":1\},"msg":"Success"\}$`,
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "ingest invalid body",
+			route:        route,
+			method:       "POST",
+			body:         `{"points":"temperature"}`,
+			expected:     `^\{"code":4000009,"msg":"Telemetry invalid"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "ingest invalid metric",
+			route:        route,
+			method:       "POST",
+			body:         `{"points":[{"metric":"temp erature","value":1}]}`,
+			expected:     `^\{"code":4000009,"msg":"Telemetry invalid"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "ingest unknown device",
+			route:        "/v1/device/5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60/telemetry",
+			method:       "POST",
+			body:         `{"points":[{"metric":"temperature","value":1}]}`,
+			expected:     `^\{"code":4040000,"msg":"Not found"\}$`,
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			description: "series by minute",
+			route:       fmt.Sprintf("%s?metric=temperature&from=%d&to=%d&step=1m", route, hour, hour+2*telemetry.Minute),
+			method:      "GET",
+			expected: fmt.Sprintf(`^\{"code":2000000,"data":\{"Metric":"temperature","From":%d,"To":%d,"Step":60000,"Points":\[`+
+				`\{"Time":%d,"Count":2,"Avg":21,"Min":20,"Max":22,"Sum":42\},`+
+				`\{"Time":%d,"Count":1,"Avg":30,"Min":30,"Max":30,"Sum":30\}\]\},"msg":"Success"\}$`,
+				hour, hour+2*telemetry.Minute, hour, hour+telemetry.Minute),
+			expectedCode: http.StatusOK,
+		},
+		{
+			description: "series by hour",
+			route:       fmt.Sprintf("%s?metric=temperature&from=%d&to=%d&step=3600000", route, hour, hour+telemetry.Hour),
+			method:      "GET",
+			expected: fmt.Sprintf(`^\{"code":2000000,"data":\{"Metric":"temperature","From":%d,"To":%d,"Step":3600000,"Points":\[`+
+				`\{"Time":%d,"Count":3,"Avg":24,"Min":20,"Max":30,"Sum":72\}\]\},"msg":"Success"\}$`,
+				hour, hour+telemetry.Hour, hour),
+			expectedCode: http.StatusOK,
+		},
+		{
+			description:  "series invalid step",
+			route:        route + "?metric=temperature&step=often",
+			method:       "GET",
+			expected:     `^\{"code":4000010,"msg":"Telemetry query invalid"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description:  "series without metric",
+			route:        route,
+			method:       "GET",
+			expected:     `^\{"code":4000010,"msg":"Telemetry query invalid"\}$`,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.route, strings.NewReader(tc.body))
+			if len(tc.body) > 0 {
+				req.Header.Set("Content-Type", gin.MIMEJSON)
+			}
+			actul := httptest.NewRecorder()
+			s.c.ServeHTTP(actul, req)
+			assert.Equal(t, tc.expectedCode, actul.Code)
+			assert.Regexp(t, regexp.MustCompile(tc.expected), strings.TrimSpace(actul.Body.String()))
+		})
+	}
+}
@@ -0,0 +1,17 @@
+package telemetry
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github/demo/service"
+)
+
+func MakeHandler(r *gin.RouterGroup, s service.ITelemetryService) {
+	e := &Endpoint{Telemetry: s}
+
+	g := r.Group("/device")
+	{
+		g.GET("/:id/telemetry", e.FindSeries)
+		g.POST("/:id/telemetry", e.IngestTelemetry)
+	}
+}
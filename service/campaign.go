@@ -0,0 +1,538 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/model/firmware"
+	"github/demo/utils/audit"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+)
+
+const (
+	// DefaultCampaignTimeout is how long a device of a campaign without a
+	// timeout has to run its release
+	DefaultCampaignTimeout = time.Hour
+	// DefaultFailureThreshold is the failure rate past which a campaign
+	// without a threshold is paused
+	DefaultFailureThreshold = 0.1
+	// FirmwareUpdateCommand is the command that tells a device to update,
+	// with an UpdatePayload
+	FirmwareUpdateCommand = "firmware.update"
+)
+
+// CampaignRequest rolls release ReleaseId out to the devices of its model
+// Selector selects, in waves of the percentages of Waves. A Timeout of 0 is
+// DefaultCampaignTimeout.
+type CampaignRequest struct {
+	ReleaseId        string        `json:"release_id"`
+	Selector         string        `json:"selector"`
+	Waves            []int         `json:"waves"`
+	FailureThreshold float64       `json:"failure_threshold"`
+	Timeout          time.Duration `json:"timeout"`
+}
+
+type Campaign struct {
+	Id               string  `json:"id"`
+	ReleaseId        string  `json:"release_id"`
+	Selector         string  `json:"selector"`
+	Waves            []int   `json:"waves"`
+	Wave             int     `json:"wave"`
+	Status           string  `json:"status"`
+	FailureThreshold float64 `json:"failure_threshold"`
+	// Timeout is in milliseconds
+	Timeout    int64  `json:"timeout"`
+	Reason     string `json:"reason"`
+	CreateTime int64  `json:"create_time"`
+	UpdateTime int64  `json:"update_time"`
+	// Progress is the number of devices of the campaign by status, only
+	// filled by GetCampaign
+	Progress map[string]int64 `json:"progress,omitempty"`
+}
+
+func (c *Campaign) Assemble(x *firmware.Campaign) {
+	c.Id = x.Id.String()
+	c.ReleaseId = x.ReleaseId.String()
+	c.Selector = x.Selector
+	c.Waves, _ = firmware.ParseWaves(x.Waves)
+	c.Wave = x.Wave
+	c.Status = x.Status
+	c.FailureThreshold = x.FailureThreshold
+	c.Timeout = x.Timeout
+	c.Reason = x.Reason
+	c.CreateTime = x.CreateTime
+	c.UpdateTime = x.UpdateTime
+}
+
+// CampaignDevice is a device of a campaign
+type CampaignDevice struct {
+	DeviceId   string `json:"device_id"`
+	Wave       int    `json:"wave"`
+	Status     string `json:"status"`
+	StartTime  int64  `json:"start_time"`
+	UpdateTime int64  `json:"update_time"`
+}
+
+func (d *CampaignDevice) Assemble(x *firmware.Target) {
+	d.DeviceId = x.DeviceId.String()
+	d.Wave = x.Wave
+	d.Status = x.Status
+	d.StartTime = x.StartTime
+	d.UpdateTime = x.UpdateTime
+}
+
+// UpdatePayload is the payload of a FirmwareUpdateCommand, the device
+// downloads the artifact of release ReleaseId and checks it against Checksum
+// and Signature, the signature of key KeyId
+type UpdatePayload struct {
+	CampaignId string `json:"campaign_id"`
+	ReleaseId  string `json:"release_id"`
+	Version    string `json:"version"`
+	Checksum   string `json:"checksum"`
+	Size       int64  `json:"size"`
+	Signature  string `json:"signature"`
+	KeyId      string `json:"key_id"`
+}
+
+// CreateCampaign starts rolling a release out, its first wave starts on the
+// next Rollout
+func (s *firmwareService) CreateCampaign(ctx context.Context, x *CampaignRequest) (*Campaign, ErrorCode) {
+	ctx, span := trace.Start(ctx, "firmwareService.CreateCampaign")
+	defer span.Finish()
+
+	if x == nil {
+		return nil, ErrorCodeCampaignInvalid
+	}
+	release, code := s.release(ctx, x.ReleaseId)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	selector := strings.TrimSpace(x.Selector)
+	if _, err := device.ParseSelector(selector); err != nil {
+		return nil, ErrorCodeSelectorInvalid
+	}
+	waves := firmware.FormatWaves(x.Waves)
+	if _, err := firmware.ParseWaves(waves); err != nil {
+		return nil, ErrorCodeCampaignInvalid
+	}
+	if x.FailureThreshold < 0 || x.FailureThreshold > 1 || x.Timeout < 0 {
+		return nil, ErrorCodeCampaignInvalid
+	}
+	timeout := x.Timeout
+	if timeout == 0 {
+		timeout = DefaultCampaignTimeout
+	}
+
+	now := millis(time.Now())
+	campaign := &firmware.Campaign{
+		Id:               device.UUID(uuid.Must(uuid.NewV4()).String()),
+		ReleaseId:        release.Id,
+		Selector:         selector,
+		Waves:            waves,
+		Status:           firmware.CampaignRunning,
+		FailureThreshold: x.FailureThreshold,
+		Timeout:          int64(timeout / time.Millisecond),
+		CreateTime:       now,
+		UpdateTime:       now,
+	}
+	if _, err := s.campaignRepo.Create(ctx, campaign); err != nil {
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBCreateFail)
+	}
+
+	re := &Campaign{}
+	re.Assemble(campaign)
+	return re, ErrorCodeSuccess
+}
+
+// GetCampaign returns campaign id with its progress
+func (s *firmwareService) GetCampaign(ctx context.Context, id string) (*Campaign, ErrorCode) {
+	ctx, span := trace.Start(ctx, "firmwareService.GetCampaign")
+	defer span.Finish()
+
+	campaign, code := s.campaign(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	counts, err := s.campaignRepo.CountTargets(ctx, campaign.Id)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+
+	re := &Campaign{}
+	re.Assemble(campaign)
+	re.Progress = map[string]int64{
+		firmware.TargetUpdating:  counts[firmware.TargetUpdating],
+		firmware.TargetSucceeded: counts[firmware.TargetSucceeded],
+		firmware.TargetFailed:    counts[firmware.TargetFailed],
+	}
+	return re, ErrorCodeSuccess
+}
+
+// FindCampaigns returns the campaigns in status, in any status when it is
+// empty, newest first
+func (s *firmwareService) FindCampaigns(ctx context.Context, status string, page *Page) ([]*Campaign, ErrorCode) {
+	ctx, span := trace.Start(ctx, "firmwareService.FindCampaigns")
+	defer span.Finish()
+
+	if _, ok := firmware.CampaignFrom[status]; len(status) > 0 && !ok {
+		return nil, ErrorCodeCampaignInvalid
+	}
+	p, code := firmwarePage(page)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	rows, err := s.campaignRepo.Find(ctx, "", status, p)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+
+	campaigns := make([]*Campaign, 0, len(rows))
+	for _, v := range rows {
+		re := &Campaign{}
+		re.Assemble(v)
+		campaigns = append(campaigns, re)
+	}
+	return campaigns, ErrorCodeSuccess
+}
+
+// CampaignDevices returns the devices of campaign id in status, in any
+// status when it is empty, by wave
+func (s *firmwareService) CampaignDevices(ctx context.Context, id, status string, page *Page) ([]*CampaignDevice, ErrorCode) {
+	ctx, span := trace.Start(ctx, "firmwareService.CampaignDevices")
+	defer span.Finish()
+
+	switch status {
+	case "", firmware.TargetUpdating, firmware.TargetSucceeded, firmware.TargetFailed:
+	default:
+		return nil, ErrorCodeCampaignInvalid
+	}
+	p, code := firmwarePage(page)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	campaign, code := s.campaign(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	rows, err := s.campaignRepo.Targets(ctx, campaign.Id, status, p)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+
+	devices := make([]*CampaignDevice, 0, len(rows))
+	for _, v := range rows {
+		re := &CampaignDevice{}
+		re.Assemble(v)
+		devices = append(devices, re)
+	}
+	return devices, ErrorCodeSuccess
+}
+
+// UpdateCampaign pauses, resumes or cancels campaign id. A campaign resumed
+// with a threshold takes it as its failure threshold, one paused for its
+// failure rate is paused again unless the threshold is raised.
+func (s *firmwareService) UpdateCampaign(ctx context.Context, id, status string, threshold *float64) (*Campaign, ErrorCode) {
+	ctx, span := trace.Start(ctx, "firmwareService.UpdateCampaign")
+	defer span.Finish()
+
+	switch status {
+	case firmware.CampaignRunning, firmware.CampaignPaused, firmware.CampaignCancelled:
+	case firmware.CampaignCompleted:
+		// a campaign completes once its last wave is done
+		return nil, ErrorCodeCampaignStatusInvalid
+	default:
+		return nil, ErrorCodeCampaignInvalid
+	}
+	if threshold != nil && (*threshold < 0 || *threshold > 1) {
+		return nil, ErrorCodeCampaignInvalid
+	}
+	campaign, code := s.campaign(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+
+	wave := campaign.Wave
+	campaign.Status = status
+	campaign.UpdateTime = millis(time.Now())
+	if threshold != nil {
+		campaign.FailureThreshold = *threshold
+	}
+	if status == firmware.CampaignPaused {
+		campaign.Reason = fmt.Sprintf("paused by %s", audit.Actor(ctx))
+	}
+	n, err := s.campaignRepo.Update(ctx, campaign, firmware.CampaignFrom[status], wave)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBUpdateFail)
+	}
+	if n == 0 {
+		// the campaign isn't in a status it moves from, or Rollout moved it
+		// in the meantime
+		return nil, ErrorCodeCampaignStatusInvalid
+	}
+	log.WithContext(ctx).Infof("firmware campaign %s %s by %s", campaign.Id, status, audit.Actor(ctx))
+
+	re := &Campaign{}
+	re.Assemble(campaign)
+	return re, ErrorCodeSuccess
+}
+
+// Rollout steps every running campaign: it settles the devices updating,
+// pauses a campaign whose failure rate is over its threshold, and once no
+// device of a wave is updating starts the next wave or completes it.
+func (s *firmwareService) Rollout(ctx context.Context) ErrorCode {
+	ctx, span := trace.Start(ctx, "firmwareService.Rollout")
+	defer span.Finish()
+
+	// a campaign stepped can leave running, the pages are read before any of
+	// them is stepped
+	var campaigns []*firmware.Campaign
+	for p := (&model.Page{Limit: firmwareNumber}); ; p.Offset += p.Limit {
+		rows, err := s.campaignRepo.Find(ctx, "", firmware.CampaignRunning, p)
+		if err != nil {
+			return contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+		}
+		campaigns = append(campaigns, rows...)
+		if uint64(len(rows)) < p.Limit {
+			break
+		}
+	}
+
+	result := ErrorCodeSuccess
+	for _, c := range campaigns {
+		if code := s.step(ctx, c, time.Now()); code != ErrorCodeSuccess {
+			if err := ctx.Err(); err != nil {
+				return contextErrorCode(err, code)
+			}
+			// one campaign failing doesn't hold the others back
+			log.WithContext(ctx).Errorf("firmware campaign %s rollout fail => %d", c.Id, code)
+			result = code
+		}
+	}
+	return result
+}
+
+// step moves campaign c on at now
+func (s *firmwareService) step(ctx context.Context, c *firmware.Campaign, now time.Time) ErrorCode {
+	release, err := s.firmwareRepo.Get(ctx, c.ReleaseId)
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+	waves, err := firmware.ParseWaves(c.Waves)
+	if err != nil {
+		log.WithContext(ctx).Errorf("firmware campaign %s => %v", c.Id, err)
+		return ErrorCodeCampaignInvalid
+	}
+
+	if code := s.settle(ctx, c, release, millis(now)); code != ErrorCodeSuccess {
+		return code
+	}
+	counts, err := s.campaignRepo.CountTargets(ctx, c.Id)
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+
+	wave := c.Wave
+	c.UpdateTime = millis(now)
+	if total > 0 {
+		if rate := float64(counts[firmware.TargetFailed]) / float64(total); rate > c.FailureThreshold {
+			c.Status = firmware.CampaignPaused
+			c.Reason = fmt.Sprintf("failure rate %.2f over %.2f", rate, c.FailureThreshold)
+			return s.updateCampaign(ctx, c, wave)
+		}
+	}
+	if counts[firmware.TargetUpdating] > 0 {
+		return ErrorCodeSuccess
+	}
+	if wave >= len(waves) {
+		c.Status = firmware.CampaignCompleted
+		return s.updateCampaign(ctx, c, wave)
+	}
+
+	if code := s.startWave(ctx, c, release, waves[wave], millis(now)); code != ErrorCodeSuccess {
+		return code
+	}
+	c.Wave = wave + 1
+	return s.updateCampaign(ctx, c, wave)
+}
+
+// settle moves the devices of campaign c updating to succeeded once they run
+// release, and to failed once they are out of time or gone
+func (s *firmwareService) settle(ctx context.Context, c *firmware.Campaign, release *firmware.Release, now int64) ErrorCode {
+	updating, err := s.campaignRepo.Targets(ctx, c.Id, firmware.TargetUpdating, nil)
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+
+	for _, t := range updating {
+		status := ""
+		d, err := s.deviceRepo.Get(ctx, t.DeviceId)
+		switch {
+		case gorm.IsRecordNotFoundError(err):
+			status = firmware.TargetFailed
+		case err != nil:
+			return contextErrorCode(err, ErrorCodeDeviceDBFindFail)
+		case d.Firmware == release.Version:
+			status = firmware.TargetSucceeded
+		case now-t.StartTime >= c.Timeout:
+			status = firmware.TargetFailed
+		default:
+			continue
+		}
+		if _, err := s.campaignRepo.SetTargetStatus(ctx, c.Id, t.DeviceId, firmware.TargetUpdating, status, now); err != nil {
+			return contextErrorCode(err, ErrorCodeFirmwareDBUpdateFail)
+		}
+	}
+	return ErrorCodeSuccess
+}
+
+// startWave adds the devices of campaign c up to percent of those it
+// selects, and tells those not running release yet to update. The devices
+// are taken in an order of their own for each campaign, so the first waves
+// of campaigns don't always land on the same devices.
+func (s *firmwareService) startWave(ctx context.Context, c *firmware.Campaign, release *firmware.Release, percent int, now int64) ErrorCode {
+	selector, err := device.ParseSelector(c.Selector)
+	if err != nil {
+		log.WithContext(ctx).Errorf("firmware campaign %s => %v", c.Id, err)
+		return ErrorCodeCampaignInvalid
+	}
+	targets, err := s.campaignRepo.Targets(ctx, c.Id, "", nil)
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+	targeted := make(map[device.UUID]bool, len(targets))
+	for _, t := range targets {
+		targeted[t.DeviceId] = true
+	}
+
+	type candidate struct {
+		d    *device.Device
+		rank uint64
+	}
+	candidates := []*candidate{}
+	selected := 0
+	err = s.deviceRepo.Iterate(ctx, &device.Device{Model: release.Model, Selector: selector}, nil, func(d *device.Device) error {
+		if d.State == device.StateDecommissioned {
+			return nil
+		}
+		selected++
+		if targeted[d.Id] {
+			return nil
+		}
+		h := fnv.New64a()
+		h.Write([]byte(c.Id.String() + d.Id.String()))
+		candidates = append(candidates, &candidate{d: d, rank: h.Sum64()})
+		return nil
+	})
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeDeviceDBFindFail)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].rank < candidates[j].rank
+	})
+
+	// the devices targeted by the waves before count towards this one, those
+	// no longer selected too
+	want := (selected*percent + 99) / 100
+	add := want - (selected - len(candidates))
+	if add <= 0 {
+		return ErrorCodeSuccess
+	}
+	if add > len(candidates) {
+		add = len(candidates)
+	}
+
+	added := make([]*firmware.Target, 0, add)
+	for _, v := range candidates[:add] {
+		status := firmware.TargetUpdating
+		if v.d.Firmware == release.Version {
+			status = firmware.TargetSucceeded
+		}
+		added = append(added, &firmware.Target{
+			CampaignId: c.Id,
+			DeviceId:   v.d.Id,
+			Wave:       c.Wave + 1,
+			Status:     status,
+			StartTime:  now,
+			UpdateTime: now,
+		})
+	}
+	if _, err := s.campaignRepo.AddTargets(ctx, added); err != nil {
+		return contextErrorCode(err, ErrorCodeFirmwareDBCreateFail)
+	}
+
+	if s.commands == nil {
+		return ErrorCodeSuccess
+	}
+	payload, _ := json.Marshal(&UpdatePayload{
+		CampaignId: c.Id.String(),
+		ReleaseId:  release.Id.String(),
+		Version:    release.Version,
+		Checksum:   release.Checksum,
+		Size:       release.Size,
+		Signature:  release.Signature,
+		KeyId:      release.KeyId,
+	})
+	for _, t := range added {
+		if t.Status != firmware.TargetUpdating {
+			continue
+		}
+		// a device that isn't told fails once out of time
+		if _, code := s.commands.Enqueue(ctx, t.DeviceId.String(), &CommandRequest{
+			Name:    FirmwareUpdateCommand,
+			Payload: payload,
+		}); code != ErrorCodeSuccess {
+			if err := ctx.Err(); err != nil {
+				return contextErrorCode(err, code)
+			}
+			log.WithContext(ctx).Errorf("firmware campaign %s device %s command fail => %d", c.Id, t.DeviceId, code)
+		}
+	}
+	return ErrorCodeSuccess
+}
+
+// updateCampaign stores c if it is still running at wave, it is left as is
+// when it was paused or cancelled in the meantime
+func (s *firmwareService) updateCampaign(ctx context.Context, c *firmware.Campaign, wave int) ErrorCode {
+	n, err := s.campaignRepo.Update(ctx, c, []string{firmware.CampaignRunning}, wave)
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeFirmwareDBUpdateFail)
+	}
+	switch {
+	case n == 0:
+	case c.Status == firmware.CampaignPaused:
+		log.WithContext(ctx).Warnf("firmware campaign %s paused => %s", c.Id, c.Reason)
+	case c.Status == firmware.CampaignCompleted:
+		log.WithContext(ctx).Infof("firmware campaign %s completed", c.Id)
+	}
+	return ErrorCodeSuccess
+}
+
+// campaign returns campaign id
+func (s *firmwareService) campaign(ctx context.Context, id string) (*firmware.Campaign, ErrorCode) {
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	campaign, err := s.campaignRepo.Get(ctx, device.UUID(id))
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrorCodeNotFound
+		}
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+	return campaign, ErrorCodeSuccess
+}
@@ -0,0 +1,374 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+
+	"github/demo/model"
+	"github/demo/model/catalog"
+	"github/demo/model/device"
+	"github/demo/utils/trace"
+)
+
+// Model is a product model of the catalog
+type Model struct {
+	Name       string   `json:"name"`
+	Colors     []string `json:"colors"`
+	Versions   []string `json:"versions"`
+	CreateTime int64    `json:"create_time"`
+	UpdateTime int64    `json:"update_time"`
+}
+
+func (m *Model) repoType() *catalog.Model {
+	return &catalog.Model{
+		Name:     strings.TrimSpace(m.Name),
+		Colors:   options(m.Colors),
+		Versions: options(m.Versions),
+	}
+}
+
+func (m *Model) Assemble(r *catalog.Model) {
+	m.Name = r.Name
+	m.Colors = append([]string{}, r.Colors...)
+	m.Versions = append([]string{}, r.Versions...)
+	m.CreateTime = r.CreateTime
+	m.UpdateTime = r.UpdateTime
+}
+
+// options returns values trimmed, without the empty ones
+func options(values []string) []string {
+	re := []string{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			re = append(re, v)
+		}
+	}
+	return re
+}
+
+// Mismatch is a device that doesn't match the catalog, Fields names what
+// doesn't: its model, or else its color and its version
+type Mismatch struct {
+	Device *Device  `json:"device"`
+	Fields []string `json:"fields"`
+}
+
+// catalogError is a device that doesn't match the catalog
+type catalogError struct {
+	field string
+	value string
+	model string
+}
+
+func (e *catalogError) Error() string {
+	if e.field == "model" && len(e.value) == 0 {
+		return "model is required"
+	}
+	if e.field == "model" {
+		return fmt.Sprintf("model %q is not in the catalog", e.value)
+	}
+	return fmt.Sprintf("%s %q is not in the catalog of model %q", e.field, e.value, e.model)
+}
+
+// conform checks d, applied on before when it updates a device, against
+// catalog models. As the foreign keys of the device table, a new device is
+// checked whole and an update on the model when it is set and a color or a
+// version when it or the model is. The model of d is trimmed and, found
+// regardless of case, takes the name of the catalog.
+func conform(ctx context.Context, models catalog.Repository, before *device.Device, d *Device) error {
+	if models == nil {
+		return nil
+	}
+
+	after := Device{}
+	if before != nil {
+		after.Assemble(before)
+	}
+	d.Model = strings.TrimSpace(d.Model)
+	if len(d.Model) > 0 {
+		after.Model = d.Model
+	}
+	if len(d.Color) > 0 {
+		after.Color = d.Color
+	}
+	if len(d.Version) > 0 {
+		after.Version = d.Version
+	}
+	// a new device is checked whole, as the foreign keys check every row
+	// inserted, an empty model included
+	if before == nil && len(after.Model) == 0 {
+		return &catalogError{field: "model"}
+	}
+	if before != nil && len(d.Model)+len(d.Color)+len(d.Version) == 0 {
+		return nil
+	}
+
+	m, err := models.Get(ctx, after.Model)
+	if gorm.IsRecordNotFoundError(err) {
+		return &catalogError{field: "model", value: after.Model}
+	}
+	if err != nil {
+		return err
+	}
+	if len(d.Model) > 0 {
+		d.Model = m.Name
+	} else if m.Name != after.Model {
+		// a stored model is checked as the foreign keys do, case included
+		return &catalogError{field: "model", value: after.Model}
+	}
+	if (len(d.Model) > 0 || len(d.Color) > 0) && !m.HasColor(after.Color) {
+		return &catalogError{field: "color", value: after.Color, model: m.Name}
+	}
+	if (len(d.Model) > 0 || len(d.Version) > 0) && !m.HasVersion(after.Version) {
+		return &catalogError{field: "version", value: after.Version, model: m.Name}
+	}
+	return nil
+}
+
+// catalogErrorCode returns ErrorCodeDeviceNotInCatalog for a device that
+// doesn't match the catalog, or code for any other err
+func catalogErrorCode(err error, code ErrorCode) ErrorCode {
+	if _, ok := err.(*catalogError); ok {
+		return ErrorCodeDeviceNotInCatalog
+	}
+	return contextErrorCode(err, code)
+}
+
+type catalogService struct {
+	catalogRepo catalog.Repository
+	deviceRepo  device.Repository
+}
+
+// number of models returned by a Find without a page
+const modelNumber = 50
+
+func (s *catalogService) Find(ctx context.Context, page *Page) ([]*Model, ErrorCode) {
+	ctx, span := trace.Start(ctx, "catalogService.Find")
+	defer span.Finish()
+
+	if page == nil {
+		return nil, ErrorCodeBadRequest
+	}
+	if page.Page == 0 {
+		page.Page = 1
+	}
+	if page.Number == 0 {
+		page.Number = modelNumber
+	}
+
+	rows, err := s.catalogRepo.Find(ctx, &model.Page{
+		Limit:  page.Number,
+		Offset: page.Number * (page.Page - 1),
+	})
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeModelDBFindFail)
+	}
+
+	models := []*Model{}
+	for _, v := range rows {
+		m := &Model{}
+		m.Assemble(v)
+		models = append(models, m)
+	}
+	return models, ErrorCodeSuccess
+}
+
+func (s *catalogService) Get(ctx context.Context, name string) (*Model, ErrorCode) {
+	ctx, span := trace.Start(ctx, "catalogService.Get")
+	defer span.Finish()
+
+	x, err := s.catalogRepo.Get(ctx, name)
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrorCodeNotFound
+		}
+		return nil, contextErrorCode(err, ErrorCodeModelDBFindFail)
+	}
+	m := &Model{}
+	m.Assemble(x)
+	return m, ErrorCodeSuccess
+}
+
+func (s *catalogService) Create(ctx context.Context, m *Model) (*Model, ErrorCode) {
+	ctx, span := trace.Start(ctx, "catalogService.Create")
+	defer span.Finish()
+
+	if m == nil {
+		return nil, ErrorCodeBadRequest
+	}
+	r := m.repoType()
+	if len(r.Name) == 0 {
+		return nil, ErrorCodeBadRequest
+	}
+
+	if _, code := s.Get(ctx, r.Name); code == ErrorCodeSuccess {
+		return nil, ErrorCodeModelExists
+	} else if code != ErrorCodeNotFound {
+		return nil, code
+	}
+
+	x, err := s.catalogRepo.Create(ctx, r)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeModelDBCreateFail)
+	}
+	re := &Model{}
+	re.Assemble(x)
+	return re, ErrorCodeSuccess
+}
+
+// Update replaces the colors and the versions of model m.Name, those still
+// used by a device can't be removed
+func (s *catalogService) Update(ctx context.Context, m *Model) (int64, ErrorCode) {
+	ctx, span := trace.Start(ctx, "catalogService.Update")
+	defer span.Finish()
+
+	if m == nil {
+		return 0, ErrorCodeBadRequest
+	}
+	r := m.repoType()
+	current, code := s.Get(ctx, r.Name)
+	if code != ErrorCodeSuccess {
+		return 0, code
+	}
+	r.Name = current.Name
+
+	for _, color := range missing(current.Colors, r.Colors) {
+		if code := s.unused(ctx, &device.Device{Model: r.Name, Color: color}); code != ErrorCodeSuccess {
+			return 0, code
+		}
+	}
+	for _, version := range missing(current.Versions, r.Versions) {
+		if code := s.unused(ctx, &device.Device{Model: r.Name, Version: version}); code != ErrorCodeSuccess {
+			return 0, code
+		}
+	}
+
+	affect, err := s.catalogRepo.Update(ctx, r)
+	if err != nil {
+		return 0, contextErrorCode(err, ErrorCodeModelDBUpdateFail)
+	}
+	return affect, ErrorCodeSuccess
+}
+
+// Delete removes a model no device uses
+func (s *catalogService) Delete(ctx context.Context, name string) ErrorCode {
+	ctx, span := trace.Start(ctx, "catalogService.Delete")
+	defer span.Finish()
+
+	if code := s.unused(ctx, &device.Device{Model: name}); code != ErrorCodeSuccess {
+		return code
+	}
+
+	affect, err := s.catalogRepo.Delete(ctx, name)
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeModelDBDeleteFail)
+	}
+	if affect <= 0 {
+		return ErrorCodeSuccessButNotFound
+	}
+	return ErrorCodeSuccess
+}
+
+// Mismatches returns the devices that don't match the catalog, a page of them
+// when both fields of page are set
+func (s *catalogService) Mismatches(ctx context.Context, page *Page) ([]*Mismatch, ErrorCode) {
+	ctx, span := trace.Start(ctx, "catalogService.Mismatches")
+	defer span.Finish()
+
+	offset, limit := uint64(0), uint64(0)
+	if page != nil && page.Page > 0 && page.Number > 0 {
+		offset, limit = page.Number*(page.Page-1), page.Number
+	}
+
+	// the catalog is small, it is read once for every device
+	models := make(map[string]*catalog.Model)
+	for p := (&model.Page{Limit: modelNumber}); ; p.Offset += p.Limit {
+		rows, err := s.catalogRepo.Find(ctx, p)
+		if err != nil {
+			return nil, contextErrorCode(err, ErrorCodeModelDBFindFail)
+		}
+		for _, m := range rows {
+			models[m.Name] = m
+		}
+		if uint64(len(rows)) < p.Limit {
+			break
+		}
+	}
+
+	mismatches := []*Mismatch{}
+	err := s.deviceRepo.Iterate(ctx, &device.Device{}, nil, func(d *device.Device) error {
+		var fields []string
+		if m, ok := models[d.Model]; !ok {
+			fields = append(fields, "model")
+		} else {
+			if !m.HasColor(d.Color) {
+				fields = append(fields, "color")
+			}
+			if !m.HasVersion(d.Version) {
+				fields = append(fields, "version")
+			}
+		}
+		if len(fields) == 0 {
+			return nil
+		}
+		if offset > 0 {
+			offset--
+			return nil
+		}
+		if limit > 0 && uint64(len(mismatches)) >= limit {
+			return errMismatchesDone
+		}
+		x := &Device{}
+		x.Assemble(d)
+		mismatches = append(mismatches, &Mismatch{Device: x, Fields: fields})
+		return nil
+	})
+	if err != nil && err != errMismatchesDone {
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBFindFail)
+	}
+	span.SetAttribute("device.count", len(mismatches))
+	return mismatches, ErrorCodeSuccess
+}
+
+// errMismatchesDone stops the devices of Mismatches once the page is full
+var errMismatchesDone = fmt.Errorf("mismatches page full")
+
+// unused returns ErrorCodeModelInUse when a device matches the non-zero
+// fields of d
+func (s *catalogService) unused(ctx context.Context, d *device.Device) ErrorCode {
+	devices, err := s.deviceRepo.Find(ctx, d, &model.Page{Limit: 1})
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeDeviceDBFindFail)
+	}
+	if len(devices) > 0 {
+		return ErrorCodeModelInUse
+	}
+	return ErrorCodeSuccess
+}
+
+// missing returns the values of have not in want
+func missing(have, want []string) []string {
+	kept := make(map[string]bool, len(want))
+	for _, v := range want {
+		kept[v] = true
+	}
+	var re []string
+	for _, v := range have {
+		if !kept[v] {
+			re = append(re, v)
+		}
+	}
+	return re
+}
+
+// NewCatalogService returns the catalog service over cr, checking with dr
+// which entries devices use
+func NewCatalogService(cr catalog.Repository, dr device.Repository) ICatalogService {
+	return &catalogService{
+		catalogRepo: cr,
+		deviceRepo:  dr,
+	}
+}
@@ -0,0 +1,123 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/daos"
+	"github/demo/model/device"
+	"github/demo/service"
+)
+
+func TestCatalogService(t *testing.T) {
+	// Pro was registered before there was a catalog
+	legacy := &device.Device{Id: "c9d7c314-fd95-448a-8db9-4756cc774f7d", Model: "pro", Color: "White", Version: "v1.2"}
+	dr := daos.NewMemoryDeviceRepo(legacy)
+	cr := daos.NewMemoryCatalogRepo()
+	ds := service.NewDeviceService(dr, daos.NewMemoryHistoryRepo(), cr, nil)
+	s := service.NewCatalogService(cr, dr)
+	ctx := context.Background()
+
+	m, code := s.Create(ctx, &service.Model{Name: " Pro ", Colors: []string{"White", " Black", ""}, Versions: []string{"v1.2"}})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, "Pro", m.Name)
+	assert.Equal(t, []string{"Black", "White"}, m.Colors)
+	_, code = s.Create(ctx, &service.Model{Name: "Pro"})
+	assert.Equal(t, service.ErrorCodeModelExists, code)
+	_, code = s.Create(ctx, &service.Model{Name: "PRO"})
+	assert.Equal(t, service.ErrorCodeModelExists, code)
+	_, code = s.Create(ctx, &service.Model{Name: " "})
+	assert.Equal(t, service.ErrorCodeBadRequest, code)
+
+	tt := []struct {
+		description  string
+		device       *service.Device
+		expectedCode service.ErrorCode
+	}{
+		{description: "in the catalog", device: &service.Device{Model: "Pro", Color: "Black", Version: "v1.2"}, expectedCode: service.ErrorCodeSuccess},
+		{description: "unknown model", device: &service.Device{Model: "Lite", Color: "Black", Version: "v1.2"}, expectedCode: service.ErrorCodeDeviceNotInCatalog},
+		{description: "unknown color", device: &service.Device{Model: "Pro", Color: "Red", Version: "v1.2"}, expectedCode: service.ErrorCodeDeviceNotInCatalog},
+		{description: "unknown version", device: &service.Device{Model: "Pro", Color: "Black", Version: "v9"}, expectedCode: service.ErrorCodeDeviceNotInCatalog},
+		{description: "no model", device: &service.Device{}, expectedCode: service.ErrorCodeDeviceNotInCatalog},
+		{description: "no color", device: &service.Device{Model: "Pro", Version: "v1.2"}, expectedCode: service.ErrorCodeDeviceNotInCatalog},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			_, code := ds.Register(ctx, tc.device)
+			assert.Equal(t, tc.expectedCode, code)
+		})
+	}
+
+	// the model is found regardless of case, the device takes its name
+	d, code := ds.Register(ctx, &service.Device{Model: " PRO ", Color: "Black", Version: "v1.2"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, "Pro", d.Model)
+
+	// an update is checked as the foreign keys, on the fields it sets
+	_, code = ds.Update(ctx, &service.Device{Id: string(legacy.Id), Color: "Black"})
+	assert.Equal(t, service.ErrorCodeDeviceNotInCatalog, code)
+	_, code = ds.Update(ctx, &service.Device{Id: string(legacy.Id), Model: "Pro"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	_, code = ds.Update(ctx, &service.Device{Id: string(legacy.Id), Version: "v1.3"})
+	assert.Equal(t, service.ErrorCodeDeviceNotInCatalog, code)
+
+	mismatches, code := s.Mismatches(ctx, nil)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Empty(t, mismatches)
+
+	_, code = s.Update(ctx, &service.Model{Name: "Pro", Colors: []string{"Black"}, Versions: []string{"v1.2", "v1.3"}})
+	assert.Equal(t, service.ErrorCodeModelInUse, code)
+	_, code = s.Update(ctx, &service.Model{Name: "Missing"})
+	assert.Equal(t, service.ErrorCodeNotFound, code)
+	affect, code := s.Update(ctx, &service.Model{Name: "Pro", Colors: []string{"White", "Black", "Red"}, Versions: []string{"v1.2", "v1.3"}})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, int64(1), affect)
+	_, code = ds.Update(ctx, &service.Device{Id: string(legacy.Id), Version: "v1.3"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	// devices stored around the service are reported
+	dr.Create(ctx, &device.Device{Id: "99f970f5-b876-4c94-9190-34ee11d54edb", Model: "Pro ", Color: "White", Version: "v1.2"})
+	dr.Create(ctx, &device.Device{Id: "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60", Model: "Pro", Color: "Pink", Version: "v0"})
+	mismatches, code = s.Mismatches(ctx, nil)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	if assert.Len(t, mismatches, 2) {
+		assert.Equal(t, "99f970f5-b876-4c94-9190-34ee11d54edb", mismatches[0].Device.Id)
+		assert.Equal(t, []string{"model"}, mismatches[0].Fields)
+		assert.Equal(t, []string{"color", "version"}, mismatches[1].Fields)
+	}
+	mismatches, code = s.Mismatches(ctx, &service.Page{Page: 2, Number: 1})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	if assert.Len(t, mismatches, 1) {
+		assert.Equal(t, "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60", mismatches[0].Device.Id)
+	}
+
+	assert.Equal(t, service.ErrorCodeModelInUse, s.Delete(ctx, "Pro"))
+	_, code = s.Create(ctx, &service.Model{Name: "Lite"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	models, code := s.Find(ctx, &service.Page{})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Len(t, models, 2)
+	assert.Equal(t, service.ErrorCodeSuccess, s.Delete(ctx, "Lite"))
+	assert.Equal(t, service.ErrorCodeSuccessButNotFound, s.Delete(ctx, "Lite"))
+}
+
+func TestDeviceService_ImportCatalog(t *testing.T) {
+	cr := daos.NewMemoryCatalogRepo()
+	s := service.NewDeviceService(daos.NewMemoryDeviceRepo(), daos.NewMemoryHistoryRepo(), cr, nil)
+	service.NewCatalogService(cr, nil).Create(context.Background(), &service.Model{Name: "Pro", Colors: []string{"White"}, Versions: []string{"v1.2"}})
+
+	for _, dryRun := range []bool{true, false} {
+		dec, _ := service.NewDeviceDecoder(service.FormatCSV, strings.NewReader("model,color,version\nPro,White,v1.2\nLite,White,v1.2\n"))
+		result, code := s.Import(context.Background(), dec, dryRun)
+		assert.Equal(t, service.ErrorCodeSuccess, code)
+		assert.Equal(t, 1, result.Created)
+		if assert.Len(t, result.Errors, 1) {
+			assert.Equal(t, 3, result.Errors[0].Row)
+			assert.Equal(t, `model "Lite" is not in the catalog`, result.Errors[0].Message)
+		}
+	}
+}
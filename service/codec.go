@@ -0,0 +1,224 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Formats of the device import and export
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// FormatContentType returns the media type of format
+func FormatContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	}
+	return ""
+}
+
+var csvHeader = []string{"id", "model", "color", "version", "create_time", "update_time"}
+
+// DeviceEncoder writes devices one by one
+type DeviceEncoder interface {
+	Encode(d *Device) error
+	// Flush writes the buffered devices
+	Flush() error
+}
+
+// NewDeviceEncoder returns the encoder of format writing to w
+func NewDeviceEncoder(format string, w io.Writer) (DeviceEncoder, error) {
+	switch format {
+	case FormatCSV:
+		return &csvEncoder{w: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		bw := bufio.NewWriter(w)
+		return &ndjsonEncoder{w: bw, enc: json.NewEncoder(bw)}, nil
+	}
+	return nil, fmt.Errorf("format not support: %q", format)
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.w.Write(csvHeader)
+}
+
+func (e *csvEncoder) Encode(d *Device) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	return e.w.Write([]string{
+		d.Id,
+		d.Model,
+		d.Color,
+		d.Version,
+		strconv.FormatInt(d.CreateTime, 10),
+		strconv.FormatInt(d.UpdateTime, 10),
+	})
+}
+
+func (e *csvEncoder) Flush() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(d *Device) error {
+	return e.enc.Encode(d)
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+// ImportRow is one device read by a DeviceDecoder, or the error that made it
+// unreadable
+type ImportRow struct {
+	// Row of the device in the input, from 1. The header of a CSV is row 1.
+	Row    int
+	Device *Device
+	Err    error
+}
+
+// DeviceDecoder reads devices one by one
+type DeviceDecoder interface {
+	// Next returns the next row, or io.EOF after the last one. Any other
+	// error makes the whole input unreadable.
+	Next() (*ImportRow, error)
+}
+
+// NewDeviceDecoder returns the decoder of format reading r
+func NewDeviceDecoder(format string, r io.Reader) (DeviceDecoder, error) {
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+		return &csvDecoder{r: cr}, nil
+	case FormatNDJSON:
+		return &ndjsonDecoder{r: bufio.NewReader(r)}, nil
+	}
+	return nil, fmt.Errorf("format not support: %q", format)
+}
+
+type csvDecoder struct {
+	r       *csv.Reader
+	columns map[string]int
+	row     int
+}
+
+func (d *csvDecoder) readHeader() error {
+	header, err := d.r.Read()
+	if err == io.EOF {
+		return fmt.Errorf("csv header missing")
+	}
+	if err != nil {
+		return err
+	}
+
+	d.columns = make(map[string]int)
+	for i, name := range header {
+		// spreadsheets may start the file with a byte order mark
+		name = strings.TrimPrefix(name, "\ufeff")
+		d.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"model", "color", "version"} {
+		if _, ok := d.columns[name]; !ok {
+			return fmt.Errorf("csv column %q missing", name)
+		}
+	}
+	return nil
+}
+
+func (d *csvDecoder) Next() (*ImportRow, error) {
+	if d.columns == nil {
+		if err := d.readHeader(); err != nil {
+			return nil, err
+		}
+		d.row = 1
+	}
+
+	record, err := d.r.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	d.row++
+	row := &ImportRow{Row: d.row}
+	if err != nil {
+		if _, ok := err.(*csv.ParseError); !ok {
+			return nil, err
+		}
+		row.Err = err
+		return row, nil
+	}
+
+	field := func(name string) string {
+		if i, ok := d.columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	row.Device = &Device{
+		Id:      field("id"),
+		Model:   field("model"),
+		Color:   field("color"),
+		Version: field("version"),
+	}
+	return row, nil
+}
+
+type ndjsonDecoder struct {
+	r    *bufio.Reader
+	line int
+}
+
+func (d *ndjsonDecoder) Next() (*ImportRow, error) {
+	for {
+		b, err := d.r.ReadBytes('\n')
+		if len(b) == 0 && err != nil {
+			return nil, err
+		}
+		d.line++
+
+		b = bytes.TrimSpace(b)
+		if len(b) == 0 {
+			continue
+		}
+
+		row := &ImportRow{Row: d.line}
+		device := &Device{}
+		if err := json.Unmarshal(b, device); err != nil {
+			row.Err = err
+			return row, nil
+		}
+		device.Id = strings.TrimSpace(device.Id)
+		row.Device = device
+		return row, nil
+	}
+}
@@ -0,0 +1,399 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github/demo/model"
+	"github/demo/model/command"
+	"github/demo/model/device"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+)
+
+// CommandPolicy bounds the commands queued for the devices
+type CommandPolicy struct {
+	// DefaultTTL is how long a command queued without a TTL lives
+	DefaultTTL time.Duration
+	// MaxTTL is the longest TTL a command is queued with
+	MaxTTL time.Duration
+	// PollTimeout is the longest a device waits for its next command
+	PollTimeout time.Duration
+	// Retention is how long a command is kept once it succeeded, failed or
+	// expired
+	Retention time.Duration
+}
+
+// DefaultCommandPolicy is the policy of a command service given none
+var DefaultCommandPolicy = CommandPolicy{
+	DefaultTTL:  time.Hour,
+	MaxTTL:      24 * time.Hour,
+	PollTimeout: 20 * time.Second,
+	Retention:   30 * 24 * time.Hour,
+}
+
+const (
+	// maximum size of the payload and of the result of a command
+	maxCommandPayload = 64 << 10
+	// number of commands of a page without number
+	commandNumber = 50
+	// how often a waiting device checks its queue, for the commands queued
+	// by another instance of the service
+	commandRecheck = time.Second
+)
+
+// CommandRequest queues command Name with the arguments of Payload, a JSON
+// object. It expires after TTL, the default TTL of the policy when 0.
+type CommandRequest struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload"`
+	TTL     time.Duration   `json:"ttl"`
+}
+
+// CommandReport is the status a device reports a command in, with what it
+// has to say about it
+type CommandReport struct {
+	Status string `json:"status"`
+	Result string `json:"result"`
+}
+
+type Command struct {
+	Id         string          `json:"id"`
+	DeviceId   string          `json:"device_id"`
+	Name       string          `json:"name"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Status     string          `json:"status"`
+	Result     string          `json:"result"`
+	CreateTime int64           `json:"create_time"`
+	UpdateTime int64           `json:"update_time"`
+	ExpireTime int64           `json:"expire_time"`
+}
+
+func (c *Command) Assemble(r *command.Command) {
+	c.Id = r.Id.String()
+	c.DeviceId = r.DeviceId.String()
+	c.Name = r.Name
+	c.Payload = nil
+	if len(r.Payload) > 0 {
+		c.Payload = json.RawMessage(r.Payload)
+	}
+	c.Status = r.Status
+	c.Result = r.Result
+	c.CreateTime = r.CreateTime
+	c.UpdateTime = r.UpdateTime
+	c.ExpireTime = r.ExpireTime
+}
+
+type commandService struct {
+	commandRepo command.Repository
+	deviceRepo  device.Repository
+	policy      *CommandPolicy
+
+	// waiting holds the waiters per device that waits for a command, closed
+	// and removed when a command is queued for it or the last one leaves
+	mu      sync.Mutex
+	waiting map[device.UUID]*waiter
+}
+
+// waiter is the channel the polls of a device wait on, and how many do
+type waiter struct {
+	ch chan struct{}
+	n  int
+}
+
+// Enqueue queues a command for device id
+func (s *commandService) Enqueue(ctx context.Context, id string, r *CommandRequest) (*Command, ErrorCode) {
+	ctx, span := trace.Start(ctx, "commandService.Enqueue")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	if r == nil {
+		return nil, ErrorCodeCommandInvalid
+	}
+	if err := command.ValidateName(r.Name); err != nil {
+		log.WithContext(ctx).Warnf("device %s command => %v", id, err)
+		return nil, ErrorCodeCommandInvalid
+	}
+	payload, ok := commandPayload(r.Payload)
+	if !ok {
+		return nil, ErrorCodeCommandInvalid
+	}
+	ttl := r.TTL
+	if ttl == 0 {
+		ttl = s.policy.DefaultTTL
+	}
+	if ttl < 0 || ttl > s.policy.MaxTTL {
+		return nil, ErrorCodeCommandInvalid
+	}
+	if code := s.exists(ctx, id); code != ErrorCodeSuccess {
+		return nil, code
+	}
+
+	now := time.Now()
+	c := &command.Command{
+		Id:         device.UUID(uuid.Must(uuid.NewV4()).String()),
+		DeviceId:   device.UUID(id),
+		Name:       r.Name,
+		Payload:    payload,
+		Status:     command.StatusPending,
+		CreateTime: millis(now),
+		UpdateTime: millis(now),
+		ExpireTime: millis(now.Add(ttl)),
+	}
+	if _, err := s.commandRepo.Create(ctx, c); err != nil {
+		return nil, contextErrorCode(err, ErrorCodeCommandDBCreateFail)
+	}
+	s.notify(c.DeviceId)
+
+	re := &Command{}
+	re.Assemble(c)
+	return re, ErrorCodeSuccess
+}
+
+// Next returns the oldest pending command of device id. Without one it waits
+// up to wait, capped at the poll timeout of the policy, for one to be queued,
+// and returns ErrorCodeSuccessButNotFound when none is. A command stays
+// pending, and is returned again, until the device reports it.
+func (s *commandService) Next(ctx context.Context, id string, wait time.Duration) (*Command, ErrorCode) {
+	ctx, span := trace.Start(ctx, "commandService.Next")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	if wait > s.policy.PollTimeout {
+		wait = s.policy.PollTimeout
+	}
+	if code := s.exists(ctx, id); code != ErrorCodeSuccess {
+		return nil, code
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		// the channel is taken before the queue is read, a command queued in
+		// between closes it
+		queued, leave := s.wait(device.UUID(id))
+		c, err := s.commandRepo.Next(ctx, device.UUID(id), millis(time.Now()))
+		if err != nil {
+			leave()
+			return nil, contextErrorCode(err, ErrorCodeCommandDBFindFail)
+		}
+		if c != nil {
+			leave()
+			re := &Command{}
+			re.Assemble(c)
+			return re, ErrorCodeSuccess
+		}
+
+		left := time.Until(deadline)
+		if left <= 0 {
+			leave()
+			return nil, ErrorCodeSuccessButNotFound
+		}
+		if left > commandRecheck {
+			left = commandRecheck
+		}
+		timer := time.NewTimer(left)
+		select {
+		case <-queued:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			leave()
+			return nil, contextErrorCode(ctx.Err(), ErrorCodeCommandDBFindFail)
+		}
+		timer.Stop()
+		leave()
+	}
+}
+
+// Report moves command commandId of device id to the status of r. A command
+// is delivered from pending, and succeeded or failed from pending or
+// delivered, until it expires.
+func (s *commandService) Report(ctx context.Context, id, commandId string, r *CommandReport) (*Command, ErrorCode) {
+	ctx, span := trace.Start(ctx, "commandService.Report")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil || uuid.FromStringOrNil(commandId) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	if r == nil || len(r.Result) > maxCommandPayload {
+		return nil, ErrorCodeCommandInvalid
+	}
+	switch r.Status {
+	case command.StatusDelivered, command.StatusSucceeded, command.StatusFailed:
+	default:
+		return nil, ErrorCodeCommandInvalid
+	}
+
+	c, err := s.commandRepo.Get(ctx, device.UUID(commandId))
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrorCodeNotFound
+		}
+		return nil, contextErrorCode(err, ErrorCodeCommandDBFindFail)
+	}
+	if c.DeviceId != device.UUID(id) {
+		return nil, ErrorCodeNotFound
+	}
+
+	now := millis(time.Now())
+	affect, err := s.commandRepo.SetStatus(ctx, c.Id, command.From[r.Status], r.Status, r.Result, now)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeCommandDBUpdateFail)
+	}
+	if affect == 0 {
+		return nil, ErrorCodeCommandStatusInvalid
+	}
+	c.Status = r.Status
+	c.Result = r.Result
+	c.UpdateTime = now
+
+	re := &Command{}
+	re.Assemble(c)
+	return re, ErrorCodeSuccess
+}
+
+// History returns the commands of device id, in status unless it is empty,
+// newest first
+func (s *commandService) History(ctx context.Context, id, status string, page *Page) ([]*Command, ErrorCode) {
+	ctx, span := trace.Start(ctx, "commandService.History")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	if len(status) > 0 && !command.IsStatus(status) {
+		return nil, ErrorCodeCommandInvalid
+	}
+	if page == nil {
+		return nil, ErrorCodeBadRequest
+	}
+	if page.Page == 0 {
+		page.Page = 1
+	}
+	if page.Number == 0 {
+		page.Number = commandNumber
+	}
+
+	rows, err := s.commandRepo.Find(ctx, device.UUID(id), status, &model.Page{
+		Limit:  page.Number,
+		Offset: page.Number * (page.Page - 1),
+	})
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeCommandDBFindFail)
+	}
+
+	commands := make([]*Command, 0, len(rows))
+	for _, v := range rows {
+		c := &Command{}
+		c.Assemble(v)
+		commands = append(commands, c)
+	}
+	return commands, ErrorCodeSuccess
+}
+
+// Cleanup expires the commands past their TTL, deletes the commands past
+// the retention of the policy, and returns how many were expired and deleted
+func (s *commandService) Cleanup(ctx context.Context) (int64, int64, ErrorCode) {
+	ctx, span := trace.Start(ctx, "commandService.Cleanup")
+	defer span.Finish()
+
+	now := time.Now()
+	expired, err := s.commandRepo.Expire(ctx, millis(now))
+	if err != nil {
+		return 0, 0, contextErrorCode(err, ErrorCodeCommandDBUpdateFail)
+	}
+	deleted, err := s.commandRepo.Purge(ctx, millis(now.Add(-s.policy.Retention)))
+	if err != nil {
+		return expired, 0, contextErrorCode(err, ErrorCodeCommandDBDeleteFail)
+	}
+	return expired, deleted, ErrorCodeSuccess
+}
+
+// exists returns ErrorCodeNotFound when there is no device id
+func (s *commandService) exists(ctx context.Context, id string) ErrorCode {
+	if _, err := s.deviceRepo.Get(ctx, device.UUID(id)); err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return ErrorCodeNotFound
+		}
+		return contextErrorCode(err, ErrorCodeDeviceDBFindFail)
+	}
+	return ErrorCodeSuccess
+}
+
+// wait returns the channel closed when a command is next queued for device
+// id, and the func to call once done waiting on it
+func (s *commandService) wait(id device.UUID) (<-chan struct{}, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.waiting[id]
+	if !ok {
+		w = &waiter{ch: make(chan struct{})}
+		s.waiting[id] = w
+	}
+	w.n++
+	return w.ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// a notified waiter is already removed, another may have taken its
+		// place
+		w.n--
+		if w.n == 0 && s.waiting[id] == w {
+			delete(s.waiting, id)
+		}
+	}
+}
+
+// notify wakes up the requests waiting for a command of device id
+func (s *commandService) notify(id device.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if w, ok := s.waiting[id]; ok {
+		close(w.ch)
+		delete(s.waiting, id)
+	}
+}
+
+// commandPayload returns the payload stored for p, empty for none, and
+// false when p isn't a JSON object
+func commandPayload(p json.RawMessage) (string, bool) {
+	if len(p) == 0 {
+		return "", true
+	}
+	if len(p) > maxCommandPayload {
+		return "", false
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(p, &m); err != nil {
+		return "", false
+	}
+	if m == nil {
+		return "", true
+	}
+	return string(p), true
+}
+
+// NewCommandService returns the command service, a nil p queues the commands
+// under DefaultCommandPolicy
+func NewCommandService(cr command.Repository, dr device.Repository, p *CommandPolicy) ICommandService {
+	if p == nil {
+		p = &DefaultCommandPolicy
+	}
+	return &commandService{
+		commandRepo: cr,
+		deviceRepo:  dr,
+		policy:      p,
+		waiting:     make(map[device.UUID]*waiter),
+	}
+}
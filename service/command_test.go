@@ -0,0 +1,347 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/daos"
+	"github/demo/model/command"
+	"github/demo/model/device"
+	"github/demo/service"
+)
+
+// newCommandService returns a command service with a poll timeout of a
+// second, and a registered device
+func newCommandService(t *testing.T) (service.ICommandService, command.Repository, string) {
+	dr := daos.NewMemoryDeviceRepo()
+	created, code := service.NewDeviceService(dr, daos.NewMemoryHistoryRepo(), nil, nil).
+		Register(context.Background(), &service.Device{Model: "Pro", Color: "White", Version: "v1.2"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	cr := daos.NewMemoryCommandRepo()
+	s := service.NewCommandService(cr, dr, &service.CommandPolicy{
+		DefaultTTL:  time.Hour,
+		MaxTTL:      2 * time.Hour,
+		PollTimeout: time.Second,
+		Retention:   time.Hour,
+	})
+	return s, cr, created.Id
+}
+
+func TestCommandService_Enqueue(t *testing.T) {
+	s, _, id := newCommandService(t)
+	ctx := context.Background()
+
+	tt := []struct {
+		description  string
+		id           string
+		request      *service.CommandRequest
+		expectedCode service.ErrorCode
+		expectedTTL  time.Duration
+	}{
+		{
+			description:  "input invalid uuid",
+			id:           "1234",
+			request:      &service.CommandRequest{Name: "reboot"},
+			expectedCode: service.ErrorCodeParseUUIDFail,
+		},
+		{
+			description:  "name invalid",
+			id:           id,
+			request:      &service.CommandRequest{Name: "re boot"},
+			expectedCode: service.ErrorCodeCommandInvalid,
+		},
+		{
+			description:  "payload not an object",
+			id:           id,
+			request:      &service.CommandRequest{Name: "config", Payload: json.RawMessage(`[1, 2]`)},
+			expectedCode: service.ErrorCodeCommandInvalid,
+		},
+		{
+			description:  "ttl over the maximum",
+			id:           id,
+			request:      &service.CommandRequest{Name: "reboot", TTL: 3 * time.Hour},
+			expectedCode: service.ErrorCodeCommandInvalid,
+		},
+		{
+			description:  "not found",
+			id:           "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60",
+			request:      &service.CommandRequest{Name: "reboot"},
+			expectedCode: service.ErrorCodeNotFound,
+		},
+		{
+			description:  "default ttl",
+			id:           id,
+			request:      &service.CommandRequest{Name: "reboot"},
+			expectedCode: service.ErrorCodeSuccess,
+			expectedTTL:  time.Hour,
+		},
+		{
+			description:  "payload and ttl",
+			id:           id,
+			request:      &service.CommandRequest{Name: "config", Payload: json.RawMessage(`{"interval":60}`), TTL: time.Minute},
+			expectedCode: service.ErrorCodeSuccess,
+			expectedTTL:  time.Minute,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			c, code := s.Enqueue(ctx, tc.id, tc.request)
+			assert.Equal(t, tc.expectedCode, code)
+			if tc.expectedCode != service.ErrorCodeSuccess {
+				assert.Nil(t, c)
+				return
+			}
+			assert.NotEmpty(t, c.Id)
+			assert.Equal(t, tc.id, c.DeviceId)
+			assert.Equal(t, tc.request.Name, c.Name)
+			assert.Equal(t, tc.request.Payload, c.Payload)
+			assert.Equal(t, command.StatusPending, c.Status)
+			assert.Equal(t, int64(tc.expectedTTL/time.Millisecond), c.ExpireTime-c.CreateTime)
+		})
+	}
+}
+
+func TestCommandService_Next(t *testing.T) {
+	s, _, id := newCommandService(t)
+	ctx := context.Background()
+
+	_, code := s.Next(ctx, "1234", 0)
+	assert.Equal(t, service.ErrorCodeParseUUIDFail, code)
+	_, code = s.Next(ctx, "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60", 0)
+	assert.Equal(t, service.ErrorCodeNotFound, code)
+
+	// no command, the poll returns at once
+	c, code := s.Next(ctx, id, 0)
+	assert.Equal(t, service.ErrorCodeSuccessButNotFound, code)
+	assert.Nil(t, c)
+
+	// a command queued while waiting is returned before the timeout
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		s.Enqueue(ctx, id, &service.CommandRequest{Name: "reboot"})
+	}()
+	start := time.Now()
+	first, code := s.Next(ctx, id, time.Minute)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	if assert.NotNil(t, first) {
+		assert.Equal(t, "reboot", first.Name)
+	}
+	assert.True(t, time.Since(start) < time.Second, "%v", time.Since(start))
+
+	// a pending command is returned again until it is reported, the commands
+	// are a millisecond apart
+	time.Sleep(2 * time.Millisecond)
+	_, code = s.Enqueue(ctx, id, &service.CommandRequest{Name: "config"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	c, code = s.Next(ctx, id, 0)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, first.Id, c.Id)
+
+	_, code = s.Report(ctx, id, first.Id, &service.CommandReport{Status: command.StatusDelivered})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	c, code = s.Next(ctx, id, 0)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, "config", c.Name)
+
+	// the wait is capped at the poll timeout
+	_, code = s.Report(ctx, id, c.Id, &service.CommandReport{Status: command.StatusDelivered})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	start = time.Now()
+	_, code = s.Next(ctx, id, time.Minute)
+	assert.Equal(t, service.ErrorCodeSuccessButNotFound, code)
+	assert.True(t, time.Since(start) < 2*time.Second, "%v", time.Since(start))
+
+	// a cancelled poll returns at once
+	cctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, code = s.Next(cctx, id, time.Second)
+	assert.Equal(t, service.ErrorCodeDeadlineExceeded, code)
+}
+
+func TestCommandService_Report(t *testing.T) {
+	s, _, id := newCommandService(t)
+	ctx := context.Background()
+
+	queued, code := s.Enqueue(ctx, id, &service.CommandRequest{Name: "reboot"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	expiring, code := s.Enqueue(ctx, id, &service.CommandRequest{Name: "reboot", TTL: time.Millisecond})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	time.Sleep(2 * time.Millisecond)
+
+	tt := []struct {
+		description    string
+		id             string
+		commandId      string
+		report         *service.CommandReport
+		expectedCode   service.ErrorCode
+		expectedStatus string
+	}{
+		{
+			description:  "input invalid uuid",
+			id:           id,
+			commandId:    "1234",
+			report:       &service.CommandReport{Status: command.StatusDelivered},
+			expectedCode: service.ErrorCodeParseUUIDFail,
+		},
+		{
+			description:  "status not reported by a device",
+			id:           id,
+			commandId:    queued.Id,
+			report:       &service.CommandReport{Status: command.StatusExpired},
+			expectedCode: service.ErrorCodeCommandInvalid,
+		},
+		{
+			description:  "command of another device",
+			id:           "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60",
+			commandId:    queued.Id,
+			report:       &service.CommandReport{Status: command.StatusDelivered},
+			expectedCode: service.ErrorCodeNotFound,
+		},
+		{
+			description:  "not found",
+			id:           id,
+			commandId:    "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60",
+			report:       &service.CommandReport{Status: command.StatusDelivered},
+			expectedCode: service.ErrorCodeNotFound,
+		},
+		{
+			description:    "delivered",
+			id:             id,
+			commandId:      queued.Id,
+			report:         &service.CommandReport{Status: command.StatusDelivered},
+			expectedCode:   service.ErrorCodeSuccess,
+			expectedStatus: command.StatusDelivered,
+		},
+		{
+			description:  "delivered again",
+			id:           id,
+			commandId:    queued.Id,
+			report:       &service.CommandReport{Status: command.StatusDelivered},
+			expectedCode: service.ErrorCodeCommandStatusInvalid,
+		},
+		{
+			description:    "failed",
+			id:             id,
+			commandId:      queued.Id,
+			report:         &service.CommandReport{Status: command.StatusFailed, Result: "disk full"},
+			expectedCode:   service.ErrorCodeSuccess,
+			expectedStatus: command.StatusFailed,
+		},
+		{
+			description:  "succeeded once failed",
+			id:           id,
+			commandId:    queued.Id,
+			report:       &service.CommandReport{Status: command.StatusSucceeded},
+			expectedCode: service.ErrorCodeCommandStatusInvalid,
+		},
+		{
+			description:  "expired before the cleanup",
+			id:           id,
+			commandId:    expiring.Id,
+			report:       &service.CommandReport{Status: command.StatusSucceeded},
+			expectedCode: service.ErrorCodeCommandStatusInvalid,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			c, code := s.Report(ctx, tc.id, tc.commandId, tc.report)
+			assert.Equal(t, tc.expectedCode, code)
+			if tc.expectedCode != service.ErrorCodeSuccess {
+				return
+			}
+			assert.Equal(t, tc.expectedStatus, c.Status)
+			assert.Equal(t, tc.report.Result, c.Result)
+		})
+	}
+}
+
+func TestCommandService_History(t *testing.T) {
+	s, _, id := newCommandService(t)
+	ctx := context.Background()
+
+	var ids []string
+	for _, name := range []string{"reboot", "config", "reset"} {
+		c, code := s.Enqueue(ctx, id, &service.CommandRequest{Name: name})
+		assert.Equal(t, service.ErrorCodeSuccess, code)
+		ids = append(ids, c.Id)
+		// the commands are a millisecond apart
+		time.Sleep(2 * time.Millisecond)
+	}
+	_, code := s.Report(ctx, id, ids[1], &service.CommandReport{Status: command.StatusSucceeded})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	tt := []struct {
+		description  string
+		status       string
+		page         *service.Page
+		expectedCode service.ErrorCode
+		expected     []string
+	}{
+		{description: "newest first", page: &service.Page{}, expectedCode: service.ErrorCodeSuccess, expected: []string{ids[2], ids[1], ids[0]}},
+		{description: "page", page: &service.Page{Page: 2, Number: 2}, expectedCode: service.ErrorCodeSuccess, expected: []string{ids[0]}},
+		{description: "status", status: command.StatusPending, page: &service.Page{}, expectedCode: service.ErrorCodeSuccess, expected: []string{ids[2], ids[0]}},
+		{description: "status invalid", status: "done", page: &service.Page{}, expectedCode: service.ErrorCodeCommandInvalid},
+		{description: "no page", expectedCode: service.ErrorCodeBadRequest},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			commands, code := s.History(ctx, id, tc.status, tc.page)
+			assert.Equal(t, tc.expectedCode, code)
+			if tc.expectedCode != service.ErrorCodeSuccess {
+				return
+			}
+			got := []string{}
+			for _, c := range commands {
+				got = append(got, c.Id)
+			}
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestCommandService_Cleanup(t *testing.T) {
+	s, cr, id := newCommandService(t)
+	ctx := context.Background()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	hour := int64(time.Hour / time.Millisecond)
+	for _, c := range []*command.Command{
+		// past its ttl
+		{Id: "6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0001", Status: command.StatusDelivered, UpdateTime: now - hour, ExpireTime: now - 1},
+		// past the retention
+		{Id: "6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0002", Status: command.StatusSucceeded, UpdateTime: now - 2*hour, ExpireTime: now + hour},
+		// kept
+		{Id: "6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0003", Status: command.StatusFailed, UpdateTime: now - 1, ExpireTime: now + hour},
+		{Id: "6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0004", Status: command.StatusPending, UpdateTime: now - 2*hour, ExpireTime: now + hour},
+	} {
+		c.DeviceId = device.UUID(id)
+		c.Name = "reboot"
+		_, err := cr.Create(ctx, c)
+		assert.NoError(t, err)
+	}
+
+	expired, deleted, code := s.Cleanup(ctx)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, int64(1), expired)
+	assert.Equal(t, int64(1), deleted)
+
+	commands, code := s.History(ctx, id, "", &service.Page{})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	status := map[string]string{}
+	for _, c := range commands {
+		status[c.Id] = c.Status
+	}
+	assert.Equal(t, map[string]string{
+		"6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0001": command.StatusExpired,
+		"6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0003": command.StatusFailed,
+		"6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0004": command.StatusPending,
+	}, status)
+}
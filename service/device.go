@@ -1,13 +1,17 @@
 package service
 
 import (
+	"context"
 	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
 
 	"github/demo/model"
+	"github/demo/model/catalog"
 	"github/demo/model/device"
 	"github/demo/utils/log"
+	"github/demo/utils/trace"
 )
 
 type Device struct {
@@ -15,8 +19,48 @@ type Device struct {
 	Model      string `json:"model"`
 	Color      string `json:"color"`
 	Version    string `json:"version"`
+	State      string `json:"state"`
 	CreateTime int64  `json:"create_time"`
 	UpdateTime int64  `json:"update_time"`
+	// LastSeen is the time of the last heartbeat and Firmware the firmware it
+	// reported, a device never seen has neither
+	LastSeen int64  `json:"last_seen,omitempty"`
+	Firmware string `json:"firmware,omitempty"`
+	// Status is online, stale or offline by the time since LastSeen, see
+	// Liveness. It narrows a filter down to the devices in that status.
+	Status string `json:"status,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+	// Selector is a label selector narrowing a filter, see
+	// device.ParseSelector
+	Selector string `json:"-"`
+	// Groups narrows a filter down to the members of any of these groups
+	Groups []string `json:"-"`
+}
+
+// repoFilter returns d as a repository filter, with its selector parsed and
+// its status as of now
+func (d *Device) repoFilter(l *Liveness, now time.Time) (*device.Device, ErrorCode) {
+	s, err := device.ParseSelector(d.Selector)
+	if err != nil {
+		return nil, ErrorCodeSelectorInvalid
+	}
+	f := d.repoType()
+	f.Selector = s
+	if len(d.Status) > 0 {
+		seen, ok := l.seen(d.Status, now)
+		if !ok {
+			return nil, ErrorCodeStatusInvalid
+		}
+		f.Seen = seen
+	}
+	if d.Groups != nil {
+		f.Membership = &device.Membership{GroupIds: []device.UUID{}}
+		for _, id := range d.Groups {
+			f.Membership.GroupIds = append(f.Membership.GroupIds, device.UUID(id))
+		}
+	}
+	return f, ErrorCodeSuccess
 }
 
 func (d *Device) repoType() *device.Device {
@@ -25,6 +69,7 @@ func (d *Device) repoType() *device.Device {
 		Model:   d.Model,
 		Color:   d.Color,
 		Version: d.Version,
+		State:   d.State,
 	}
 }
 
@@ -33,15 +78,32 @@ func (d *Device) Assemble(r *device.Device) {
 	d.Model = r.Model
 	d.Color = r.Color
 	d.Version = r.Version
+	d.State = r.State
 	d.CreateTime = r.CreateTime
 	d.UpdateTime = r.UpdateTime
+	d.LastSeen = r.LastSeen
+	d.Firmware = r.Firmware
+}
+
+type DeviceCount struct {
+	Model   string `json:"model"`
+	Version string `json:"version"`
+	Total   int64  `json:"total"`
 }
 
 type deviceService struct {
-	deviceRepo device.Repository
+	deviceRepo  device.Repository
+	historyRepo device.HistoryRepository
+	// catalogRepo holds the models the devices must match, none are checked
+	// without it
+	catalogRepo catalog.Repository
+	liveness    *Liveness
 }
 
-func (s *deviceService) Find(d *Device, page *Page) ([]*Device, ErrorCode) {
+func (s *deviceService) Find(ctx context.Context, d *Device, page *Page) ([]*Device, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.Find")
+	defer span.Finish()
+
 	if d == nil {
 		return nil, ErrorCodeBadRequest
 	}
@@ -52,26 +114,100 @@ func (s *deviceService) Find(d *Device, page *Page) ([]*Device, ErrorCode) {
 		p.Offset = page.Number * (page.Page - 1)
 	}
 
-	rows, err := s.deviceRepo.Find(d.repoType(), p)
+	now := time.Now()
+	f, code := d.repoFilter(s.liveness, now)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+
+	rows, err := s.deviceRepo.Find(ctx, f, p)
 	if err != nil {
-		return nil, ErrorCodeDeviceDBFindFail
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBFindFail)
 	}
 
 	if len(rows) == 0 {
 		return nil, ErrorCodeSuccessButNotFound
 	}
 
+	ids := make([]device.UUID, 0, len(rows))
+	for _, v := range rows {
+		ids = append(ids, v.Id)
+	}
+	labels, err := s.deviceRepo.Labels(ctx, ids...)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBFindFail)
+	}
+
 	devices := []*Device{}
 	for _, v := range rows {
 		srv := &Device{}
 		srv.Assemble(v)
+		srv.Status = s.liveness.Status(v.LastSeen, now)
+		srv.Labels = labels[v.Id]
 		devices = append(devices, srv)
 	}
 
 	return devices, ErrorCodeSuccess
 }
 
-func (s *deviceService) Register(d *Device) (*Device, ErrorCode) {
+// yieldError carries an error of the func given to Iterate through the
+// repository, apart from its own errors
+type yieldError struct {
+	err error
+}
+
+func (e *yieldError) Error() string { return e.err.Error() }
+
+// Iterate calls fn with the devices matching the non-zero fields of d one at
+// a time, without holding them all in memory, and without their labels. A nil
+// page or a zero page.Number iterates all of them. An error of fn stops the
+// iteration with ErrorCodeServerErr.
+func (s *deviceService) Iterate(ctx context.Context, d *Device, page *Page, fn func(*Device) error) ErrorCode {
+	ctx, span := trace.Start(ctx, "deviceService.Iterate")
+	defer span.Finish()
+
+	if d == nil || fn == nil {
+		return ErrorCodeBadRequest
+	}
+
+	var p *model.Page
+	if page != nil && page.Number > 0 && page.Page > 0 {
+		p = &model.Page{
+			Limit:  page.Number,
+			Offset: page.Number * (page.Page - 1),
+		}
+	}
+
+	now := time.Now()
+	f, code := d.repoFilter(s.liveness, now)
+	if code != ErrorCodeSuccess {
+		return code
+	}
+
+	err := s.deviceRepo.Iterate(ctx, f, p, func(v *device.Device) error {
+		srv := &Device{}
+		srv.Assemble(v)
+		srv.Status = s.liveness.Status(v.LastSeen, now)
+		if err := fn(srv); err != nil {
+			return &yieldError{err: err}
+		}
+		return nil
+	})
+	if e, ok := err.(*yieldError); ok {
+		span.SetError(e.err)
+		log.WithContext(ctx).Errorf("device iterate fail => %+v", e.err)
+		return ErrorCodeServerErr
+	}
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeDeviceDBFindFail)
+	}
+	return ErrorCodeSuccess
+}
+
+func (s *deviceService) Register(ctx context.Context, d *Device) (*Device, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.Register")
+	defer span.Finish()
+
 	if d == nil {
 		return nil, ErrorCodeBadRequest
 	}
@@ -80,50 +216,156 @@ func (s *deviceService) Register(d *Device) (*Device, ErrorCode) {
 	d.CreateTime = now
 	d.UpdateTime = now
 	d.Id = uuid.Must(uuid.NewV4()).String()
-	x, err := s.deviceRepo.Create(d.repoType())
+	d.State = device.StateProvisioned
+	x, err := s.create(ctx, d)
 	if err != nil {
-		return nil, ErrorCodeDeviceDBCreateFail
+		return nil, catalogErrorCode(err, ErrorCodeDeviceDBCreateFail)
 	}
 
 	re := &Device{}
 	re.Assemble(x)
+	re.Status = s.liveness.Status(x.LastSeen, time.Now())
 	return re, ErrorCodeSuccess
 }
 
-func (s *deviceService) Update(d *Device) (int64, ErrorCode) {
+func (s *deviceService) Update(ctx context.Context, d *Device) (int64, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.Update")
+	defer span.Finish()
+
 	iformat := uuid.FromStringOrNil(d.Id)
 	if iformat == uuid.Nil {
 		return 0, ErrorCodeParseUUIDFail
 	}
 
-	_, a, err := s.deviceRepo.Update(d.repoType())
+	// the lifecycle only moves by its transitions
+	if len(d.State) > 0 {
+		return 0, ErrorCodeStateNotUpdatable
+	}
+
+	a, err := s.update(ctx, d)
 	if err != nil {
-		return 0, ErrorCodeDeviceDBUpdateFail
+		return 0, catalogErrorCode(err, ErrorCodeDeviceDBUpdateFail)
 	}
 
 	return a, ErrorCodeSuccess
 }
 
-func (s *deviceService) Delete(i string) ErrorCode {
+func (s *deviceService) Delete(ctx context.Context, i string) ErrorCode {
+	ctx, span := trace.Start(ctx, "deviceService.Delete")
+	defer span.Finish()
+
 	iformat := uuid.FromStringOrNil(i)
 	if iformat == uuid.Nil {
 		return ErrorCodeParseUUIDFail
 	}
 
-	affect, err := s.deviceRepo.Delete(device.UUID(i))
+	before, err := s.deviceRepo.Get(ctx, device.UUID(i))
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return contextErrorCode(err, ErrorCodeDeviceDBDeleteFail)
+	}
+	labels, err := s.deviceRepo.Labels(ctx, device.UUID(i))
 	if err != nil {
-		return ErrorCodeDeviceDBDeleteFail
+		return contextErrorCode(err, ErrorCodeDeviceDBDeleteFail)
+	}
+
+	affect, err := s.deviceRepo.Delete(ctx, device.UUID(i))
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeDeviceDBDeleteFail)
 	}
 	if affect <= 0 {
-		log.Error("File does not exist: ", i)
+		log.WithContext(ctx).Error("File does not exist: ", i)
 		return ErrorCodeSuccessButNotFound
 	}
+	s.record(ctx, device.ActionDelete, device.UUID(i), diffLabels(diff(before, nil), labels[device.UUID(i)], nil))
+
+	// the labels go with the device, a failure leaves them unreachable
+	if _, err := s.deviceRepo.RemoveLabels(ctx, device.UUID(i)); err != nil {
+		log.WithContext(ctx).Errorf("device %s labels remove fail => %+v", i, err)
+	}
 
 	return ErrorCodeSuccess
 }
 
-func NewDeviceService(dr device.Repository) IDeviceService {
+// create stores d and records it in the history, d must match the catalog
+func (s *deviceService) create(ctx context.Context, d *Device) (*device.Device, error) {
+	if err := conform(ctx, s.catalogRepo, nil, d); err != nil {
+		return nil, err
+	}
+	x, err := s.deviceRepo.Create(ctx, d.repoType())
+	if err != nil {
+		return nil, err
+	}
+	s.record(ctx, device.ActionCreate, x.Id, diff(nil, x))
+	return x, nil
+}
+
+// update applies the non-zero fields of d to its device and records the
+// change in the history, the change must match the catalog
+func (s *deviceService) update(ctx context.Context, d *Device) (int64, error) {
+	before, err := s.deviceRepo.Get(ctx, device.UUID(d.Id))
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return 0, err
+	}
+	if before != nil {
+		if err := conform(ctx, s.catalogRepo, before, d); err != nil {
+			return 0, err
+		}
+	}
+
+	_, affect, err := s.deviceRepo.Update(ctx, d.repoType())
+	if err != nil {
+		return 0, err
+	}
+	if before == nil || affect <= 0 {
+		return affect, nil
+	}
+
+	after := *before
+	if len(d.Model) > 0 {
+		after.Model = d.Model
+	}
+	if len(d.Color) > 0 {
+		after.Color = d.Color
+	}
+	if len(d.Version) > 0 {
+		after.Version = d.Version
+	}
+	s.record(ctx, device.ActionUpdate, before.Id, diff(before, &after))
+	return affect, nil
+}
+
+func (s *deviceService) Count(ctx context.Context) ([]*DeviceCount, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.Count")
+	defer span.Finish()
+
+	rows, err := s.deviceRepo.Count(ctx)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBFindFail)
+	}
+
+	counts := []*DeviceCount{}
+	for _, v := range rows {
+		counts = append(counts, &DeviceCount{
+			Model:   v.Model,
+			Version: v.Version,
+			Total:   v.Total,
+		})
+	}
+
+	return counts, ErrorCodeSuccess
+}
+
+// NewDeviceService returns the device service over dr, recording the changes
+// of the devices in hr unless it is nil. The devices are classified by l, or
+// DefaultLiveness when it is nil.
+func NewDeviceService(dr device.Repository, hr device.HistoryRepository, cr catalog.Repository, l *Liveness) IDeviceService {
+	if l == nil {
+		l = &DefaultLiveness
+	}
 	return &deviceService{
-		deviceRepo: dr,
+		deviceRepo:  dr,
+		historyRepo: hr,
+		catalogRepo: cr,
+		liveness:    l,
 	}
 }
@@ -1,10 +1,13 @@
 package service_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/stretchr/testify/assert"
@@ -36,9 +39,11 @@ func setupDeviceTestCaseSuite(t *testing.T) (DeviceTestCaseSuite, func(t *testin
 		Host:    df.Name(),
 	}
 
-	s.db, err = database.NewDatabase(c)
+	s.db, err = database.NewDatabase(context.Background(), c)
+	s.db.GetDB().AutoMigrate(&device.History{}, &device.Label{})
 	deviceRepo := daos.NewDeviceRepo(s.db.GetDB())
-	s.device = service.NewDeviceService(deviceRepo)
+	historyRepo := daos.NewHistoryRepo(s.db.GetDB())
+	s.device = service.NewDeviceService(deviceRepo, historyRepo, nil, nil)
 
 	return s, func(t *testing.T) {
 		s.db.Close()
@@ -52,6 +57,8 @@ func GetDeviceFromService1() *service.Device {
 		Model:   "Pro",
 		Color:   "White",
 		Version: "v1.2",
+		// never seen
+		Status: service.StatusOffline,
 	}
 }
 
@@ -61,6 +68,8 @@ func GetDeviceFromService2() *service.Device {
 		Model:   "Normal",
 		Color:   "Black",
 		Version: "v1.2",
+		// never seen
+		Status: service.StatusOffline,
 	}
 }
 
@@ -127,7 +136,87 @@ func TestDeviceService_Find(t *testing.T) {
 			teardownSubTest := tc.setupTestCase(t)
 			defer teardownSubTest(t)
 
-			devices, code := s.device.Find(tc.filter, tc.page)
+			devices, code := s.device.Find(context.Background(), tc.filter, tc.page)
+			assert.Equal(t, tc.expectedCode, code)
+			assert.Equal(t, tc.expected, devices)
+		})
+	}
+}
+
+func TestDeviceService_Iterate(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	seed := func(t *testing.T) func(t *testing.T) {
+		s.db.GetDB().AutoMigrate(&device.Device{})
+		s.db.GetDB().Create(GetDevice1())
+		s.db.GetDB().Create(GetDevice2())
+
+		return func(t *testing.T) {
+			s.db.GetDB().DropTable(&device.Device{})
+		}
+	}
+
+	tt := []struct {
+		description   string
+		page          *service.Page
+		filter        *service.Device
+		yield         error
+		expectedCode  service.ErrorCode
+		expected      []*service.Device
+		setupTestCase test.SetupSubTest
+	}{
+		{
+			description:  "all",
+			filter:       &service.Device{},
+			expectedCode: service.ErrorCodeSuccess,
+			expected: []*service.Device{
+				GetDeviceFromService1(),
+				GetDeviceFromService2(),
+			},
+			setupTestCase: seed,
+		},
+		{
+			description:  "input page=2 number=1",
+			page:         &service.Page{Page: 2, Number: 1},
+			filter:       &service.Device{},
+			expectedCode: service.ErrorCodeSuccess,
+			expected: []*service.Device{
+				GetDeviceFromService2(),
+			},
+			setupTestCase: seed,
+		},
+		{
+			description:  "fn fail",
+			filter:       &service.Device{},
+			yield:        errors.New("write fail"),
+			expectedCode: service.ErrorCodeServerErr,
+			expected: []*service.Device{
+				GetDeviceFromService1(),
+			},
+			setupTestCase: seed,
+		},
+		{
+			description:  "database fail",
+			filter:       &service.Device{},
+			expectedCode: service.ErrorCodeDeviceDBFindFail,
+			setupTestCase: func(t *testing.T) func(t *testing.T) {
+				return func(t *testing.T) {
+				}
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			teardownSubTest := tc.setupTestCase(t)
+			defer teardownSubTest(t)
+
+			var devices []*service.Device
+			code := s.device.Iterate(context.Background(), tc.filter, tc.page, func(d *service.Device) error {
+				devices = append(devices, d)
+				return tc.yield
+			})
 			assert.Equal(t, tc.expectedCode, code)
 			assert.Equal(t, tc.expected, devices)
 		})
@@ -165,11 +254,12 @@ func TestDeviceService_Register(t *testing.T) {
 			teardownSubTest := tc.setupTestCase(t)
 			defer teardownSubTest(t)
 
-			device, code := s.device.Register(tc.inputData)
+			device, code := s.device.Register(context.Background(), tc.inputData)
 			assert.Equal(t, tc.expectedCode, code)
 
 			if tc.expected != nil {
 				tc.expected.Id = device.Id
+				tc.expected.State = "provisioned"
 				tc.expected.CreateTime = device.CreateTime
 				tc.expected.UpdateTime = device.UpdateTime
 			}
@@ -210,7 +300,7 @@ func TestDeviceService_Update(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			teardownSubTest := tc.setupTestCase(t)
 			defer teardownSubTest(t)
-			affect, code := s.device.Update(tc.inputData)
+			affect, code := s.device.Update(context.Background(), tc.inputData)
 
 			assert.Equal(t, tc.expectedCode, code)
 			assert.Equal(t, tc.expectedAffect, affect)
@@ -248,8 +338,53 @@ func TestDeviceService_Delete(t *testing.T) {
 			teardownSubTest := tc.setupTestCase(t)
 			defer teardownSubTest(t)
 
-			code := s.device.Delete(tc.inputId)
+			code := s.device.Delete(context.Background(), tc.inputId)
 			assert.Equal(t, tc.expectedCode, code)
 		})
 	}
 }
+
+func TestDeviceService_Context(t *testing.T) {
+	s, teardownTestCase := setupDeviceTestCaseSuite(t)
+	defer teardownTestCase(t)
+
+	s.db.GetDB().DropTable(&device.Device{})
+	s.db.GetDB().AutoMigrate(&device.Device{})
+
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tt := []struct {
+		name     string
+		ctx      context.Context
+		wantCode service.ErrorCode
+	}{
+		{
+			name:     "deadline exceeded",
+			ctx:      expired,
+			wantCode: service.ErrorCodeDeadlineExceeded,
+		},
+		{
+			name:     "canceled",
+			ctx:      canceled,
+			wantCode: service.ErrorCodeRequestCanceled,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, code := s.device.Find(tc.ctx, &service.Device{}, &service.Page{Number: 10, Page: 1})
+			assert.Equal(t, tc.wantCode, code)
+
+			_, code = s.device.Register(tc.ctx, GetDeviceFromService2())
+			assert.Equal(t, tc.wantCode, code)
+
+			code = s.device.Delete(tc.ctx, GetDeviceFromService1().Id)
+			assert.Equal(t, tc.wantCode, code)
+		})
+	}
+
+	assert.Equal(t, 504, service.ErrorStatusCode(service.ErrorCodeDeadlineExceeded))
+}
@@ -3,11 +3,18 @@ xeniro platform custom error code
 http status code + category + serial number
 xxx 00 xx General
 xxx 01 xx MdcSrv
+xxx 02 xx Group
+xxx 03 xx Model
+xxx 04 xx Telemetry
+xxx 05 xx Command
+xxx 06 xx Firmware
 */
 
 package service
 
 import (
+	"context"
+	stderrors "errors"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -28,6 +35,19 @@ const (
 const (
 	ErrorCodeBadRequest ErrorCode = iota + 4000000
 	ErrorCodeParseUUIDFail
+	ErrorCodeFormatNotSupport
+	ErrorCodeImportUnreadable
+	ErrorCodeSelectorInvalid
+	ErrorCodeLabelInvalid
+	ErrorCodeGroupParentInvalid
+	ErrorCodeDeviceNotInCatalog
+	ErrorCodeStatusInvalid
+	ErrorCodeTelemetryInvalid
+	ErrorCodeTelemetryQueryInvalid
+	ErrorCodeCommandInvalid
+	ErrorCodeReleaseInvalid
+	ErrorCodeCampaignInvalid
+	ErrorCodeStateNotUpdatable
 )
 
 // 401 00
@@ -46,6 +66,24 @@ const (
 	ErrorCodeNotFound ErrorCode = iota + 4040000
 )
 
+// 409 00
+const (
+	ErrorCodeGroupNotEmpty ErrorCode = iota + 4090000
+	ErrorCodeModelInUse
+	ErrorCodeModelExists
+	ErrorCodeStateTransitionInvalid
+	ErrorCodeShadowVersionConflict
+	ErrorCodeCommandStatusInvalid
+	ErrorCodeReleaseExists
+	ErrorCodeReleaseInUse
+	ErrorCodeCampaignStatusInvalid
+)
+
+// 499 00
+const (
+	ErrorCodeRequestCanceled ErrorCode = iota + 4990000
+)
+
 // 500 00
 const (
 	ErrorCodeServerErr ErrorCode = iota + 5000000
@@ -53,35 +91,142 @@ const (
 	ErrorCodeTokenCreateFail
 )
 
+// 504 00
+const (
+	ErrorCodeDeadlineExceeded ErrorCode = iota + 5040000
+)
+
 // 500 01
 const (
 	ErrorCodeDeviceDBFindFail ErrorCode = iota + 5000100
 	ErrorCodeDeviceDBUpdateFail
 	ErrorCodeDeviceDBCreateFail
 	ErrorCodeDeviceDBDeleteFail
+	ErrorCodeDeviceDBHistoryFail
+	ErrorCodeDeviceDBLabelFail
+)
+
+// 500 02
+const (
+	ErrorCodeGroupDBFindFail ErrorCode = iota + 5000200
+	ErrorCodeGroupDBUpdateFail
+	ErrorCodeGroupDBCreateFail
+	ErrorCodeGroupDBDeleteFail
+)
+
+// 500 03
+const (
+	ErrorCodeModelDBFindFail ErrorCode = iota + 5000300
+	ErrorCodeModelDBUpdateFail
+	ErrorCodeModelDBCreateFail
+	ErrorCodeModelDBDeleteFail
+)
+
+// 500 04
+const (
+	ErrorCodeTelemetryDBAppendFail ErrorCode = iota + 5000400
+	ErrorCodeTelemetryDBFindFail
+	ErrorCodeTelemetryDBPurgeFail
+)
+
+// 500 05
+const (
+	ErrorCodeCommandDBFindFail ErrorCode = iota + 5000500
+	ErrorCodeCommandDBUpdateFail
+	ErrorCodeCommandDBCreateFail
+	ErrorCodeCommandDBDeleteFail
+)
+
+// 500 06
+const (
+	ErrorCodeFirmwareDBFindFail ErrorCode = iota + 5000600
+	ErrorCodeFirmwareDBUpdateFail
+	ErrorCodeFirmwareDBCreateFail
+	ErrorCodeFirmwareDBDeleteFail
+	ErrorCodeArtifactFail
+	ErrorCodeSigningFail
 )
 
 var errorMsg = map[ErrorCode]string{
-	ErrorCodeSuccess:            "Success",
-	ErrorCodeSuccessButNotFound: "Success with no affect rows",
-	ErrorCodeBadRequest:         "Bad request",
-	ErrorCodeTokenInvalid:       "Token invalid",
-	ErrorCodeForbidden:          "Forbidden",
-	ErrorCodeNotFound:           "Not found",
-	ErrorCodeServerErr:          "Internal server error",
-	ErrorCodeDatabaseFail:       "Database failure",
-	ErrorCodeTokenCreateFail:    "Token create fail",
-	ErrorCodeParseUUIDFail:      "Had a error in uuid parsing",
-	ErrorCodeDeviceDBFindFail:   "Device find fail",
-	ErrorCodeDeviceDBUpdateFail: "Device update fail",
-	ErrorCodeDeviceDBCreateFail: "Device create fail",
-	ErrorCodeDeviceDBDeleteFail: "Device delete fail",
+	ErrorCodeSuccess:                "Success",
+	ErrorCodeSuccessButNotFound:     "Success with no affect rows",
+	ErrorCodeBadRequest:             "Bad request",
+	ErrorCodeTokenInvalid:           "Token invalid",
+	ErrorCodeForbidden:              "Forbidden",
+	ErrorCodeNotFound:               "Not found",
+	ErrorCodeServerErr:              "Internal server error",
+	ErrorCodeDatabaseFail:           "Database failure",
+	ErrorCodeTokenCreateFail:        "Token create fail",
+	ErrorCodeRequestCanceled:        "Request canceled",
+	ErrorCodeDeadlineExceeded:       "Deadline exceeded",
+	ErrorCodeParseUUIDFail:          "Had a error in uuid parsing",
+	ErrorCodeFormatNotSupport:       "Format not support",
+	ErrorCodeImportUnreadable:       "Import input unreadable",
+	ErrorCodeSelectorInvalid:        "Label selector invalid",
+	ErrorCodeLabelInvalid:           "Label invalid",
+	ErrorCodeDeviceDBFindFail:       "Device find fail",
+	ErrorCodeDeviceDBUpdateFail:     "Device update fail",
+	ErrorCodeDeviceDBCreateFail:     "Device create fail",
+	ErrorCodeDeviceDBDeleteFail:     "Device delete fail",
+	ErrorCodeDeviceDBHistoryFail:    "Device history find fail",
+	ErrorCodeDeviceDBLabelFail:      "Device label fail",
+	ErrorCodeGroupParentInvalid:     "Group parent invalid",
+	ErrorCodeGroupNotEmpty:          "Group has subgroups",
+	ErrorCodeGroupDBFindFail:        "Group find fail",
+	ErrorCodeGroupDBUpdateFail:      "Group update fail",
+	ErrorCodeGroupDBCreateFail:      "Group create fail",
+	ErrorCodeGroupDBDeleteFail:      "Group delete fail",
+	ErrorCodeDeviceNotInCatalog:     "Device not in model catalog",
+	ErrorCodeModelInUse:             "Model in use",
+	ErrorCodeModelExists:            "Model already exists",
+	ErrorCodeStateTransitionInvalid: "Device state transition invalid",
+	ErrorCodeStatusInvalid:          "Device status invalid",
+	ErrorCodeStateNotUpdatable:      "Device state is changed by the activate, suspend and decommission endpoints",
+	ErrorCodeShadowVersionConflict:  "Device shadow version conflict",
+	ErrorCodeModelDBFindFail:        "Model find fail",
+	ErrorCodeModelDBUpdateFail:      "Model update fail",
+	ErrorCodeModelDBCreateFail:      "Model create fail",
+	ErrorCodeModelDBDeleteFail:      "Model delete fail",
+	ErrorCodeTelemetryInvalid:       "Telemetry invalid",
+	ErrorCodeTelemetryQueryInvalid:  "Telemetry query invalid",
+	ErrorCodeTelemetryDBAppendFail:  "Telemetry append fail",
+	ErrorCodeTelemetryDBFindFail:    "Telemetry find fail",
+	ErrorCodeTelemetryDBPurgeFail:   "Telemetry purge fail",
+	ErrorCodeCommandInvalid:         "Command invalid",
+	ErrorCodeCommandStatusInvalid:   "Command status transition invalid",
+	ErrorCodeCommandDBFindFail:      "Command find fail",
+	ErrorCodeCommandDBUpdateFail:    "Command update fail",
+	ErrorCodeCommandDBCreateFail:    "Command create fail",
+	ErrorCodeCommandDBDeleteFail:    "Command delete fail",
+	ErrorCodeReleaseInvalid:         "Firmware release invalid",
+	ErrorCodeCampaignInvalid:        "Rollout campaign invalid",
+	ErrorCodeReleaseExists:          "Firmware release already exists",
+	ErrorCodeReleaseInUse:           "Firmware release in use",
+	ErrorCodeCampaignStatusInvalid:  "Rollout campaign status transition invalid",
+	ErrorCodeFirmwareDBFindFail:     "Firmware find fail",
+	ErrorCodeFirmwareDBUpdateFail:   "Firmware update fail",
+	ErrorCodeFirmwareDBCreateFail:   "Firmware create fail",
+	ErrorCodeFirmwareDBDeleteFail:   "Firmware delete fail",
+	ErrorCodeArtifactFail:           "Firmware artifact fail",
+	ErrorCodeSigningFail:            "Firmware signing fail",
 }
 
 func ErrorMsg(code ErrorCode) string {
 	return errorMsg[code]
 }
 
+// contextErrorCode returns the code of a cancelled or timed out request, or
+// code for any other err
+func contextErrorCode(err error, code ErrorCode) ErrorCode {
+	switch {
+	case stderrors.Is(err, context.DeadlineExceeded):
+		return ErrorCodeDeadlineExceeded
+	case stderrors.Is(err, context.Canceled):
+		return ErrorCodeRequestCanceled
+	}
+	return code
+}
+
 func ErrorStatusCode(code ErrorCode) int {
 	i, _ := strconv.Atoi(fmt.Sprintf("%d", code)[:3])
 	return i
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github/demo/model/device"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+)
+
+// ImportError is the reason a row was not imported
+type ImportError struct {
+	Row     int    `json:"row"`
+	Id      string `json:"id,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportResult reports what an import did, or would do in a dry run
+type ImportResult struct {
+	DryRun  bool           `json:"dry_run"`
+	Total   int            `json:"total"`
+	Created int            `json:"created"`
+	Updated int            `json:"updated"`
+	Failed  int            `json:"failed"`
+	Errors  []*ImportError `json:"errors"`
+}
+
+func (r *ImportResult) fail(row int, id string, err error) {
+	r.Failed++
+	r.Errors = append(r.Errors, &ImportError{Row: row, Id: id, Message: err.Error()})
+}
+
+// Export writes every device matching the non-zero fields of d to enc
+func (s *deviceService) Export(ctx context.Context, d *Device, enc DeviceEncoder) ErrorCode {
+	ctx, span := trace.Start(ctx, "deviceService.Export")
+	defer span.Finish()
+
+	if d == nil || enc == nil {
+		return ErrorCodeBadRequest
+	}
+
+	total := 0
+	code := s.Iterate(ctx, d, nil, func(v *Device) error {
+		total++
+		return enc.Encode(v)
+	})
+	if code != ErrorCodeSuccess {
+		return code
+	}
+
+	if err := enc.Flush(); err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("device export flush fail => %+v", err)
+		return ErrorCodeServerErr
+	}
+	span.SetAttribute("device.count", total)
+	return ErrorCodeSuccess
+}
+
+// Import creates the rows of dec without id or with an unknown id and updates
+// the others. Invalid rows are reported and skipped, a dry run only validates.
+func (s *deviceService) Import(ctx context.Context, dec DeviceDecoder, dryRun bool) (*ImportResult, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.Import")
+	defer span.Finish()
+
+	if dec == nil {
+		return nil, ErrorCodeBadRequest
+	}
+
+	result := &ImportResult{
+		DryRun: dryRun,
+		Errors: []*ImportError{},
+	}
+	// ids created by this import, a later row with the same id updates it
+	seen := make(map[string]bool)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, contextErrorCode(err, ErrorCodeServerErr)
+		}
+
+		row, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			span.SetError(err)
+			log.WithContext(ctx).Errorf("device import read fail => %+v", err)
+			return nil, ErrorCodeImportUnreadable
+		}
+		result.Total++
+
+		if row.Err != nil {
+			result.fail(row.Row, "", row.Err)
+			continue
+		}
+		d := row.Device
+		// the lifecycle isn't imported, a created device is provisioned
+		d.State = ""
+		if err := validateImport(d); err != nil {
+			result.fail(row.Row, d.Id, err)
+			continue
+		}
+
+		exists := false
+		if len(d.Id) > 0 {
+			exists = seen[d.Id]
+			if !exists {
+				found, err := s.deviceRepo.List(ctx, &device.Device{Id: device.UUID(d.Id)})
+				if err != nil {
+					result.fail(row.Row, d.Id, err)
+					continue
+				}
+				exists = len(found) > 0
+			}
+		}
+
+		if dryRun {
+			if err := conform(ctx, s.catalogRepo, nil, d); err != nil {
+				result.fail(row.Row, d.Id, err)
+				continue
+			}
+			if exists {
+				result.Updated++
+			} else {
+				result.Created++
+			}
+			if len(d.Id) > 0 {
+				seen[d.Id] = true
+			}
+			continue
+		}
+
+		if exists {
+			if _, err := s.update(ctx, d); err != nil {
+				result.fail(row.Row, d.Id, err)
+				continue
+			}
+			result.Updated++
+			continue
+		}
+
+		if len(d.Id) == 0 {
+			d.Id = uuid.Must(uuid.NewV4()).String()
+		}
+		now := time.Now().UnixNano() / int64(time.Millisecond)
+		d.CreateTime = now
+		d.UpdateTime = now
+		if _, err := s.create(ctx, d); err != nil {
+			result.fail(row.Row, d.Id, err)
+			continue
+		}
+		seen[d.Id] = true
+		result.Created++
+	}
+
+	span.SetAttribute("import.total", result.Total)
+	span.SetAttribute("import.failed", result.Failed)
+	return result, ErrorCodeSuccess
+}
+
+func validateImport(d *Device) error {
+	if len(d.Id) > 0 && uuid.FromStringOrNil(d.Id) == uuid.Nil {
+		return fmt.Errorf("id %q is not a uuid", d.Id)
+	}
+	switch {
+	case len(d.Model) == 0:
+		return fmt.Errorf("model is required")
+	case len(d.Color) == 0:
+		return fmt.Errorf("color is required")
+	case len(d.Version) == 0:
+		return fmt.Errorf("version is required")
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/model/firmware"
+	"github/demo/utils/artifact"
+	"github/demo/utils/keywrap"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+)
+
+const (
+	// maximum size of a firmware artifact
+	maxArtifactSize = 512 << 20
+	// number of releases and campaigns of a page without number
+	firmwareNumber = 50
+)
+
+// ReleaseRequest registers firmware Version of Model. Checksum is the SHA-256
+// digest of the artifact in hex, the artifact is rejected when it doesn't
+// match, unchecked when it is empty.
+type ReleaseRequest struct {
+	Model    string `json:"model"`
+	Version  string `json:"version"`
+	Notes    string `json:"notes"`
+	Checksum string `json:"checksum"`
+}
+
+type Release struct {
+	Id       string `json:"id"`
+	Model    string `json:"model"`
+	Version  string `json:"version"`
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+	// Signature is the Ed25519 signature of the release by key KeyId, in
+	// base64
+	Signature  string `json:"signature"`
+	KeyId      string `json:"key_id"`
+	Notes      string `json:"notes"`
+	CreateTime int64  `json:"create_time"`
+}
+
+func (r *Release) Assemble(x *firmware.Release) {
+	r.Id = x.Id.String()
+	r.Model = x.Model
+	r.Version = x.Version
+	r.Checksum = x.Checksum
+	r.Size = x.Size
+	r.Signature = x.Signature
+	r.KeyId = x.KeyId
+	r.Notes = x.Notes
+	r.CreateTime = x.CreateTime
+}
+
+type firmwareService struct {
+	firmwareRepo firmware.Repository
+	campaignRepo firmware.CampaignRepository
+	keyRepo      firmware.KeyRepository
+	// kek wraps the private keys of keyRepo, the releases are stored
+	// unsigned without it
+	kek        *keywrap.KEK
+	deviceRepo device.Repository
+	artifacts  *artifact.Store
+	// commands tells the devices of a wave to update, they aren't told
+	// without it
+	commands ICommandService
+}
+
+// CreateRelease stores the artifact read from r and registers it as release
+// x, signed with the active key when there is a key-encryption key. A model
+// has one release of a version.
+func (s *firmwareService) CreateRelease(ctx context.Context, x *ReleaseRequest, r io.Reader) (*Release, ErrorCode) {
+	ctx, span := trace.Start(ctx, "firmwareService.CreateRelease")
+	defer span.Finish()
+
+	if x == nil || r == nil {
+		return nil, ErrorCodeReleaseInvalid
+	}
+	release := &firmware.Release{
+		Model:   strings.TrimSpace(x.Model),
+		Version: strings.TrimSpace(x.Version),
+		Notes:   x.Notes,
+	}
+	if err := release.Validate(); err != nil {
+		log.WithContext(ctx).Warnf("firmware release => %v", err)
+		return nil, ErrorCodeReleaseInvalid
+	}
+	checksum := strings.ToLower(strings.TrimSpace(x.Checksum))
+	if b, err := hex.DecodeString(checksum); len(checksum) > 0 && (err != nil || len(b) != 32) {
+		return nil, ErrorCodeReleaseInvalid
+	}
+
+	existing, err := s.firmwareRepo.Find(ctx, release.Model, release.Version, &model.Page{Limit: 1})
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+	if len(existing) > 0 {
+		return nil, ErrorCodeReleaseExists
+	}
+
+	release.Id = device.UUID(uuid.Must(uuid.NewV4()).String())
+	info, err := s.artifacts.Put(ctx, release.Id.String(), r, maxArtifactSize)
+	if err != nil {
+		if err == artifact.ErrTooLarge {
+			return nil, ErrorCodeReleaseInvalid
+		}
+		log.WithContext(ctx).Errorf("firmware release %s artifact fail => %+v", release.Id, err)
+		return nil, contextErrorCode(err, ErrorCodeArtifactFail)
+	}
+	if info.Size == 0 || (len(checksum) > 0 && checksum != info.Digest) {
+		s.deleteArtifact(ctx, release.Id)
+		return nil, ErrorCodeReleaseInvalid
+	}
+
+	release.Checksum = info.Digest
+	release.Size = info.Size
+	release.CreateTime = millis(time.Now())
+	if code := s.sign(ctx, release); code != ErrorCodeSuccess {
+		s.deleteArtifact(ctx, release.Id)
+		return nil, code
+	}
+	if _, err := s.firmwareRepo.Create(ctx, release); err != nil {
+		s.deleteArtifact(ctx, release.Id)
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBCreateFail)
+	}
+
+	re := &Release{}
+	re.Assemble(release)
+	return re, ErrorCodeSuccess
+}
+
+func (s *firmwareService) GetRelease(ctx context.Context, id string) (*Release, ErrorCode) {
+	ctx, span := trace.Start(ctx, "firmwareService.GetRelease")
+	defer span.Finish()
+
+	release, code := s.release(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	re := &Release{}
+	re.Assemble(release)
+	return re, ErrorCodeSuccess
+}
+
+// FindReleases returns the releases of model m, of all models when it is
+// empty, newest first
+func (s *firmwareService) FindReleases(ctx context.Context, m string, page *Page) ([]*Release, ErrorCode) {
+	ctx, span := trace.Start(ctx, "firmwareService.FindReleases")
+	defer span.Finish()
+
+	p, code := firmwarePage(page)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	rows, err := s.firmwareRepo.Find(ctx, m, "", p)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+
+	releases := make([]*Release, 0, len(rows))
+	for _, v := range rows {
+		re := &Release{}
+		re.Assemble(v)
+		releases = append(releases, re)
+	}
+	return releases, ErrorCodeSuccess
+}
+
+// DeleteRelease removes release id and its artifact, a release rolled out by
+// a campaign is kept
+func (s *firmwareService) DeleteRelease(ctx context.Context, id string) ErrorCode {
+	ctx, span := trace.Start(ctx, "firmwareService.DeleteRelease")
+	defer span.Finish()
+
+	release, code := s.release(ctx, id)
+	if code != ErrorCodeSuccess {
+		return code
+	}
+	campaigns, err := s.campaignRepo.Find(ctx, release.Id, "", &model.Page{Limit: 1})
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+	if len(campaigns) > 0 {
+		return ErrorCodeReleaseInUse
+	}
+
+	if _, err := s.firmwareRepo.Delete(ctx, release.Id); err != nil {
+		return contextErrorCode(err, ErrorCodeFirmwareDBDeleteFail)
+	}
+	s.deleteArtifact(ctx, release.Id)
+	return ErrorCodeSuccess
+}
+
+// Artifact returns release id and the content of its artifact, the caller
+// closes it
+func (s *firmwareService) Artifact(ctx context.Context, id string) (*Release, io.ReadCloser, ErrorCode) {
+	ctx, span := trace.Start(ctx, "firmwareService.Artifact")
+	defer span.Finish()
+
+	release, code := s.release(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, nil, code
+	}
+	r, _, err := s.artifacts.Open(ctx, release.Id.String())
+	if err != nil {
+		if err == artifact.ErrNotFound {
+			return nil, nil, ErrorCodeNotFound
+		}
+		log.WithContext(ctx).Errorf("firmware release %s artifact fail => %+v", release.Id, err)
+		return nil, nil, contextErrorCode(err, ErrorCodeArtifactFail)
+	}
+
+	re := &Release{}
+	re.Assemble(release)
+	return re, r, ErrorCodeSuccess
+}
+
+// release returns release id
+func (s *firmwareService) release(ctx context.Context, id string) (*firmware.Release, ErrorCode) {
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	release, err := s.firmwareRepo.Get(ctx, device.UUID(id))
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrorCodeNotFound
+		}
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+	return release, ErrorCodeSuccess
+}
+
+// deleteArtifact removes the artifact of release id once the release is gone
+// or was never stored, a failure is only logged
+func (s *firmwareService) deleteArtifact(ctx context.Context, id device.UUID) {
+	// the artifact is removed even when the request is cancelled
+	if err := s.artifacts.Delete(context.Background(), id.String()); err != nil {
+		log.WithContext(ctx).Errorf("firmware release %s artifact delete fail => %+v", id, err)
+	}
+}
+
+// firmwarePage returns the repository page of page
+func firmwarePage(page *Page) (*model.Page, ErrorCode) {
+	if page == nil {
+		return nil, ErrorCodeBadRequest
+	}
+	if page.Page == 0 {
+		page.Page = 1
+	}
+	if page.Number == 0 {
+		page.Number = firmwareNumber
+	}
+	return &model.Page{
+		Limit:  page.Number,
+		Offset: page.Number * (page.Page - 1),
+	}, ErrorCodeSuccess
+}
+
+// NewFirmwareService returns the firmware service, keeping the artifacts in
+// store and the signing keys in kr, their private keys wrapped by kek. With a
+// nil kek the releases are stored unsigned and no key is made, and a nil
+// commands doesn't tell the devices to update.
+func NewFirmwareService(fr firmware.Repository, cr firmware.CampaignRepository, kr firmware.KeyRepository, kek *keywrap.KEK, dr device.Repository, store *artifact.Store, commands ICommandService) IFirmwareService {
+	return &firmwareService{
+		firmwareRepo: fr,
+		campaignRepo: cr,
+		keyRepo:      kr,
+		kek:          kek,
+		deviceRepo:   dr,
+		artifacts:    store,
+		commands:     commands,
+	}
+}
@@ -0,0 +1,655 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/daos"
+	"github/demo/model/firmware"
+	"github/demo/service"
+	"github/demo/utils/artifact"
+	"github/demo/utils/audit"
+	"github/demo/utils/keywrap"
+)
+
+// "hello" and its SHA-256 digest
+const (
+	helloArtifact = "hello"
+	helloDigest   = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+)
+
+type firmwareFixture struct {
+	firmware service.IFirmwareService
+	devices  service.IDeviceService
+	commands service.ICommandService
+	keys     firmware.KeyRepository
+	kek      *keywrap.KEK
+	// ids are the devices of model Pro
+	ids []string
+	dir string
+}
+
+// newFirmwareService returns a firmware service with its artifacts in a
+// temporary directory, the caller removes f.dir, and n devices of model Pro
+// and one of model Lite
+func newFirmwareService(t *testing.T, n int) *firmwareFixture {
+	dir, err := ioutil.TempDir("", "firmware")
+	assert.NoError(t, err)
+
+	dr := daos.NewMemoryDeviceRepo()
+	f := &firmwareFixture{
+		devices: service.NewDeviceService(dr, daos.NewMemoryHistoryRepo(), nil, nil),
+		dir:     dir,
+	}
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		created, code := f.devices.Register(ctx, &service.Device{Model: "Pro", Color: "White", Version: "v1.2"})
+		assert.Equal(t, service.ErrorCodeSuccess, code)
+		f.ids = append(f.ids, created.Id)
+	}
+	_, code := f.devices.Register(ctx, &service.Device{Model: "Lite", Color: "White", Version: "v1.2"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	f.commands = service.NewCommandService(daos.NewMemoryCommandRepo(), dr, nil)
+	f.keys = daos.NewMemoryKeyRepo()
+	f.kek, err = keywrap.New(bytes.Repeat([]byte{7}, keywrap.Size))
+	assert.NoError(t, err)
+	f.firmware = service.NewFirmwareService(daos.NewMemoryFirmwareRepo(), daos.NewMemoryCampaignRepo(),
+		f.keys, f.kek, dr, artifact.NewStore(dir), f.commands)
+	return f
+}
+
+// heartbeat reports that the devices ids run firmware version
+func (f *firmwareFixture) heartbeat(t *testing.T, version string, ids ...string) {
+	for _, id := range ids {
+		_, code := f.devices.Heartbeat(context.Background(), id, &service.Heartbeat{Firmware: version})
+		assert.Equal(t, service.ErrorCodeSuccess, code)
+	}
+}
+
+// targets returns the devices of campaign id in status
+func (f *firmwareFixture) targets(t *testing.T, id, status string) []string {
+	devices, code := f.firmware.CampaignDevices(context.Background(), id, status, &service.Page{Number: 100})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	ids := []string{}
+	for _, d := range devices {
+		ids = append(ids, d.DeviceId)
+	}
+	return ids
+}
+
+func TestFirmwareService_CreateRelease(t *testing.T) {
+	f := newFirmwareService(t, 0)
+	defer os.RemoveAll(f.dir)
+	ctx := context.Background()
+
+	tt := []struct {
+		description  string
+		request      *service.ReleaseRequest
+		artifact     string
+		expectedCode service.ErrorCode
+	}{
+		{
+			description:  "version invalid",
+			request:      &service.ReleaseRequest{Model: "Pro", Version: "v 2"},
+			artifact:     helloArtifact,
+			expectedCode: service.ErrorCodeReleaseInvalid,
+		},
+		{
+			description:  "checksum not a digest",
+			request:      &service.ReleaseRequest{Model: "Pro", Version: "v2.0", Checksum: "abc"},
+			artifact:     helloArtifact,
+			expectedCode: service.ErrorCodeReleaseInvalid,
+		},
+		{
+			description:  "checksum mismatch",
+			request:      &service.ReleaseRequest{Model: "Pro", Version: "v2.0", Checksum: strings.Repeat("0", 64)},
+			artifact:     helloArtifact,
+			expectedCode: service.ErrorCodeReleaseInvalid,
+		},
+		{
+			description:  "empty artifact",
+			request:      &service.ReleaseRequest{Model: "Pro", Version: "v2.0"},
+			expectedCode: service.ErrorCodeReleaseInvalid,
+		},
+		{
+			description:  "checksum matches",
+			request:      &service.ReleaseRequest{Model: "Pro", Version: "v2.0", Notes: "fixes", Checksum: strings.ToUpper(helloDigest)},
+			artifact:     helloArtifact,
+			expectedCode: service.ErrorCodeSuccess,
+		},
+		{
+			description:  "version exists",
+			request:      &service.ReleaseRequest{Model: "Pro", Version: "v2.0"},
+			artifact:     helloArtifact,
+			expectedCode: service.ErrorCodeReleaseExists,
+		},
+		{
+			description:  "version of another model",
+			request:      &service.ReleaseRequest{Model: "Lite", Version: "v2.0"},
+			artifact:     helloArtifact,
+			expectedCode: service.ErrorCodeSuccess,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			r, code := f.firmware.CreateRelease(ctx, tc.request, strings.NewReader(tc.artifact))
+			assert.Equal(t, tc.expectedCode, code)
+			if tc.expectedCode != service.ErrorCodeSuccess {
+				assert.Nil(t, r)
+				return
+			}
+			assert.Equal(t, tc.request.Model, r.Model)
+			assert.Equal(t, tc.request.Version, r.Version)
+			assert.Equal(t, tc.request.Notes, r.Notes)
+			assert.Equal(t, helloDigest, r.Checksum)
+			assert.Equal(t, int64(len(tc.artifact)), r.Size)
+			assert.NotEmpty(t, r.Signature)
+			assert.NotEmpty(t, r.KeyId)
+
+			got, a, code := f.firmware.Artifact(ctx, r.Id)
+			assert.Equal(t, service.ErrorCodeSuccess, code)
+			assert.Equal(t, r, got)
+			b, err := ioutil.ReadAll(a)
+			a.Close()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.artifact, string(b))
+		})
+	}
+
+	// only the artifacts of the releases are kept
+	files, err := ioutil.ReadDir(f.dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	releases, code := f.firmware.FindReleases(ctx, "Pro", &service.Page{})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Len(t, releases, 1)
+	releases, code = f.firmware.FindReleases(ctx, "", &service.Page{})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Len(t, releases, 2)
+}
+
+func TestFirmwareService_VerifyRelease(t *testing.T) {
+	f := newFirmwareService(t, 0)
+	defer os.RemoveAll(f.dir)
+	ctx := context.Background()
+
+	old, code := f.firmware.CreateRelease(ctx, &service.ReleaseRequest{Model: "Pro", Version: "v2.0"}, strings.NewReader(helloArtifact))
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	keys, code := f.firmware.Keys(ctx)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, old.KeyId, keys[0].Id)
+	assert.Equal(t, firmware.KeyActive, keys[0].Status)
+
+	// the releases signed before a rotation are still verified by the
+	// retired key, those after are signed by the new one
+	rotated, code := f.firmware.RotateKey(ctx)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.NotEqual(t, old.KeyId, rotated.Id)
+	keys, code = f.firmware.Keys(ctx)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, rotated, keys[0])
+	assert.Equal(t, firmware.KeyRetired, keys[1].Status)
+	assert.NotZero(t, keys[1].RetireTime)
+
+	release, code := f.firmware.CreateRelease(ctx, &service.ReleaseRequest{Model: "Pro", Version: "v2.1"}, strings.NewReader(helloArtifact))
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, rotated.Id, release.KeyId)
+	// the version is signed, the same artifact of another version isn't
+	// signed alike
+	assert.NotEqual(t, old.Signature, release.Signature)
+
+	tampered, code := f.firmware.CreateRelease(ctx, &service.ReleaseRequest{Model: "Pro", Version: "v2.2"}, strings.NewReader(helloArtifact))
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(f.dir, tampered.Id), []byte("hellO"), 0644))
+
+	tt := []struct {
+		description    string
+		id             string
+		expectedCode   service.ErrorCode
+		expectedValid  bool
+		expectedReason string
+	}{
+		{
+			description:  "id invalid",
+			id:           "1",
+			expectedCode: service.ErrorCodeParseUUIDFail,
+		},
+		{
+			description:  "release not found",
+			id:           "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60",
+			expectedCode: service.ErrorCodeNotFound,
+		},
+		{
+			description:   "signed by the retired key",
+			id:            old.Id,
+			expectedCode:  service.ErrorCodeSuccess,
+			expectedValid: true,
+		},
+		{
+			description:   "signed by the active key",
+			id:            release.Id,
+			expectedCode:  service.ErrorCodeSuccess,
+			expectedValid: true,
+		},
+		{
+			description:    "artifact tampered",
+			id:             tampered.Id,
+			expectedCode:   service.ErrorCodeSuccess,
+			expectedReason: "artifact digest mismatch",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			v, code := f.firmware.VerifyRelease(ctx, tc.id)
+			assert.Equal(t, tc.expectedCode, code)
+			if tc.expectedCode != service.ErrorCodeSuccess {
+				assert.Nil(t, v)
+				return
+			}
+			assert.Equal(t, tc.expectedValid, v.Valid)
+			assert.Equal(t, tc.expectedReason, v.Reason)
+			assert.Equal(t, tc.id, v.ReleaseId)
+		})
+	}
+}
+
+func TestFirmwareService_SigningKey(t *testing.T) {
+	f := newFirmwareService(t, 0)
+	defer os.RemoveAll(f.dir)
+	ctx := context.Background()
+
+	release, code := f.firmware.CreateRelease(ctx, &service.ReleaseRequest{Model: "Pro", Version: "v2.0"}, strings.NewReader(helloArtifact))
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	_, code = f.firmware.RotateKey(ctx)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	// the stored keys hold the private keys wrapped only, in no encoding
+	// of the clear ones
+	keys, err := f.keys.Find(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	for _, k := range keys {
+		private, err := f.kek.Unwrap(k.Id, k.WrappedKey)
+		assert.NoError(t, err)
+		assert.Len(t, private, ed25519.PrivateKeySize)
+		public, err := base64.StdEncoding.DecodeString(k.PublicKey)
+		assert.NoError(t, err)
+		assert.Equal(t, public, []byte(ed25519.PrivateKey(private).Public().(ed25519.PublicKey)))
+
+		seed := ed25519.PrivateKey(private).Seed()
+		row, err := json.Marshal(k)
+		assert.NoError(t, err)
+		wrapped, err := base64.StdEncoding.DecodeString(k.WrappedKey)
+		assert.NoError(t, err)
+		for _, clear := range [][]byte{private, seed} {
+			assert.False(t, bytes.Contains(row, clear))
+			assert.False(t, bytes.Contains(wrapped, clear))
+			assert.NotContains(t, string(row), base64.StdEncoding.EncodeToString(clear))
+			assert.NotContains(t, string(row), hex.EncodeToString(clear))
+		}
+	}
+
+	// nothing is signed with another key-encryption key
+	other, err := keywrap.New(bytes.Repeat([]byte{8}, keywrap.Size))
+	assert.NoError(t, err)
+	s := service.NewFirmwareService(daos.NewMemoryFirmwareRepo(), daos.NewMemoryCampaignRepo(),
+		f.keys, other, daos.NewMemoryDeviceRepo(), artifact.NewStore(f.dir), nil)
+	_, code = s.CreateRelease(ctx, &service.ReleaseRequest{Model: "Pro", Version: "v2.1"}, strings.NewReader(helloArtifact))
+	assert.Equal(t, service.ErrorCodeSigningFail, code)
+
+	// without one the releases are stored unsigned and no key is made
+	s = service.NewFirmwareService(daos.NewMemoryFirmwareRepo(), daos.NewMemoryCampaignRepo(),
+		f.keys, nil, daos.NewMemoryDeviceRepo(), artifact.NewStore(f.dir), nil)
+	unsigned, code := s.CreateRelease(ctx, &service.ReleaseRequest{Model: "Pro", Version: "v2.1"}, strings.NewReader(helloArtifact))
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Empty(t, unsigned.Signature)
+	assert.Empty(t, unsigned.KeyId)
+	v, code := s.VerifyRelease(ctx, unsigned.Id)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.False(t, v.Valid)
+	assert.Equal(t, "release not signed", v.Reason)
+	_, code = s.RotateKey(ctx)
+	assert.Equal(t, service.ErrorCodeSigningFail, code)
+	keys, err = f.keys.Find(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+
+	v, code = f.firmware.VerifyRelease(ctx, release.Id)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.True(t, v.Valid)
+}
+
+func TestFirmwareService_DeleteRelease(t *testing.T) {
+	f := newFirmwareService(t, 1)
+	defer os.RemoveAll(f.dir)
+	ctx := context.Background()
+
+	used, code := f.firmware.CreateRelease(ctx, &service.ReleaseRequest{Model: "Pro", Version: "v2.0"}, strings.NewReader(helloArtifact))
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	_, code = f.firmware.CreateCampaign(ctx, &service.CampaignRequest{ReleaseId: used.Id, Waves: []int{100}})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	unused, code := f.firmware.CreateRelease(ctx, &service.ReleaseRequest{Model: "Pro", Version: "v2.1"}, strings.NewReader(helloArtifact))
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	assert.Equal(t, service.ErrorCodeParseUUIDFail, f.firmware.DeleteRelease(ctx, "1234"))
+	assert.Equal(t, service.ErrorCodeNotFound, f.firmware.DeleteRelease(ctx, "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60"))
+	assert.Equal(t, service.ErrorCodeReleaseInUse, f.firmware.DeleteRelease(ctx, used.Id))
+	assert.Equal(t, service.ErrorCodeSuccess, f.firmware.DeleteRelease(ctx, unused.Id))
+
+	_, code = f.firmware.GetRelease(ctx, unused.Id)
+	assert.Equal(t, service.ErrorCodeNotFound, code)
+	_, _, code = f.firmware.Artifact(ctx, unused.Id)
+	assert.Equal(t, service.ErrorCodeNotFound, code)
+	files, err := ioutil.ReadDir(f.dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestFirmwareService_CreateCampaign(t *testing.T) {
+	f := newFirmwareService(t, 0)
+	defer os.RemoveAll(f.dir)
+	ctx := context.Background()
+
+	release, code := f.firmware.CreateRelease(ctx, &service.ReleaseRequest{Model: "Pro", Version: "v2.0"}, strings.NewReader(helloArtifact))
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	tt := []struct {
+		description     string
+		request         *service.CampaignRequest
+		expectedCode    service.ErrorCode
+		expectedTimeout int64
+	}{
+		{
+			description:  "input invalid uuid",
+			request:      &service.CampaignRequest{ReleaseId: "1234", Waves: []int{100}},
+			expectedCode: service.ErrorCodeParseUUIDFail,
+		},
+		{
+			description:  "release not found",
+			request:      &service.CampaignRequest{ReleaseId: "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60", Waves: []int{100}},
+			expectedCode: service.ErrorCodeNotFound,
+		},
+		{
+			description:  "selector invalid",
+			request:      &service.CampaignRequest{ReleaseId: release.Id, Selector: "site in (tpe", Waves: []int{100}},
+			expectedCode: service.ErrorCodeSelectorInvalid,
+		},
+		{
+			description:  "no waves",
+			request:      &service.CampaignRequest{ReleaseId: release.Id},
+			expectedCode: service.ErrorCodeCampaignInvalid,
+		},
+		{
+			description:  "waves not rising",
+			request:      &service.CampaignRequest{ReleaseId: release.Id, Waves: []int{50, 10, 100}},
+			expectedCode: service.ErrorCodeCampaignInvalid,
+		},
+		{
+			description:  "wave over 100",
+			request:      &service.CampaignRequest{ReleaseId: release.Id, Waves: []int{10, 200}},
+			expectedCode: service.ErrorCodeCampaignInvalid,
+		},
+		{
+			description:  "threshold over 1",
+			request:      &service.CampaignRequest{ReleaseId: release.Id, Waves: []int{100}, FailureThreshold: 1.5},
+			expectedCode: service.ErrorCodeCampaignInvalid,
+		},
+		{
+			description:     "default timeout",
+			request:         &service.CampaignRequest{ReleaseId: release.Id, Selector: "site=tpe", Waves: []int{10, 50, 100}, FailureThreshold: 0.2},
+			expectedCode:    service.ErrorCodeSuccess,
+			expectedTimeout: int64(service.DefaultCampaignTimeout / time.Millisecond),
+		},
+		{
+			description:     "timeout",
+			request:         &service.CampaignRequest{ReleaseId: release.Id, Waves: []int{100}, Timeout: time.Minute},
+			expectedCode:    service.ErrorCodeSuccess,
+			expectedTimeout: 60000,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			c, code := f.firmware.CreateCampaign(ctx, tc.request)
+			assert.Equal(t, tc.expectedCode, code)
+			if tc.expectedCode != service.ErrorCodeSuccess {
+				assert.Nil(t, c)
+				return
+			}
+			assert.Equal(t, release.Id, c.ReleaseId)
+			assert.Equal(t, tc.request.Selector, c.Selector)
+			assert.Equal(t, tc.request.Waves, c.Waves)
+			assert.Equal(t, 0, c.Wave)
+			assert.Equal(t, firmware.CampaignRunning, c.Status)
+			assert.Equal(t, tc.request.FailureThreshold, c.FailureThreshold)
+			assert.Equal(t, tc.expectedTimeout, c.Timeout)
+		})
+	}
+
+	campaigns, code := f.firmware.FindCampaigns(ctx, firmware.CampaignRunning, &service.Page{})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Len(t, campaigns, 2)
+	_, code = f.firmware.FindCampaigns(ctx, "done", &service.Page{})
+	assert.Equal(t, service.ErrorCodeCampaignInvalid, code)
+}
+
+func TestFirmwareService_Rollout(t *testing.T) {
+	f := newFirmwareService(t, 10)
+	defer os.RemoveAll(f.dir)
+	ctx := context.Background()
+
+	release, code := f.firmware.CreateRelease(ctx, &service.ReleaseRequest{Model: "Pro", Version: "v2.0"}, strings.NewReader(helloArtifact))
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	c, code := f.firmware.CreateCampaign(ctx, &service.CampaignRequest{
+		ReleaseId:        release.Id,
+		Waves:            []int{20, 100},
+		FailureThreshold: 0.5,
+	})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	// the first wave takes 2 of the 10 devices of the model, and tells them
+	// to update
+	assert.Equal(t, service.ErrorCodeSuccess, f.firmware.Rollout(ctx))
+	first := f.targets(t, c.Id, firmware.TargetUpdating)
+	assert.Len(t, first, 2)
+	for _, id := range first {
+		commands, code := f.commands.History(ctx, id, "", &service.Page{})
+		assert.Equal(t, service.ErrorCodeSuccess, code)
+		assert.Len(t, commands, 1)
+		assert.Equal(t, service.FirmwareUpdateCommand, commands[0].Name)
+		payload := &service.UpdatePayload{}
+		assert.NoError(t, json.Unmarshal(commands[0].Payload, payload))
+		assert.Equal(t, &service.UpdatePayload{
+			CampaignId: c.Id,
+			ReleaseId:  release.Id,
+			Version:    "v2.0",
+			Checksum:   helloDigest,
+			Size:       int64(len(helloArtifact)),
+			Signature:  release.Signature,
+			KeyId:      release.KeyId,
+		}, payload)
+	}
+
+	// the next wave waits for the devices updating
+	assert.Equal(t, service.ErrorCodeSuccess, f.firmware.Rollout(ctx))
+	got, code := f.firmware.GetCampaign(ctx, c.Id)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, 1, got.Wave)
+	assert.Equal(t, map[string]int64{"updating": 2, "succeeded": 0, "failed": 0}, got.Progress)
+
+	// a device running the release succeeds, the last wave takes the rest
+	f.heartbeat(t, "v2.0", first...)
+	assert.Equal(t, service.ErrorCodeSuccess, f.firmware.Rollout(ctx))
+	assert.ElementsMatch(t, first, f.targets(t, c.Id, firmware.TargetSucceeded))
+	rest := f.targets(t, c.Id, firmware.TargetUpdating)
+	assert.Len(t, rest, 8)
+
+	f.heartbeat(t, "v2.0", rest...)
+	assert.Equal(t, service.ErrorCodeSuccess, f.firmware.Rollout(ctx))
+	got, code = f.firmware.GetCampaign(ctx, c.Id)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, firmware.CampaignCompleted, got.Status)
+	assert.Equal(t, 2, got.Wave)
+	assert.Equal(t, map[string]int64{"updating": 0, "succeeded": 10, "failed": 0}, got.Progress)
+}
+
+func TestFirmwareService_RolloutFailures(t *testing.T) {
+	f := newFirmwareService(t, 10)
+	defer os.RemoveAll(f.dir)
+	ctx := context.Background()
+
+	release, code := f.firmware.CreateRelease(ctx, &service.ReleaseRequest{Model: "Pro", Version: "v2.0"}, strings.NewReader(helloArtifact))
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	c, code := f.firmware.CreateCampaign(ctx, &service.CampaignRequest{
+		ReleaseId:        release.Id,
+		Waves:            []int{100},
+		FailureThreshold: 0.5,
+		Timeout:          time.Millisecond,
+	})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	// a device already running the release succeeds at once, and isn't told
+	// to update
+	f.heartbeat(t, "v2.0", f.ids[0])
+	assert.Equal(t, service.ErrorCodeSuccess, f.firmware.Rollout(ctx))
+	assert.Equal(t, []string{f.ids[0]}, f.targets(t, c.Id, firmware.TargetSucceeded))
+	commands, code := f.commands.History(ctx, f.ids[0], "", &service.Page{})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Len(t, commands, 0)
+
+	// 6 of the 10 devices don't update in time, the campaign pauses
+	f.heartbeat(t, "v2.0", f.ids[1:4]...)
+	time.Sleep(2 * time.Millisecond)
+	assert.Equal(t, service.ErrorCodeSuccess, f.firmware.Rollout(ctx))
+	got, code := f.firmware.GetCampaign(ctx, c.Id)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, firmware.CampaignPaused, got.Status)
+	assert.Equal(t, "failure rate 0.60 over 0.50", got.Reason)
+	assert.Equal(t, map[string]int64{"updating": 0, "succeeded": 4, "failed": 6}, got.Progress)
+
+	// a paused campaign isn't stepped
+	assert.Equal(t, service.ErrorCodeSuccess, f.firmware.Rollout(ctx))
+	got, code = f.firmware.GetCampaign(ctx, c.Id)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, firmware.CampaignPaused, got.Status)
+
+	// resumed with a higher threshold, it completes
+	threshold := 0.7
+	got, code = f.firmware.UpdateCampaign(ctx, c.Id, firmware.CampaignRunning, &threshold)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, 0.7, got.FailureThreshold)
+	assert.Equal(t, service.ErrorCodeSuccess, f.firmware.Rollout(ctx))
+	got, code = f.firmware.GetCampaign(ctx, c.Id)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, firmware.CampaignCompleted, got.Status)
+}
+
+func TestFirmwareService_UpdateCampaign(t *testing.T) {
+	f := newFirmwareService(t, 0)
+	defer os.RemoveAll(f.dir)
+	ctx := audit.NewContext(context.Background(), "alice")
+
+	release, code := f.firmware.CreateRelease(ctx, &service.ReleaseRequest{Model: "Pro", Version: "v2.0"}, strings.NewReader(helloArtifact))
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	c, code := f.firmware.CreateCampaign(ctx, &service.CampaignRequest{ReleaseId: release.Id, Waves: []int{100}})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	over := 2.0
+
+	tt := []struct {
+		description    string
+		id             string
+		status         string
+		threshold      *float64
+		expectedCode   service.ErrorCode
+		expectedReason string
+	}{
+		{
+			description:  "input invalid uuid",
+			id:           "1234",
+			status:       firmware.CampaignPaused,
+			expectedCode: service.ErrorCodeParseUUIDFail,
+		},
+		{
+			description:  "not found",
+			id:           "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60",
+			status:       firmware.CampaignPaused,
+			expectedCode: service.ErrorCodeNotFound,
+		},
+		{
+			description:  "status invalid",
+			id:           c.Id,
+			status:       "stopped",
+			expectedCode: service.ErrorCodeCampaignInvalid,
+		},
+		{
+			description:  "threshold invalid",
+			id:           c.Id,
+			status:       firmware.CampaignRunning,
+			threshold:    &over,
+			expectedCode: service.ErrorCodeCampaignInvalid,
+		},
+		{
+			description:  "completed by hand",
+			id:           c.Id,
+			status:       firmware.CampaignCompleted,
+			expectedCode: service.ErrorCodeCampaignStatusInvalid,
+		},
+		{
+			description:  "resume running",
+			id:           c.Id,
+			status:       firmware.CampaignRunning,
+			expectedCode: service.ErrorCodeCampaignStatusInvalid,
+		},
+		{
+			description:    "pause",
+			id:             c.Id,
+			status:         firmware.CampaignPaused,
+			expectedCode:   service.ErrorCodeSuccess,
+			expectedReason: "paused by alice",
+		},
+		{
+			description:    "cancel paused",
+			id:             c.Id,
+			status:         firmware.CampaignCancelled,
+			expectedCode:   service.ErrorCodeSuccess,
+			expectedReason: "paused by alice",
+		},
+		{
+			description:  "resume cancelled",
+			id:           c.Id,
+			status:       firmware.CampaignRunning,
+			expectedCode: service.ErrorCodeCampaignStatusInvalid,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			got, code := f.firmware.UpdateCampaign(ctx, tc.id, tc.status, tc.threshold)
+			assert.Equal(t, tc.expectedCode, code)
+			if tc.expectedCode != service.ErrorCodeSuccess {
+				assert.Nil(t, got)
+				return
+			}
+			assert.Equal(t, tc.status, got.Status)
+			assert.Equal(t, tc.expectedReason, got.Reason)
+		})
+	}
+}
@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/model/group"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+)
+
+type Group struct {
+	Id string `json:"id"`
+	// ParentId is empty for a top level group
+	ParentId   string `json:"parent_id"`
+	Name       string `json:"name"`
+	CreateTime int64  `json:"create_time"`
+	UpdateTime int64  `json:"update_time"`
+}
+
+func (g *Group) repoType() *group.Group {
+	r := &group.Group{
+		Id:   device.UUID(g.Id),
+		Name: g.Name,
+	}
+	if len(g.ParentId) > 0 {
+		parent := device.UUID(g.ParentId)
+		r.ParentId = &parent
+	}
+	return r
+}
+
+func (g *Group) Assemble(r *group.Group) {
+	g.Id = r.Id.String()
+	g.ParentId = ""
+	if r.ParentId != nil {
+		g.ParentId = r.ParentId.String()
+	}
+	g.Name = r.Name
+	g.CreateTime = r.CreateTime
+	g.UpdateTime = r.UpdateTime
+}
+
+type groupService struct {
+	groupRepo  group.Repository
+	deviceRepo device.Repository
+	// devices is the device service the group operations go through
+	devices IDeviceService
+}
+
+// number of groups returned by a Find without a page
+const groupNumber = 50
+
+// Find returns the groups in parent, every group when parent is empty
+func (s *groupService) Find(ctx context.Context, parent string, page *Page) ([]*Group, ErrorCode) {
+	ctx, span := trace.Start(ctx, "groupService.Find")
+	defer span.Finish()
+
+	if page == nil {
+		return nil, ErrorCodeBadRequest
+	}
+	if page.Page == 0 {
+		page.Page = 1
+	}
+	if page.Number == 0 {
+		page.Number = groupNumber
+	}
+
+	var parentId *device.UUID
+	if len(parent) > 0 {
+		if uuid.FromStringOrNil(parent) == uuid.Nil {
+			return nil, ErrorCodeParseUUIDFail
+		}
+		id := device.UUID(parent)
+		parentId = &id
+	}
+
+	rows, err := s.groupRepo.Find(ctx, parentId, &model.Page{
+		Limit:  page.Number,
+		Offset: page.Number * (page.Page - 1),
+	})
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeGroupDBFindFail)
+	}
+
+	groups := []*Group{}
+	for _, v := range rows {
+		g := &Group{}
+		g.Assemble(v)
+		groups = append(groups, g)
+	}
+	return groups, ErrorCodeSuccess
+}
+
+func (s *groupService) Get(ctx context.Context, id string) (*Group, ErrorCode) {
+	ctx, span := trace.Start(ctx, "groupService.Get")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+
+	x, code := s.get(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	g := &Group{}
+	g.Assemble(x)
+	return g, ErrorCodeSuccess
+}
+
+func (s *groupService) Create(ctx context.Context, g *Group) (*Group, ErrorCode) {
+	ctx, span := trace.Start(ctx, "groupService.Create")
+	defer span.Finish()
+
+	if g == nil || len(g.Name) == 0 {
+		return nil, ErrorCodeBadRequest
+	}
+	if len(g.ParentId) > 0 {
+		if uuid.FromStringOrNil(g.ParentId) == uuid.Nil {
+			return nil, ErrorCodeGroupParentInvalid
+		}
+		if _, code := s.get(ctx, g.ParentId); code == ErrorCodeNotFound {
+			return nil, ErrorCodeGroupParentInvalid
+		} else if code != ErrorCodeSuccess {
+			return nil, code
+		}
+	}
+
+	g.Id = uuid.Must(uuid.NewV4()).String()
+	x, err := s.groupRepo.Create(ctx, g.repoType())
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeGroupDBCreateFail)
+	}
+
+	re := &Group{}
+	re.Assemble(x)
+	return re, ErrorCodeSuccess
+}
+
+// Update sets the name and the parent of g, an empty ParentId moves it to the
+// top level. A group can't be moved under itself or its descendants.
+func (s *groupService) Update(ctx context.Context, g *Group) (int64, ErrorCode) {
+	ctx, span := trace.Start(ctx, "groupService.Update")
+	defer span.Finish()
+
+	if g == nil || len(g.Name) == 0 {
+		return 0, ErrorCodeBadRequest
+	}
+	if uuid.FromStringOrNil(g.Id) == uuid.Nil {
+		return 0, ErrorCodeParseUUIDFail
+	}
+	if _, code := s.get(ctx, g.Id); code != ErrorCodeSuccess {
+		return 0, code
+	}
+
+	if len(g.ParentId) > 0 {
+		if uuid.FromStringOrNil(g.ParentId) == uuid.Nil {
+			return 0, ErrorCodeGroupParentInvalid
+		}
+		if _, code := s.get(ctx, g.ParentId); code == ErrorCodeNotFound {
+			return 0, ErrorCodeGroupParentInvalid
+		} else if code != ErrorCodeSuccess {
+			return 0, code
+		}
+
+		descendants, err := s.groupRepo.Descendants(ctx, device.UUID(g.Id))
+		if err != nil {
+			return 0, contextErrorCode(err, ErrorCodeGroupDBUpdateFail)
+		}
+		for _, id := range descendants {
+			if id.String() == g.ParentId {
+				return 0, ErrorCodeGroupParentInvalid
+			}
+		}
+	}
+
+	affect, err := s.groupRepo.Update(ctx, g.repoType())
+	if err != nil {
+		return 0, contextErrorCode(err, ErrorCodeGroupDBUpdateFail)
+	}
+	return affect, ErrorCodeSuccess
+}
+
+// Delete removes a group without subgroups, its devices only leave it
+func (s *groupService) Delete(ctx context.Context, id string) ErrorCode {
+	ctx, span := trace.Start(ctx, "groupService.Delete")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return ErrorCodeParseUUIDFail
+	}
+
+	parent := device.UUID(id)
+	children, err := s.groupRepo.Find(ctx, &parent, &model.Page{Limit: 1})
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeGroupDBDeleteFail)
+	}
+	if len(children) > 0 {
+		return ErrorCodeGroupNotEmpty
+	}
+
+	affect, err := s.groupRepo.Delete(ctx, device.UUID(id))
+	if err != nil {
+		return contextErrorCode(err, ErrorCodeGroupDBDeleteFail)
+	}
+	if affect <= 0 {
+		return ErrorCodeSuccessButNotFound
+	}
+
+	if _, err := s.deviceRepo.RemoveMembers(ctx, device.UUID(id)); err != nil {
+		log.WithContext(ctx).Errorf("group %s members remove fail => %+v", id, err)
+	}
+	return ErrorCodeSuccess
+}
+
+// AddDevices makes the devices ids members of group id
+func (s *groupService) AddDevices(ctx context.Context, id string, ids []string) ErrorCode {
+	ctx, span := trace.Start(ctx, "groupService.AddDevices")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return ErrorCodeParseUUIDFail
+	}
+	if len(ids) == 0 {
+		return ErrorCodeBadRequest
+	}
+	if _, code := s.get(ctx, id); code != ErrorCodeSuccess {
+		return code
+	}
+
+	members := make([]device.UUID, 0, len(ids))
+	for _, v := range ids {
+		if uuid.FromStringOrNil(v) == uuid.Nil {
+			return ErrorCodeParseUUIDFail
+		}
+		if _, err := s.deviceRepo.Get(ctx, device.UUID(v)); err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrorCodeNotFound
+			}
+			return contextErrorCode(err, ErrorCodeGroupDBUpdateFail)
+		}
+		members = append(members, device.UUID(v))
+	}
+
+	if err := s.deviceRepo.AddMembers(ctx, device.UUID(id), members...); err != nil {
+		return contextErrorCode(err, ErrorCodeGroupDBUpdateFail)
+	}
+	return ErrorCodeSuccess
+}
+
+// RemoveDevices removes the devices ids from group id
+func (s *groupService) RemoveDevices(ctx context.Context, id string, ids []string) (int64, ErrorCode) {
+	ctx, span := trace.Start(ctx, "groupService.RemoveDevices")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return 0, ErrorCodeParseUUIDFail
+	}
+	if len(ids) == 0 {
+		return 0, ErrorCodeBadRequest
+	}
+
+	members := make([]device.UUID, 0, len(ids))
+	for _, v := range ids {
+		if uuid.FromStringOrNil(v) == uuid.Nil {
+			return 0, ErrorCodeParseUUIDFail
+		}
+		members = append(members, device.UUID(v))
+	}
+
+	affect, err := s.deviceRepo.RemoveMembers(ctx, device.UUID(id), members...)
+	if err != nil {
+		return 0, contextErrorCode(err, ErrorCodeGroupDBUpdateFail)
+	}
+	if affect <= 0 {
+		return 0, ErrorCodeSuccessButNotFound
+	}
+	return affect, ErrorCodeSuccess
+}
+
+// Devices returns the devices of group id matching the non-zero fields of d,
+// with those of its subgroups at any depth when recursive
+func (s *groupService) Devices(ctx context.Context, id string, recursive bool, d *Device, page *Page) ([]*Device, ErrorCode) {
+	ctx, span := trace.Start(ctx, "groupService.Devices")
+	defer span.Finish()
+
+	if d == nil {
+		return nil, ErrorCodeBadRequest
+	}
+	groups, code := s.groups(ctx, id, recursive)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+
+	filter := *d
+	filter.Groups = groups
+	return s.devices.Find(ctx, &filter, page)
+}
+
+// UpdateDevices applies the non-zero fields of d to every device of group id,
+// and of its subgroups at any depth when recursive, through the device update
+// so each change is validated and recorded. It returns the number of devices
+// updated, up to the first failure.
+func (s *groupService) UpdateDevices(ctx context.Context, id string, recursive bool, d *Device) (int64, ErrorCode) {
+	ctx, span := trace.Start(ctx, "groupService.UpdateDevices")
+	defer span.Finish()
+
+	if d == nil || len(d.Model)+len(d.Color)+len(d.Version) == 0 {
+		return 0, ErrorCodeBadRequest
+	}
+	groups, code := s.groups(ctx, id, recursive)
+	if code != ErrorCodeSuccess {
+		return 0, code
+	}
+
+	// the members are read before the first update, the rows aren't held
+	// open while writing
+	var ids []string
+	code = s.devices.Iterate(ctx, &Device{Groups: groups}, nil, func(v *Device) error {
+		ids = append(ids, v.Id)
+		return nil
+	})
+	if code != ErrorCodeSuccess {
+		return 0, code
+	}
+
+	var total int64
+	for _, v := range ids {
+		affect, code := s.devices.Update(ctx, &Device{
+			Id:      v,
+			Model:   d.Model,
+			Color:   d.Color,
+			Version: d.Version,
+		})
+		if code != ErrorCodeSuccess {
+			return total, code
+		}
+		total += affect
+	}
+	span.SetAttribute("device.count", total)
+	return total, ErrorCodeSuccess
+}
+
+// get returns group id, or ErrorCodeNotFound when there is none
+func (s *groupService) get(ctx context.Context, id string) (*group.Group, ErrorCode) {
+	g, err := s.groupRepo.Get(ctx, device.UUID(id))
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrorCodeNotFound
+		}
+		return nil, contextErrorCode(err, ErrorCodeGroupDBFindFail)
+	}
+	return g, ErrorCodeSuccess
+}
+
+// groups returns group id, with its descendants when recursive
+func (s *groupService) groups(ctx context.Context, id string, recursive bool) ([]string, ErrorCode) {
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	if _, code := s.get(ctx, id); code != ErrorCodeSuccess {
+		return nil, code
+	}
+	if !recursive {
+		return []string{id}, ErrorCodeSuccess
+	}
+
+	descendants, err := s.groupRepo.Descendants(ctx, device.UUID(id))
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeGroupDBFindFail)
+	}
+	groups := make([]string, 0, len(descendants))
+	for _, v := range descendants {
+		groups = append(groups, v.String())
+	}
+	return groups, ErrorCodeSuccess
+}
+
+// NewGroupService returns the group service over gr, keeping the members in
+// dr and going through ds for the operations on them
+func NewGroupService(gr group.Repository, dr device.Repository, ds IDeviceService) IGroupService {
+	return &groupService{
+		groupRepo:  gr,
+		deviceRepo: dr,
+		devices:    ds,
+	}
+}
@@ -0,0 +1,107 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/daos"
+	"github/demo/service"
+)
+
+func TestGroupService(t *testing.T) {
+	dr := daos.NewMemoryDeviceRepo()
+	ds := service.NewDeviceService(dr, daos.NewMemoryHistoryRepo(), nil, nil)
+	s := service.NewGroupService(daos.NewMemoryGroupRepo(), dr, ds)
+	ctx := context.Background()
+
+	fleet, code := s.Create(ctx, &service.Group{Name: "fleet"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	site, code := s.Create(ctx, &service.Group{Name: "site", ParentId: fleet.Id})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, fleet.Id, site.ParentId)
+	room, _ := s.Create(ctx, &service.Group{Name: "room", ParentId: site.Id})
+	other, _ := s.Create(ctx, &service.Group{Name: "other"})
+
+	tt := []struct {
+		description  string
+		group        *service.Group
+		expectedCode service.ErrorCode
+	}{
+		{description: "no name", group: &service.Group{Id: site.Id}, expectedCode: service.ErrorCodeBadRequest},
+		{description: "invalid id", group: &service.Group{Id: "1234", Name: "site"}, expectedCode: service.ErrorCodeParseUUIDFail},
+		{description: "unknown group", group: &service.Group{Id: "99f970f5-b876-4c94-9190-34ee11d54edb", Name: "site"}, expectedCode: service.ErrorCodeNotFound},
+		{description: "unknown parent", group: &service.Group{Id: site.Id, Name: "site", ParentId: "99f970f5-b876-4c94-9190-34ee11d54edb"}, expectedCode: service.ErrorCodeGroupParentInvalid},
+		{description: "own parent", group: &service.Group{Id: site.Id, Name: "site", ParentId: site.Id}, expectedCode: service.ErrorCodeGroupParentInvalid},
+		{description: "under a descendant", group: &service.Group{Id: fleet.Id, Name: "fleet", ParentId: room.Id}, expectedCode: service.ErrorCodeGroupParentInvalid},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			_, code := s.Update(ctx, tc.group)
+			assert.Equal(t, tc.expectedCode, code)
+		})
+	}
+
+	groups, code := s.Find(ctx, fleet.Id, &service.Page{})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	if assert.Len(t, groups, 1) {
+		assert.Equal(t, site.Id, groups[0].Id)
+	}
+
+	d1, _ := ds.Register(ctx, &service.Device{Model: "Pro", Color: "White", Version: "v1.2"})
+	d2, _ := ds.Register(ctx, &service.Device{Model: "Pro", Color: "Black", Version: "v1.2"})
+	d3, _ := ds.Register(ctx, &service.Device{Model: "Normal", Color: "Black", Version: "v1.2"})
+
+	assert.Equal(t, service.ErrorCodeSuccess, s.AddDevices(ctx, fleet.Id, []string{d1.Id}))
+	assert.Equal(t, service.ErrorCodeSuccess, s.AddDevices(ctx, room.Id, []string{d2.Id, d1.Id}))
+	assert.Equal(t, service.ErrorCodeSuccess, s.AddDevices(ctx, other.Id, []string{d3.Id}))
+	assert.Equal(t, service.ErrorCodeNotFound, s.AddDevices(ctx, room.Id, []string{"99f970f5-b876-4c94-9190-34ee11d54edb"}))
+	assert.Equal(t, service.ErrorCodeBadRequest, s.AddDevices(ctx, room.Id, nil))
+
+	devices, code := s.Devices(ctx, fleet.Id, false, &service.Device{}, &service.Page{Page: 1, Number: 10})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Len(t, devices, 1)
+	devices, code = s.Devices(ctx, fleet.Id, true, &service.Device{}, &service.Page{Page: 1, Number: 10})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Len(t, devices, 2)
+	devices, code = s.Devices(ctx, fleet.Id, true, &service.Device{Color: "Black"}, &service.Page{Page: 1, Number: 10})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, d2.Id, devices[0].Id)
+	}
+
+	// the group update goes through the device update, into the history
+	affect, code := s.UpdateDevices(ctx, fleet.Id, true, &service.Device{Version: "v1.3"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, int64(2), affect)
+	_, code = s.UpdateDevices(ctx, fleet.Id, true, &service.Device{})
+	assert.Equal(t, service.ErrorCodeBadRequest, code)
+
+	devices, _ = ds.Find(ctx, &service.Device{Version: "v1.3"}, &service.Page{Page: 1, Number: 10})
+	assert.Len(t, devices, 2)
+	history, _ := ds.History(ctx, d2.Id, &service.Page{})
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, map[string]*service.Change{"version": {Before: "v1.2", After: "v1.3"}}, history[0].Changes)
+	}
+
+	affect, code = s.RemoveDevices(ctx, room.Id, []string{d1.Id})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, int64(1), affect)
+	_, code = s.RemoveDevices(ctx, room.Id, []string{d1.Id})
+	assert.Equal(t, service.ErrorCodeSuccessButNotFound, code)
+
+	// a group is moved, and deleted once it has no subgroups
+	_, code = s.Update(ctx, &service.Group{Id: room.Id, Name: "room"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	devices, _ = s.Devices(ctx, fleet.Id, true, &service.Device{}, &service.Page{Page: 1, Number: 10})
+	assert.Len(t, devices, 1)
+
+	assert.Equal(t, service.ErrorCodeGroupNotEmpty, s.Delete(ctx, fleet.Id))
+	assert.Equal(t, service.ErrorCodeSuccess, s.Delete(ctx, site.Id))
+	assert.Equal(t, service.ErrorCodeSuccess, s.Delete(ctx, fleet.Id))
+	assert.Equal(t, service.ErrorCodeSuccessButNotFound, s.Delete(ctx, fleet.Id))
+	_, code = s.Get(ctx, fleet.Id)
+	assert.Equal(t, service.ErrorCodeNotFound, code)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github/demo/model/device"
+	"github/demo/utils/trace"
+)
+
+// Statuses of a device by the time since its last heartbeat
+const (
+	StatusOnline  = "online"
+	StatusStale   = "stale"
+	StatusOffline = "offline"
+)
+
+// Liveness classifies the devices by the time since their last heartbeat
+type Liveness struct {
+	// Online is how long a device stays online after a heartbeat
+	Online time.Duration
+	// Offline is how long after a heartbeat a device is offline, it is stale
+	// in between
+	Offline time.Duration
+}
+
+// DefaultLiveness is the liveness of a device service given none
+var DefaultLiveness = Liveness{
+	Online:  2 * time.Minute,
+	Offline: 10 * time.Minute,
+}
+
+// Status returns the status of a device last seen at lastSeen, in
+// milliseconds, a device never seen is offline
+func (l *Liveness) Status(lastSeen int64, now time.Time) string {
+	if lastSeen == 0 {
+		return StatusOffline
+	}
+	since := now.Sub(time.Unix(0, lastSeen*int64(time.Millisecond)))
+	switch {
+	case since < l.Online:
+		return StatusOnline
+	case since < l.Offline:
+		return StatusStale
+	}
+	return StatusOffline
+}
+
+// seen returns the range of last seen times of the devices in status
+func (l *Liveness) seen(status string, now time.Time) (*device.SeenRange, bool) {
+	online := now.Add(-l.Online).UnixNano() / int64(time.Millisecond)
+	offline := now.Add(-l.Offline).UnixNano() / int64(time.Millisecond)
+	switch status {
+	case StatusOnline:
+		return &device.SeenRange{Since: online + 1}, true
+	case StatusStale:
+		return &device.SeenRange{Since: offline + 1, Before: online + 1}, true
+	case StatusOffline:
+		return &device.SeenRange{Before: offline + 1}, true
+	}
+	return nil, false
+}
+
+// Heartbeat is what a device reports when it checks in
+type Heartbeat struct {
+	// Firmware is the running firmware version, the reported one is kept
+	// when it is empty
+	Firmware string `json:"firmware,omitempty"`
+}
+
+// Heartbeat records that device id is alive now and returns the time it was
+// seen. It is no change of the device, nothing is recorded in its history.
+func (s *deviceService) Heartbeat(ctx context.Context, id string, h *Heartbeat) (int64, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.Heartbeat")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return 0, ErrorCodeParseUUIDFail
+	}
+	firmware := ""
+	if h != nil {
+		firmware = strings.TrimSpace(h.Firmware)
+	}
+
+	seen := time.Now().UnixNano() / int64(time.Millisecond)
+	affect, err := s.deviceRepo.Heartbeat(ctx, device.UUID(id), seen, firmware)
+	if err != nil {
+		return 0, contextErrorCode(err, ErrorCodeDeviceDBUpdateFail)
+	}
+	if affect <= 0 {
+		return 0, ErrorCodeNotFound
+	}
+	return seen, ErrorCodeSuccess
+}
@@ -0,0 +1,121 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/daos"
+	"github/demo/model/device"
+	"github/demo/service"
+)
+
+func TestLiveness_Status(t *testing.T) {
+	l := &service.Liveness{Online: time.Minute, Offline: 5 * time.Minute}
+	now := time.Unix(1000, 0)
+	ms := func(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) }
+
+	tt := []struct {
+		description string
+		lastSeen    int64
+		expected    string
+	}{
+		{description: "never seen", lastSeen: 0, expected: service.StatusOffline},
+		{description: "just seen", lastSeen: ms(now), expected: service.StatusOnline},
+		{description: "seen within online", lastSeen: ms(now.Add(-59 * time.Second)), expected: service.StatusOnline},
+		{description: "seen online ago", lastSeen: ms(now.Add(-time.Minute)), expected: service.StatusStale},
+		{description: "seen within offline", lastSeen: ms(now.Add(-4 * time.Minute)), expected: service.StatusStale},
+		{description: "seen offline ago", lastSeen: ms(now.Add(-5 * time.Minute)), expected: service.StatusOffline},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.Equal(t, tc.expected, l.Status(tc.lastSeen, now))
+		})
+	}
+}
+
+func TestDeviceService_Heartbeat(t *testing.T) {
+	dr := daos.NewMemoryDeviceRepo()
+	s := service.NewDeviceService(dr, daos.NewMemoryHistoryRepo(), nil, &service.Liveness{Online: time.Minute, Offline: 5 * time.Minute})
+	ctx := context.Background()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		created, code := s.Register(ctx, &service.Device{Model: "Pro", Color: "White", Version: "v1.2"})
+		assert.Equal(t, service.ErrorCodeSuccess, code)
+		assert.Equal(t, service.StatusOffline, created.Status)
+		ids = append(ids, created.Id)
+	}
+
+	tt := []struct {
+		description  string
+		id           string
+		heartbeat    *service.Heartbeat
+		expectedCode service.ErrorCode
+	}{
+		{
+			description:  "input invalid uuid",
+			id:           "1234",
+			expectedCode: service.ErrorCodeParseUUIDFail,
+		},
+		{
+			description:  "not found",
+			id:           "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60",
+			expectedCode: service.ErrorCodeNotFound,
+		},
+		{
+			description:  "with firmware",
+			id:           ids[0],
+			heartbeat:    &service.Heartbeat{Firmware: " fw-2.0 "},
+			expectedCode: service.ErrorCodeSuccess,
+		},
+		{
+			description:  "without body",
+			id:           ids[0],
+			expectedCode: service.ErrorCodeSuccess,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			seen, code := s.Heartbeat(ctx, tc.id, tc.heartbeat)
+			assert.Equal(t, tc.expectedCode, code)
+			if tc.expectedCode == service.ErrorCodeSuccess {
+				assert.NotZero(t, seen)
+			}
+		})
+	}
+
+	// the second device was seen a while ago, the third never
+	stale := time.Now().Add(-2*time.Minute).UnixNano() / int64(time.Millisecond)
+	_, err := dr.Heartbeat(ctx, device.UUID(ids[1]), stale, "")
+	assert.NoError(t, err)
+
+	for status, id := range map[string]string{
+		service.StatusOnline:  ids[0],
+		service.StatusStale:   ids[1],
+		service.StatusOffline: ids[2],
+	} {
+		devices, code := s.Find(ctx, &service.Device{Status: status}, &service.Page{Page: 1, Number: 10})
+		assert.Equal(t, service.ErrorCodeSuccess, code)
+		if assert.Len(t, devices, 1, status) {
+			assert.Equal(t, id, devices[0].Id)
+			assert.Equal(t, status, devices[0].Status)
+		}
+	}
+	devices, _ := s.Find(ctx, &service.Device{Id: ids[0]}, &service.Page{Page: 1, Number: 1})
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, "fw-2.0", devices[0].Firmware)
+	}
+
+	_, code := s.Find(ctx, &service.Device{Status: "asleep"}, &service.Page{Page: 1, Number: 10})
+	assert.Equal(t, service.ErrorCodeStatusInvalid, code)
+
+	// heartbeats aren't recorded
+	history, code := s.History(ctx, ids[0], &service.Page{})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Len(t, history, 1)
+}
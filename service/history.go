@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/utils/audit"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+)
+
+// number of history records of a page without number
+const historyNumber = 50
+
+// Change is the value of a field before and after a change
+type Change struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type History struct {
+	Id         uint64             `json:"id"`
+	DeviceId   string             `json:"device_id"`
+	Action     string             `json:"action"`
+	Actor      string             `json:"actor"`
+	RequestId  string             `json:"request_id"`
+	Changes    map[string]*Change `json:"changes"`
+	CreateTime int64              `json:"create_time"`
+}
+
+func (h *History) Assemble(r *device.History) {
+	h.Id = r.Id
+	h.DeviceId = r.DeviceId.String()
+	h.Action = r.Action
+	h.Actor = r.Actor
+	h.RequestId = r.RequestId
+	h.Changes = map[string]*Change{}
+	json.Unmarshal([]byte(r.Changes), &h.Changes)
+	h.CreateTime = r.CreateTime
+}
+
+// History returns the changes of device id, newest first. It is kept after
+// the device is deleted.
+func (s *deviceService) History(ctx context.Context, id string, page *Page) ([]*History, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.History")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	if page == nil {
+		return nil, ErrorCodeBadRequest
+	}
+	if page.Page == 0 {
+		page.Page = 1
+	}
+	if page.Number == 0 {
+		page.Number = historyNumber
+	}
+
+	history := []*History{}
+	if s.historyRepo == nil {
+		return history, ErrorCodeSuccess
+	}
+
+	rows, err := s.historyRepo.Find(ctx, device.UUID(id), &model.Page{
+		Limit:  page.Number,
+		Offset: page.Number * (page.Page - 1),
+	})
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBHistoryFail)
+	}
+
+	for _, v := range rows {
+		h := &History{}
+		h.Assemble(v)
+		history = append(history, h)
+	}
+	return history, ErrorCodeSuccess
+}
+
+// record adds a change of device id to its history. The change is already
+// made, a failure is only logged.
+func (s *deviceService) record(ctx context.Context, action string, id device.UUID, changes map[string]*Change) {
+	if s.historyRepo == nil {
+		return
+	}
+
+	b, err := json.Marshal(changes)
+	if err == nil {
+		err = s.historyRepo.Create(ctx, &device.History{
+			DeviceId:   id,
+			Action:     action,
+			Actor:      audit.Actor(ctx),
+			RequestId:  log.RequestID(ctx),
+			Changes:    string(b),
+			CreateTime: time.Now().UnixNano() / int64(time.Millisecond),
+		})
+	}
+	if err != nil {
+		log.WithContext(ctx).Errorf("device %s history %s fail => %+v", id, action, err)
+	}
+}
+
+// diff returns the fields that differ between before and after, a nil device
+// has none of them set
+func diff(before, after *device.Device) map[string]*Change {
+	if before == nil {
+		before = &device.Device{}
+	}
+	if after == nil {
+		after = &device.Device{}
+	}
+
+	changes := make(map[string]*Change)
+	for _, f := range []struct {
+		name          string
+		before, after string
+	}{
+		{"model", before.Model, after.Model},
+		{"color", before.Color, after.Color},
+		{"version", before.Version, after.Version},
+		{"state", before.State, after.State},
+		{"desired.color", before.DesiredColor, after.DesiredColor},
+		{"desired.version", before.DesiredVersion, after.DesiredVersion},
+	} {
+		if f.before != f.after {
+			changes[f.name] = &Change{Before: f.before, After: f.after}
+		}
+	}
+	return changes
+}
+
+// diffLabels adds to changes the labels that differ between before and after,
+// as labels.<key>
+func diffLabels(changes map[string]*Change, before, after map[string]string) map[string]*Change {
+	for k, v := range before {
+		if a, ok := after[k]; !ok || a != v {
+			changes["labels."+k] = &Change{Before: v, After: a}
+		}
+	}
+	for k, v := range after {
+		if _, ok := before[k]; !ok {
+			changes["labels."+k] = &Change{Before: "", After: v}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,107 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/daos"
+	"github/demo/service"
+	"github/demo/utils/audit"
+	"github/demo/utils/log"
+)
+
+func TestDeviceService_History(t *testing.T) {
+	s := service.NewDeviceService(daos.NewMemoryDeviceRepo(), daos.NewMemoryHistoryRepo(), nil, nil)
+	ctx := audit.NewContext(log.NewContext(context.Background(), "req-1"), "alice")
+
+	created, code := s.Register(ctx, &service.Device{Model: "Pro", Color: "White", Version: "v1.2"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	_, code = s.Update(ctx, &service.Device{Id: created.Id, Version: "v1.3"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	// an import records its changes too
+	dec, err := service.NewDeviceDecoder(service.FormatNDJSON, strings.NewReader(
+		`{"id":"`+created.Id+`","model":"Pro","color":"Black","version":"v1.3"}`))
+	assert.NoError(t, err)
+	result, code := s.Import(context.Background(), dec, false)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, 1, result.Updated)
+	code = s.Delete(ctx, created.Id)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	tt := []struct {
+		description  string
+		id           string
+		page         *service.Page
+		expectedCode service.ErrorCode
+		expected     []*service.History
+	}{
+		{
+			description:  "newest first",
+			id:           created.Id,
+			page:         &service.Page{},
+			expectedCode: service.ErrorCodeSuccess,
+			expected: []*service.History{
+				{Id: 4, DeviceId: created.Id, Action: "delete", Actor: "alice", RequestId: "req-1", Changes: map[string]*service.Change{
+					"model":   {Before: "Pro", After: ""},
+					"color":   {Before: "Black", After: ""},
+					"version": {Before: "v1.3", After: ""},
+					"state":   {Before: "provisioned", After: ""},
+				}},
+				{Id: 3, DeviceId: created.Id, Action: "update", Actor: audit.Anonymous, RequestId: "", Changes: map[string]*service.Change{
+					"color": {Before: "White", After: "Black"},
+				}},
+				{Id: 2, DeviceId: created.Id, Action: "update", Actor: "alice", RequestId: "req-1", Changes: map[string]*service.Change{
+					"version": {Before: "v1.2", After: "v1.3"},
+				}},
+				{Id: 1, DeviceId: created.Id, Action: "create", Actor: "alice", RequestId: "req-1", Changes: map[string]*service.Change{
+					"model":   {Before: "", After: "Pro"},
+					"color":   {Before: "", After: "White"},
+					"version": {Before: "", After: "v1.2"},
+					"state":   {Before: "", After: "provisioned"},
+				}},
+			},
+		},
+		{
+			description:  "input page=2 number=3",
+			id:           created.Id,
+			page:         &service.Page{Page: 2, Number: 3},
+			expectedCode: service.ErrorCodeSuccess,
+			expected: []*service.History{
+				{Id: 1, DeviceId: created.Id, Action: "create", Actor: "alice", RequestId: "req-1", Changes: map[string]*service.Change{
+					"model":   {Before: "", After: "Pro"},
+					"color":   {Before: "", After: "White"},
+					"version": {Before: "", After: "v1.2"},
+					"state":   {Before: "", After: "provisioned"},
+				}},
+			},
+		},
+		{
+			description:  "unknown device",
+			id:           "99f970f5-b876-4c94-9190-34ee11d54edb",
+			page:         &service.Page{},
+			expectedCode: service.ErrorCodeSuccess,
+			expected:     []*service.History{},
+		},
+		{
+			description:  "invalid id",
+			id:           "1234",
+			page:         &service.Page{},
+			expectedCode: service.ErrorCodeParseUUIDFail,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			history, code := s.History(context.Background(), tc.id, tc.page)
+			assert.Equal(t, tc.expectedCode, code)
+			for _, h := range history {
+				assert.NotZero(t, h.CreateTime)
+				h.CreateTime = 0
+			}
+			assert.Equal(t, tc.expected, history)
+		})
+	}
+}
@@ -1,8 +1,78 @@
 package service
 
+import (
+	"context"
+	"io"
+	"time"
+)
+
 type IDeviceService interface {
-	Find(*Device, *Page) ([]*Device, ErrorCode)
-	Register(*Device) (*Device, ErrorCode)
-	Update(*Device) (int64, ErrorCode)
-	Delete(string) ErrorCode
+	Find(context.Context, *Device, *Page) ([]*Device, ErrorCode)
+	Iterate(context.Context, *Device, *Page, func(*Device) error) ErrorCode
+	Register(context.Context, *Device) (*Device, ErrorCode)
+	Update(context.Context, *Device) (int64, ErrorCode)
+	Delete(context.Context, string) ErrorCode
+	Count(context.Context) ([]*DeviceCount, ErrorCode)
+	History(context.Context, string, *Page) ([]*History, ErrorCode)
+	SetLabels(context.Context, string, map[string]string) (map[string]string, ErrorCode)
+	RemoveLabels(context.Context, string, ...string) (map[string]string, ErrorCode)
+	Export(context.Context, *Device, DeviceEncoder) ErrorCode
+	Import(context.Context, DeviceDecoder, bool) (*ImportResult, ErrorCode)
+	Transition(context.Context, string, string) (*Device, ErrorCode)
+	Heartbeat(context.Context, string, *Heartbeat) (int64, ErrorCode)
+	Shadow(context.Context, string) (*Shadow, ErrorCode)
+	SetDesired(context.Context, string, *ShadowState, int64) (*Shadow, ErrorCode)
+	Acknowledge(context.Context, string, int64, *ShadowState) (*Shadow, ErrorCode)
+}
+
+type IGroupService interface {
+	Find(context.Context, string, *Page) ([]*Group, ErrorCode)
+	Get(context.Context, string) (*Group, ErrorCode)
+	Create(context.Context, *Group) (*Group, ErrorCode)
+	Update(context.Context, *Group) (int64, ErrorCode)
+	Delete(context.Context, string) ErrorCode
+	AddDevices(context.Context, string, []string) ErrorCode
+	RemoveDevices(context.Context, string, []string) (int64, ErrorCode)
+	Devices(context.Context, string, bool, *Device, *Page) ([]*Device, ErrorCode)
+	UpdateDevices(context.Context, string, bool, *Device) (int64, ErrorCode)
+}
+
+type ICatalogService interface {
+	Find(context.Context, *Page) ([]*Model, ErrorCode)
+	Get(context.Context, string) (*Model, ErrorCode)
+	Create(context.Context, *Model) (*Model, ErrorCode)
+	Update(context.Context, *Model) (int64, ErrorCode)
+	Delete(context.Context, string) ErrorCode
+	Mismatches(context.Context, *Page) ([]*Mismatch, ErrorCode)
+}
+
+type ITelemetryService interface {
+	Ingest(context.Context, string, []*TelemetryPoint) (*TelemetryResult, ErrorCode)
+	Series(context.Context, string, *SeriesQuery) (*Series, ErrorCode)
+	Purge(context.Context) (int64, ErrorCode)
+}
+
+type ICommandService interface {
+	Enqueue(context.Context, string, *CommandRequest) (*Command, ErrorCode)
+	Next(context.Context, string, time.Duration) (*Command, ErrorCode)
+	Report(context.Context, string, string, *CommandReport) (*Command, ErrorCode)
+	History(context.Context, string, string, *Page) ([]*Command, ErrorCode)
+	Cleanup(context.Context) (int64, int64, ErrorCode)
+}
+
+type IFirmwareService interface {
+	CreateRelease(context.Context, *ReleaseRequest, io.Reader) (*Release, ErrorCode)
+	GetRelease(context.Context, string) (*Release, ErrorCode)
+	FindReleases(context.Context, string, *Page) ([]*Release, ErrorCode)
+	DeleteRelease(context.Context, string) ErrorCode
+	Artifact(context.Context, string) (*Release, io.ReadCloser, ErrorCode)
+	CreateCampaign(context.Context, *CampaignRequest) (*Campaign, ErrorCode)
+	GetCampaign(context.Context, string) (*Campaign, ErrorCode)
+	FindCampaigns(context.Context, string, *Page) ([]*Campaign, ErrorCode)
+	CampaignDevices(context.Context, string, string, *Page) ([]*CampaignDevice, ErrorCode)
+	UpdateCampaign(context.Context, string, string, *float64) (*Campaign, ErrorCode)
+	Rollout(context.Context) ErrorCode
+	Keys(context.Context) ([]*SigningKey, ErrorCode)
+	RotateKey(context.Context) (*SigningKey, ErrorCode)
+	VerifyRelease(context.Context, string) (*Verification, ErrorCode)
 }
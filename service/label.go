@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github/demo/model/device"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+)
+
+// SetLabels adds labels to device id, replacing the values of the keys it
+// already has, and returns all of its labels
+func (s *deviceService) SetLabels(ctx context.Context, id string, labels map[string]string) (map[string]string, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.SetLabels")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	if len(labels) == 0 {
+		return nil, ErrorCodeBadRequest
+	}
+	for k, v := range labels {
+		if err := device.ValidateLabel(k, v); err != nil {
+			log.WithContext(ctx).Warnf("device %s label => %v", id, err)
+			return nil, ErrorCodeLabelInvalid
+		}
+	}
+
+	before, code := s.labels(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	if err := s.deviceRepo.SetLabels(ctx, device.UUID(id), labels); err != nil {
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBLabelFail)
+	}
+
+	after := make(map[string]string, len(before)+len(labels))
+	for k, v := range before {
+		after[k] = v
+	}
+	for k, v := range labels {
+		after[k] = v
+	}
+	if changes := diffLabels(map[string]*Change{}, before, after); len(changes) > 0 {
+		s.record(ctx, device.ActionUpdate, device.UUID(id), changes)
+	}
+	return after, ErrorCodeSuccess
+}
+
+// RemoveLabels removes the labels keys of device id and returns the labels
+// left
+func (s *deviceService) RemoveLabels(ctx context.Context, id string, keys ...string) (map[string]string, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.RemoveLabels")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	if len(keys) == 0 {
+		return nil, ErrorCodeBadRequest
+	}
+
+	before, code := s.labels(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	if _, err := s.deviceRepo.RemoveLabels(ctx, device.UUID(id), keys...); err != nil {
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBLabelFail)
+	}
+
+	after := make(map[string]string, len(before))
+	for k, v := range before {
+		after[k] = v
+	}
+	for _, k := range keys {
+		delete(after, k)
+	}
+	if changes := diffLabels(map[string]*Change{}, before, after); len(changes) > 0 {
+		s.record(ctx, device.ActionUpdate, device.UUID(id), changes)
+	}
+	return after, ErrorCodeSuccess
+}
+
+// labels returns the labels of device id, or ErrorCodeNotFound when there is
+// no such device
+func (s *deviceService) labels(ctx context.Context, id string) (map[string]string, ErrorCode) {
+	if _, err := s.deviceRepo.Get(ctx, device.UUID(id)); err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrorCodeNotFound
+		}
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBLabelFail)
+	}
+
+	labels, err := s.deviceRepo.Labels(ctx, device.UUID(id))
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBLabelFail)
+	}
+	if labels[device.UUID(id)] == nil {
+		return map[string]string{}, ErrorCodeSuccess
+	}
+	return labels[device.UUID(id)], ErrorCodeSuccess
+}
@@ -0,0 +1,89 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/daos"
+	"github/demo/service"
+)
+
+func TestDeviceService_Labels(t *testing.T) {
+	s := service.NewDeviceService(daos.NewMemoryDeviceRepo(), daos.NewMemoryHistoryRepo(), nil, nil)
+	ctx := context.Background()
+
+	d1, _ := s.Register(ctx, &service.Device{Model: "Pro", Color: "White", Version: "v1.2"})
+	d2, _ := s.Register(ctx, &service.Device{Model: "Pro", Color: "Black", Version: "v1.2"})
+
+	labels, code := s.SetLabels(ctx, d1.Id, map[string]string{"site": "tpe", "env": "lab"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, map[string]string{"site": "tpe", "env": "lab"}, labels)
+
+	labels, code = s.SetLabels(ctx, d1.Id, map[string]string{"env": "prod"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, map[string]string{"site": "tpe", "env": "prod"}, labels)
+
+	_, code = s.SetLabels(ctx, d2.Id, map[string]string{"site": "khh", "env": "lab"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	tt := []struct {
+		description  string
+		id           string
+		labels       map[string]string
+		expectedCode service.ErrorCode
+	}{
+		{description: "invalid key", id: d1.Id, labels: map[string]string{"-site": "tpe"}, expectedCode: service.ErrorCodeLabelInvalid},
+		{description: "invalid value", id: d1.Id, labels: map[string]string{"site": "t p e"}, expectedCode: service.ErrorCodeLabelInvalid},
+		{description: "no labels", id: d1.Id, labels: map[string]string{}, expectedCode: service.ErrorCodeBadRequest},
+		{description: "invalid id", id: "1234", labels: map[string]string{"site": "tpe"}, expectedCode: service.ErrorCodeParseUUIDFail},
+		{description: "unknown device", id: "99f970f5-b876-4c94-9190-34ee11d54edb", labels: map[string]string{"site": "tpe"}, expectedCode: service.ErrorCodeNotFound},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			_, code := s.SetLabels(ctx, tc.id, tc.labels)
+			assert.Equal(t, tc.expectedCode, code)
+		})
+	}
+
+	// the labels come with the devices found, and select them
+	devices, code := s.Find(ctx, &service.Device{Selector: "site=tpe,env!=lab"}, &service.Page{Page: 1, Number: 10})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, d1.Id, devices[0].Id)
+		assert.Equal(t, map[string]string{"site": "tpe", "env": "prod"}, devices[0].Labels)
+	}
+
+	_, code = s.Find(ctx, &service.Device{Selector: "site in (tpe"}, &service.Page{Page: 1, Number: 10})
+	assert.Equal(t, service.ErrorCodeSelectorInvalid, code)
+	code = s.Iterate(ctx, &service.Device{Selector: "!"}, nil, func(*service.Device) error { return nil })
+	assert.Equal(t, service.ErrorCodeSelectorInvalid, code)
+
+	labels, code = s.RemoveLabels(ctx, d1.Id, "env", "missing")
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, map[string]string{"site": "tpe"}, labels)
+
+	// the label changes are in the history
+	history, code := s.History(ctx, d1.Id, &service.Page{})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	if assert.Len(t, history, 4) {
+		assert.Equal(t, map[string]*service.Change{"labels.env": {Before: "prod", After: ""}}, history[0].Changes)
+		assert.Equal(t, map[string]*service.Change{"labels.env": {Before: "lab", After: "prod"}}, history[1].Changes)
+		assert.Equal(t, map[string]*service.Change{
+			"labels.site": {Before: "", After: "tpe"},
+			"labels.env":  {Before: "", After: "lab"},
+		}, history[2].Changes)
+	}
+
+	// the labels go with a deleted device
+	assert.Equal(t, service.ErrorCodeSuccess, s.Delete(ctx, d2.Id))
+	devices, code = s.Find(ctx, &service.Device{Selector: "site=khh"}, &service.Page{Page: 1, Number: 10})
+	assert.Equal(t, service.ErrorCodeSuccessButNotFound, code)
+	history, _ = s.History(ctx, d2.Id, &service.Page{Number: 1})
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, "delete", history[0].Action)
+		assert.Equal(t, &service.Change{Before: "khh", After: ""}, history[0].Changes["labels.site"])
+	}
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github/demo/utils/metrics"
+)
+
+// RegisterMetrics exposes the business gauges read from s on reg
+func RegisterMetrics(reg *metrics.Registry, s IDeviceService) {
+	reg.Func("demo_devices", "Number of registered devices by model and version.",
+		metrics.TypeGauge, []string{"model", "version"},
+		func(report func(float64, ...string)) error {
+			counts, code := s.Count(context.Background())
+			if code != ErrorCodeSuccess {
+				return fmt.Errorf("%s", ErrorMsg(code))
+			}
+			for _, c := range counts {
+				report(float64(c.Total), c.Model, c.Version)
+			}
+			return nil
+		})
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github/demo/model/device"
+	"github/demo/utils/trace"
+)
+
+// AnyVersion sets the desired config of a shadow whatever its version
+const AnyVersion int64 = -1
+
+// ShadowState is the config of a device in one section of its shadow
+type ShadowState struct {
+	Color   string `json:"color,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// Shadow is the config an operator wants a device to run next to the config
+// the device reports
+type Shadow struct {
+	Id       string       `json:"id"`
+	Desired  *ShadowState `json:"desired"`
+	Reported *ShadowState `json:"reported"`
+	// Delta holds the desired fields the device doesn't report yet
+	Delta *ShadowState `json:"delta"`
+	// Version counts the changes of the desired config and the
+	// acknowledgements of the device
+	Version int64 `json:"version"`
+}
+
+func (s *Shadow) Assemble(r *device.Device) {
+	s.Id = r.Id.String()
+	s.Desired = &ShadowState{Color: r.DesiredColor, Version: r.DesiredVersion}
+	s.Reported = &ShadowState{Color: r.Color, Version: r.Version}
+	s.Delta = &ShadowState{}
+	if len(r.DesiredColor) > 0 && r.DesiredColor != r.Color {
+		s.Delta.Color = r.DesiredColor
+	}
+	if len(r.DesiredVersion) > 0 && r.DesiredVersion != r.Version {
+		s.Delta.Version = r.DesiredVersion
+	}
+	s.Version = r.ShadowVersion
+}
+
+// Shadow returns the shadow of device id
+func (s *deviceService) Shadow(ctx context.Context, id string) (*Shadow, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.Shadow")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	d, code := s.get(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+
+	re := &Shadow{}
+	re.Assemble(d)
+	return re, ErrorCodeSuccess
+}
+
+// SetDesired replaces the desired config of device id if its shadow is at
+// version, or whatever its version with AnyVersion. The desired config must
+// match the catalog, an empty field wants nothing.
+func (s *deviceService) SetDesired(ctx context.Context, id string, desired *ShadowState, version int64) (*Shadow, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.SetDesired")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	if desired == nil {
+		return nil, ErrorCodeBadRequest
+	}
+	want := &device.Desired{
+		Color:   strings.TrimSpace(desired.Color),
+		Version: strings.TrimSpace(desired.Version),
+	}
+
+	before, code := s.get(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	if version != AnyVersion && version != before.ShadowVersion {
+		return nil, ErrorCodeShadowVersionConflict
+	}
+	if err := conform(ctx, s.catalogRepo, before, &Device{Color: want.Color, Version: want.Version}); err != nil {
+		return nil, catalogErrorCode(err, ErrorCodeDeviceDBUpdateFail)
+	}
+
+	// the desired config is set only if the shadow didn't change since
+	affect, err := s.deviceRepo.AdvanceShadow(ctx, before.Id, before.ShadowVersion, want)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBUpdateFail)
+	}
+	if affect <= 0 {
+		return nil, ErrorCodeShadowVersionConflict
+	}
+
+	after := *before
+	after.DesiredColor = want.Color
+	after.DesiredVersion = want.Version
+	after.ShadowVersion++
+	s.record(ctx, device.ActionUpdate, before.Id, diff(before, &after))
+
+	re := &Shadow{}
+	re.Assemble(&after)
+	return re, ErrorCodeSuccess
+}
+
+// Acknowledge records that device id applied the delta of its shadow at
+// version, reporting the config it runs now, the delta itself when reported
+// is nil. The reported config goes through the device update path, it must
+// match the catalog and its changes are in the history.
+func (s *deviceService) Acknowledge(ctx context.Context, id string, version int64, reported *ShadowState) (*Shadow, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.Acknowledge")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+
+	before, code := s.get(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	if version != before.ShadowVersion {
+		return nil, ErrorCodeShadowVersionConflict
+	}
+	if reported == nil {
+		shadow := &Shadow{}
+		shadow.Assemble(before)
+		reported = shadow.Delta
+	}
+
+	d := &Device{
+		Id:      id,
+		Color:   strings.TrimSpace(reported.Color),
+		Version: strings.TrimSpace(reported.Version),
+	}
+	if len(d.Color)+len(d.Version) > 0 {
+		if _, err := s.update(ctx, d); err != nil {
+			return nil, catalogErrorCode(err, ErrorCodeDeviceDBUpdateFail)
+		}
+	}
+
+	// a desired config set meanwhile keeps the version, the device fetches
+	// the new delta. The reported config is stored even so, it is what the
+	// device runs.
+	affect, err := s.deviceRepo.AdvanceShadow(ctx, before.Id, version, nil)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBUpdateFail)
+	}
+	if affect <= 0 {
+		return nil, ErrorCodeShadowVersionConflict
+	}
+
+	after, code := s.get(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	re := &Shadow{}
+	re.Assemble(after)
+	return re, ErrorCodeSuccess
+}
+
+// get returns device id, ErrorCodeNotFound when there is none
+func (s *deviceService) get(ctx context.Context, id string) (*device.Device, ErrorCode) {
+	d, err := s.deviceRepo.Get(ctx, device.UUID(id))
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrorCodeNotFound
+		}
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBFindFail)
+	}
+	return d, ErrorCodeSuccess
+}
@@ -0,0 +1,197 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/daos"
+	"github/demo/service"
+)
+
+func TestDeviceService_Shadow(t *testing.T) {
+	cr := daos.NewMemoryCatalogRepo()
+	hr := daos.NewMemoryHistoryRepo()
+	s := service.NewDeviceService(daos.NewMemoryDeviceRepo(), hr, cr, nil)
+	ctx := context.Background()
+
+	service.NewCatalogService(cr, nil).Create(ctx, &service.Model{Name: "Pro", Colors: []string{"White", "Black"}, Versions: []string{"v1.2", "v1.3"}})
+	created, code := s.Register(ctx, &service.Device{Model: "Pro", Color: "White", Version: "v1.2"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	id := created.Id
+
+	shadow, code := s.Shadow(ctx, id)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, &service.Shadow{
+		Id:       id,
+		Desired:  &service.ShadowState{},
+		Reported: &service.ShadowState{Color: "White", Version: "v1.2"},
+		Delta:    &service.ShadowState{},
+	}, shadow)
+
+	tt := []struct {
+		description    string
+		id             string
+		desired        *service.ShadowState
+		version        int64
+		expectedCode   service.ErrorCode
+		expectedShadow *service.Shadow
+	}{
+		{
+			description:  "input invalid uuid",
+			id:           "1234",
+			desired:      &service.ShadowState{Version: "v1.3"},
+			version:      service.AnyVersion,
+			expectedCode: service.ErrorCodeParseUUIDFail,
+		},
+		{
+			description:  "not found",
+			id:           "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60",
+			desired:      &service.ShadowState{Version: "v1.3"},
+			version:      service.AnyVersion,
+			expectedCode: service.ErrorCodeNotFound,
+		},
+		{
+			description:  "not in catalog",
+			id:           id,
+			desired:      &service.ShadowState{Version: "v9.9"},
+			version:      service.AnyVersion,
+			expectedCode: service.ErrorCodeDeviceNotInCatalog,
+		},
+		{
+			description:  "stale version",
+			id:           id,
+			desired:      &service.ShadowState{Version: "v1.3"},
+			version:      3,
+			expectedCode: service.ErrorCodeShadowVersionConflict,
+		},
+		{
+			description:  "desire",
+			id:           id,
+			desired:      &service.ShadowState{Color: " Black ", Version: "v1.3"},
+			version:      0,
+			expectedCode: service.ErrorCodeSuccess,
+			expectedShadow: &service.Shadow{
+				Id:       id,
+				Desired:  &service.ShadowState{Color: "Black", Version: "v1.3"},
+				Reported: &service.ShadowState{Color: "White", Version: "v1.2"},
+				Delta:    &service.ShadowState{Color: "Black", Version: "v1.3"},
+				Version:  1,
+			},
+		},
+		{
+			description:  "desire the reported color",
+			id:           id,
+			desired:      &service.ShadowState{Color: "White", Version: "v1.3"},
+			version:      service.AnyVersion,
+			expectedCode: service.ErrorCodeSuccess,
+			expectedShadow: &service.Shadow{
+				Id:       id,
+				Desired:  &service.ShadowState{Color: "White", Version: "v1.3"},
+				Reported: &service.ShadowState{Color: "White", Version: "v1.2"},
+				Delta:    &service.ShadowState{Version: "v1.3"},
+				Version:  2,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			shadow, code := s.SetDesired(ctx, tc.id, tc.desired, tc.version)
+			assert.Equal(t, tc.expectedCode, code)
+			assert.Equal(t, tc.expectedShadow, shadow)
+		})
+	}
+
+	// the desired config is in the history
+	history, code := s.History(ctx, id, &service.Page{Page: 1, Number: 10})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Len(t, history, 3)
+	assert.Equal(t, &service.Change{Before: "", After: "Black"}, history[1].Changes["desired.color"])
+}
+
+func TestDeviceService_Acknowledge(t *testing.T) {
+	cr := daos.NewMemoryCatalogRepo()
+	s := service.NewDeviceService(daos.NewMemoryDeviceRepo(), daos.NewMemoryHistoryRepo(), cr, nil)
+	ctx := context.Background()
+
+	service.NewCatalogService(cr, nil).Create(ctx, &service.Model{Name: "Pro", Colors: []string{"White", "Black"}, Versions: []string{"v1.2", "v1.3"}})
+	created, code := s.Register(ctx, &service.Device{Model: "Pro", Color: "White", Version: "v1.2"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	id := created.Id
+	_, code = s.SetDesired(ctx, id, &service.ShadowState{Color: "Black", Version: "v1.3"}, service.AnyVersion)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	tt := []struct {
+		description    string
+		id             string
+		version        int64
+		reported       *service.ShadowState
+		expectedCode   service.ErrorCode
+		expectedShadow *service.Shadow
+	}{
+		{
+			description:  "input invalid uuid",
+			id:           "1234",
+			version:      1,
+			expectedCode: service.ErrorCodeParseUUIDFail,
+		},
+		{
+			description:  "stale version",
+			id:           id,
+			version:      0,
+			expectedCode: service.ErrorCodeShadowVersionConflict,
+		},
+		{
+			description:  "reported not in catalog",
+			id:           id,
+			version:      1,
+			reported:     &service.ShadowState{Version: "v9.9"},
+			expectedCode: service.ErrorCodeDeviceNotInCatalog,
+		},
+		{
+			description:  "report part of the delta",
+			id:           id,
+			version:      1,
+			reported:     &service.ShadowState{Version: "v1.3"},
+			expectedCode: service.ErrorCodeSuccess,
+			expectedShadow: &service.Shadow{
+				Id:       id,
+				Desired:  &service.ShadowState{Color: "Black", Version: "v1.3"},
+				Reported: &service.ShadowState{Color: "White", Version: "v1.3"},
+				Delta:    &service.ShadowState{Color: "Black"},
+				Version:  2,
+			},
+		},
+		{
+			description:  "apply the delta",
+			id:           id,
+			version:      2,
+			expectedCode: service.ErrorCodeSuccess,
+			expectedShadow: &service.Shadow{
+				Id:       id,
+				Desired:  &service.ShadowState{Color: "Black", Version: "v1.3"},
+				Reported: &service.ShadowState{Color: "Black", Version: "v1.3"},
+				Delta:    &service.ShadowState{},
+				Version:  3,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			shadow, code := s.Acknowledge(ctx, tc.id, tc.version, tc.reported)
+			assert.Equal(t, tc.expectedCode, code)
+			assert.Equal(t, tc.expectedShadow, shadow)
+		})
+	}
+
+	// the reported config is the device
+	found, code := s.Find(ctx, &service.Device{Model: "Pro"}, &service.Page{Page: 1, Number: 10})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "Black", found[0].Color)
+		assert.Equal(t, "v1.3", found[0].Version)
+	}
+}
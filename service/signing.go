@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github/demo/model/firmware"
+	"github/demo/utils/artifact"
+	"github/demo/utils/audit"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+)
+
+// SigningKey is the public half of a key signing the releases
+type SigningKey struct {
+	Id string `json:"id"`
+	// PublicKey is the Ed25519 public key, in base64
+	PublicKey  string `json:"public_key"`
+	Status     string `json:"status"`
+	CreateTime int64  `json:"create_time"`
+	RetireTime int64  `json:"retire_time"`
+}
+
+func (k *SigningKey) Assemble(x *firmware.Key) {
+	k.Id = x.Id
+	k.PublicKey = x.PublicKey
+	k.Status = x.Status
+	k.CreateTime = x.CreateTime
+	k.RetireTime = x.RetireTime
+}
+
+// Verification is the result of checking the artifact of a release against
+// its digest and signature. Reason is why it isn't Valid.
+type Verification struct {
+	ReleaseId string `json:"release_id"`
+	KeyId     string `json:"key_id"`
+	Checksum  string `json:"checksum"`
+	// Digest is the SHA-256 digest of the stored artifact, in hex
+	Digest    string `json:"digest"`
+	Signature string `json:"signature"`
+	Valid     bool   `json:"valid"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Keys returns the signing keys, newest first, the retired ones included
+func (s *firmwareService) Keys(ctx context.Context) ([]*SigningKey, ErrorCode) {
+	ctx, span := trace.Start(ctx, "firmwareService.Keys")
+	defer span.Finish()
+
+	rows, err := s.keyRepo.Find(ctx)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+	keys := make([]*SigningKey, 0, len(rows))
+	for _, v := range rows {
+		re := &SigningKey{}
+		re.Assemble(v)
+		keys = append(keys, re)
+	}
+	return keys, ErrorCodeSuccess
+}
+
+// RotateKey makes a new key sign the releases from now on. The key before is
+// retired, it still verifies the releases it signed.
+func (s *firmwareService) RotateKey(ctx context.Context) (*SigningKey, ErrorCode) {
+	ctx, span := trace.Start(ctx, "firmwareService.RotateKey")
+	defer span.Finish()
+
+	k, code := s.rotateKey(ctx)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	log.WithContext(ctx).Infof("firmware signing key rotated to %s by %s", k.Id, audit.Actor(ctx))
+
+	re := &SigningKey{}
+	re.Assemble(k)
+	return re, ErrorCodeSuccess
+}
+
+// VerifyRelease reads the artifact of release id back and checks it against
+// the digest and the signature of the release
+func (s *firmwareService) VerifyRelease(ctx context.Context, id string) (*Verification, ErrorCode) {
+	ctx, span := trace.Start(ctx, "firmwareService.VerifyRelease")
+	defer span.Finish()
+
+	release, code := s.release(ctx, id)
+	if code != ErrorCodeSuccess {
+		return nil, code
+	}
+	v := &Verification{
+		ReleaseId: release.Id.String(),
+		KeyId:     release.KeyId,
+		Checksum:  release.Checksum,
+		Signature: release.Signature,
+	}
+
+	r, _, err := s.artifacts.Open(ctx, release.Id.String())
+	if err == artifact.ErrNotFound {
+		v.Reason = "artifact missing"
+		return v, ErrorCodeSuccess
+	}
+	if err != nil {
+		log.WithContext(ctx).Errorf("firmware release %s artifact fail => %+v", release.Id, err)
+		return nil, contextErrorCode(err, ErrorCodeArtifactFail)
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, r)
+	r.Close()
+	if err != nil {
+		log.WithContext(ctx).Errorf("firmware release %s artifact fail => %+v", release.Id, err)
+		return nil, contextErrorCode(err, ErrorCodeArtifactFail)
+	}
+	v.Digest = hex.EncodeToString(h.Sum(nil))
+	if v.Digest != release.Checksum {
+		v.Reason = "artifact digest mismatch"
+		return v, ErrorCodeSuccess
+	}
+
+	if len(release.Signature) == 0 {
+		v.Reason = "release not signed"
+		return v, ErrorCodeSuccess
+	}
+	k, err := s.keyRepo.Get(ctx, release.KeyId)
+	if gorm.IsRecordNotFoundError(err) {
+		v.Reason = fmt.Sprintf("signing key %s unknown", release.KeyId)
+		return v, ErrorCodeSuccess
+	}
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+	public, err1 := base64.StdEncoding.DecodeString(k.PublicKey)
+	signature, err2 := base64.StdEncoding.DecodeString(release.Signature)
+	if err1 != nil || err2 != nil || len(public) != ed25519.PublicKeySize ||
+		!ed25519.Verify(public, release.SignedMessage(), signature) {
+		v.Reason = "signature invalid"
+		return v, ErrorCodeSuccess
+	}
+
+	v.Valid = true
+	return v, ErrorCodeSuccess
+}
+
+// sign signs release with the active key, the first key is made on the first
+// release signed. Without a key-encryption key release is left unsigned.
+func (s *firmwareService) sign(ctx context.Context, release *firmware.Release) ErrorCode {
+	if s.kek == nil {
+		log.WithContext(ctx).Warnf("firmware release %s not signed, no key-encryption key is set", release.Id)
+		return ErrorCodeSuccess
+	}
+	k, err := s.keyRepo.Active(ctx)
+	if gorm.IsRecordNotFoundError(err) {
+		var code ErrorCode
+		if k, code = s.rotateKey(ctx); code != ErrorCodeSuccess {
+			return code
+		}
+		log.WithContext(ctx).Infof("firmware signing key %s made", k.Id)
+	} else if err != nil {
+		return contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+
+	private, err := s.kek.Unwrap(k.Id, k.WrappedKey)
+	if err != nil || len(private) != ed25519.PrivateKeySize {
+		log.WithContext(ctx).Errorf("firmware signing key %s invalid, or wrapped by another key-encryption key", k.Id)
+		return ErrorCodeSigningFail
+	}
+	release.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(private, release.SignedMessage()))
+	release.KeyId = k.Id
+	return ErrorCodeSuccess
+}
+
+// rotateKey makes a new key and stores it as the active one, its private key
+// wrapped by the key-encryption key
+func (s *firmwareService) rotateKey(ctx context.Context) (*firmware.Key, ErrorCode) {
+	if s.kek == nil {
+		log.WithContext(ctx).Error("firmware signing needs a key-encryption key, none is set")
+		return nil, ErrorCodeSigningFail
+	}
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		log.WithContext(ctx).Errorf("firmware signing key generate fail => %+v", err)
+		return nil, ErrorCodeSigningFail
+	}
+	// the new key must sort before the one it retires, even when both are
+	// made within the same millisecond
+	now := millis(time.Now())
+	active, err := s.keyRepo.Active(ctx)
+	switch {
+	case err == nil && active.CreateTime >= now:
+		now = active.CreateTime + 1
+	case err != nil && !gorm.IsRecordNotFoundError(err):
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBFindFail)
+	}
+
+	digest := sha256.Sum256(public)
+	id := hex.EncodeToString(digest[:8])
+	wrapped, err := s.kek.Wrap(id, private)
+	if err != nil {
+		log.WithContext(ctx).Errorf("firmware signing key wrap fail => %+v", err)
+		return nil, ErrorCodeSigningFail
+	}
+	k := &firmware.Key{
+		Id:         id,
+		PublicKey:  base64.StdEncoding.EncodeToString(public),
+		WrappedKey: wrapped,
+		Status:     firmware.KeyActive,
+		CreateTime: now,
+	}
+	if err := s.keyRepo.Rotate(ctx, k); err != nil {
+		return nil, contextErrorCode(err, ErrorCodeFirmwareDBCreateFail)
+	}
+	return k, ErrorCodeSuccess
+}
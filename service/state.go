@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github/demo/model/device"
+	"github/demo/utils/trace"
+)
+
+// Transition applies the lifecycle transition action to device id, see
+// device.Transitions, and records it in the history
+func (s *deviceService) Transition(ctx context.Context, id string, action string) (*Device, ErrorCode) {
+	ctx, span := trace.Start(ctx, "deviceService.Transition")
+	defer span.Finish()
+	span.SetAttribute("device.transition", action)
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	t, ok := device.Transitions[action]
+	if !ok {
+		return nil, ErrorCodeBadRequest
+	}
+
+	before, err := s.deviceRepo.Get(ctx, device.UUID(id))
+	if err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrorCodeNotFound
+		}
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBFindFail)
+	}
+	if !t.Allows(before.State) {
+		return nil, ErrorCodeStateTransitionInvalid
+	}
+
+	// the state is set only if no other transition moved the device since
+	affect, err := s.deviceRepo.SetState(ctx, before.Id, []string{before.State}, t.To)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBUpdateFail)
+	}
+	if affect <= 0 {
+		return nil, ErrorCodeStateTransitionInvalid
+	}
+
+	after, err := s.deviceRepo.Get(ctx, before.Id)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeDeviceDBFindFail)
+	}
+	s.record(ctx, action, before.Id, diff(before, after))
+
+	re := &Device{}
+	re.Assemble(after)
+	re.Status = s.liveness.Status(after.LastSeen, time.Now())
+	return re, ErrorCodeSuccess
+}
@@ -0,0 +1,108 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/daos"
+	"github/demo/model/device"
+	"github/demo/service"
+)
+
+func TestDeviceService_Transition(t *testing.T) {
+	s := service.NewDeviceService(daos.NewMemoryDeviceRepo(), daos.NewMemoryHistoryRepo(), nil, nil)
+	ctx := context.Background()
+
+	created, code := s.Register(ctx, &service.Device{Model: "Pro", Color: "White", Version: "v1.2"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	tt := []struct {
+		description   string
+		id            string
+		action        string
+		expectedCode  service.ErrorCode
+		expectedState string
+	}{
+		{
+			description:  "input invalid uuid",
+			id:           "1234",
+			action:       device.ActionActivate,
+			expectedCode: service.ErrorCodeParseUUIDFail,
+		},
+		{
+			description:  "input unknown action",
+			id:           created.Id,
+			action:       "reboot",
+			expectedCode: service.ErrorCodeBadRequest,
+		},
+		{
+			description:  "not found",
+			id:           "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60",
+			action:       device.ActionActivate,
+			expectedCode: service.ErrorCodeNotFound,
+		},
+		{
+			description:  "suspend a provisioned device",
+			id:           created.Id,
+			action:       device.ActionSuspend,
+			expectedCode: service.ErrorCodeStateTransitionInvalid,
+		},
+		{
+			description:   "activate",
+			id:            created.Id,
+			action:        device.ActionActivate,
+			expectedCode:  service.ErrorCodeSuccess,
+			expectedState: device.StateActive,
+		},
+		{
+			description:   "suspend",
+			id:            created.Id,
+			action:        device.ActionSuspend,
+			expectedCode:  service.ErrorCodeSuccess,
+			expectedState: device.StateSuspended,
+		},
+		{
+			description:   "reactivate",
+			id:            created.Id,
+			action:        device.ActionActivate,
+			expectedCode:  service.ErrorCodeSuccess,
+			expectedState: device.StateActive,
+		},
+		{
+			description:   "decommission",
+			id:            created.Id,
+			action:        device.ActionDecommission,
+			expectedCode:  service.ErrorCodeSuccess,
+			expectedState: device.StateDecommissioned,
+		},
+		{
+			description:  "activate a decommissioned device",
+			id:           created.Id,
+			action:       device.ActionActivate,
+			expectedCode: service.ErrorCodeStateTransitionInvalid,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			actual, code := s.Transition(ctx, tc.id, tc.action)
+			assert.Equal(t, tc.expectedCode, code)
+			if tc.expectedCode == service.ErrorCodeSuccess {
+				assert.Equal(t, tc.expectedState, actual.State)
+			}
+		})
+	}
+
+	history, code := s.History(ctx, created.Id, &service.Page{})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	var actions []string
+	for _, h := range history {
+		actions = append(actions, h.Action)
+	}
+	assert.Equal(t, []string{"decommission", "activate", "suspend", "activate", "create"}, actions)
+	assert.Equal(t, map[string]*service.Change{
+		"state": {Before: device.StateActive, After: device.StateDecommissioned},
+	}, history[0].Changes)
+}
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jinzhu/gorm"
+
+	"github/demo/model/device"
+	"github/demo/model/telemetry"
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+)
+
+// Retention is how long the telemetry is kept, the raw points and the
+// rollups of a minute and of an hour
+type Retention struct {
+	Raw    time.Duration
+	Minute time.Duration
+	Hour   time.Duration
+}
+
+// DefaultRetention is the retention of a telemetry service given none
+var DefaultRetention = Retention{
+	Raw:    7 * 24 * time.Hour,
+	Minute: 30 * 24 * time.Hour,
+	Hour:   365 * 24 * time.Hour,
+}
+
+const (
+	// maximum number of points of a batch
+	maxTelemetryBatch = 1000
+	// maximum number of buckets of a series
+	maxSeriesBuckets = 10000
+	// how far ahead of the clock of the service a point may be
+	telemetrySkew = 5 * time.Minute
+	// range of a series without from
+	seriesRange = time.Hour
+)
+
+// TelemetryPoint is one value of a metric reported by a device
+type TelemetryPoint struct {
+	Metric string `json:"metric"`
+	// Time in milliseconds, the time the point is received when 0
+	Time  int64   `json:"time"`
+	Value float64 `json:"value"`
+}
+
+// TelemetryResult is the outcome of a batch of points. A point stored before
+// is neither stored nor dropped.
+type TelemetryResult struct {
+	Stored int64 `json:"stored"`
+	// Dropped counts the points older than the retention of the raw points,
+	// or ahead of the clock
+	Dropped int `json:"dropped"`
+}
+
+// SeriesQuery selects the points of Metric in [From, To), in milliseconds,
+// summed up in buckets of Step milliseconds
+type SeriesQuery struct {
+	Metric string
+	From   int64
+	To     int64
+	Step   int64
+}
+
+// Series is a metric of a device summed up in buckets
+type Series struct {
+	Metric string `json:"metric"`
+	From   int64  `json:"from"`
+	To     int64  `json:"to"`
+	Step   int64  `json:"step"`
+	// Points holds the buckets with points, by time
+	Points []*SeriesPoint `json:"points"`
+}
+
+// SeriesPoint sums up the points of a bucket starting at Time
+type SeriesPoint struct {
+	Time  int64   `json:"time"`
+	Count int64   `json:"count"`
+	Avg   float64 `json:"avg"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Sum   float64 `json:"sum"`
+}
+
+func (p *SeriesPoint) Assemble(b *telemetry.Bucket) {
+	p.Time = b.Time
+	p.Count = b.Count
+	p.Min = b.Min
+	p.Max = b.Max
+	p.Sum = b.Sum
+	p.Avg = 0
+	if b.Count > 0 {
+		p.Avg = b.Sum / float64(b.Count)
+	}
+}
+
+// source is where a series is read from, the raw points when step is 0
+type source struct {
+	step      int64
+	retention time.Duration
+}
+
+type telemetryService struct {
+	telemetryRepo telemetry.Repository
+	deviceRepo    device.Repository
+	retention     *Retention
+}
+
+// Ingest stores the points of device id and updates their rollups. The points
+// are checked first, one invalid point rejects the batch.
+func (s *telemetryService) Ingest(ctx context.Context, id string, points []*TelemetryPoint) (*TelemetryResult, ErrorCode) {
+	ctx, span := trace.Start(ctx, "telemetryService.Ingest")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	if len(points) == 0 || len(points) > maxTelemetryBatch {
+		return nil, ErrorCodeTelemetryInvalid
+	}
+	for _, p := range points {
+		if p == nil {
+			return nil, ErrorCodeTelemetryInvalid
+		}
+		if err := telemetry.ValidateMetric(p.Metric); err != nil {
+			log.WithContext(ctx).Warnf("device %s telemetry => %v", id, err)
+			return nil, ErrorCodeTelemetryInvalid
+		}
+		if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) || p.Time < 0 {
+			return nil, ErrorCodeTelemetryInvalid
+		}
+	}
+	if code := s.exists(ctx, id); code != ErrorCodeSuccess {
+		return nil, code
+	}
+
+	now := time.Now()
+	oldest := millis(now.Add(-s.retention.Raw))
+	newest := millis(now.Add(telemetrySkew))
+
+	result := &TelemetryResult{}
+	stored := make([]*telemetry.Point, 0, len(points))
+	metrics := make(map[string]bool)
+	var from, to int64
+	for _, p := range points {
+		t := p.Time
+		if t == 0 {
+			t = millis(now)
+		}
+		if t < oldest || t > newest {
+			result.Dropped++
+			continue
+		}
+		if len(stored) == 0 || t < from {
+			from = t
+		}
+		if len(stored) == 0 || t > to {
+			to = t
+		}
+		metrics[p.Metric] = true
+		stored = append(stored, &telemetry.Point{
+			DeviceId: device.UUID(id),
+			Metric:   p.Metric,
+			Time:     t,
+			Value:    p.Value,
+		})
+	}
+	if len(stored) == 0 {
+		return result, ErrorCodeSuccess
+	}
+
+	n, err := s.telemetryRepo.Append(ctx, stored)
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeTelemetryDBAppendFail)
+	}
+	result.Stored = n
+
+	// the buckets of the batch are rolled up again, the minutes from the
+	// points and the hours from the minutes. A batch sent again after a
+	// failure here rolls them up anew.
+	names := make([]string, 0, len(metrics))
+	for m := range metrics {
+		names = append(names, m)
+	}
+	err = s.telemetryRepo.Rollup(ctx, device.UUID(id), names, 0, telemetry.Minute,
+		floor(from, telemetry.Minute), floor(to, telemetry.Minute)+telemetry.Minute)
+	if err == nil {
+		err = s.telemetryRepo.Rollup(ctx, device.UUID(id), names, telemetry.Minute, telemetry.Hour,
+			floor(from, telemetry.Hour), floor(to, telemetry.Hour)+telemetry.Hour)
+	}
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeTelemetryDBAppendFail)
+	}
+	return result, ErrorCodeSuccess
+}
+
+// Series returns a metric of device id summed up in buckets. It is read from
+// the coarsest rollups fitting the step and still kept at q.From, the step is
+// rounded up to the resolution of the source when none fits.
+func (s *telemetryService) Series(ctx context.Context, id string, q *SeriesQuery) (*Series, ErrorCode) {
+	ctx, span := trace.Start(ctx, "telemetryService.Series")
+	defer span.Finish()
+
+	if uuid.FromStringOrNil(id) == uuid.Nil {
+		return nil, ErrorCodeParseUUIDFail
+	}
+	if q == nil || telemetry.ValidateMetric(q.Metric) != nil || q.From < 0 || q.Step < 0 {
+		return nil, ErrorCodeTelemetryQueryInvalid
+	}
+
+	now := time.Now()
+	to := q.To
+	if to == 0 {
+		to = millis(now)
+	}
+	from := q.From
+	if from == 0 {
+		from = to - int64(seriesRange/time.Millisecond)
+	}
+	step := q.Step
+	if step == 0 {
+		step = telemetry.Minute
+		if to-from > 24*telemetry.Hour {
+			step = telemetry.Hour
+		}
+	}
+	if from >= to {
+		return nil, ErrorCodeTelemetryQueryInvalid
+	}
+
+	src := s.source(step, from, now)
+	if src.step > 0 && step%src.step != 0 {
+		step += src.step - step%src.step
+	}
+	from = floor(from, step)
+	if (to-from+step-1)/step > maxSeriesBuckets {
+		return nil, ErrorCodeTelemetryQueryInvalid
+	}
+	if code := s.exists(ctx, id); code != ErrorCodeSuccess {
+		return nil, code
+	}
+
+	buckets, err := s.telemetryRepo.Series(ctx, &telemetry.Query{
+		DeviceId: device.UUID(id),
+		Metric:   q.Metric,
+		From:     from,
+		To:       to,
+		Step:     step,
+		Source:   src.step,
+	})
+	if err != nil {
+		return nil, contextErrorCode(err, ErrorCodeTelemetryDBFindFail)
+	}
+
+	series := &Series{
+		Metric: q.Metric,
+		From:   from,
+		To:     to,
+		Step:   step,
+		Points: make([]*SeriesPoint, 0, len(buckets)),
+	}
+	for _, b := range buckets {
+		p := &SeriesPoint{}
+		p.Assemble(b)
+		series.Points = append(series.Points, p)
+	}
+	return series, ErrorCodeSuccess
+}
+
+// source returns where a series of step from from is read. The hourly
+// rollups are kept the longest, they are the last resort.
+func (s *telemetryService) source(step, from int64, now time.Time) source {
+	sources := []source{
+		{step: telemetry.Hour, retention: s.retention.Hour},
+		{step: telemetry.Minute, retention: s.retention.Minute},
+		{step: 0, retention: s.retention.Raw},
+	}
+	kept := func(src source) bool {
+		return from >= millis(now.Add(-src.retention))
+	}
+
+	for _, src := range sources {
+		if (src.step == 0 || step%src.step == 0) && kept(src) {
+			return src
+		}
+	}
+	for i := len(sources) - 1; i >= 0; i-- {
+		if kept(sources[i]) {
+			return sources[i]
+		}
+	}
+	return sources[0]
+}
+
+// Purge deletes the telemetry past its retention and returns how many points
+// and buckets were deleted
+func (s *telemetryService) Purge(ctx context.Context) (int64, ErrorCode) {
+	ctx, span := trace.Start(ctx, "telemetryService.Purge")
+	defer span.Finish()
+
+	now := time.Now()
+	var deleted int64
+	for _, src := range []source{
+		{step: 0, retention: s.retention.Raw},
+		{step: telemetry.Minute, retention: s.retention.Minute},
+		{step: telemetry.Hour, retention: s.retention.Hour},
+	} {
+		n, err := s.telemetryRepo.Purge(ctx, src.step, millis(now.Add(-src.retention)))
+		if err != nil {
+			return deleted, contextErrorCode(err, ErrorCodeTelemetryDBPurgeFail)
+		}
+		deleted += n
+	}
+	return deleted, ErrorCodeSuccess
+}
+
+// exists returns ErrorCodeNotFound when there is no device id
+func (s *telemetryService) exists(ctx context.Context, id string) ErrorCode {
+	if _, err := s.deviceRepo.Get(ctx, device.UUID(id)); err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return ErrorCodeNotFound
+		}
+		return contextErrorCode(err, ErrorCodeDeviceDBFindFail)
+	}
+	return ErrorCodeSuccess
+}
+
+// millis returns t in milliseconds
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// floor rounds t down to a multiple of step
+func floor(t, step int64) int64 {
+	return t - t%step
+}
+
+// NewTelemetryService returns the telemetry service, a nil r keeps the
+// telemetry for DefaultRetention
+func NewTelemetryService(tr telemetry.Repository, dr device.Repository, r *Retention) ITelemetryService {
+	if r == nil {
+		r = &DefaultRetention
+	}
+	return &telemetryService{
+		telemetryRepo: tr,
+		deviceRepo:    dr,
+		retention:     r,
+	}
+}
@@ -0,0 +1,244 @@
+package service_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/daos"
+	"github/demo/model/device"
+	"github/demo/model/telemetry"
+	"github/demo/service"
+)
+
+// newTelemetryService returns a telemetry service keeping the raw points an
+// hour, with a registered device, and the start of a minute half an hour ago
+func newTelemetryService(t *testing.T) (service.ITelemetryService, telemetry.Repository, string, int64) {
+	dr := daos.NewMemoryDeviceRepo()
+	created, code := service.NewDeviceService(dr, daos.NewMemoryHistoryRepo(), nil, nil).
+		Register(context.Background(), &service.Device{Model: "Pro", Color: "White", Version: "v1.2"})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+
+	tr := daos.NewMemoryTelemetryRepo()
+	s := service.NewTelemetryService(tr, dr, &service.Retention{Raw: time.Hour, Minute: 24 * time.Hour, Hour: 48 * time.Hour})
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	base := now - 30*telemetry.Minute
+	base -= base % telemetry.Minute
+	// the minutes of the tests stay in one hour
+	if base%telemetry.Hour > telemetry.Hour-2*telemetry.Minute {
+		base -= 2 * telemetry.Minute
+	}
+	return s, tr, created.Id, base
+}
+
+func TestTelemetryService_Ingest(t *testing.T) {
+	s, _, id, base := newTelemetryService(t)
+	ctx := context.Background()
+
+	tt := []struct {
+		description    string
+		id             string
+		points         []*service.TelemetryPoint
+		expectedCode   service.ErrorCode
+		expectedResult *service.TelemetryResult
+	}{
+		{
+			description:  "input invalid uuid",
+			id:           "1234",
+			points:       []*service.TelemetryPoint{{Metric: "temperature", Time: base, Value: 20}},
+			expectedCode: service.ErrorCodeParseUUIDFail,
+		},
+		{
+			description:  "empty batch",
+			id:           id,
+			expectedCode: service.ErrorCodeTelemetryInvalid,
+		},
+		{
+			description:  "metric invalid",
+			id:           id,
+			points:       []*service.TelemetryPoint{{Metric: "-temperature", Time: base, Value: 20}},
+			expectedCode: service.ErrorCodeTelemetryInvalid,
+		},
+		{
+			description:  "value not a number",
+			id:           id,
+			points:       []*service.TelemetryPoint{{Metric: "temperature", Time: base, Value: math.NaN()}},
+			expectedCode: service.ErrorCodeTelemetryInvalid,
+		},
+		{
+			description:  "not found",
+			id:           "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60",
+			points:       []*service.TelemetryPoint{{Metric: "temperature", Time: base, Value: 20}},
+			expectedCode: service.ErrorCodeNotFound,
+		},
+		{
+			description: "drop points out of retention",
+			id:          id,
+			points: []*service.TelemetryPoint{
+				{Metric: "temperature", Time: base, Value: 20},
+				{Metric: "temperature", Time: base + 30*1000, Value: 22},
+				{Metric: "temperature", Time: base - 2*telemetry.Hour, Value: 10},
+				{Metric: "temperature", Time: base + 2*telemetry.Hour, Value: 30},
+			},
+			expectedCode:   service.ErrorCodeSuccess,
+			expectedResult: &service.TelemetryResult{Stored: 2, Dropped: 2},
+		},
+		{
+			description: "sent again",
+			id:          id,
+			points: []*service.TelemetryPoint{
+				{Metric: "temperature", Time: base, Value: 20},
+				{Metric: "temperature", Time: base + telemetry.Minute, Value: 21},
+			},
+			expectedCode:   service.ErrorCodeSuccess,
+			expectedResult: &service.TelemetryResult{Stored: 1},
+		},
+		{
+			description:    "time of receipt",
+			id:             id,
+			points:         []*service.TelemetryPoint{{Metric: "battery", Value: 90}},
+			expectedCode:   service.ErrorCodeSuccess,
+			expectedResult: &service.TelemetryResult{Stored: 1},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			result, code := s.Ingest(ctx, tc.id, tc.points)
+			assert.Equal(t, tc.expectedCode, code)
+			assert.Equal(t, tc.expectedResult, result)
+		})
+	}
+}
+
+func TestTelemetryService_Series(t *testing.T) {
+	s, _, id, base := newTelemetryService(t)
+	ctx := context.Background()
+
+	_, code := s.Ingest(ctx, id, []*service.TelemetryPoint{
+		{Metric: "temperature", Time: base, Value: 20},
+		{Metric: "temperature", Time: base + 30*1000, Value: 22},
+		{Metric: "temperature", Time: base + telemetry.Minute, Value: 21},
+	})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	hour := base - base%telemetry.Hour
+
+	tt := []struct {
+		description    string
+		id             string
+		query          *service.SeriesQuery
+		expectedCode   service.ErrorCode
+		expectedSeries *service.Series
+	}{
+		{
+			description:  "input invalid uuid",
+			id:           "1234",
+			query:        &service.SeriesQuery{Metric: "temperature"},
+			expectedCode: service.ErrorCodeParseUUIDFail,
+		},
+		{
+			description:  "metric invalid",
+			id:           id,
+			query:        &service.SeriesQuery{Metric: ""},
+			expectedCode: service.ErrorCodeTelemetryQueryInvalid,
+		},
+		{
+			description:  "from after to",
+			id:           id,
+			query:        &service.SeriesQuery{Metric: "temperature", From: base, To: base - 1},
+			expectedCode: service.ErrorCodeTelemetryQueryInvalid,
+		},
+		{
+			description:  "too many buckets",
+			id:           id,
+			query:        &service.SeriesQuery{Metric: "temperature", From: base, To: base + telemetry.Hour, Step: 100},
+			expectedCode: service.ErrorCodeTelemetryQueryInvalid,
+		},
+		{
+			description:  "not found",
+			id:           "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60",
+			query:        &service.SeriesQuery{Metric: "temperature"},
+			expectedCode: service.ErrorCodeNotFound,
+		},
+		{
+			description:  "raw points",
+			id:           id,
+			query:        &service.SeriesQuery{Metric: "temperature", From: base, To: base + 2*telemetry.Minute, Step: 30 * 1000},
+			expectedCode: service.ErrorCodeSuccess,
+			expectedSeries: &service.Series{
+				Metric: "temperature", From: base, To: base + 2*telemetry.Minute, Step: 30 * 1000,
+				Points: []*service.SeriesPoint{
+					{Time: base, Count: 1, Avg: 20, Min: 20, Max: 20, Sum: 20},
+					{Time: base + 30*1000, Count: 1, Avg: 22, Min: 22, Max: 22, Sum: 22},
+					{Time: base + telemetry.Minute, Count: 1, Avg: 21, Min: 21, Max: 21, Sum: 21},
+				},
+			},
+		},
+		{
+			description:  "step rounded up to the minute rollups",
+			id:           id,
+			query:        &service.SeriesQuery{Metric: "temperature", From: base - 2*telemetry.Hour, To: base + 2*telemetry.Minute, Step: 30 * 1000},
+			expectedCode: service.ErrorCodeSuccess,
+			expectedSeries: &service.Series{
+				Metric: "temperature", From: base - 2*telemetry.Hour, To: base + 2*telemetry.Minute, Step: telemetry.Minute,
+				Points: []*service.SeriesPoint{
+					{Time: base, Count: 2, Avg: 21, Min: 20, Max: 22, Sum: 42},
+					{Time: base + telemetry.Minute, Count: 1, Avg: 21, Min: 21, Max: 21, Sum: 21},
+				},
+			},
+		},
+		{
+			description:  "hour rollups",
+			id:           id,
+			query:        &service.SeriesQuery{Metric: "temperature", From: base, To: hour + telemetry.Hour, Step: telemetry.Hour},
+			expectedCode: service.ErrorCodeSuccess,
+			expectedSeries: &service.Series{
+				Metric: "temperature", From: hour, To: hour + telemetry.Hour, Step: telemetry.Hour,
+				Points: []*service.SeriesPoint{
+					{Time: hour, Count: 3, Avg: 21, Min: 20, Max: 22, Sum: 63},
+				},
+			},
+		},
+		{
+			description:  "other metric",
+			id:           id,
+			query:        &service.SeriesQuery{Metric: "battery", From: base, To: base + telemetry.Hour},
+			expectedCode: service.ErrorCodeSuccess,
+			expectedSeries: &service.Series{
+				Metric: "battery", From: base, To: base + telemetry.Hour, Step: telemetry.Minute,
+				Points: []*service.SeriesPoint{},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			series, code := s.Series(ctx, tc.id, tc.query)
+			assert.Equal(t, tc.expectedCode, code)
+			assert.Equal(t, tc.expectedSeries, series)
+		})
+	}
+}
+
+func TestTelemetryService_Purge(t *testing.T) {
+	s, tr, id, base := newTelemetryService(t)
+	ctx := context.Background()
+
+	_, code := s.Ingest(ctx, id, []*service.TelemetryPoint{{Metric: "temperature", Time: base, Value: 20}})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	// a point stored before the retention was shortened
+	_, err := tr.Append(ctx, []*telemetry.Point{{DeviceId: device.UUID(id), Metric: "temperature", Time: base - 2*telemetry.Hour, Value: 10}})
+	assert.NoError(t, err)
+
+	deleted, code := s.Purge(ctx)
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Equal(t, int64(1), deleted)
+
+	series, code := s.Series(ctx, id, &service.SeriesQuery{Metric: "temperature", From: base, To: base + telemetry.Minute})
+	assert.Equal(t, service.ErrorCodeSuccess, code)
+	assert.Len(t, series.Points, 1)
+}
@@ -0,0 +1,163 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/model"
+	"github/demo/model/catalog"
+)
+
+// CatalogRepoFactory returns an empty catalog repository and the func
+// releasing it
+type CatalogRepoFactory func(t *testing.T) (catalog.Repository, func(t *testing.T))
+
+// CatalogRepository runs the conformance suite of catalog.Repository against
+// the repositories of newRepo, a new one per case
+func CatalogRepository(t *testing.T, newRepo CatalogRepoFactory) {
+	tt := []struct {
+		name string
+		run  func(t *testing.T, newRepo CatalogRepoFactory)
+	}{
+		{name: "CRUD", run: testCatalogCRUD},
+		{name: "Find", run: testCatalogFind},
+		{name: "Context", run: testCatalogContext},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newRepo)
+		})
+	}
+}
+
+// seedCatalog creates the models Pro and Normal
+func seedCatalog(t *testing.T, repo catalog.Repository) {
+	for _, m := range []*catalog.Model{
+		{Name: "Pro", Colors: []string{"White", "Black"}, Versions: []string{"v1.2", "v1.3"}},
+		{Name: "Normal", Colors: []string{"Black"}, Versions: []string{"v1.2"}},
+	} {
+		_, err := repo.Create(context.Background(), m)
+		assert.NoError(t, err)
+	}
+}
+
+func testCatalogCRUD(t *testing.T, newRepo CatalogRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, &catalog.Model{Name: "Pro", Colors: []string{"White", "Black", "White"}, Versions: []string{"v1.2"}})
+	assert.NoError(t, err)
+	assert.NotZero(t, created.CreateTime)
+	assert.Equal(t, []string{"Black", "White"}, created.Colors)
+
+	_, err = repo.Create(ctx, &catalog.Model{Name: "Pro"})
+	assert.Error(t, err)
+
+	m, err := repo.Get(ctx, "Pro")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Black", "White"}, m.Colors)
+	assert.Equal(t, []string{"v1.2"}, m.Versions)
+
+	// the name is compared regardless of case
+	m, err = repo.Get(ctx, "pRO")
+	assert.NoError(t, err)
+	assert.Equal(t, "Pro", m.Name)
+	assert.Equal(t, []string{"Black", "White"}, m.Colors)
+
+	// the options are replaced
+	affect, err := repo.Update(ctx, &catalog.Model{Name: "Pro", Colors: []string{"White", "Red"}, Versions: []string{"v1.2", "v1.3"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affect)
+	m, err = repo.Get(ctx, "Pro")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Red", "White"}, m.Colors)
+	assert.Equal(t, []string{"v1.2", "v1.3"}, m.Versions)
+
+	affect, err = repo.Update(ctx, &catalog.Model{Name: "Pro"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affect)
+	m, err = repo.Get(ctx, "Pro")
+	assert.NoError(t, err)
+	assert.Empty(t, m.Colors)
+	assert.Empty(t, m.Versions)
+
+	affect, err = repo.Update(ctx, &catalog.Model{Name: "Missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), affect)
+
+	affect, err = repo.Delete(ctx, "Pro")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affect)
+	affect, err = repo.Delete(ctx, "Pro")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), affect)
+
+	_, err = repo.Get(ctx, "Pro")
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+
+	// a deleted model takes its options along
+	_, err = repo.Create(ctx, &catalog.Model{Name: "Pro", Versions: []string{"v2.0"}})
+	assert.NoError(t, err)
+	m, err = repo.Get(ctx, "Pro")
+	assert.NoError(t, err)
+	assert.Empty(t, m.Colors)
+	assert.Equal(t, []string{"v2.0"}, m.Versions)
+}
+
+func testCatalogFind(t *testing.T, newRepo CatalogRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	seedCatalog(t, repo)
+
+	models, err := repo.Find(context.Background(), &model.Page{Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, models, 2) {
+		assert.Equal(t, "Normal", models[0].Name)
+		assert.Equal(t, []string{"Black"}, models[0].Colors)
+		assert.Equal(t, "Pro", models[1].Name)
+		assert.Equal(t, []string{"Black", "White"}, models[1].Colors)
+		assert.Equal(t, []string{"v1.2", "v1.3"}, models[1].Versions)
+	}
+
+	models, err = repo.Find(context.Background(), &model.Page{Limit: 1, Offset: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, models, 1) {
+		assert.Equal(t, "Pro", models[0].Name)
+	}
+
+	models, err = repo.Find(context.Background(), &model.Page{Limit: 10, Offset: 2})
+	assert.NoError(t, err)
+	assert.Empty(t, models)
+}
+
+func testCatalogContext(t *testing.T, newRepo CatalogRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	seedCatalog(t, repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.Get(ctx, "Pro")
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Create(ctx, &catalog.Model{Name: "Lite"})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Update(ctx, &catalog.Model{Name: "Pro"})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Delete(ctx, "Normal")
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Find(ctx, &model.Page{Limit: 10})
+	assert.Equal(t, context.Canceled, err)
+
+	// nothing was written
+	m, err := repo.Get(context.Background(), "Pro")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Black", "White"}, m.Colors)
+	_, err = repo.Get(context.Background(), "Normal")
+	assert.NoError(t, err)
+}
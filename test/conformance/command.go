@@ -0,0 +1,288 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/model"
+	"github/demo/model/command"
+	"github/demo/model/device"
+)
+
+// CommandRepoFactory returns an empty command repository and the func
+// releasing it
+type CommandRepoFactory func(t *testing.T) (command.Repository, func(t *testing.T))
+
+// CommandRepository runs the conformance suite of command.Repository against
+// the repositories of newRepo, a new one per case
+func CommandRepository(t *testing.T, newRepo CommandRepoFactory) {
+	tt := []struct {
+		name string
+		run  func(t *testing.T, newRepo CommandRepoFactory)
+	}{
+		{name: "Get", run: testCommandGet},
+		{name: "Next", run: testCommandNext},
+		{name: "SetStatus", run: testCommandSetStatus},
+		{name: "Find", run: testCommandFind},
+		{name: "Expire", run: testCommandExpire},
+		{name: "Purge", run: testCommandPurge},
+		{name: "Context", run: testCommandContext},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newRepo)
+		})
+	}
+}
+
+// Ids of the commands of seedCommands, by create time
+const (
+	command1 device.UUID = "6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0001"
+	command2 device.UUID = "6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0002"
+	command3 device.UUID = "6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0003"
+	command4 device.UUID = "6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0004"
+)
+
+// seedCommands queues three commands for device1, expiring at 1000, 3000 and
+// 3000, and one for device2
+func seedCommands(t *testing.T, repo command.Repository) {
+	for _, c := range []*command.Command{
+		{Id: command1, DeviceId: device1().Id, Name: "reboot", CreateTime: 100, UpdateTime: 100, ExpireTime: 1000},
+		{Id: command2, DeviceId: device1().Id, Name: "config", Payload: `{"interval":60}`, CreateTime: 200, UpdateTime: 200, ExpireTime: 3000},
+		{Id: command3, DeviceId: device1().Id, Name: "reboot", CreateTime: 300, UpdateTime: 300, ExpireTime: 3000},
+		{Id: command4, DeviceId: device2().Id, Name: "reboot", CreateTime: 100, UpdateTime: 100, ExpireTime: 3000},
+	} {
+		c.Status = command.StatusPending
+		_, err := repo.Create(context.Background(), c)
+		assert.NoError(t, err)
+	}
+}
+
+func testCommandGet(t *testing.T, newRepo CommandRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedCommands(t, repo)
+
+	c, err := repo.Get(ctx, command2)
+	assert.NoError(t, err)
+	assert.Equal(t, &command.Command{
+		Id: command2, DeviceId: device1().Id, Name: "config", Payload: `{"interval":60}`, Status: command.StatusPending,
+		CreateTime: 200, UpdateTime: 200, ExpireTime: 3000,
+	}, c)
+
+	_, err = repo.Get(ctx, "6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0009")
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+}
+
+func testCommandNext(t *testing.T, newRepo CommandRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedCommands(t, repo)
+
+	tt := []struct {
+		description string
+		id          device.UUID
+		now         int64
+		expected    device.UUID
+	}{
+		{description: "oldest", id: device1().Id, now: 500, expected: command1},
+		{description: "skip expired", id: device1().Id, now: 1000, expected: command2},
+		{description: "other device", id: device2().Id, now: 500, expected: command4},
+		{description: "all expired", id: device1().Id, now: 3000},
+		{description: "no command", id: device3().Id, now: 500},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			c, err := repo.Next(ctx, tc.id, tc.now)
+			assert.NoError(t, err)
+			if len(tc.expected) == 0 {
+				assert.Nil(t, c)
+				return
+			}
+			if assert.NotNil(t, c) {
+				assert.Equal(t, tc.expected, c.Id)
+			}
+		})
+	}
+
+	// a delivered command is no longer next
+	affect, err := repo.SetStatus(ctx, command1, command.From[command.StatusDelivered], command.StatusDelivered, "", 600)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affect)
+	c, err := repo.Next(ctx, device1().Id, 600)
+	assert.NoError(t, err)
+	if assert.NotNil(t, c) {
+		assert.Equal(t, command2, c.Id)
+	}
+}
+
+func testCommandSetStatus(t *testing.T, newRepo CommandRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedCommands(t, repo)
+
+	tt := []struct {
+		description string
+		id          device.UUID
+		to          string
+		now         int64
+		expected    int64
+	}{
+		{description: "deliver", id: command1, to: command.StatusDelivered, now: 700, expected: 1},
+		{description: "deliver again", id: command1, to: command.StatusDelivered, now: 700, expected: 0},
+		{description: "fail", id: command1, to: command.StatusFailed, now: 700, expected: 1},
+		{description: "succeed a failed command", id: command1, to: command.StatusSucceeded, now: 700, expected: 0},
+		{description: "succeed a pending command", id: command2, to: command.StatusSucceeded, now: 700, expected: 1},
+		{description: "unknown command", id: "6f1c2a3b-0d4e-4f5a-8b6c-7d8e9f0a0009", to: command.StatusDelivered, now: 700, expected: 0},
+		{description: "expired not swept", id: command3, to: command.StatusSucceeded, now: 3000, expected: 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			affect, err := repo.SetStatus(ctx, tc.id, command.From[tc.to], tc.to, tc.description, tc.now)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, affect)
+		})
+	}
+
+	c, err := repo.Get(ctx, command1)
+	assert.NoError(t, err)
+	assert.Equal(t, command.StatusFailed, c.Status)
+	assert.Equal(t, "fail", c.Result)
+	assert.Equal(t, int64(700), c.UpdateTime)
+	c, err = repo.Get(ctx, command3)
+	assert.NoError(t, err)
+	assert.Equal(t, command.StatusPending, c.Status)
+}
+
+func testCommandFind(t *testing.T, newRepo CommandRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedCommands(t, repo)
+	_, err := repo.SetStatus(ctx, command2, command.From[command.StatusSucceeded], command.StatusSucceeded, "", 700)
+	assert.NoError(t, err)
+
+	tt := []struct {
+		description string
+		id          device.UUID
+		status      string
+		page        *model.Page
+		expected    []device.UUID
+	}{
+		{description: "newest first", id: device1().Id, page: &model.Page{Limit: 10}, expected: []device.UUID{command3, command2, command1}},
+		{description: "page", id: device1().Id, page: &model.Page{Limit: 1, Offset: 1}, expected: []device.UUID{command2}},
+		{description: "status", id: device1().Id, status: command.StatusPending, page: &model.Page{Limit: 10}, expected: []device.UUID{command3, command1}},
+		{description: "other device", id: device2().Id, page: &model.Page{Limit: 10}, expected: []device.UUID{command4}},
+		{description: "no command", id: device3().Id, page: &model.Page{Limit: 10}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			found, err := repo.Find(ctx, tc.id, tc.status, tc.page)
+			assert.NoError(t, err)
+			var ids []device.UUID
+			for _, c := range found {
+				ids = append(ids, c.Id)
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+}
+
+func testCommandExpire(t *testing.T, newRepo CommandRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedCommands(t, repo)
+	// a command carried out before it expires stays so
+	_, err := repo.SetStatus(ctx, command2, command.From[command.StatusDelivered], command.StatusDelivered, "", 400)
+	assert.NoError(t, err)
+	_, err = repo.SetStatus(ctx, command3, command.From[command.StatusSucceeded], command.StatusSucceeded, "", 400)
+	assert.NoError(t, err)
+
+	expired, err := repo.Expire(ctx, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), expired)
+	expired, err = repo.Expire(ctx, 3000)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), expired)
+
+	for id, status := range map[device.UUID]string{
+		command1: command.StatusExpired,
+		command2: command.StatusExpired,
+		command3: command.StatusSucceeded,
+		command4: command.StatusExpired,
+	} {
+		c, err := repo.Get(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, status, c.Status, "%s", id)
+	}
+	c, err := repo.Get(ctx, command1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), c.UpdateTime)
+}
+
+func testCommandPurge(t *testing.T, newRepo CommandRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedCommands(t, repo)
+	_, err := repo.SetStatus(ctx, command1, command.From[command.StatusFailed], command.StatusFailed, "", 400)
+	assert.NoError(t, err)
+	_, err = repo.SetStatus(ctx, command2, command.From[command.StatusSucceeded], command.StatusSucceeded, "", 600)
+	assert.NoError(t, err)
+
+	// the open commands are kept whatever their age
+	deleted, err := repo.Purge(ctx, 500)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	_, err = repo.Get(ctx, command1)
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+	for _, id := range []device.UUID{command2, command3, command4} {
+		_, err = repo.Get(ctx, id)
+		assert.NoError(t, err)
+	}
+}
+
+func testCommandContext(t *testing.T, newRepo CommandRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.Create(ctx, &command.Command{Id: command1, DeviceId: device1().Id, Name: "reboot", Status: command.StatusPending, ExpireTime: 1000})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Get(ctx, command1)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Next(ctx, device1().Id, 0)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.SetStatus(ctx, command1, command.From[command.StatusDelivered], command.StatusDelivered, "", 0)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Find(ctx, device1().Id, "", &model.Page{Limit: 10})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Expire(ctx, 0)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Purge(ctx, 0)
+	assert.Equal(t, context.Canceled, err)
+
+	// nothing was written
+	_, err = repo.Get(context.Background(), command1)
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+}
@@ -0,0 +1,729 @@
+// Package conformance holds the behaviour every implementation of a
+// repository has to share, so SQLite, Postgres and in-memory backends are
+// proven to behave the same.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/model"
+	"github/demo/model/device"
+)
+
+// DeviceRepoFactory returns an empty repository holding devices, stored as
+// they are, and the func releasing it
+type DeviceRepoFactory func(t *testing.T, devices ...*device.Device) (device.Repository, func(t *testing.T))
+
+// DeviceRepository runs the conformance suite of device.Repository against
+// the repositories of newRepo, a new one per case
+func DeviceRepository(t *testing.T, newRepo DeviceRepoFactory) {
+	tt := []struct {
+		name string
+		run  func(t *testing.T, newRepo DeviceRepoFactory)
+	}{
+		{name: "Get", run: testGet},
+		{name: "Create", run: testCreate},
+		{name: "Update", run: testUpdate},
+		{name: "Delete", run: testDelete},
+		{name: "List", run: testList},
+		{name: "Find", run: testFind},
+		{name: "Iterate", run: testIterate},
+		{name: "Count", run: testCount},
+		{name: "Labels", run: testLabels},
+		{name: "Selector", run: testSelector},
+		{name: "Members", run: testMembers},
+		{name: "State", run: testState},
+		{name: "Heartbeat", run: testHeartbeat},
+		{name: "Shadow", run: testShadow},
+		{name: "Context", run: testContext},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newRepo)
+		})
+	}
+}
+
+func device1() *device.Device {
+	return &device.Device{
+		Id:      "c9d7c314-fd95-448a-8db9-4756cc774f7d",
+		Model:   "Pro",
+		Color:   "White",
+		Version: "v1.2",
+	}
+}
+
+func device2() *device.Device {
+	return &device.Device{
+		Id:      "99f970f5-b876-4c94-9190-34ee11d54edb",
+		Model:   "Normal",
+		Color:   "Black",
+		Version: "v1.2",
+	}
+}
+
+func device3() *device.Device {
+	return &device.Device{
+		Id:      "5a4f0f1e-3a0d-4f4f-9c1a-1b2c3d4e5f60",
+		Model:   "Pro",
+		Color:   "Black",
+		Version: "v1.5",
+	}
+}
+
+func testGet(t *testing.T, newRepo DeviceRepoFactory) {
+	repo, teardown := newRepo(t, device1())
+	defer teardown(t)
+
+	d, err := repo.Get(context.Background(), device1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, device1(), d)
+
+	_, err = repo.Get(context.Background(), device2().Id)
+	assert.True(t, gorm.IsRecordNotFoundError(err), "record not found was expected, got %v", err)
+}
+
+func testCreate(t *testing.T, newRepo DeviceRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+
+	d, err := repo.Create(context.Background(), device1())
+	assert.NoError(t, err)
+	if assert.NotNil(t, d) {
+		assert.NotZero(t, d.CreateTime)
+		assert.Equal(t, device.StateProvisioned, d.State)
+	}
+
+	x, err := repo.Get(context.Background(), device1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, d, x)
+
+	_, err = repo.Create(context.Background(), device1())
+	assert.Error(t, err, "a duplicate id must be refused")
+}
+
+func testUpdate(t *testing.T, newRepo DeviceRepoFactory) {
+	tt := []struct {
+		name        string
+		testData    *device.Device
+		wantResult  *device.Device
+		rowAffected int64
+		nilResult   bool
+	}{
+		{
+			name:        "nil device",
+			testData:    nil,
+			wantResult:  device1(),
+			rowAffected: 0,
+			nilResult:   true,
+		},
+		{
+			name:        "only id",
+			testData:    &device.Device{Id: device1().Id},
+			wantResult:  device1(),
+			rowAffected: 0,
+			nilResult:   true,
+		},
+		{
+			name:        "success",
+			testData:    &device.Device{Id: device1().Id, Model: "Max", Color: "Red", Version: "v2.0"},
+			wantResult:  &device.Device{Id: device1().Id, Model: "Max", Color: "Red", Version: "v2.0"},
+			rowAffected: 1,
+		},
+		{
+			name:        "keep zero fields",
+			testData:    &device.Device{Id: device1().Id, Version: "v1.5"},
+			wantResult:  &device.Device{Id: device1().Id, Model: "Pro", Color: "White", Version: "v1.5"},
+			rowAffected: 1,
+		},
+		{
+			name:        "not exist id",
+			testData:    &device.Device{Id: device2().Id, Version: "v1.5"},
+			wantResult:  device1(),
+			rowAffected: 0,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			repo, teardown := newRepo(t, device1())
+			defer teardown(t)
+
+			re, affected, err := repo.Update(context.Background(), tc.testData)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.rowAffected, affected)
+			if tc.nilResult {
+				assert.Nil(t, re)
+			}
+
+			d, err := repo.Get(context.Background(), device1().Id)
+			assert.NoError(t, err)
+			if tc.rowAffected > 0 {
+				assert.NotZero(t, d.UpdateTime)
+			}
+			tc.wantResult.UpdateTime = d.UpdateTime
+			assert.Equal(t, tc.wantResult, d)
+		})
+	}
+}
+
+func testDelete(t *testing.T, newRepo DeviceRepoFactory) {
+	repo, teardown := newRepo(t, device1(), device2())
+	defer teardown(t)
+
+	affected, err := repo.Delete(context.Background(), device1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+
+	affected, err = repo.Delete(context.Background(), device1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), affected)
+
+	devices, err := repo.List(context.Background(), &device.Device{})
+	assert.NoError(t, err)
+	assert.Equal(t, []*device.Device{device2()}, devices)
+}
+
+func testList(t *testing.T, newRepo DeviceRepoFactory) {
+	tt := []struct {
+		name       string
+		seed       []*device.Device
+		testData   *device.Device
+		wantResult []*device.Device
+	}{
+		{
+			name:       "no data",
+			seed:       nil,
+			testData:   &device.Device{},
+			wantResult: []*device.Device{},
+		},
+		{
+			name:       "all data",
+			seed:       []*device.Device{device1(), device2(), device3()},
+			testData:   &device.Device{},
+			wantResult: []*device.Device{device1(), device2(), device3()},
+		},
+		{
+			name:       "filter fields",
+			seed:       []*device.Device{device1(), device2(), device3()},
+			testData:   &device.Device{Model: "Pro", Color: "Black"},
+			wantResult: []*device.Device{device3()},
+		},
+		{
+			name:       "no match",
+			seed:       []*device.Device{device1(), device2(), device3()},
+			testData:   &device.Device{Color: "Red"},
+			wantResult: []*device.Device{},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			repo, teardown := newRepo(t, tc.seed...)
+			defer teardown(t)
+
+			devices, err := repo.List(context.Background(), tc.testData)
+			assert.NoError(t, err)
+			assert.NotNil(t, devices)
+			assert.ElementsMatch(t, tc.wantResult, devices)
+		})
+	}
+}
+
+func testFind(t *testing.T, newRepo DeviceRepoFactory) {
+	repo, teardown := newRepo(t, device1(), device2(), device3())
+	defer teardown(t)
+
+	tt := []struct {
+		name     string
+		testData *device.Device
+		testPage *model.Page
+		wantLen  int
+		wantIn   []*device.Device
+	}{
+		{
+			name:     "zero limit",
+			testData: &device.Device{},
+			testPage: &model.Page{Limit: 0, Offset: 0},
+			wantLen:  0,
+		},
+		{
+			name:     "limit > count",
+			testData: &device.Device{},
+			testPage: &model.Page{Limit: 5, Offset: 0},
+			wantLen:  3,
+			wantIn:   []*device.Device{device1(), device2(), device3()},
+		},
+		{
+			name:     "limit",
+			testData: &device.Device{},
+			testPage: &model.Page{Limit: 2, Offset: 0},
+			wantLen:  2,
+			wantIn:   []*device.Device{device1(), device2(), device3()},
+		},
+		{
+			name:     "offset past count",
+			testData: &device.Device{},
+			testPage: &model.Page{Limit: 2, Offset: 3},
+			wantLen:  0,
+		},
+		{
+			name:     "filter with paging",
+			testData: &device.Device{Version: "v1.2"},
+			testPage: &model.Page{Limit: 1, Offset: 1},
+			wantLen:  1,
+			wantIn:   []*device.Device{device1(), device2()},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			devices, err := repo.Find(context.Background(), tc.testData, tc.testPage)
+			assert.NoError(t, err)
+			assert.NotNil(t, devices)
+			assert.Len(t, devices, tc.wantLen)
+			for _, d := range devices {
+				assert.Contains(t, tc.wantIn, d)
+			}
+		})
+	}
+
+	// consecutive pages do not overlap
+	seen := make(map[device.UUID]bool)
+	for offset := uint64(0); offset < 3; offset++ {
+		devices, err := repo.Find(context.Background(), &device.Device{}, &model.Page{Limit: 1, Offset: offset})
+		assert.NoError(t, err)
+		if assert.Len(t, devices, 1) {
+			assert.False(t, seen[devices[0].Id], "%s returned twice", devices[0].Id)
+			seen[devices[0].Id] = true
+		}
+	}
+}
+
+func testIterate(t *testing.T, newRepo DeviceRepoFactory) {
+	repo, teardown := newRepo(t, device1(), device2(), device3())
+	defer teardown(t)
+
+	tt := []struct {
+		name    string
+		filter  *device.Device
+		page    *model.Page
+		wantLen int
+	}{
+		{name: "all", filter: &device.Device{}, wantLen: 3},
+		{name: "zero limit", filter: &device.Device{}, page: &model.Page{}, wantLen: 3},
+		{name: "filter", filter: &device.Device{Model: "Pro"}, wantLen: 2},
+		{name: "page", filter: &device.Device{}, page: &model.Page{Limit: 2, Offset: 2}, wantLen: 1},
+		{name: "no match", filter: &device.Device{Model: "None"}, wantLen: 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var devices []*device.Device
+			err := repo.Iterate(context.Background(), tc.filter, tc.page, func(d *device.Device) error {
+				devices = append(devices, d)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Len(t, devices, tc.wantLen)
+			for _, d := range devices {
+				assert.Contains(t, []*device.Device{device1(), device2(), device3()}, d)
+			}
+		})
+	}
+
+	// the first error of fn stops the iteration
+	stop := errors.New("stop")
+	calls := 0
+	err := repo.Iterate(context.Background(), &device.Device{}, nil, func(*device.Device) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+}
+
+func testCount(t *testing.T, newRepo DeviceRepoFactory) {
+	empty, teardownEmpty := newRepo(t)
+	defer teardownEmpty(t)
+
+	counts, err := empty.Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*device.Count{}, counts)
+
+	repo, teardown := newRepo(t, device1(), device2(), device3())
+	defer teardown(t)
+
+	counts, err = repo.Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*device.Count{
+		{Model: "Normal", Version: "v1.2", Total: 1},
+		{Model: "Pro", Version: "v1.2", Total: 1},
+		{Model: "Pro", Version: "v1.5", Total: 1},
+	}, counts)
+}
+
+func testLabels(t *testing.T, newRepo DeviceRepoFactory) {
+	repo, teardown := newRepo(t, device1(), device2())
+	defer teardown(t)
+	ctx := context.Background()
+
+	labels, err := repo.Labels(ctx, device1().Id, device2().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, map[device.UUID]map[string]string{}, labels)
+
+	assert.NoError(t, repo.SetLabels(ctx, device1().Id, map[string]string{"site": "tpe", "env": "lab"}))
+	assert.NoError(t, repo.SetLabels(ctx, device1().Id, map[string]string{"env": "prod", "batch": ""}))
+	assert.NoError(t, repo.SetLabels(ctx, device2().Id, map[string]string{"site": "khh"}))
+
+	labels, err = repo.Labels(ctx, device1().Id, device2().Id, device3().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, map[device.UUID]map[string]string{
+		device1().Id: {"site": "tpe", "env": "prod", "batch": ""},
+		device2().Id: {"site": "khh"},
+	}, labels)
+
+	removed, err := repo.RemoveLabels(ctx, device1().Id, "env", "missing")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	removed, err = repo.RemoveLabels(ctx, device2().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+
+	labels, err = repo.Labels(ctx, device1().Id, device2().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, map[device.UUID]map[string]string{
+		device1().Id: {"site": "tpe", "batch": ""},
+	}, labels)
+}
+
+func testSelector(t *testing.T, newRepo DeviceRepoFactory) {
+	repo, teardown := newRepo(t, device1(), device2(), device3())
+	defer teardown(t)
+	ctx := context.Background()
+
+	assert.NoError(t, repo.SetLabels(ctx, device1().Id, map[string]string{"site": "tpe", "env": "prod", "batch": "a"}))
+	assert.NoError(t, repo.SetLabels(ctx, device2().Id, map[string]string{"site": "tpe", "env": "lab", "batch": "b"}))
+	assert.NoError(t, repo.SetLabels(ctx, device3().Id, map[string]string{"site": "khh"}))
+
+	tt := []struct {
+		selector string
+		filter   *device.Device
+		want     []device.UUID
+	}{
+		{selector: "site=tpe", want: []device.UUID{device1().Id, device2().Id}},
+		{selector: "site==tpe,env!=lab", want: []device.UUID{device1().Id}},
+		{selector: "env!=lab", want: []device.UUID{device1().Id, device3().Id}},
+		{selector: "batch in (a,b)", want: []device.UUID{device1().Id, device2().Id}},
+		{selector: "batch notin (a)", want: []device.UUID{device2().Id, device3().Id}},
+		{selector: "env", want: []device.UUID{device1().Id, device2().Id}},
+		{selector: "!env", want: []device.UUID{device3().Id}},
+		{selector: "site=tpe", filter: &device.Device{Color: "Black"}, want: []device.UUID{device2().Id}},
+		{selector: "site=nowhere", want: []device.UUID{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.selector, func(t *testing.T) {
+			s, err := device.ParseSelector(tc.selector)
+			assert.NoError(t, err)
+			filter := tc.filter
+			if filter == nil {
+				filter = &device.Device{}
+			}
+			filter.Selector = s
+
+			ids := func(devices []*device.Device) []device.UUID {
+				ids := []device.UUID{}
+				for _, d := range devices {
+					ids = append(ids, d.Id)
+				}
+				return ids
+			}
+
+			listed, err := repo.List(ctx, filter)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tc.want, ids(listed))
+
+			found, err := repo.Find(ctx, filter, &model.Page{Limit: 10})
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tc.want, ids(found))
+
+			var iterated []*device.Device
+			err = repo.Iterate(ctx, filter, nil, func(d *device.Device) error {
+				iterated = append(iterated, d)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tc.want, ids(iterated))
+		})
+	}
+}
+
+func testMembers(t *testing.T, newRepo DeviceRepoFactory) {
+	repo, teardown := newRepo(t, device1(), device2(), device3())
+	defer teardown(t)
+	ctx := context.Background()
+
+	assert.NoError(t, repo.AddMembers(ctx, fleet, device1().Id, device2().Id))
+	// adding a member again is not an error
+	assert.NoError(t, repo.AddMembers(ctx, fleet, device1().Id))
+	assert.NoError(t, repo.AddMembers(ctx, subFleet, device2().Id, device3().Id))
+	assert.NoError(t, repo.AddMembers(ctx, other))
+
+	ids := func(groups ...device.UUID) []device.UUID {
+		devices, err := repo.List(ctx, &device.Device{Membership: &device.Membership{GroupIds: groups}})
+		assert.NoError(t, err)
+		ids := []device.UUID{}
+		for _, d := range devices {
+			ids = append(ids, d.Id)
+		}
+		return ids
+	}
+
+	assert.ElementsMatch(t, []device.UUID{device1().Id, device2().Id}, ids(fleet))
+	assert.ElementsMatch(t, []device.UUID{device1().Id, device2().Id, device3().Id}, ids(fleet, subFleet))
+	assert.ElementsMatch(t, []device.UUID{}, ids(other))
+	assert.ElementsMatch(t, []device.UUID{}, ids())
+
+	// the membership narrows the other filters
+	found, err := repo.Find(ctx, &device.Device{Model: "Pro", Membership: &device.Membership{GroupIds: []device.UUID{subFleet}}}, &model.Page{Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, device3().Id, found[0].Id)
+	}
+
+	removed, err := repo.RemoveMembers(ctx, fleet, device1().Id, device3().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+	assert.ElementsMatch(t, []device.UUID{device2().Id}, ids(fleet))
+
+	removed, err = repo.RemoveMembers(ctx, subFleet)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), removed)
+	assert.ElementsMatch(t, []device.UUID{}, ids(subFleet))
+}
+
+func testState(t *testing.T, newRepo DeviceRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	for _, d := range []*device.Device{device1(), device2()} {
+		_, err := repo.Create(ctx, d)
+		assert.NoError(t, err)
+	}
+
+	affect, err := repo.SetState(ctx, device1().Id, []string{device.StateProvisioned, device.StateSuspended}, device.StateActive)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affect)
+	d, err := repo.Get(ctx, device1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, device.StateActive, d.State)
+	assert.NotZero(t, d.UpdateTime)
+
+	// a device in none of the states from stays
+	affect, err = repo.SetState(ctx, device1().Id, []string{device.StateProvisioned}, device.StateActive)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), affect)
+	affect, err = repo.SetState(ctx, device3().Id, []string{device.StateProvisioned}, device.StateActive)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), affect)
+
+	// the state filters
+	found, err := repo.List(ctx, &device.Device{State: device.StateProvisioned})
+	assert.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, device2().Id, found[0].Id)
+	}
+
+	// an update leaves the state alone
+	_, _, err = repo.Update(ctx, &device.Device{Id: device1().Id, Color: "Red", State: device.StateSuspended})
+	assert.NoError(t, err)
+	d, err = repo.Get(ctx, device1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Red", d.Color)
+	assert.Equal(t, device.StateActive, d.State)
+}
+
+func testHeartbeat(t *testing.T, newRepo DeviceRepoFactory) {
+	repo, teardown := newRepo(t, device1(), device2(), device3())
+	defer teardown(t)
+	ctx := context.Background()
+
+	affect, err := repo.Heartbeat(ctx, device1().Id, 1000, "fw-1.0")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affect)
+	affect, err = repo.Heartbeat(ctx, device2().Id, 2000, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affect)
+	affect, err = repo.Heartbeat(ctx, "0b0c6d0e-8a43-4a4e-9f43-7f1f0a000009", 2000, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), affect)
+
+	d, err := repo.Get(ctx, device1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), d.LastSeen)
+	assert.Equal(t, "fw-1.0", d.Firmware)
+	// a heartbeat isn't an update
+	assert.Equal(t, device1().UpdateTime, d.UpdateTime)
+
+	// an empty firmware keeps the reported one
+	_, err = repo.Heartbeat(ctx, device1().Id, 3000, "")
+	assert.NoError(t, err)
+	d, err = repo.Get(ctx, device1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3000), d.LastSeen)
+	assert.Equal(t, "fw-1.0", d.Firmware)
+
+	tt := []struct {
+		description string
+		seen        *device.SeenRange
+		expected    []device.UUID
+	}{
+		{
+			description: "since",
+			seen:        &device.SeenRange{Since: 2000},
+			expected:    []device.UUID{device1().Id, device2().Id},
+		},
+		{
+			description: "between",
+			seen:        &device.SeenRange{Since: 1000, Before: 3000},
+			expected:    []device.UUID{device2().Id},
+		},
+		{
+			description: "before, with the devices never seen",
+			seen:        &device.SeenRange{Before: 3000},
+			expected:    []device.UUID{device2().Id, device3().Id},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			found, err := repo.List(ctx, &device.Device{Seen: tc.seen})
+			assert.NoError(t, err)
+			var ids []device.UUID
+			for _, d := range found {
+				ids = append(ids, d.Id)
+			}
+			assert.ElementsMatch(t, tc.expected, ids)
+		})
+	}
+}
+
+func testShadow(t *testing.T, newRepo DeviceRepoFactory) {
+	repo, teardown := newRepo(t, device1(), device2())
+	defer teardown(t)
+	ctx := context.Background()
+
+	tt := []struct {
+		description string
+		id          device.UUID
+		from        int64
+		desired     *device.Desired
+		expected    int64
+	}{
+		{
+			description: "desire",
+			id:          device1().Id,
+			from:        0,
+			desired:     &device.Desired{Color: "Black", Version: "v1.3"},
+			expected:    1,
+		},
+		{
+			description: "stale version",
+			id:          device1().Id,
+			from:        0,
+			desired:     &device.Desired{Color: "Red"},
+			expected:    0,
+		},
+		{
+			description: "keep the desired config",
+			id:          device1().Id,
+			from:        1,
+			expected:    1,
+		},
+		{
+			description: "unknown device",
+			id:          "0b0c6d0e-8a43-4a4e-9f43-7f1f0a000009",
+			from:        0,
+			expected:    0,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			affect, err := repo.AdvanceShadow(ctx, tc.id, tc.from, tc.desired)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, affect)
+		})
+	}
+
+	d, err := repo.Get(ctx, device1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "Black", d.DesiredColor)
+	assert.Equal(t, "v1.3", d.DesiredVersion)
+	assert.Equal(t, int64(2), d.ShadowVersion)
+	// the reported config is left as it is
+	assert.Equal(t, device1().Color, d.Color)
+	assert.Equal(t, device1().Version, d.Version)
+
+	d, err = repo.Get(ctx, device2().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "", d.DesiredColor)
+	assert.Equal(t, int64(0), d.ShadowVersion)
+}
+
+func testContext(t *testing.T, newRepo DeviceRepoFactory) {
+	repo, teardown := newRepo(t, device1())
+	defer teardown(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.Get(ctx, device1().Id)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Create(ctx, device2())
+	assert.Equal(t, context.Canceled, err)
+	_, _, err = repo.Update(ctx, &device.Device{Id: device1().Id, Color: "Red"})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Delete(ctx, device1().Id)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.List(ctx, &device.Device{})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Find(ctx, &device.Device{}, &model.Page{Limit: 1})
+	assert.Equal(t, context.Canceled, err)
+	err = repo.Iterate(ctx, &device.Device{}, nil, func(*device.Device) error { return nil })
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Count(ctx)
+	assert.Equal(t, context.Canceled, err)
+	err = repo.SetLabels(ctx, device1().Id, map[string]string{"site": "tpe"})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.RemoveLabels(ctx, device1().Id)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Labels(ctx, device1().Id)
+	assert.Equal(t, context.Canceled, err)
+	err = repo.AddMembers(ctx, fleet, device1().Id)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.RemoveMembers(ctx, fleet)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.SetState(ctx, device1().Id, []string{""}, device.StateActive)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Heartbeat(ctx, device1().Id, 1000, "fw-1.0")
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.AdvanceShadow(ctx, device1().Id, 0, &device.Desired{Color: "Red"})
+	assert.Equal(t, context.Canceled, err)
+
+	// nothing was written
+	d, err := repo.Get(context.Background(), device1().Id)
+	assert.NoError(t, err)
+	assert.Equal(t, device1(), d)
+	_, err = repo.Get(context.Background(), device2().Id)
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+}
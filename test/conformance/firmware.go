@@ -0,0 +1,497 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/model/firmware"
+)
+
+// FirmwareRepoFactory returns an empty release repository and the func
+// releasing it
+type FirmwareRepoFactory func(t *testing.T) (firmware.Repository, func(t *testing.T))
+
+// CampaignRepoFactory returns an empty campaign repository and the func
+// releasing it
+type CampaignRepoFactory func(t *testing.T) (firmware.CampaignRepository, func(t *testing.T))
+
+// KeyRepoFactory returns an empty signing key repository and the func
+// releasing it
+type KeyRepoFactory func(t *testing.T) (firmware.KeyRepository, func(t *testing.T))
+
+// FirmwareRepository runs the conformance suite of firmware.Repository
+// against the repositories of newRepo, a new one per case
+func FirmwareRepository(t *testing.T, newRepo FirmwareRepoFactory) {
+	tt := []struct {
+		name string
+		run  func(t *testing.T, newRepo FirmwareRepoFactory)
+	}{
+		{name: "Get", run: testReleaseGet},
+		{name: "Find", run: testReleaseFind},
+		{name: "Delete", run: testReleaseDelete},
+		{name: "Context", run: testReleaseContext},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newRepo)
+		})
+	}
+}
+
+// CampaignRepository runs the conformance suite of
+// firmware.CampaignRepository against the repositories of newRepo, a new one
+// per case
+func CampaignRepository(t *testing.T, newRepo CampaignRepoFactory) {
+	tt := []struct {
+		name string
+		run  func(t *testing.T, newRepo CampaignRepoFactory)
+	}{
+		{name: "Get", run: testCampaignGet},
+		{name: "Find", run: testCampaignFind},
+		{name: "Update", run: testCampaignUpdate},
+		{name: "Targets", run: testCampaignTargets},
+		{name: "Context", run: testCampaignContext},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newRepo)
+		})
+	}
+}
+
+// Ids of the releases of seedReleases, by create time
+const (
+	release1 device.UUID = "7a2d3b4c-1e5f-4a6b-9c7d-8e9f0a1b0001"
+	release2 device.UUID = "7a2d3b4c-1e5f-4a6b-9c7d-8e9f0a1b0002"
+	release3 device.UUID = "7a2d3b4c-1e5f-4a6b-9c7d-8e9f0a1b0003"
+)
+
+// seedReleases stores two releases of Pro and one of Normal
+func seedReleases(t *testing.T, repo firmware.Repository) {
+	for _, r := range []*firmware.Release{
+		{Id: release1, Model: "Pro", Version: "1.0.0", Checksum: "a1", Size: 10, Notes: "first", CreateTime: 100, Signature: "s1", KeyId: "k1"},
+		{Id: release2, Model: "Normal", Version: "1.0.0", Checksum: "a2", Size: 20, CreateTime: 200},
+		{Id: release3, Model: "Pro", Version: "1.1.0", Checksum: "a3", Size: 30, CreateTime: 300},
+	} {
+		_, err := repo.Create(context.Background(), r)
+		assert.NoError(t, err)
+	}
+}
+
+func testReleaseGet(t *testing.T, newRepo FirmwareRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedReleases(t, repo)
+
+	r, err := repo.Get(ctx, release1)
+	assert.NoError(t, err)
+	assert.Equal(t, &firmware.Release{
+		Id: release1, Model: "Pro", Version: "1.0.0", Checksum: "a1", Size: 10, Notes: "first", CreateTime: 100,
+		Signature: "s1", KeyId: "k1",
+	}, r)
+
+	_, err = repo.Get(ctx, "0b0c6d0e-8a43-4a4e-9f43-7f1f0a000009")
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+
+	// a model has one release of a version
+	_, err = repo.Create(ctx, &firmware.Release{Id: "7a2d3b4c-1e5f-4a6b-9c7d-8e9f0a1b0009", Model: "Pro", Version: "1.0.0", CreateTime: 400})
+	assert.Error(t, err)
+}
+
+func testReleaseFind(t *testing.T, newRepo FirmwareRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedReleases(t, repo)
+
+	tt := []struct {
+		description string
+		model       string
+		version     string
+		page        *model.Page
+		expected    []device.UUID
+	}{
+		{description: "newest first", page: &model.Page{Limit: 10}, expected: []device.UUID{release3, release2, release1}},
+		{description: "page", page: &model.Page{Limit: 1, Offset: 1}, expected: []device.UUID{release2}},
+		{description: "model", model: "Pro", page: &model.Page{Limit: 10}, expected: []device.UUID{release3, release1}},
+		{description: "version", model: "Pro", version: "1.0.0", page: &model.Page{Limit: 10}, expected: []device.UUID{release1}},
+		{description: "no release", model: "Lite", page: &model.Page{Limit: 10}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			found, err := repo.Find(ctx, tc.model, tc.version, tc.page)
+			assert.NoError(t, err)
+			var ids []device.UUID
+			for _, r := range found {
+				ids = append(ids, r.Id)
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+}
+
+func testReleaseDelete(t *testing.T, newRepo FirmwareRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedReleases(t, repo)
+
+	affect, err := repo.Delete(ctx, release1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affect)
+	affect, err = repo.Delete(ctx, release1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), affect)
+
+	_, err = repo.Get(ctx, release1)
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+
+	// the version is free again
+	_, err = repo.Create(ctx, &firmware.Release{Id: "7a2d3b4c-1e5f-4a6b-9c7d-8e9f0a1b0009", Model: "Pro", Version: "1.0.0", CreateTime: 400})
+	assert.NoError(t, err)
+}
+
+func testReleaseContext(t *testing.T, newRepo FirmwareRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.Create(ctx, &firmware.Release{Id: release1, Model: "Pro", Version: "1.0.0"})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Get(ctx, release1)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Find(ctx, "", "", &model.Page{Limit: 10})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Delete(ctx, release1)
+	assert.Equal(t, context.Canceled, err)
+
+	// nothing was written
+	_, err = repo.Get(context.Background(), release1)
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+}
+
+// Ids of the campaigns of seedCampaigns, by create time
+const (
+	campaign1 device.UUID = "8b3e4c5d-2f6a-4b7c-8d8e-9f0a1b2c0001"
+	campaign2 device.UUID = "8b3e4c5d-2f6a-4b7c-8d8e-9f0a1b2c0002"
+	campaign3 device.UUID = "8b3e4c5d-2f6a-4b7c-8d8e-9f0a1b2c0003"
+)
+
+// seedCampaigns stores two running campaigns of release1 and a paused one of
+// release3
+func seedCampaigns(t *testing.T, repo firmware.CampaignRepository) {
+	for _, c := range []*firmware.Campaign{
+		{Id: campaign1, ReleaseId: release1, Selector: "site=tpe", Waves: "10,100", Status: firmware.CampaignRunning, FailureThreshold: 0.1, Timeout: 1000, CreateTime: 100, UpdateTime: 100},
+		{Id: campaign2, ReleaseId: release1, Waves: "100", Status: firmware.CampaignRunning, CreateTime: 200, UpdateTime: 200},
+		{Id: campaign3, ReleaseId: release3, Waves: "50,100", Status: firmware.CampaignPaused, Wave: 1, Reason: "manual", CreateTime: 300, UpdateTime: 300},
+	} {
+		_, err := repo.Create(context.Background(), c)
+		assert.NoError(t, err)
+	}
+}
+
+func testCampaignGet(t *testing.T, newRepo CampaignRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedCampaigns(t, repo)
+
+	c, err := repo.Get(ctx, campaign1)
+	assert.NoError(t, err)
+	assert.Equal(t, &firmware.Campaign{
+		Id: campaign1, ReleaseId: release1, Selector: "site=tpe", Waves: "10,100", Status: firmware.CampaignRunning,
+		FailureThreshold: 0.1, Timeout: 1000, CreateTime: 100, UpdateTime: 100,
+	}, c)
+
+	_, err = repo.Get(ctx, "0b0c6d0e-8a43-4a4e-9f43-7f1f0a000009")
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+}
+
+func testCampaignFind(t *testing.T, newRepo CampaignRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedCampaigns(t, repo)
+
+	tt := []struct {
+		description string
+		release     device.UUID
+		status      string
+		page        *model.Page
+		expected    []device.UUID
+	}{
+		{description: "newest first", page: &model.Page{Limit: 10}, expected: []device.UUID{campaign3, campaign2, campaign1}},
+		{description: "page", page: &model.Page{Limit: 1, Offset: 2}, expected: []device.UUID{campaign1}},
+		{description: "release", release: release1, page: &model.Page{Limit: 10}, expected: []device.UUID{campaign2, campaign1}},
+		{description: "status", status: firmware.CampaignPaused, page: &model.Page{Limit: 10}, expected: []device.UUID{campaign3}},
+		{description: "no campaign", release: release2, page: &model.Page{Limit: 10}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			found, err := repo.Find(ctx, tc.release, tc.status, tc.page)
+			assert.NoError(t, err)
+			var ids []device.UUID
+			for _, c := range found {
+				ids = append(ids, c.Id)
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+}
+
+func testCampaignUpdate(t *testing.T, newRepo CampaignRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedCampaigns(t, repo)
+
+	started := &firmware.Campaign{Id: campaign1, Status: firmware.CampaignRunning, Wave: 1, FailureThreshold: 0.1, UpdateTime: 500}
+	tt := []struct {
+		description string
+		campaign    *firmware.Campaign
+		from        []string
+		wave        int
+		expected    int64
+	}{
+		{description: "start a wave", campaign: started, from: []string{firmware.CampaignRunning}, wave: 0, expected: 1},
+		{description: "start it again", campaign: started, from: []string{firmware.CampaignRunning}, wave: 0, expected: 0},
+		{description: "not in status", campaign: &firmware.Campaign{Id: campaign1, Status: firmware.CampaignRunning, Wave: 1}, from: []string{firmware.CampaignPaused}, wave: 1, expected: 0},
+		{
+			description: "pause",
+			campaign:    &firmware.Campaign{Id: campaign1, Status: firmware.CampaignPaused, Wave: 1, FailureThreshold: 0.2, Reason: "too many failures", UpdateTime: 600},
+			from:        firmware.CampaignFrom[firmware.CampaignPaused],
+			wave:        1,
+			expected:    1,
+		},
+		{description: "unknown campaign", campaign: &firmware.Campaign{Id: "0b0c6d0e-8a43-4a4e-9f43-7f1f0a000009"}, from: []string{firmware.CampaignRunning}, expected: 0},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			affect, err := repo.Update(ctx, tc.campaign, tc.from, tc.wave)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, affect)
+		})
+	}
+
+	c, err := repo.Get(ctx, campaign1)
+	assert.NoError(t, err)
+	assert.Equal(t, &firmware.Campaign{
+		Id: campaign1, ReleaseId: release1, Selector: "site=tpe", Waves: "10,100", Wave: 1, Status: firmware.CampaignPaused,
+		FailureThreshold: 0.2, Timeout: 1000, Reason: "too many failures", CreateTime: 100, UpdateTime: 600,
+	}, c)
+}
+
+func testCampaignTargets(t *testing.T, newRepo CampaignRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedCampaigns(t, repo)
+
+	target := func(campaign device.UUID, d *device.Device, wave int, status string) *firmware.Target {
+		return &firmware.Target{CampaignId: campaign, DeviceId: d.Id, Wave: wave, Status: status, StartTime: 100, UpdateTime: 100}
+	}
+	added, err := repo.AddTargets(ctx, []*firmware.Target{
+		target(campaign1, device3(), 1, firmware.TargetUpdating),
+		target(campaign1, device1(), 2, firmware.TargetUpdating),
+		target(campaign1, device2(), 2, firmware.TargetSucceeded),
+		target(campaign2, device1(), 1, firmware.TargetUpdating),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), added)
+
+	// a target added again is skipped
+	added, err = repo.AddTargets(ctx, []*firmware.Target{
+		target(campaign1, device3(), 3, firmware.TargetFailed),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), added)
+
+	tt := []struct {
+		description string
+		status      string
+		page        *model.Page
+		expected    []device.UUID
+	}{
+		{description: "by wave and device", expected: []device.UUID{device3().Id, device2().Id, device1().Id}},
+		{description: "page", page: &model.Page{Limit: 1, Offset: 1}, expected: []device.UUID{device2().Id}},
+		{description: "status", status: firmware.TargetUpdating, expected: []device.UUID{device3().Id, device1().Id}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			found, err := repo.Targets(ctx, campaign1, tc.status, tc.page)
+			assert.NoError(t, err)
+			var ids []device.UUID
+			for _, v := range found {
+				ids = append(ids, v.DeviceId)
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+
+	affect, err := repo.SetTargetStatus(ctx, campaign1, device1().Id, firmware.TargetUpdating, firmware.TargetFailed, 700)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affect)
+	affect, err = repo.SetTargetStatus(ctx, campaign1, device1().Id, firmware.TargetUpdating, firmware.TargetSucceeded, 800)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), affect)
+
+	found, err := repo.Targets(ctx, campaign1, firmware.TargetFailed, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []*firmware.Target{{
+		CampaignId: campaign1, DeviceId: device1().Id, Wave: 2, Status: firmware.TargetFailed, StartTime: 100, UpdateTime: 700,
+	}}, found)
+
+	counts, err := repo.CountTargets(ctx, campaign1)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		firmware.TargetUpdating:  1,
+		firmware.TargetSucceeded: 1,
+		firmware.TargetFailed:    1,
+	}, counts)
+	counts, err = repo.CountTargets(ctx, campaign3)
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+}
+
+func testCampaignContext(t *testing.T, newRepo CampaignRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.Create(ctx, &firmware.Campaign{Id: campaign1, ReleaseId: release1, Waves: "100", Status: firmware.CampaignRunning})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Get(ctx, campaign1)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Find(ctx, "", "", &model.Page{Limit: 10})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Update(ctx, &firmware.Campaign{Id: campaign1}, []string{firmware.CampaignRunning}, 0)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.AddTargets(ctx, []*firmware.Target{{CampaignId: campaign1, DeviceId: device1().Id, Status: firmware.TargetUpdating}})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Targets(ctx, campaign1, "", nil)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.SetTargetStatus(ctx, campaign1, device1().Id, firmware.TargetUpdating, firmware.TargetFailed, 0)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.CountTargets(ctx, campaign1)
+	assert.Equal(t, context.Canceled, err)
+
+	// nothing was written
+	_, err = repo.Get(context.Background(), campaign1)
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+	counts, err := repo.CountTargets(context.Background(), campaign1)
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+}
+
+// KeyRepository runs the conformance suite of firmware.KeyRepository against
+// the repositories of newRepo, a new one per case
+func KeyRepository(t *testing.T, newRepo KeyRepoFactory) {
+	tt := []struct {
+		name string
+		run  func(t *testing.T, newRepo KeyRepoFactory)
+	}{
+		{name: "Rotate", run: testKeyRotate},
+		{name: "Context", run: testKeyContext},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newRepo)
+		})
+	}
+}
+
+func testKeyRotate(t *testing.T, newRepo KeyRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	_, err := repo.Active(ctx)
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+	keys, err := repo.Find(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	k1 := &firmware.Key{Id: "k1", PublicKey: "p1", WrappedKey: "s1", Status: firmware.KeyActive, CreateTime: 100}
+	assert.NoError(t, repo.Rotate(ctx, k1))
+	active, err := repo.Active(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, k1, active)
+
+	// the key before is retired at the create time of the new one
+	k2 := &firmware.Key{Id: "k2", PublicKey: "p2", WrappedKey: "s2", Status: firmware.KeyActive, CreateTime: 200}
+	assert.NoError(t, repo.Rotate(ctx, k2))
+	active, err = repo.Active(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, k2, active)
+
+	retired, err := repo.Get(ctx, "k1")
+	assert.NoError(t, err)
+	assert.Equal(t, &firmware.Key{
+		Id: "k1", PublicKey: "p1", WrappedKey: "s1", Status: firmware.KeyRetired, CreateTime: 100, RetireTime: 200,
+	}, retired)
+
+	keys, err = repo.Find(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k2", "k1"}, keyIds(keys))
+
+	// a rotation to a key that exists changes nothing
+	assert.Error(t, repo.Rotate(ctx, &firmware.Key{Id: "k1", PublicKey: "p1", WrappedKey: "s1", Status: firmware.KeyActive, CreateTime: 300}))
+	active, err = repo.Active(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "k2", active.Id)
+
+	_, err = repo.Get(ctx, "k9")
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+}
+
+func testKeyContext(t *testing.T, newRepo KeyRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := repo.Rotate(ctx, &firmware.Key{Id: "k1", PublicKey: "p1", WrappedKey: "s1", Status: firmware.KeyActive, CreateTime: 100})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Get(ctx, "k1")
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Active(ctx)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Find(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	// nothing was written
+	_, err = repo.Get(context.Background(), "k1")
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+}
+
+func keyIds(keys []*firmware.Key) []string {
+	ids := []string{}
+	for _, k := range keys {
+		ids = append(ids, k.Id)
+	}
+	return ids
+}
@@ -0,0 +1,196 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/model"
+	"github/demo/model/device"
+	"github/demo/model/group"
+)
+
+// GroupRepoFactory returns an empty group repository and the func releasing
+// it
+type GroupRepoFactory func(t *testing.T) (group.Repository, func(t *testing.T))
+
+// GroupRepository runs the conformance suite of group.Repository against the
+// repositories of newRepo, a new one per case
+func GroupRepository(t *testing.T, newRepo GroupRepoFactory) {
+	tt := []struct {
+		name string
+		run  func(t *testing.T, newRepo GroupRepoFactory)
+	}{
+		{name: "CRUD", run: testGroupCRUD},
+		{name: "Find", run: testGroupFind},
+		{name: "Descendants", run: testGroupDescendants},
+		{name: "Context", run: testGroupContext},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newRepo)
+		})
+	}
+}
+
+const (
+	fleet    device.UUID = "0b0c6d0e-8a43-4a4e-9f43-7f1f0a000001"
+	subFleet device.UUID = "0b0c6d0e-8a43-4a4e-9f43-7f1f0a000002"
+	leaf     device.UUID = "0b0c6d0e-8a43-4a4e-9f43-7f1f0a000003"
+	other    device.UUID = "0b0c6d0e-8a43-4a4e-9f43-7f1f0a000004"
+)
+
+func newGroup(id device.UUID, name string, parent *device.UUID) *group.Group {
+	return &group.Group{Id: id, Name: name, ParentId: parent}
+}
+
+func uuidOf(id device.UUID) *device.UUID {
+	return &id
+}
+
+// seedGroups creates fleet > subFleet > leaf and other
+func seedGroups(t *testing.T, repo group.Repository) {
+	for _, g := range []*group.Group{
+		newGroup(fleet, "fleet", nil),
+		newGroup(subFleet, "sub fleet", uuidOf(fleet)),
+		newGroup(leaf, "leaf", uuidOf(subFleet)),
+		newGroup(other, "other", nil),
+	} {
+		_, err := repo.Create(context.Background(), g)
+		assert.NoError(t, err)
+	}
+}
+
+func testGroupCRUD(t *testing.T, newRepo GroupRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, newGroup(fleet, "fleet", nil))
+	assert.NoError(t, err)
+	assert.NotZero(t, created.CreateTime)
+	_, err = repo.Create(ctx, newGroup(subFleet, "sub fleet", uuidOf(fleet)))
+	assert.NoError(t, err)
+
+	g, err := repo.Get(ctx, subFleet)
+	assert.NoError(t, err)
+	assert.Equal(t, "sub fleet", g.Name)
+	assert.Equal(t, uuidOf(fleet), g.ParentId)
+
+	// a nil parent moves the group to the top level
+	affect, err := repo.Update(ctx, newGroup(subFleet, "fleet 2", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affect)
+	g, err = repo.Get(ctx, subFleet)
+	assert.NoError(t, err)
+	assert.Equal(t, "fleet 2", g.Name)
+	assert.Nil(t, g.ParentId)
+
+	affect, err = repo.Update(ctx, newGroup(leaf, "missing", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), affect)
+
+	affect, err = repo.Delete(ctx, subFleet)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affect)
+	affect, err = repo.Delete(ctx, subFleet)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), affect)
+
+	_, err = repo.Get(ctx, subFleet)
+	assert.True(t, gorm.IsRecordNotFoundError(err))
+}
+
+func testGroupFind(t *testing.T, newRepo GroupRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	seedGroups(t, repo)
+
+	tt := []struct {
+		name    string
+		parent  *device.UUID
+		page    *model.Page
+		wantIds []device.UUID
+	}{
+		{name: "all", page: &model.Page{Limit: 10}, wantIds: []device.UUID{fleet, subFleet, leaf, other}},
+		{name: "page", page: &model.Page{Limit: 2, Offset: 1}, wantIds: []device.UUID{subFleet, leaf}},
+		{name: "children", parent: uuidOf(fleet), page: &model.Page{Limit: 10}, wantIds: []device.UUID{subFleet}},
+		{name: "no children", parent: uuidOf(leaf), page: &model.Page{Limit: 10}, wantIds: []device.UUID{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			groups, err := repo.Find(context.Background(), tc.parent, tc.page)
+			assert.NoError(t, err)
+			ids := []device.UUID{}
+			for _, g := range groups {
+				ids = append(ids, g.Id)
+			}
+			assert.ElementsMatch(t, tc.wantIds, ids)
+		})
+	}
+}
+
+func testGroupDescendants(t *testing.T, newRepo GroupRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	seedGroups(t, repo)
+
+	tt := []struct {
+		name    string
+		id      device.UUID
+		wantIds []device.UUID
+	}{
+		{name: "root", id: fleet, wantIds: []device.UUID{fleet, subFleet, leaf}},
+		{name: "middle", id: subFleet, wantIds: []device.UUID{subFleet, leaf}},
+		{name: "leaf", id: leaf, wantIds: []device.UUID{leaf}},
+		{name: "missing", id: "0b0c6d0e-8a43-4a4e-9f43-7f1f0a000009", wantIds: []device.UUID{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ids, err := repo.Descendants(context.Background(), tc.id)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tc.wantIds, ids)
+		})
+	}
+
+	// a cycle ends
+	_, err := repo.Update(context.Background(), newGroup(fleet, "fleet", uuidOf(leaf)))
+	assert.NoError(t, err)
+	ids, err := repo.Descendants(context.Background(), fleet)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []device.UUID{fleet, subFleet, leaf}, ids)
+}
+
+func testGroupContext(t *testing.T, newRepo GroupRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	seedGroups(t, repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.Get(ctx, fleet)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Create(ctx, newGroup("0b0c6d0e-8a43-4a4e-9f43-7f1f0a000009", "new", nil))
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Update(ctx, newGroup(fleet, "renamed", nil))
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Delete(ctx, other)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Find(ctx, nil, &model.Page{Limit: 10})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Descendants(ctx, fleet)
+	assert.Equal(t, context.Canceled, err)
+
+	// nothing was written
+	g, err := repo.Get(context.Background(), fleet)
+	assert.NoError(t, err)
+	assert.Equal(t, "fleet", g.Name)
+	_, err = repo.Get(context.Background(), other)
+	assert.NoError(t, err)
+}
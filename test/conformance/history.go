@@ -0,0 +1,115 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/model"
+	"github/demo/model/device"
+)
+
+// HistoryRepoFactory returns an empty history repository and the func
+// releasing it
+type HistoryRepoFactory func(t *testing.T) (device.HistoryRepository, func(t *testing.T))
+
+// HistoryRepository runs the conformance suite of device.HistoryRepository
+// against the repositories of newRepo, a new one per case
+func HistoryRepository(t *testing.T, newRepo HistoryRepoFactory) {
+	tt := []struct {
+		name string
+		run  func(t *testing.T, newRepo HistoryRepoFactory)
+	}{
+		{name: "Create", run: testHistoryCreate},
+		{name: "Find", run: testHistoryFind},
+		{name: "Context", run: testHistoryContext},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newRepo)
+		})
+	}
+}
+
+func history(id device.UUID, action string, createTime int64) *device.History {
+	return &device.History{
+		DeviceId:   id,
+		Action:     action,
+		Actor:      "tester",
+		RequestId:  "req-" + action,
+		Changes:    `{"color":{"before":"","after":"White"}}`,
+		CreateTime: createTime,
+	}
+}
+
+func testHistoryCreate(t *testing.T, newRepo HistoryRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+
+	first := history(device1().Id, device.ActionCreate, 1)
+	assert.NoError(t, repo.Create(context.Background(), first))
+	assert.NotZero(t, first.Id)
+
+	second := history(device1().Id, device.ActionUpdate, 2)
+	assert.NoError(t, repo.Create(context.Background(), second))
+	assert.NotEqual(t, first.Id, second.Id)
+
+	found, err := repo.Find(context.Background(), device1().Id, &model.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, []*device.History{second, first}, found)
+}
+
+func testHistoryFind(t *testing.T, newRepo HistoryRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+
+	for i, action := range []string{device.ActionCreate, device.ActionUpdate, device.ActionDelete} {
+		assert.NoError(t, repo.Create(context.Background(), history(device1().Id, action, int64(i+1))))
+	}
+	assert.NoError(t, repo.Create(context.Background(), history(device2().Id, device.ActionCreate, 4)))
+
+	tt := []struct {
+		name        string
+		id          device.UUID
+		page        *model.Page
+		wantActions []string
+	}{
+		{name: "newest first", id: device1().Id, page: &model.Page{Limit: 10}, wantActions: []string{device.ActionDelete, device.ActionUpdate, device.ActionCreate}},
+		{name: "page", id: device1().Id, page: &model.Page{Limit: 2, Offset: 1}, wantActions: []string{device.ActionUpdate, device.ActionCreate}},
+		{name: "other device", id: device2().Id, page: &model.Page{Limit: 10}, wantActions: []string{device.ActionCreate}},
+		{name: "no history", id: device3().Id, page: &model.Page{Limit: 10}, wantActions: []string{}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			found, err := repo.Find(context.Background(), tc.id, tc.page)
+			assert.NoError(t, err)
+			actions := []string{}
+			for _, h := range found {
+				assert.Equal(t, tc.id, h.DeviceId)
+				actions = append(actions, h.Action)
+			}
+			assert.Equal(t, tc.wantActions, actions)
+		})
+	}
+}
+
+func testHistoryContext(t *testing.T, newRepo HistoryRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := repo.Create(ctx, history(device1().Id, device.ActionCreate, 1))
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Find(ctx, device1().Id, &model.Page{Limit: 10})
+	assert.Equal(t, context.Canceled, err)
+
+	// nothing was written
+	found, err := repo.Find(context.Background(), device1().Id, &model.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+}
@@ -0,0 +1,248 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/model/telemetry"
+)
+
+// TelemetryRepoFactory returns an empty telemetry repository and the func
+// releasing it
+type TelemetryRepoFactory func(t *testing.T) (telemetry.Repository, func(t *testing.T))
+
+// TelemetryRepository runs the conformance suite of telemetry.Repository
+// against the repositories of newRepo, a new one per case
+func TelemetryRepository(t *testing.T, newRepo TelemetryRepoFactory) {
+	tt := []struct {
+		name string
+		run  func(t *testing.T, newRepo TelemetryRepoFactory)
+	}{
+		{name: "Append", run: testTelemetryAppend},
+		{name: "Series", run: testTelemetrySeries},
+		{name: "Rollup", run: testTelemetryRollup},
+		{name: "Purge", run: testTelemetryPurge},
+		{name: "Context", run: testTelemetryContext},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newRepo)
+		})
+	}
+}
+
+// point returns a point of device1 at minute m and second s
+func point(metric string, m, s int64, v float64) *telemetry.Point {
+	return &telemetry.Point{
+		DeviceId: device1().Id,
+		Metric:   metric,
+		Time:     m*telemetry.Minute + s*1000,
+		Value:    v,
+	}
+}
+
+// seedTelemetry stores temperatures in the minutes 0, 1 and 61 and a battery
+// level in the minute 0
+func seedTelemetry(t *testing.T, repo telemetry.Repository) {
+	stored, err := repo.Append(context.Background(), []*telemetry.Point{
+		point("temperature", 0, 0, 20),
+		point("temperature", 0, 30, 22),
+		point("temperature", 1, 0, 21),
+		point("temperature", 61, 0, 30),
+		point("battery", 0, 0, 90),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), stored)
+}
+
+func testTelemetryAppend(t *testing.T, newRepo TelemetryRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedTelemetry(t, repo)
+
+	// a point sent again is kept as it is
+	stored, err := repo.Append(ctx, []*telemetry.Point{
+		point("temperature", 0, 0, 99),
+		point("temperature", 2, 0, 23),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stored)
+
+	buckets, err := repo.Series(ctx, &telemetry.Query{
+		DeviceId: device1().Id, Metric: "temperature", From: 0, To: telemetry.Minute, Step: telemetry.Minute,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*telemetry.Bucket{
+		{Time: 0, Count: 2, Sum: 42, Min: 20, Max: 22},
+	}, buckets)
+}
+
+func testTelemetrySeries(t *testing.T, newRepo TelemetryRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+
+	seedTelemetry(t, repo)
+
+	tt := []struct {
+		description string
+		query       *telemetry.Query
+		expected    []*telemetry.Bucket
+	}{
+		{
+			description: "by minute",
+			query:       &telemetry.Query{DeviceId: device1().Id, Metric: "temperature", From: 0, To: 2 * telemetry.Hour, Step: telemetry.Minute},
+			expected: []*telemetry.Bucket{
+				{Time: 0, Count: 2, Sum: 42, Min: 20, Max: 22},
+				{Time: telemetry.Minute, Count: 1, Sum: 21, Min: 21, Max: 21},
+				{Time: 61 * telemetry.Minute, Count: 1, Sum: 30, Min: 30, Max: 30},
+			},
+		},
+		{
+			description: "by hour",
+			query:       &telemetry.Query{DeviceId: device1().Id, Metric: "temperature", From: 0, To: 2 * telemetry.Hour, Step: telemetry.Hour},
+			expected: []*telemetry.Bucket{
+				{Time: 0, Count: 3, Sum: 63, Min: 20, Max: 22},
+				{Time: telemetry.Hour, Count: 1, Sum: 30, Min: 30, Max: 30},
+			},
+		},
+		{
+			description: "range end excluded",
+			query:       &telemetry.Query{DeviceId: device1().Id, Metric: "temperature", From: 30 * 1000, To: 61 * telemetry.Minute, Step: 30 * 1000},
+			expected: []*telemetry.Bucket{
+				{Time: 30 * 1000, Count: 1, Sum: 22, Min: 22, Max: 22},
+				{Time: telemetry.Minute, Count: 1, Sum: 21, Min: 21, Max: 21},
+			},
+		},
+		{
+			description: "other metric",
+			query:       &telemetry.Query{DeviceId: device1().Id, Metric: "battery", From: 0, To: telemetry.Hour, Step: telemetry.Hour},
+			expected: []*telemetry.Bucket{
+				{Time: 0, Count: 1, Sum: 90, Min: 90, Max: 90},
+			},
+		},
+		{
+			description: "other device",
+			query:       &telemetry.Query{DeviceId: device2().Id, Metric: "temperature", From: 0, To: telemetry.Hour, Step: telemetry.Hour},
+			expected:    []*telemetry.Bucket{},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			buckets, err := repo.Series(context.Background(), tc.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, buckets)
+		})
+	}
+}
+
+func testTelemetryRollup(t *testing.T, newRepo TelemetryRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedTelemetry(t, repo)
+	metrics := []string{"temperature", "battery"}
+
+	assert.NoError(t, repo.Rollup(ctx, device1().Id, metrics, 0, telemetry.Minute, 0, 2*telemetry.Hour))
+	assert.NoError(t, repo.Rollup(ctx, device1().Id, metrics, telemetry.Minute, telemetry.Hour, 0, 2*telemetry.Hour))
+	// rolling up again replaces the buckets
+	_, err := repo.Append(ctx, []*telemetry.Point{point("temperature", 1, 30, 25)})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Rollup(ctx, device1().Id, metrics, 0, telemetry.Minute, telemetry.Minute, 2*telemetry.Minute))
+	assert.NoError(t, repo.Rollup(ctx, device1().Id, metrics, telemetry.Minute, telemetry.Hour, 0, telemetry.Hour))
+
+	buckets, err := repo.Series(ctx, &telemetry.Query{
+		DeviceId: device1().Id, Metric: "temperature", From: 0, To: 2 * telemetry.Hour, Step: telemetry.Minute, Source: telemetry.Minute,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*telemetry.Bucket{
+		{Time: 0, Count: 2, Sum: 42, Min: 20, Max: 22},
+		{Time: telemetry.Minute, Count: 2, Sum: 46, Min: 21, Max: 25},
+		{Time: 61 * telemetry.Minute, Count: 1, Sum: 30, Min: 30, Max: 30},
+	}, buckets)
+
+	buckets, err = repo.Series(ctx, &telemetry.Query{
+		DeviceId: device1().Id, Metric: "temperature", From: 0, To: 2 * telemetry.Hour, Step: 2 * telemetry.Hour, Source: telemetry.Hour,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*telemetry.Bucket{
+		{Time: 0, Count: 5, Sum: 118, Min: 20, Max: 30},
+	}, buckets)
+
+	// the rollups outlive the points
+	_, err = repo.Purge(ctx, 0, 2*telemetry.Hour)
+	assert.NoError(t, err)
+	buckets, err = repo.Series(ctx, &telemetry.Query{
+		DeviceId: device1().Id, Metric: "battery", From: 0, To: 2 * telemetry.Hour, Step: telemetry.Hour, Source: telemetry.Hour,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*telemetry.Bucket{
+		{Time: 0, Count: 1, Sum: 90, Min: 90, Max: 90},
+	}, buckets)
+}
+
+func testTelemetryPurge(t *testing.T, newRepo TelemetryRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+	ctx := context.Background()
+
+	seedTelemetry(t, repo)
+	assert.NoError(t, repo.Rollup(ctx, device1().Id, []string{"temperature"}, 0, telemetry.Minute, 0, 2*telemetry.Hour))
+
+	deleted, err := repo.Purge(ctx, 0, telemetry.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+	deleted, err = repo.Purge(ctx, telemetry.Minute, 2*telemetry.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	// there are no rollups of an hour
+	deleted, err = repo.Purge(ctx, telemetry.Hour, 2*telemetry.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+
+	buckets, err := repo.Series(ctx, &telemetry.Query{
+		DeviceId: device1().Id, Metric: "temperature", From: 0, To: 2 * telemetry.Hour, Step: telemetry.Hour,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*telemetry.Bucket{
+		{Time: 0, Count: 1, Sum: 21, Min: 21, Max: 21},
+		{Time: telemetry.Hour, Count: 1, Sum: 30, Min: 30, Max: 30},
+	}, buckets)
+	buckets, err = repo.Series(ctx, &telemetry.Query{
+		DeviceId: device1().Id, Metric: "temperature", From: 0, To: 2 * telemetry.Hour, Step: telemetry.Hour, Source: telemetry.Minute,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*telemetry.Bucket{
+		{Time: telemetry.Hour, Count: 1, Sum: 30, Min: 30, Max: 30},
+	}, buckets)
+}
+
+func testTelemetryContext(t *testing.T, newRepo TelemetryRepoFactory) {
+	repo, teardown := newRepo(t)
+	defer teardown(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := repo.Append(ctx, []*telemetry.Point{point("temperature", 0, 0, 20)})
+	assert.Equal(t, context.Canceled, err)
+	err = repo.Rollup(ctx, device1().Id, []string{"temperature"}, 0, telemetry.Minute, 0, telemetry.Hour)
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Series(ctx, &telemetry.Query{DeviceId: device1().Id, Metric: "temperature", From: 0, To: telemetry.Hour, Step: telemetry.Hour})
+	assert.Equal(t, context.Canceled, err)
+	_, err = repo.Purge(ctx, 0, telemetry.Hour)
+	assert.Equal(t, context.Canceled, err)
+
+	// nothing was written
+	buckets, err := repo.Series(context.Background(), &telemetry.Query{
+		DeviceId: device1().Id, Metric: "temperature", From: 0, To: telemetry.Hour, Step: telemetry.Hour,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*telemetry.Bucket{}, buckets)
+}
@@ -0,0 +1,169 @@
+// Package artifact keeps the files uploaded to the service, such as firmware
+// images, in a directory.
+package artifact
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github/demo/utils/trace"
+)
+
+var (
+	// ErrNotFound is returned for an artifact that isn't stored
+	ErrNotFound = errors.New("artifact not found")
+	// ErrTooLarge is returned for an artifact over the size limit
+	ErrTooLarge = errors.New("artifact too large")
+)
+
+// Info describes a stored artifact
+type Info struct {
+	// Digest is the SHA-256 digest of the content, in hex
+	Digest string
+	Size   int64
+}
+
+// Store keeps the artifacts under their name, one file per artifact. An
+// artifact is written to a temporary file first, a reader never sees one
+// half written.
+type Store struct {
+	dir string
+}
+
+// NewStore returns the store of the artifacts in dir, created on the first
+// Put
+func NewStore(dir string) *Store {
+	return &Store{
+		dir: dir,
+	}
+}
+
+// Put stores the content of r as artifact name, replacing it if it exists,
+// and returns its digest and size. Content over limit bytes is not stored,
+// limit 0 is no limit.
+func (s *Store) Put(ctx context.Context, name string, r io.Reader, limit int64) (*Info, error) {
+	_, span := trace.Start(ctx, "artifactStore.Put")
+	defer span.Finish()
+
+	path, err := s.path(name)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+
+	f, err := ioutil.TempFile(s.dir, "."+name+".*")
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	// the temporary file is gone once renamed, removing it then is a no-op
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), &contextReader{ctx: ctx, r: r})
+	if err == nil && limit > 0 && size > limit {
+		err = ErrTooLarge
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	return &Info{
+		Digest: hex.EncodeToString(h.Sum(nil)),
+		Size:   size,
+	}, nil
+}
+
+// Open returns the content of artifact name and its size, the caller closes
+// it
+func (s *Store) Open(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	_, span := trace.Start(ctx, "artifactStore.Open")
+	defer span.Finish()
+
+	path, err := s.path(name)
+	if err != nil {
+		span.SetError(err)
+		return nil, 0, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		span.SetError(err)
+		return nil, 0, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		span.SetError(err)
+		return nil, 0, err
+	}
+	return f, fi.Size(), nil
+}
+
+// Delete removes artifact name, removing one that isn't stored is not an
+// error
+func (s *Store) Delete(ctx context.Context, name string) error {
+	_, span := trace.Start(ctx, "artifactStore.Delete")
+	defer span.Finish()
+
+	path, err := s.path(name)
+	if err != nil {
+		span.SetError(err)
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		span.SetError(err)
+		return err
+	}
+	return nil
+}
+
+// path returns the file of artifact name, a name can't leave the directory
+// of the store
+func (s *Store) path(name string) (string, error) {
+	if len(name) == 0 || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("artifact name %q invalid", name)
+	}
+	return filepath.Join(s.dir, name), nil
+}
+
+// contextReader stops reading once its context is done, an upload stops
+// with the request that sends it
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,70 @@
+package artifact_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/utils/artifact"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifact")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the directory is created on the first put
+	s := artifact.NewStore(filepath.Join(dir, "firmware"))
+	ctx := context.Background()
+
+	info, err := s.Put(ctx, "a", strings.NewReader("hello"), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, &artifact.Info{
+		Digest: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		Size:   5,
+	}, info)
+
+	r, size, err := s.Open(ctx, "a")
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+	assert.Equal(t, int64(5), size)
+
+	// an artifact over the limit is not stored, the one before is kept
+	_, err = s.Put(ctx, "a", bytes.NewReader(make([]byte, 11)), 10)
+	assert.Equal(t, artifact.ErrTooLarge, err)
+	_, size, err = s.Open(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), size)
+
+	// a cancelled upload is not stored
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = s.Put(cctx, "b", strings.NewReader("hello"), 0)
+	assert.Equal(t, context.Canceled, err)
+	_, _, err = s.Open(ctx, "b")
+	assert.Equal(t, artifact.ErrNotFound, err)
+
+	// no temporary file is left
+	files, err := ioutil.ReadDir(filepath.Join(dir, "firmware"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	for _, name := range []string{"", "../a", ".a", `x\y`} {
+		_, err = s.Put(ctx, name, strings.NewReader("hello"), 0)
+		assert.Error(t, err, name)
+	}
+
+	assert.NoError(t, s.Delete(ctx, "a"))
+	assert.NoError(t, s.Delete(ctx, "a"))
+	_, _, err = s.Open(ctx, "a")
+	assert.Equal(t, artifact.ErrNotFound, err)
+}
@@ -0,0 +1,26 @@
+// Package audit carries who is behind a request, for the records of the
+// changes it makes.
+package audit
+
+import "context"
+
+// Anonymous is the actor of a context without one
+const Anonymous = "anonymous"
+
+type actorKey struct{}
+
+// NewContext returns a copy of ctx that carries actor
+func NewContext(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor returns the actor stored in ctx, or Anonymous
+func Actor(ctx context.Context) string {
+	if ctx == nil {
+		return Anonymous
+	}
+	if actor, _ := ctx.Value(actorKey{}).(string); len(actor) > 0 {
+		return actor
+	}
+	return Anonymous
+}
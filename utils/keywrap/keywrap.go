@@ -0,0 +1,75 @@
+// Package keywrap seals the private keys kept by the service with a
+// key-encryption key, so the database only ever holds them encrypted.
+package keywrap
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Size of a key-encryption key, AES-256
+const Size = 32
+
+// ErrUnwrap is returned for a wrapped key that isn't sealed by the KEK or was
+// changed since
+var ErrUnwrap = errors.New("key unwrap failed")
+
+// KEK is a key-encryption key, it wraps a key with AES-GCM
+type KEK struct {
+	aead cipher.AEAD
+}
+
+// Parse returns the KEK of s, Size bytes in base64
+func Parse(s string) (*KEK, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("key-encryption key not base64: %v", err)
+	}
+	return New(key)
+}
+
+// New returns the KEK of key, Size bytes
+func New(key []byte) (*KEK, error) {
+	if len(key) != Size {
+		return nil, fmt.Errorf("key-encryption key is %d bytes, not %d", len(key), Size)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &KEK{aead: aead}, nil
+}
+
+// Wrap seals key, bound to id, and returns the nonce and the sealed key in
+// base64. The same id must be given to Unwrap, a wrapped key copied to
+// another id doesn't unwrap.
+func (k *KEK) Wrap(id string, key []byte) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(k.aead.Seal(nonce, nonce, key, []byte(id))), nil
+}
+
+// Unwrap opens wrapped, a key of id sealed by Wrap
+func (k *KEK) Unwrap(id, wrapped string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || len(b) < k.aead.NonceSize() {
+		return nil, ErrUnwrap
+	}
+	n := k.aead.NonceSize()
+	key, err := k.aead.Open(nil, b[:n], b[n:], []byte(id))
+	if err != nil {
+		return nil, ErrUnwrap
+	}
+	return key, nil
+}
@@ -0,0 +1,63 @@
+package keywrap_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/utils/keywrap"
+)
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		description string
+		kek         string
+		expectedErr bool
+	}{
+		{description: "32 bytes", kek: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))},
+		{description: "16 bytes", kek: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 16)), expectedErr: true},
+		{description: "not base64", kek: "not base64!", expectedErr: true},
+		{description: "empty", expectedErr: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := keywrap.Parse(tc.kek)
+			assert.Equal(t, tc.expectedErr, err != nil, "%v", err)
+		})
+	}
+}
+
+func TestKEK(t *testing.T) {
+	kek, err := keywrap.New(bytes.Repeat([]byte{1}, keywrap.Size))
+	assert.NoError(t, err)
+	other, err := keywrap.New(bytes.Repeat([]byte{2}, keywrap.Size))
+	assert.NoError(t, err)
+	secret := []byte("a private key")
+
+	wrapped, err := kek.Wrap("k1", secret)
+	assert.NoError(t, err)
+	b, err := base64.StdEncoding.DecodeString(wrapped)
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(b, secret))
+
+	again, err := kek.Wrap("k1", secret)
+	assert.NoError(t, err)
+	assert.NotEqual(t, wrapped, again, "a new nonce per wrap")
+
+	key, err := kek.Unwrap("k1", wrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, secret, key)
+
+	_, err = kek.Unwrap("k2", wrapped)
+	assert.Equal(t, keywrap.ErrUnwrap, err, "bound to its id")
+	_, err = other.Unwrap("k1", wrapped)
+	assert.Equal(t, keywrap.ErrUnwrap, err, "another KEK")
+	b[len(b)-1] ^= 1
+	_, err = kek.Unwrap("k1", base64.StdEncoding.EncodeToString(b))
+	assert.Equal(t, keywrap.ErrUnwrap, err, "changed")
+	_, err = kek.Unwrap("k1", "")
+	assert.Equal(t, keywrap.ErrUnwrap, err, "empty")
+}
@@ -0,0 +1,102 @@
+package log
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/sirupsen/logrus"
+)
+
+type requestIDKey struct{}
+
+// NewContext returns a copy of ctx that carries the request id
+func NewContext(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request id stored in ctx, or an empty string
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Entry is a logger bound to a context, every line it writes carries the
+// request id of that context.
+type Entry struct {
+	fields logrus.Fields
+}
+
+// WithContext returns a logger bound to ctx
+func WithContext(ctx context.Context) *Entry {
+	e := &Entry{fields: logrus.Fields{}}
+	if id := RequestID(ctx); len(id) > 0 {
+		e.fields[requestIDTag] = id
+	}
+	return e
+}
+
+// WithField returns a copy of e with the field added
+func (e *Entry) WithField(key string, value interface{}) *Entry {
+	fields := make(logrus.Fields, len(e.fields)+1)
+	for k, v := range e.fields {
+		fields[k] = v
+	}
+	fields[key] = value
+	return &Entry{fields: fields}
+}
+
+func (e *Entry) entry(showFileInfo bool) *logrus.Entry {
+	entry := logrus.WithFields(e.fields)
+	if !showFileInfo {
+		return entry
+	}
+
+	if pc, file, line, ok := runtime.Caller(2); ok {
+		fileName, funcName := getBaseName(file, runtime.FuncForPC(pc).Name())
+		entry = entry.WithField(fileTag, fileName).WithField(lineTag, line).WithField(funcTag, funcName)
+	}
+	return entry
+}
+
+// Debug logs a message at level Debug with the context fields.
+func (e *Entry) Debug(args ...interface{}) {
+	e.entry(rtLogConf.showFileInfo).Debug(args...)
+}
+
+// Debugf logs a message at level Debug with the context fields.
+func (e *Entry) Debugf(msg string, args ...interface{}) {
+	e.entry(rtLogConf.showFileInfo).Debugf(msg, args...)
+}
+
+// Info logs a message at level Info with the context fields.
+func (e *Entry) Info(args ...interface{}) {
+	e.entry(rtLogConf.showFileInfo).Info(args...)
+}
+
+// Infof logs a message at level Info with the context fields.
+func (e *Entry) Infof(msg string, args ...interface{}) {
+	e.entry(rtLogConf.showFileInfo).Infof(msg, args...)
+}
+
+// Warn logs a message at level Warn with the context fields.
+func (e *Entry) Warn(args ...interface{}) {
+	e.entry(rtLogConf.showFileInfo).Warn(args...)
+}
+
+// Warnf logs a message at level Warn with the context fields.
+func (e *Entry) Warnf(msg string, args ...interface{}) {
+	e.entry(rtLogConf.showFileInfo).Warnf(msg, args...)
+}
+
+// Error logs a message at level Error with the context fields.
+func (e *Entry) Error(args ...interface{}) {
+	e.entry(true).Error(args...)
+}
+
+// Errorf logs a message at level Error with the context fields.
+func (e *Entry) Errorf(msg string, args ...interface{}) {
+	e.entry(true).Errorf(msg, args...)
+}
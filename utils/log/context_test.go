@@ -0,0 +1,21 @@
+package log_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/utils/log"
+)
+
+func TestWithContext(t *testing.T) {
+	log.Init("development", "", "debug")
+	log.SetFormat(false, false)
+	ctx := log.NewContext(context.Background(), "req-1")
+	re := captureOutput(func() {
+		log.WithContext(ctx).Info("info")
+	})
+	assert.Contains(t, re, "request_id=req-1")
+	assert.Contains(t, re, "file=context_test.go")
+}
@@ -19,10 +19,11 @@ Debug Level Setting
 - panic
 *************************************************/
 
-const (
-	fileTag = "file"
-	lineTag = "line"
-	funcTag = "func"
+var (
+	fileTag      = "file"
+	lineTag      = "line"
+	funcTag      = "func"
+	requestIDTag = "request_id"
 )
 
 type logConf struct {
@@ -0,0 +1,229 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Output formats
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// Output sinks
+const (
+	SinkStdout = "stdout"
+	SinkStderr = "stderr"
+	SinkFile   = "file"
+	SinkSyslog = "syslog"
+)
+
+// Options describes where and how the logger writes.
+//
+// Empty Format and Sinks fall back to the defaults of the environment:
+// development writes colored text to stderr, testbed writes text to the file
+// and stdout, production writes text to the file only.
+type Options struct {
+	Env      string
+	Level    string
+	Format   string
+	Sinks    []string
+	Filename string
+	// Rotate configures the rotation of the file sink
+	Rotate Rotate
+	// Syslog address as network://host:port, empty for the local socket
+	Syslog string
+	// Fields renames the output keys: time, level, msg, file, line, func and
+	// request_id
+	Fields map[string]string
+}
+
+func (o *Options) format() string {
+	if len(o.Format) > 0 {
+		return o.Format
+	}
+	return FormatText
+}
+
+func (o *Options) sinks() []string {
+	if len(o.Sinks) > 0 {
+		return o.Sinks
+	}
+
+	switch o.Env {
+	case "testbed":
+		if len(o.Filename) > 0 {
+			return []string{SinkFile, SinkStdout}
+		}
+		return []string{SinkStdout}
+	case "production":
+		if len(o.Filename) > 0 {
+			return []string{SinkFile}
+		}
+		return []string{SinkStdout}
+	default:
+		return []string{SinkStderr}
+	}
+}
+
+// Setup configures the standard logger from o
+func Setup(o Options) error {
+	debugLV, err := logrus.ParseLevel(o.Level)
+	if err != nil {
+		debugLV = logrus.InfoLevel
+	}
+
+	formatter, err := newFormatter(o.format(), o.Env == "development", o.Fields)
+	if err != nil {
+		return err
+	}
+
+	// build every sink before touching the globals, a failing sink leaves the
+	// previous configuration in place
+	var writers []io.Writer
+	var file *rotateWriter
+	var hooks []logrus.Hook
+	fail := func(err error) error {
+		if file != nil {
+			file.Close()
+		}
+		for _, hook := range hooks {
+			closeHook(hook)
+		}
+		return err
+	}
+	for _, sink := range o.sinks() {
+		switch strings.TrimSpace(sink) {
+		case SinkStdout:
+			writers = append(writers, os.Stdout)
+		case SinkStderr:
+			writers = append(writers, os.Stderr)
+		case SinkFile:
+			if len(o.Filename) <= 0 {
+				return fail(fmt.Errorf("log sink %q needs a filename", SinkFile))
+			}
+			if file != nil {
+				continue
+			}
+			w, err := newRotateWriter(o.Filename, o.Rotate)
+			if err != nil {
+				return fail(err)
+			}
+			file = w
+			writers = append(writers, w)
+		case SinkSyslog:
+			hook, err := newSyslogHook(o.Syslog)
+			if err != nil {
+				return fail(err)
+			}
+			hooks = append(hooks, hook)
+		default:
+			return fail(fmt.Errorf("log sink not support: %q", sink))
+		}
+	}
+
+	logger := logrus.StandardLogger()
+	levelHooks := make(logrus.LevelHooks)
+	for _, hook := range hooks {
+		levelHooks.Add(hook)
+	}
+	logger.ReplaceHooks(levelHooks)
+	setFieldTags(o.Fields)
+	logrus.SetLevel(debugLV)
+	logrus.SetFormatter(formatter)
+	switch len(writers) {
+	case 0:
+		logrus.SetOutput(ioutil.Discard)
+	case 1:
+		logrus.SetOutput(writers[0])
+	default:
+		logrus.SetOutput(io.MultiWriter(writers...))
+	}
+	rtLogConf.showFileInfo = o.Env != "production"
+	setFileSink(file)
+
+	return nil
+}
+
+// Close flushes and releases the file sink, later entries go to stderr
+func Close() {
+	logrus.SetOutput(os.Stderr)
+	setFileSink(nil)
+}
+
+var (
+	fileSinkMu sync.Mutex
+	fileSink   *rotateWriter
+)
+
+// setFileSink closes the file sink of a previous Setup and watches the
+// reopen signal for the new one
+func setFileSink(w *rotateWriter) {
+	fileSinkMu.Lock()
+	defer fileSinkMu.Unlock()
+
+	if fileSink != nil {
+		stopReopen()
+		fileSink.Close()
+	}
+	fileSink = w
+	if w != nil {
+		watchReopen(w)
+	}
+}
+
+func newFormatter(format string, color bool, fields map[string]string) (logrus.Formatter, error) {
+	fieldMap := logrus.FieldMap{}
+	if v, ok := fields[logrus.FieldKeyTime]; ok {
+		fieldMap[logrus.FieldKeyTime] = v
+	}
+	if v, ok := fields[logrus.FieldKeyLevel]; ok {
+		fieldMap[logrus.FieldKeyLevel] = v
+	}
+	if v, ok := fields[logrus.FieldKeyMsg]; ok {
+		fieldMap[logrus.FieldKeyMsg] = v
+	}
+
+	switch format {
+	case FormatText:
+		return &logrus.TextFormatter{ForceColors: color, FullTimestamp: true, FieldMap: fieldMap}, nil
+	case FormatLogfmt:
+		return &logrus.TextFormatter{DisableColors: true, FullTimestamp: true, QuoteEmptyFields: true, FieldMap: fieldMap}, nil
+	case FormatJSON:
+		return &logrus.JSONFormatter{FieldMap: fieldMap}, nil
+	default:
+		return nil, fmt.Errorf("log format not support: %q", format)
+	}
+}
+
+func setFieldTags(fields map[string]string) {
+	fileTag, lineTag, funcTag, requestIDTag = "file", "line", "func", "request_id"
+	if v, ok := fields["file"]; ok {
+		fileTag = v
+	}
+	if v, ok := fields["line"]; ok {
+		lineTag = v
+	}
+	if v, ok := fields["func"]; ok {
+		funcTag = v
+	}
+	if v, ok := fields["request_id"]; ok {
+		requestIDTag = v
+	}
+}
+
+func openFile(filename string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0744); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+}
@@ -0,0 +1,111 @@
+package log_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/utils/log"
+)
+
+func TestSetup(t *testing.T) {
+	tt := []struct {
+		description string
+		options     log.Options
+		err         string
+		check       func(t *testing.T, line string)
+	}{
+		{
+			description: "json with renamed fields",
+			options: log.Options{
+				Format: log.FormatJSON,
+				Fields: map[string]string{"msg": "message", "file": "caller_file", "request_id": "rid"},
+			},
+			check: func(t *testing.T, line string) {
+				m := make(map[string]interface{})
+				assert.NoError(t, json.Unmarshal([]byte(line), &m))
+				assert.Equal(t, "hello", m["message"])
+				assert.Equal(t, "options_test.go", m["caller_file"])
+				assert.Equal(t, "req-1", m["rid"])
+				assert.Contains(t, m, "line")
+				assert.Contains(t, m, "func")
+			},
+		},
+		{
+			description: "logfmt",
+			options: log.Options{
+				Format: log.FormatLogfmt,
+			},
+			check: func(t *testing.T, line string) {
+				assert.Contains(t, line, `msg=hello`)
+				assert.Contains(t, line, `request_id=req-1`)
+				assert.NotContains(t, line, "\x1b[")
+			},
+		},
+		{
+			description: "unknown format",
+			options:     log.Options{Format: "xml"},
+			err:         `log format not support: "xml"`,
+		},
+		{
+			description: "unknown sink",
+			options:     log.Options{Sinks: []string{"kafka"}},
+			err:         `log sink not support: "kafka"`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			name := filepath.Join(os.TempDir(), "log"+uuid.Must(uuid.NewV4()).String(), "demo.log")
+			defer os.RemoveAll(filepath.Dir(name))
+			defer log.Setup(log.Options{Env: "development", Level: "debug"})
+
+			tc.options.Env = "development"
+			tc.options.Level = "debug"
+			tc.options.Filename = name
+			if len(tc.options.Sinks) == 0 {
+				tc.options.Sinks = []string{log.SinkFile}
+			}
+			err := log.Setup(tc.options)
+			if len(tc.err) > 0 {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+
+			log.WithContext(log.NewContext(context.Background(), "req-1")).Info("hello")
+			b, err := ioutil.ReadFile(name)
+			assert.NoError(t, err)
+			tc.check(t, strings.TrimSpace(string(b)))
+		})
+	}
+}
+
+func TestSetup_KeepOnError(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "log"+uuid.Must(uuid.NewV4()).String())
+	defer os.RemoveAll(dir)
+	defer log.Setup(log.Options{Env: "development", Level: "debug"})
+
+	prev := filepath.Join(dir, "prev.log")
+	assert.NoError(t, log.Setup(log.Options{Env: "development", Level: "debug", Sinks: []string{log.SinkFile}, Filename: prev}))
+
+	next := filepath.Join(dir, "next.log")
+	err := log.Setup(log.Options{Env: "development", Level: "debug", Format: log.FormatJSON, Sinks: []string{log.SinkFile, "kafka"}, Filename: next})
+	assert.EqualError(t, err, `log sink not support: "kafka"`)
+
+	log.Info("still here")
+	b, err := ioutil.ReadFile(prev)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "still here")
+	assert.NotContains(t, string(b), "{")
+	b, err = ioutil.ReadFile(next)
+	assert.NoError(t, err)
+	assert.Empty(t, b)
+}
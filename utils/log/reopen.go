@@ -0,0 +1,40 @@
+// +build !windows,!plan9
+
+package log
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var reopenStop chan struct{}
+
+// watchReopen reopens w on SIGUSR1 so external rotators can move the file
+func watchReopen(w *rotateWriter) {
+	sig := make(chan os.Signal, 1)
+	stop := make(chan struct{})
+	signal.Notify(sig, syscall.SIGUSR1)
+	reopenStop = stop
+
+	go func() {
+		defer signal.Stop(sig)
+		for {
+			select {
+			case <-sig:
+				if err := w.Reopen(); err != nil {
+					Errorf("log reopen %s fail => %+v", w.filename, err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func stopReopen() {
+	if reopenStop != nil {
+		close(reopenStop)
+		reopenStop = nil
+	}
+}
@@ -0,0 +1,7 @@
+// +build windows plan9
+
+package log
+
+func watchReopen(w *rotateWriter) {}
+
+func stopReopen() {}
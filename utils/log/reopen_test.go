@@ -0,0 +1,47 @@
+// +build !windows,!plan9
+
+package log_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/utils/log"
+)
+
+func TestReopen(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "log"+uuid.Must(uuid.NewV4()).String())
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "demo.log")
+
+	err := log.Setup(log.Options{
+		Env:      "production",
+		Level:    "info",
+		Format:   log.FormatLogfmt,
+		Sinks:    []string{log.SinkFile},
+		Filename: name,
+	})
+	assert.NoError(t, err)
+	defer log.Setup(log.Options{Env: "development", Level: "debug"})
+
+	log.Info("before")
+	assert.NoError(t, os.Rename(name, name+".1"))
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(name)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	log.Info("after")
+	b, err := ioutil.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "msg=after")
+	assert.NotContains(t, string(b), "msg=before")
+}
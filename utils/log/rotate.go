@@ -0,0 +1,301 @@
+package log
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	megabyte     = 1024 * 1024
+	backupFormat = "20060102T150405.000"
+	compressExt  = ".gz"
+)
+
+// Rotate configures the rotation of the file sink, zero values disable the
+// corresponding limit.
+type Rotate struct {
+	// MaxSize in megabytes before the file is rotated
+	MaxSize int
+	// MaxAge of the current file before it is rotated
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files to keep
+	MaxBackups int
+	// Compress rotated files with gzip
+	Compress bool
+}
+
+// rotateWriter is an io.Writer appending to filename and rotating it by
+// size or age. Rotated files are renamed to name-<timestamp>.ext, or
+// name-<timestamp>-<n>.ext when that backup already exists.
+type rotateWriter struct {
+	filename string
+	rotate   Rotate
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openTime time.Time
+	closed   bool
+
+	// serialize compress and cleanup of backups
+	millMu sync.Mutex
+	millWG sync.WaitGroup
+}
+
+func newRotateWriter(filename string, r Rotate) (*rotateWriter, error) {
+	w := &rotateWriter{
+		filename: filename,
+		rotate:   r,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.shouldRotate(int64(len(p))) {
+		if err := w.rotateFile(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Reopen closes and reopens the file, used after an external rotator moved it
+func (w *rotateWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.close()
+	return w.open()
+}
+
+func (w *rotateWriter) Close() error {
+	w.mu.Lock()
+	err := w.close()
+	w.closed = true
+	w.mu.Unlock()
+
+	w.millWG.Wait()
+	return err
+}
+
+func (w *rotateWriter) shouldRotate(n int64) bool {
+	if w.rotate.MaxSize > 0 && w.size > 0 && w.size+n > int64(w.rotate.MaxSize)*megabyte {
+		return true
+	}
+	if w.rotate.MaxAge > 0 && time.Since(w.openTime) >= w.rotate.MaxAge {
+		return true
+	}
+	return false
+}
+
+func (w *rotateWriter) open() error {
+	f, err := openFile(w.filename)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.file = f
+	w.size = info.Size()
+	// a file left by a previous run ages from its last write, a restart
+	// must not postpone its rotation
+	w.openTime = time.Now()
+	if w.size > 0 && info.ModTime().Before(w.openTime) {
+		w.openTime = info.ModTime()
+	}
+	return nil
+}
+
+func (w *rotateWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *rotateWriter) rotateFile() error {
+	if err := w.close(); err != nil {
+		return err
+	}
+
+	backup := w.backupName(time.Now())
+	if err := os.Rename(w.filename, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	w.millWG.Add(1)
+	go w.mill()
+	return nil
+}
+
+// backupName returns the first name for a backup at t not taken by a
+// plain or compressed backup
+func (w *rotateWriter) backupName(t time.Time) string {
+	dir := filepath.Dir(w.filename)
+	ext := filepath.Ext(w.filename)
+	prefix := strings.TrimSuffix(filepath.Base(w.filename), ext) + "-" + t.Format(backupFormat)
+	for seq := 0; ; seq++ {
+		name := prefix
+		if seq > 0 {
+			name += "-" + strconv.Itoa(seq)
+		}
+		name = filepath.Join(dir, name+ext)
+		if !exists(name) && !exists(name+compressExt) {
+			return name
+		}
+	}
+}
+
+func exists(name string) bool {
+	_, err := os.Lstat(name)
+	return !os.IsNotExist(err)
+}
+
+// mill removes the backups over MaxBackups and compresses the rest
+func (w *rotateWriter) mill() {
+	defer w.millWG.Done()
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+
+	backups, err := w.backups()
+	if err != nil {
+		Errorf("log list backups fail => %+v", err)
+		return
+	}
+
+	if w.rotate.MaxBackups > 0 && len(backups) > w.rotate.MaxBackups {
+		for _, f := range backups[:len(backups)-w.rotate.MaxBackups] {
+			if err := os.Remove(f); err != nil {
+				Errorf("log remove %s fail => %+v", f, err)
+			}
+		}
+		backups = backups[len(backups)-w.rotate.MaxBackups:]
+	}
+
+	if !w.rotate.Compress {
+		return
+	}
+	for _, f := range backups {
+		if strings.HasSuffix(f, compressExt) {
+			continue
+		}
+		if err := compressFile(f); err != nil {
+			Errorf("log compress %s fail => %+v", f, err)
+		}
+	}
+}
+
+// backups returns the rotated files, oldest first
+func (w *rotateWriter) backups() ([]string, error) {
+	dir := filepath.Dir(w.filename)
+	ext := filepath.Ext(w.filename)
+	prefix := strings.TrimSuffix(filepath.Base(w.filename), ext) + "-"
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type backup struct {
+		name string
+		time time.Time
+		seq  int
+	}
+	var list []backup
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(name, compressExt), ext)[len(prefix):]
+		seq := 0
+		if i := strings.LastIndex(stamp, "-"); i >= 0 {
+			n, err := strconv.Atoi(stamp[i+1:])
+			if err != nil || n <= 0 {
+				continue
+			}
+			stamp, seq = stamp[:i], n
+		}
+		t, err := time.Parse(backupFormat, stamp)
+		if err != nil {
+			continue
+		}
+		list = append(list, backup{name: filepath.Join(dir, name), time: t, seq: seq})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].time.Equal(list[j].time) {
+			return list[i].time.Before(list[j].time)
+		}
+		return list[i].seq < list[j].seq
+	})
+
+	files := make([]string, 0, len(list))
+	for _, b := range list {
+		files = append(files, b.name)
+	}
+	return files, nil
+}
+
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+compressExt, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err == nil {
+		err = gz.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + compressExt)
+		return err
+	}
+	return os.Remove(name)
+}
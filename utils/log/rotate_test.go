@@ -0,0 +1,132 @@
+package log_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/utils/log"
+)
+
+func listDir(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRotate(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "log"+uuid.Must(uuid.NewV4()).String())
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "demo.log")
+
+	err := log.Setup(log.Options{
+		Env:      "production",
+		Level:    "info",
+		Format:   log.FormatLogfmt,
+		Sinks:    []string{log.SinkFile},
+		Filename: name,
+		Rotate: log.Rotate{
+			MaxSize:    1,
+			MaxBackups: 2,
+			Compress:   true,
+		},
+	})
+	assert.NoError(t, err)
+
+	msg := strings.Repeat("x", 600*1024)
+	for i := 0; i < 5; i++ {
+		log.Info(msg)
+		time.Sleep(2 * time.Millisecond)
+	}
+	// closes the file sink and waits for the backups to be compressed
+	log.Setup(log.Options{Env: "development", Level: "debug"})
+
+	files := listDir(t, dir)
+	assert.Len(t, files, 3)
+	assert.Equal(t, "demo.log", files[2])
+	for _, f := range files[:2] {
+		assert.True(t, strings.HasPrefix(f, "demo-"), f)
+		assert.True(t, strings.HasSuffix(f, ".log.gz"), f)
+	}
+}
+
+func TestRotate_Burst(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "log"+uuid.Must(uuid.NewV4()).String())
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "demo.log")
+
+	err := log.Setup(log.Options{
+		Env:      "production",
+		Level:    "info",
+		Format:   log.FormatLogfmt,
+		Sinks:    []string{log.SinkFile},
+		Filename: name,
+		Rotate:   log.Rotate{MaxAge: time.Nanosecond},
+	})
+	assert.NoError(t, err)
+
+	// every entry rotates the file, many of them within the same
+	// millisecond, and no backup may overwrite another
+	for i := 0; i < 20; i++ {
+		log.Info("hello")
+	}
+	log.Setup(log.Options{Env: "development", Level: "debug"})
+
+	files := listDir(t, dir)
+	assert.Len(t, files, 21)
+	lines := 0
+	for _, f := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dir, f))
+		assert.NoError(t, err)
+		lines += strings.Count(string(b), "\n")
+	}
+	assert.Equal(t, 20, lines)
+}
+
+func TestRotate_MaxAge(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "log"+uuid.Must(uuid.NewV4()).String())
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "demo.log")
+
+	// a file left by a previous run is as old as its last write
+	assert.NoError(t, os.MkdirAll(dir, 0744))
+	assert.NoError(t, ioutil.WriteFile(name, []byte("old\n"), 0644))
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(name, old, old))
+
+	err := log.Setup(log.Options{
+		Env:      "production",
+		Level:    "info",
+		Format:   log.FormatLogfmt,
+		Sinks:    []string{log.SinkFile},
+		Filename: name,
+		Rotate:   log.Rotate{MaxAge: time.Hour},
+	})
+	assert.NoError(t, err)
+	log.Info("new")
+	log.Info("newer")
+	log.Setup(log.Options{Env: "development", Level: "debug"})
+
+	files := listDir(t, dir)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "demo.log", files[1])
+	b, err := ioutil.ReadFile(filepath.Join(dir, files[0]))
+	assert.NoError(t, err)
+	assert.Equal(t, "old\n", string(b))
+	b, err = ioutil.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "msg=new")
+	assert.Contains(t, string(b), "msg=newer")
+}
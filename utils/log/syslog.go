@@ -0,0 +1,33 @@
+// +build !windows,!nacl,!plan9
+
+package log
+
+import (
+	"log/syslog"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	lsyslog "github.com/sirupsen/logrus/hooks/syslog"
+)
+
+const syslogTag = "demo"
+
+// newSyslogHook dials addr (network://host:port), an empty addr connects
+// to the local syslog socket
+func newSyslogHook(addr string) (logrus.Hook, error) {
+	var network, raddr string
+	if len(addr) > 0 {
+		network, raddr = "udp", addr
+		if i := strings.Index(addr, "://"); i >= 0 {
+			network, raddr = addr[:i], addr[i+3:]
+		}
+	}
+	return lsyslog.NewSyslogHook(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, syslogTag)
+}
+
+// closeHook releases the connection of a hook built by newSyslogHook
+func closeHook(hook logrus.Hook) {
+	if h, ok := hook.(*lsyslog.SyslogHook); ok && h.Writer != nil {
+		h.Writer.Close()
+	}
+}
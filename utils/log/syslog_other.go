@@ -0,0 +1,15 @@
+// +build windows nacl plan9
+
+package log
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newSyslogHook(addr string) (logrus.Hook, error) {
+	return nil, errors.New("log sink syslog not support on this platform")
+}
+
+func closeHook(hook logrus.Hook) {}
@@ -0,0 +1,60 @@
+package metrics_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/utils/metrics"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	reg := metrics.NewRegistry()
+	requests := reg.Counter("http_requests_total", "Number of requests.", "method", "route")
+	latency := reg.Histogram("http_latency_seconds", "Request latency.", []float64{1, 0.1}, "route")
+	reg.Func("devices", "Number of \"devices\".", metrics.TypeGauge, []string{"model"},
+		func(report func(float64, ...string)) error {
+			report(2, "Pro")
+			report(1, `a"b`)
+			return nil
+		})
+	reg.Func("broken", "Always fails.", metrics.TypeGauge, nil,
+		func(report func(float64, ...string)) error {
+			return errors.New("boom")
+		})
+
+	requests.Inc("GET", "/v1/device")
+	requests.Add(2, "GET", "/v1/device")
+	requests.Inc("POST", "/v1/device")
+	latency.Observe(0.05, "/v1/device")
+	latency.Observe(0.5, "/v1/device")
+
+	want := `# HELP http_requests_total Number of requests.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/v1/device"} 3
+http_requests_total{method="POST",route="/v1/device"} 1
+# HELP http_latency_seconds Request latency.
+# TYPE http_latency_seconds histogram
+http_latency_seconds_bucket{route="/v1/device",le="0.1"} 1
+http_latency_seconds_bucket{route="/v1/device",le="1"} 2
+http_latency_seconds_bucket{route="/v1/device",le="+Inf"} 2
+http_latency_seconds_sum{route="/v1/device"} 0.55
+http_latency_seconds_count{route="/v1/device"} 2
+# HELP devices Number of "devices".
+# TYPE devices gauge
+devices{model="Pro"} 2
+devices{model="a\"b"} 1
+`
+	buf := &bytes.Buffer{}
+	assert.NoError(t, reg.Write(buf))
+	assert.Equal(t, want, buf.String())
+	assert.Equal(t, float64(3), requests.Value("GET", "/v1/device"))
+}
+
+func TestRegistry_Duplicate(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.Counter("x_total", "x")
+	assert.Panics(t, func() { reg.Counter("x_total", "x") })
+}
@@ -0,0 +1,98 @@
+// Package schedule runs the background jobs of a process at a fixed interval
+// until it stops them.
+package schedule
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github/demo/utils/log"
+	"github/demo/utils/trace"
+)
+
+// Job is one background task
+type Job struct {
+	Name string
+	// Interval between two runs, the first run is one interval after Start
+	Interval time.Duration
+	// Run does the work of one run, its context is cancelled on Stop
+	Run func(ctx context.Context) error
+}
+
+// Scheduler runs its jobs, each in its own goroutine, a run of a job never
+// overlaps the previous one
+type Scheduler struct {
+	jobs []Job
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(jobs ...Job) *Scheduler {
+	return &Scheduler{
+		jobs: jobs,
+	}
+}
+
+// Start starts running the jobs, a job without interval is skipped
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	for _, j := range s.jobs {
+		if j.Interval <= 0 || j.Run == nil {
+			log.Warnf("job %s has no interval, skipped", j.Name)
+			continue
+		}
+		s.wg.Add(1)
+		go s.loop(ctx, j)
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, j Job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run(ctx, j)
+		}
+	}
+}
+
+// run runs j once, a failure is logged and the job runs again on the next
+// tick
+func run(ctx context.Context, j Job) {
+	ctx, span := trace.Start(ctx, "job "+j.Name)
+	defer span.Finish()
+
+	if err := j.Run(ctx); err != nil {
+		span.SetError(err)
+		log.WithContext(ctx).Errorf("job %s fail => %+v", j.Name, err)
+	}
+}
+
+// Stop cancels the running jobs and waits for them to return, or for ctx to
+// be done
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,81 @@
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/utils/schedule"
+)
+
+func TestScheduler(t *testing.T) {
+	var runs, fails int32
+	stopped := make(chan struct{})
+
+	s := schedule.New(
+		schedule.Job{
+			Name:     "count",
+			Interval: 10 * time.Millisecond,
+			Run: func(ctx context.Context) error {
+				atomic.AddInt32(&runs, 1)
+				return nil
+			},
+		},
+		schedule.Job{
+			Name:     "fail",
+			Interval: 10 * time.Millisecond,
+			Run: func(ctx context.Context) error {
+				atomic.AddInt32(&fails, 1)
+				return errors.New("boom")
+			},
+		},
+		schedule.Job{
+			Name:     "block",
+			Interval: 10 * time.Millisecond,
+			Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				select {
+				case <-stopped:
+				default:
+					close(stopped)
+				}
+				return ctx.Err()
+			},
+		},
+		schedule.Job{
+			Name: "no interval",
+			Run: func(ctx context.Context) error {
+				t.Error("job without interval ran")
+				return nil
+			},
+		},
+	)
+	s.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, s.Stop(ctx))
+
+	// a failing job runs again, a running one is cancelled
+	assert.True(t, atomic.LoadInt32(&runs) > 1)
+	assert.True(t, atomic.LoadInt32(&fails) > 1)
+	select {
+	case <-stopped:
+	default:
+		t.Error("running job not cancelled")
+	}
+
+	// nothing runs after Stop
+	n := atomic.LoadInt32(&runs)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadInt32(&runs))
+}
+
+func TestScheduler_StopNotStarted(t *testing.T) {
+	assert.NoError(t, schedule.New().Stop(context.Background()))
+}
@@ -0,0 +1,184 @@
+// Package startup runs the named phases bringing a process up, one after the
+// other, and releases what they acquired in reverse order.
+package startup
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github/demo/utils/log"
+)
+
+// Cleanup releases what a phase acquired
+type Cleanup func(ctx context.Context) error
+
+// Phase is one named step of the startup
+type Phase struct {
+	Name string
+	// Timeout of Run, zero waits for ever
+	Timeout time.Duration
+	// ExitCode of the process when the phase fails
+	ExitCode int
+	// Run does the work of the phase, the returned cleanup, if any, runs on
+	// Shutdown
+	Run func(ctx context.Context) (Cleanup, error)
+}
+
+// Error reports the phase that failed
+type Error struct {
+	Phase    string
+	ExitCode int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("startup phase %s failed: %v", e.Phase, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the exit code of the phase err failed in, 1 for any
+// other error and 0 for nil
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if e, ok := err.(*Error); ok {
+		return e.ExitCode
+	}
+	return 1
+}
+
+type cleanup struct {
+	phase string
+	fn    Cleanup
+}
+
+// Sequence runs its phases in order and stops at the first failure
+type Sequence struct {
+	phases []Phase
+
+	// running counts the Run funcs not returned yet, a timed out one keeps
+	// running in the background
+	running sync.WaitGroup
+
+	mu       sync.Mutex
+	cleanups []cleanup
+	shutdown bool
+}
+
+func New(phases ...Phase) *Sequence {
+	return &Sequence{
+		phases: phases,
+	}
+}
+
+// Run runs every phase in order, the first failure is returned as an *Error
+// and the remaining phases are skipped
+func (s *Sequence) Run(ctx context.Context) error {
+	for _, p := range s.phases {
+		start := time.Now()
+		if err := s.run(ctx, p); err != nil {
+			log.Errorf("startup phase %s failed after %v => %+v", p.Name, time.Since(start), err)
+			return &Error{Phase: p.Name, ExitCode: p.ExitCode, Err: err}
+		}
+		log.Infof("startup phase %s done in %v", p.Name, time.Since(start))
+	}
+	return nil
+}
+
+func (s *Sequence) run(ctx context.Context, p Phase) error {
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	// the cleanup is registered by the goroutine of Run itself, before the
+	// result is handed over, so a phase finishing after its timeout is
+	// still released by Shutdown
+	done := make(chan error, 1)
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		c, err := runPhase(ctx, p)
+		if c != nil {
+			s.addCleanup(p.Name, c)
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func runPhase(ctx context.Context, p Phase) (c Cleanup, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return p.Run(ctx)
+}
+
+// addCleanup registers fn for Shutdown, or runs it at once when Shutdown
+// already took the cleanups
+func (s *Sequence) addCleanup(phase string, fn Cleanup) {
+	s.mu.Lock()
+	if !s.shutdown {
+		s.cleanups = append(s.cleanups, cleanup{phase: phase, fn: fn})
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	log.Warnf("startup phase %s returned after the shutdown, releasing it", phase)
+	if err := fn(context.Background()); err != nil {
+		log.Errorf("shutdown phase %s failed => %+v", phase, err)
+	}
+}
+
+// Shutdown waits for the phases still running, for as long as ctx allows,
+// then runs the cleanups of the phases in reverse order. All of them run and
+// the first error is returned. A phase returning later is released as soon
+// as it does.
+func (s *Sequence) Shutdown(ctx context.Context) error {
+	waited := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-ctx.Done():
+		log.Warnf("startup phases still running at the shutdown => %+v", ctx.Err())
+	}
+
+	s.mu.Lock()
+	cleanups := s.cleanups
+	s.cleanups = nil
+	s.shutdown = true
+	s.mu.Unlock()
+
+	var first error
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		c := cleanups[i]
+		if err := c.fn(ctx); err != nil {
+			log.Errorf("shutdown phase %s failed => %+v", c.phase, err)
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		log.Infof("shutdown phase %s done", c.phase)
+	}
+	return first
+}
@@ -0,0 +1,165 @@
+package startup_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/utils/startup"
+)
+
+func TestSequence(t *testing.T) {
+	fail := errors.New("boom")
+
+	tt := []struct {
+		description string
+		failPhase   string
+		failWith    func(ctx context.Context) error
+		wantRun     []string
+		wantCleanup []string
+		wantCode    int
+		wantErr     error
+	}{
+		{
+			description: "all phases",
+			wantRun:     []string{"a", "b", "c"},
+			wantCleanup: []string{"c", "b", "a"},
+			wantCode:    0,
+		},
+		{
+			description: "fail fast",
+			failPhase:   "b",
+			failWith:    func(ctx context.Context) error { return fail },
+			wantRun:     []string{"a", "b"},
+			wantCleanup: []string{"a"},
+			wantCode:    12,
+			wantErr:     fail,
+		},
+		{
+			description: "timeout",
+			failPhase:   "c",
+			failWith: func(ctx context.Context) error {
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			},
+			wantRun:     []string{"a", "b", "c"},
+			wantCleanup: []string{"c", "b", "a"},
+			wantCode:    13,
+			wantErr:     context.DeadlineExceeded,
+		},
+		{
+			description: "panic",
+			failPhase:   "a",
+			failWith:    func(ctx context.Context) error { panic("boom") },
+			wantRun:     []string{"a"},
+			wantCleanup: nil,
+			wantCode:    11,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			var run, cleaned []string
+			phase := func(name string, code int) startup.Phase {
+				return startup.Phase{
+					Name:     name,
+					Timeout:  50 * time.Millisecond,
+					ExitCode: code,
+					Run: func(ctx context.Context) (startup.Cleanup, error) {
+						run = append(run, name)
+						if name == tc.failPhase {
+							if err := tc.failWith(ctx); err != nil {
+								return nil, err
+							}
+						}
+						return func(ctx context.Context) error {
+							cleaned = append(cleaned, name)
+							return nil
+						}, nil
+					},
+				}
+			}
+
+			s := startup.New(phase("a", 11), phase("b", 12), phase("c", 13))
+			err := s.Run(context.Background())
+			assert.Equal(t, tc.wantCode, startup.ExitCode(err))
+			if tc.wantCode > 0 {
+				e, ok := err.(*startup.Error)
+				if assert.True(t, ok) {
+					assert.Equal(t, tc.failPhase, e.Phase)
+				}
+			}
+			if tc.wantErr != nil {
+				assert.True(t, errors.Is(err, tc.wantErr))
+			}
+
+			// a phase past its timeout is still running, Shutdown waits
+			// for it before releasing
+			assert.NoError(t, s.Shutdown(context.Background()))
+			assert.Equal(t, tc.wantRun, run)
+			assert.Equal(t, tc.wantCleanup, cleaned)
+		})
+	}
+}
+
+func TestSequence_LateCleanup(t *testing.T) {
+	release := make(chan struct{})
+	released := make(chan struct{})
+	s := startup.New(startup.Phase{
+		Name:     "slow",
+		Timeout:  10 * time.Millisecond,
+		ExitCode: 2,
+		Run: func(ctx context.Context) (startup.Cleanup, error) {
+			<-release
+			return func(ctx context.Context) error {
+				close(released)
+				return nil
+			}, nil
+		},
+	})
+
+	assert.Equal(t, 2, startup.ExitCode(s.Run(context.Background())))
+
+	// the phase outlives the wait of Shutdown, its cleanup runs as soon as
+	// it returns
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, s.Shutdown(ctx))
+	select {
+	case <-released:
+		t.Fatal("cleanup ran before the phase returned")
+	default:
+	}
+
+	close(release)
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatal("cleanup of the timed out phase never ran")
+	}
+}
+
+func TestSequence_ShutdownError(t *testing.T) {
+	var cleaned []string
+	cleanup := func(name string, err error) startup.Phase {
+		return startup.Phase{
+			Name: name,
+			Run: func(ctx context.Context) (startup.Cleanup, error) {
+				return func(ctx context.Context) error {
+					cleaned = append(cleaned, name)
+					return err
+				}, nil
+			},
+		}
+	}
+
+	first := errors.New("first")
+	s := startup.New(cleanup("a", errors.New("last")), cleanup("b", first), cleanup("c", nil))
+	assert.NoError(t, s.Run(context.Background()))
+	assert.Equal(t, first, s.Shutdown(context.Background()))
+	assert.Equal(t, []string{"c", "b", "a"}, cleaned)
+}
@@ -0,0 +1,129 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporters
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+func newExporter(o Options) (sdktrace.SpanExporter, error) {
+	switch o.Exporter {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return NewWriterExporter(os.Stdout), nil
+	case ExporterFile:
+		if len(o.Filename) <= 0 {
+			return nil, fmt.Errorf("trace exporter %q needs a filename", ExporterFile)
+		}
+		if err := os.MkdirAll(filepath.Dir(o.Filename), 0744); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(o.Filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return NewWriterExporter(f), nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if len(o.Endpoint) > 0 {
+			opts = append(opts, otlptracehttp.WithEndpointURL(o.Endpoint))
+		}
+		// the client connects on the first export, a collector down at
+		// startup does not fail Setup
+		return otlptracehttp.New(context.Background(), opts...)
+	default:
+		return nil, fmt.Errorf("trace exporter not support: %q", o.Exporter)
+	}
+}
+
+// spanRecord is the exported JSON line of a span, following the OpenTelemetry
+// field names
+type spanRecord struct {
+	Service      string                 `json:"service.name,omitempty"`
+	Name         string                 `json:"name"`
+	Kind         string                 `json:"kind"`
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	StartTime    time.Time              `json:"start_time"`
+	EndTime      time.Time              `json:"end_time"`
+	DurationMs   float64                `json:"duration_ms"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Status       string                 `json:"status"`
+	StatusMsg    string                 `json:"status_message,omitempty"`
+}
+
+// writerExporter writes one JSON line per span
+type writerExporter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewWriterExporter returns an exporter writing JSON lines to w
+func NewWriterExporter(w io.Writer) sdktrace.SpanExporter {
+	return &writerExporter{
+		w:   w,
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (e *writerExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, s := range spans {
+		r := &spanRecord{
+			Name:       s.Name(),
+			Kind:       s.SpanKind().String(),
+			TraceID:    s.SpanContext().TraceID().String(),
+			SpanID:     s.SpanContext().SpanID().String(),
+			StartTime:  s.StartTime(),
+			EndTime:    s.EndTime(),
+			DurationMs: float64(s.EndTime().Sub(s.StartTime())) / float64(time.Millisecond),
+			Status:     strings.ToUpper(s.Status().Code.String()),
+			StatusMsg:  s.Status().Description,
+		}
+		if v, ok := s.Resource().Set().Value("service.name"); ok {
+			r.Service = v.AsString()
+		}
+		if s.Parent().IsValid() {
+			r.ParentSpanID = s.Parent().SpanID().String()
+		}
+		if attrs := s.Attributes(); len(attrs) > 0 {
+			r.Attributes = make(map[string]interface{}, len(attrs))
+			for _, kv := range attrs {
+				r.Attributes[string(kv.Key)] = kv.Value.AsInterface()
+			}
+		}
+		if err := e.enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *writerExporter) Shutdown(ctx context.Context) error {
+	if c, ok := e.w.(io.Closer); ok && e.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
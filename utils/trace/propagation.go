@@ -0,0 +1,25 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// HeaderTraceparent is the W3C trace context header
+const HeaderTraceparent = "traceparent"
+
+// w3c carries the trace context in the traceparent and tracestate headers
+var w3c = propagation.TraceContext{}
+
+// Extract returns a copy of ctx whose next span is a child of the remote
+// parent in h, ctx is returned untouched when h has none or an invalid one
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return w3c.Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// Inject writes the trace context of the current span of ctx to h
+func Inject(ctx context.Context, h http.Header) {
+	w3c.Inject(ctx, propagation.HeaderCarrier(h))
+}
@@ -0,0 +1,198 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation names the tracer of the spans started by this package
+const instrumentation = "github/demo"
+
+// Span kinds
+const (
+	KindInternal = "internal"
+	KindServer   = "server"
+	KindClient   = "client"
+)
+
+// Span status codes
+const (
+	StatusUnset = "UNSET"
+	StatusOK    = "OK"
+	StatusError = "ERROR"
+)
+
+// Span is one timed operation of a trace, a handle on an OpenTelemetry span
+type Span struct {
+	span oteltrace.Span
+}
+
+// SpanContext returns the W3C identity of the span
+func (s *Span) SpanContext() oteltrace.SpanContext {
+	if s == nil {
+		return oteltrace.SpanContext{}
+	}
+	return s.span.SpanContext()
+}
+
+// SetAttribute records key=value on the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(newAttribute(key, value))
+}
+
+// SetError marks the span as failed with err, a nil err is ignored
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// SetStatus sets the status code and message of the span
+func (s *Span) SetStatus(code, msg string) {
+	if s == nil {
+		return
+	}
+	switch code {
+	case StatusError:
+		s.span.SetStatus(codes.Error, msg)
+	case StatusOK:
+		s.span.SetStatus(codes.Ok, msg)
+	default:
+		s.span.SetStatus(codes.Unset, msg)
+	}
+}
+
+// Finish ends the span and hands it to the exporter when sampled
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// FromContext returns the current span of ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span := oteltrace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() {
+		return nil
+	}
+	return &Span{span: span}
+}
+
+// Start begins a span as a child of the current span of ctx, or of the
+// remote parent, or as a new root
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal)
+}
+
+// StartKind begins a span of kind
+func StartKind(ctx context.Context, name, kind string) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := otel.Tracer(instrumentation).Start(ctx, name, oteltrace.WithSpanKind(spanKind(kind)))
+	return ctx, &Span{span: span}
+}
+
+func spanKind(kind string) oteltrace.SpanKind {
+	switch kind {
+	case KindServer:
+		return oteltrace.SpanKindServer
+	case KindClient:
+		return oteltrace.SpanKindClient
+	default:
+		return oteltrace.SpanKindInternal
+	}
+}
+
+func newAttribute(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case []string:
+		return attribute.StringSlice(key, v)
+	case fmt.Stringer:
+		return attribute.String(key, v.String())
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
+
+// Options configures the tracer
+type Options struct {
+	// ServiceName recorded on every exported span
+	ServiceName string
+	// Exporter is none, stdout, file or otlp
+	Exporter string
+	// Filename of the file exporter
+	Filename string
+	// Endpoint of the otlp exporter as an http(s) URL, empty for the
+	// OTEL_EXPORTER_OTLP_* environment or localhost:4318
+	Endpoint string
+	// SampleRatio of the new root traces that are exported, in [0, 1]
+	SampleRatio float64
+}
+
+var (
+	mu       sync.Mutex
+	provider *sdktrace.TracerProvider
+)
+
+// Setup installs the global OpenTelemetry tracer provider and the W3C trace
+// context propagator. The spans of the previous provider are flushed and its
+// exporter is closed.
+func Setup(o Options) error {
+	exporter, err := newExporter(o)
+	if err != nil {
+		return err
+	}
+
+	// without an exporter the spans still carry ids, none is sampled
+	root := sdktrace.NeverSample()
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", o.ServiceName))),
+	}
+	if exporter != nil {
+		root = sdktrace.TraceIDRatioBased(o.SampleRatio)
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	opts = append(opts, sdktrace.WithSampler(sdktrace.ParentBased(root)))
+	tp := sdktrace.NewTracerProvider(opts...)
+
+	mu.Lock()
+	prev := provider
+	provider = tp
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	mu.Unlock()
+
+	if prev != nil {
+		return prev.Shutdown(context.Background())
+	}
+	return nil
+}
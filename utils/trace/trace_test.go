@@ -0,0 +1,129 @@
+package trace_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github/demo/utils/trace"
+)
+
+func TestExtract(t *testing.T) {
+	tt := []struct {
+		description string
+		value       string
+		sampled     bool
+		err         bool
+	}{
+		{
+			description: "sampled",
+			value:       "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			sampled:     true,
+		},
+		{
+			description: "not sampled",
+			value:       "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			sampled:     false,
+		},
+		{
+			description: "upper case",
+			value:       "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+			err:         true,
+		},
+		{
+			description: "zero trace id",
+			value:       "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			err:         true,
+		},
+		{
+			description: "forbidden version",
+			value:       "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			err:         true,
+		},
+		{
+			description: "too short",
+			value:       "00-4bf92f3577b34da6a3ce929d0e0e4736",
+			err:         true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.description, func(t *testing.T) {
+			h := http.Header{}
+			h.Set(trace.HeaderTraceparent, tc.value)
+			ctx := trace.Extract(context.Background(), h)
+			span := trace.FromContext(ctx)
+			if tc.err {
+				assert.Nil(t, span)
+				return
+			}
+			assert.NotNil(t, span)
+			assert.Equal(t, tc.sampled, span.SpanContext().IsSampled())
+
+			out := http.Header{}
+			trace.Inject(ctx, out)
+			assert.Equal(t, tc.value, out.Get(trace.HeaderTraceparent))
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	name := filepath.Join(os.TempDir(), "trace"+uuid.Must(uuid.NewV4()).String()+".json")
+	defer os.Remove(name)
+	assert.NoError(t, trace.Setup(trace.Options{
+		ServiceName: "demo",
+		Exporter:    trace.ExporterFile,
+		Filename:    name,
+		SampleRatio: 1,
+	}))
+
+	h := http.Header{}
+	h.Set(trace.HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := trace.Extract(context.Background(), h)
+	ctx, root := trace.Start(ctx, "root")
+	_, child := trace.Start(ctx, "child")
+	child.SetAttribute("k", "v")
+	child.SetError(errors.New("boom"))
+	child.Finish()
+	root.Finish()
+	assert.NoError(t, trace.Setup(trace.Options{}))
+
+	f, err := os.Open(name)
+	assert.NoError(t, err)
+	defer f.Close()
+	var spans []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m := make(map[string]interface{})
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &m))
+		spans = append(spans, m)
+	}
+
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0]["name"])
+	assert.Equal(t, "root", spans[1]["name"])
+	for _, s := range spans {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s["trace_id"])
+		assert.Equal(t, "demo", s["service.name"])
+	}
+	assert.Equal(t, "00f067aa0ba902b7", spans[1]["parent_span_id"])
+	assert.Equal(t, spans[1]["span_id"], spans[0]["parent_span_id"])
+	assert.Equal(t, "ERROR", spans[0]["status"])
+	assert.Equal(t, "boom", spans[0]["status_message"])
+	assert.Equal(t, map[string]interface{}{"k": "v"}, spans[0]["attributes"])
+}
+
+func TestStart_NotSampled(t *testing.T) {
+	assert.NoError(t, trace.Setup(trace.Options{}))
+	_, span := trace.Start(context.Background(), "root")
+	assert.True(t, span.SpanContext().IsValid())
+	assert.False(t, span.SpanContext().IsSampled())
+}